@@ -0,0 +1,45 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"net"
+	"strconv"
+)
+
+// AddressTranslator is the interface implemented by the translators of the
+// addresses of the hosts discovered from system.peers and reported by the
+// events of the cluster, they map the addresses the hosts know themselves by
+// to the addresses the driver can reach, for instance behind a NAT.
+type AddressTranslator interface {
+	Translate(addr net.IP, port int) (net.IP, int)
+}
+
+// AddressTranslatorFunc is an AddressTranslator calling a function.
+type AddressTranslatorFunc func(addr net.IP, port int) (net.IP, int)
+
+func (f AddressTranslatorFunc) Translate(addr net.IP, port int) (net.IP, int) {
+	return f(addr, port)
+}
+
+// translateAddress translates the address of a host with the
+// AddressTranslator of the config. The port is kept in the returned address
+// when the translator changes it.
+func (cfg *ClusterConfig) translateAddress(addr string) string {
+	if cfg.AddressTranslator == nil {
+		return addr
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+
+	ip, port := cfg.AddressTranslator.Translate(ip, cfg.Port)
+	if port != cfg.Port {
+		return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	}
+	return ip.String()
+}
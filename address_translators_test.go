@@ -0,0 +1,41 @@
+// +build all unit
+
+package gocql
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTranslateAddress(t *testing.T) {
+	cfg := NewCluster()
+	if addr := cfg.translateAddress("10.0.0.1"); addr != "10.0.0.1" {
+		t.Errorf("expected the address to be kept without translator, got %q", addr)
+	}
+
+	cfg.AddressTranslator = AddressTranslatorFunc(func(addr net.IP, port int) (net.IP, int) {
+		switch addr.String() {
+		case "10.0.0.1":
+			return net.ParseIP("192.168.0.1"), port
+		case "10.0.0.2":
+			return net.ParseIP("192.168.0.1"), 19042
+		}
+		return addr, port
+	})
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"10.0.0.1", "192.168.0.1"},
+		{"10.0.0.2", "192.168.0.1:19042"},
+		{"10.0.0.3", "10.0.0.3"},
+		{"not an ip", "not an ip"},
+	}
+
+	for _, test := range tests {
+		if addr := cfg.translateAddress(test.addr); addr != test.expected {
+			t.Errorf("translateAddress(%q): expected %q got %q", test.addr, test.expected, addr)
+		}
+	}
+}
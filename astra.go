@@ -0,0 +1,206 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// astraBundleConfig is the config.json file of a secure connect bundle.
+type astraBundleConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Keyspace string `json:"keyspace"`
+}
+
+// astraMetadata is the answer of the metadata service of an Astra database.
+type astraMetadata struct {
+	ContactInfo struct {
+		Type            string   `json:"type"`
+		LocalDC         string   `json:"local_dc"`
+		ContactPoints   []string `json:"contact_points"`
+		SniProxyAddress string   `json:"sni_proxy_address"`
+	} `json:"contact_info"`
+}
+
+// NewClusterFromBundle returns the config of a cluster connecting to the
+// DataStax Astra database of the secure connect bundle at path. The bundle is
+// a zip file holding the certificates of the database and the address of its
+// metadata service, which is queried for the contact points. The connections
+// go through the SNI proxy of the database with mutual TLS, which requires
+// ClusterConfig.Dialer and SslOpts to be left as returned.
+func NewClusterFromBundle(path string) (*ClusterConfig, error) {
+	bundle, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("gocql: unable to open the secure connect bundle: %w", err)
+	}
+	defer bundle.Close()
+
+	files := make(map[string][]byte)
+	for _, f := range bundle.File {
+		switch f.Name {
+		case "config.json", "ca.crt", "cert", "key":
+		default:
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name], err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range []string{"config.json", "ca.crt", "cert", "key"} {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("gocql: secure connect bundle has no %s file", name)
+		}
+	}
+
+	var config astraBundleConfig
+	if err := json.Unmarshal(files["config.json"], &config); err != nil {
+		return nil, fmt.Errorf("gocql: invalid config.json in the secure connect bundle: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(files["ca.crt"]) {
+		return nil, errors.New("gocql: invalid ca.crt in the secure connect bundle")
+	}
+	cert, err := tls.X509KeyPair(files["cert"], files["key"])
+	if err != nil {
+		return nil, fmt.Errorf("gocql: invalid certificate in the secure connect bundle: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	metadata, err := fetchAstraMetadata(config, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	info := metadata.ContactInfo
+	if info.SniProxyAddress == "" || len(info.ContactPoints) == 0 {
+		return nil, errors.New("gocql: no contact points in the Astra metadata")
+	}
+	proxyHost, proxyPortStr, err := net.SplitHostPort(info.SniProxyAddress)
+	if err != nil {
+		return nil, err
+	}
+	proxyPort, err := strconv.Atoi(proxyPortStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := NewCluster(info.ContactPoints...)
+	cluster.Port = proxyPort
+	cluster.Keyspace = config.Keyspace
+	cluster.ProtoVersion = protoVersion4
+	cluster.Timeout = 10 * time.Second
+	cluster.Dialer = &sniDialer{
+		proxyAddr: info.SniProxyAddress,
+		proxyHost: proxyHost,
+		tlsConfig: tlsConfig,
+	}
+
+	return cluster, nil
+}
+
+// fetchAstraMetadata queries the metadata service of the database.
+func fetchAstraMetadata(config astraBundleConfig, tlsConfig *tls.Config) (*astraMetadata, error) {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	url := "https://" + net.JoinHostPort(config.Host, strconv.Itoa(config.Port)) + "/metadata"
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("gocql: unable to query the Astra metadata service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gocql: unable to query the Astra metadata service: %s", resp.Status)
+	}
+
+	var metadata astraMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("gocql: invalid Astra metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// sniDialer opens the connections to the SNI proxy of an Astra database, the
+// server name of the TLS handshake is the host ID of the host the proxy
+// forwards the connection to. The certificate of the proxy is verified
+// against the name of the proxy.
+type sniDialer struct {
+	proxyAddr string
+	proxyHost string
+	tlsConfig *tls.Config
+	dialer    net.Dialer
+}
+
+func (d *sniDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	hostID, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		hostID = addr
+	}
+
+	conn, err := d.dialer.DialContext(ctx, network, d.proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := d.tlsConfig.Clone()
+	config.ServerName = hostID
+	// the certificate is issued to the proxy, not to the host IDs
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("gocql: SNI proxy sent no certificate")
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       d.proxyHost,
+			Roots:         d.tlsConfig.RootCAs,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
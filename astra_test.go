@@ -0,0 +1,242 @@
+// +build all unit
+
+package gocql
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its PEM encoding.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA
+// when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestBundle(t *testing.T, path string, files map[string][]byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, data := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewClusterFromBundle(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "127.0.0.1", ca)
+	client := newTestCert(t, "client", ca)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	metadata := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"version":1,"region":"us-east1","contact_info":{"type":"sni_proxy","local_dc":"dc1",` +
+			`"contact_points":["host-id-1","host-id-2"],"sni_proxy_address":"proxy.example.com:29042"}}`))
+	}))
+	metadata.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	metadata.StartTLS()
+	defer metadata.Close()
+
+	host, portStr, err := net.SplitHostPort(metadata.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	config, _ := json.Marshal(map[string]interface{}{"host": host, "port": port, "keyspace": "ks"})
+
+	dir, err := ioutil.TempDir("", "gocql-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secure-connect.zip")
+
+	writeTestBundle(t, path, map[string][]byte{
+		"config.json": config,
+		"ca.crt":      ca.certPEM,
+		"cert":        client.certPEM,
+		"key":         client.keyPEM,
+	})
+
+	cluster, err := NewClusterFromBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"host-id-1", "host-id-2"}; !reflect.DeepEqual(cluster.Hosts, expected) {
+		t.Errorf("expected the hosts %v got %v", expected, cluster.Hosts)
+	}
+	if cluster.Port != 29042 || cluster.Keyspace != "ks" {
+		t.Errorf("expected port 29042 and keyspace ks got %d and %q", cluster.Port, cluster.Keyspace)
+	}
+
+	dialer, ok := cluster.Dialer.(*sniDialer)
+	if !ok {
+		t.Fatalf("expected an SNI dialer got %T", cluster.Dialer)
+	}
+	if dialer.proxyAddr != "proxy.example.com:29042" || dialer.proxyHost != "proxy.example.com" {
+		t.Errorf("unexpected proxy %q", dialer.proxyAddr)
+	}
+
+	writeTestBundle(t, path, map[string][]byte{"config.json": config})
+	if _, err := NewClusterFromBundle(path); err == nil {
+		t.Error("expected an error for a bundle without certificates")
+	}
+}
+
+func TestSNIDialer(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	proxyCert := newTestCert(t, "proxy.example.com", ca)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	serverNames := make(chan string, 2)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{proxyCert.tlsCertificate(t)},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	dialer := &sniDialer{
+		proxyAddr: l.Addr().String(),
+		proxyHost: "proxy.example.com",
+		tlsConfig: &tls.Config{RootCAs: roots},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", "host-id-1:29042")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if name := <-serverNames; name != "host-id-1" {
+		t.Errorf("expected the server name host-id-1 got %q", name)
+	}
+
+	// the certificate must be issued to the proxy
+	dialer.proxyHost = "other.example.com"
+	if _, err := dialer.DialContext(ctx, "tcp", "host-id-1:29042"); err == nil {
+		t.Error("expected the certificate of the proxy to be rejected")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ChunkOptions configures Session.ExecuteChunked.
+type ChunkOptions struct {
+	// MaxStatements is the maximum number of statements of a batch.
+	// (default: 100)
+	MaxStatements int
+
+	// MaxSize is the maximum estimated size in bytes of the values of a
+	// batch, it is best kept under BatchSizeWarnThreshold. A statement
+	// larger than MaxSize is executed in a batch of its own. (default: 0,
+	// unbounded)
+	MaxSize int
+
+	// Concurrency is the number of batches executed concurrently.
+	// (default: 1)
+	Concurrency int
+}
+
+// ChunkFailure is a batch of Session.ExecuteChunked which failed.
+type ChunkFailure struct {
+	// Entries are the indexes of the statements of the batch.
+	Entries []int
+	Err     error
+}
+
+// ChunkError is the error returned by Session.ExecuteChunked when some of
+// its batches failed, the statements of the other batches were applied.
+type ChunkError struct {
+	Failures []ChunkFailure
+	// Batches is the number of batches executed.
+	Batches int
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("gocql: %d of %d batches failed, first error: %v", len(e.Failures), e.Batches, e.Failures[0].Err)
+}
+
+// Unwrap returns the error of the first failed batch.
+func (e *ChunkError) Unwrap() error {
+	return e.Failures[0].Err
+}
+
+// ExecuteChunked executes the statements of entries as unlogged batches,
+// each batch grouping statements of the same partition key, bounded in
+// number of statements and size by opts. The batches have the defaults of
+// the session, they are executed concurrently, in the order of entries when
+// opts.Concurrency is 1.
+//
+// The partition keys are computed as for the token aware host selection,
+// which prepares the statements. The statements whose partition key is not
+// known are grouped together.
+//
+// ExecuteChunked executes all the batches even when some of them fail, it
+// returns a *ChunkError listing the failed ones. It stops executing batches
+// when ctx is done.
+func (s *Session) ExecuteChunked(ctx context.Context, entries []BatchEntry, opts ChunkOptions) error {
+	if opts.MaxStatements <= 0 {
+		opts.MaxStatements = 100
+	}
+	if opts.MaxStatements > BatchSizeMaximum {
+		opts.MaxStatements = BatchSizeMaximum
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	chunks, err := s.chunkEntries(ctx, entries, opts)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu       sync.Mutex
+		failures []ChunkFailure
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+
+	executed := 0
+	for _, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		executed++
+		wg.Add(1)
+		go func(chunk []int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			batch := s.NewBatch(UnloggedBatch).WithContext(ctx)
+			for _, i := range chunk {
+				batch.Entries = append(batch.Entries, entries[i])
+			}
+
+			if err := s.ExecuteBatch(batch); err != nil {
+				mu.Lock()
+				failures = append(failures, ChunkFailure{Entries: chunk, Err: err})
+				mu.Unlock()
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil && executed < len(chunks) {
+		failures = append(failures, ChunkFailure{Entries: remainingEntries(chunks[executed:]), Err: err})
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &ChunkError{Failures: failures, Batches: executed}
+}
+
+// chunkEntries returns the indexes of the statements of each batch.
+func (s *Session) chunkEntries(ctx context.Context, entries []BatchEntry, opts ChunkOptions) ([][]int, error) {
+	type group struct {
+		chunks [][]int
+		size   int
+	}
+
+	var (
+		groups = make(map[string]*group)
+		order  []*group
+	)
+	for i, entry := range entries {
+		key, err := s.Query(entry.Stmt, entry.Args...).WithContext(ctx).GetRoutingKey()
+		if err != nil {
+			return nil, fmt.Errorf("gocql: unable to get the partition key of statement %d: %w", i, err)
+		}
+
+		g := groups[string(key)]
+		if g == nil {
+			g = &group{}
+			groups[string(key)] = g
+			order = append(order, g)
+		}
+
+		size := entrySize(entry)
+		last := len(g.chunks) - 1
+		if last < 0 || len(g.chunks[last]) >= opts.MaxStatements || opts.MaxSize > 0 && g.size+size > opts.MaxSize {
+			g.chunks = append(g.chunks, nil)
+			g.size = 0
+			last++
+		}
+		g.chunks[last] = append(g.chunks[last], i)
+		g.size += size
+	}
+
+	var chunks [][]int
+	for _, g := range order {
+		chunks = append(chunks, g.chunks...)
+	}
+	return chunks, nil
+}
+
+func remainingEntries(chunks [][]int) []int {
+	var entries []int
+	for _, chunk := range chunks {
+		entries = append(entries, chunk...)
+	}
+	return entries
+}
+
+// entrySize returns the estimated size of the values of entry, or of its
+// statement when it has no values.
+func entrySize(entry BatchEntry) int {
+	if len(entry.Args) == 0 {
+		return len(entry.Stmt)
+	}
+
+	size := 0
+	for _, arg := range entry.Args {
+		size += valueSize(reflect.ValueOf(arg))
+	}
+	return size
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(UUID{})
+)
+
+// valueSize returns the estimated size of the marshalled value v.
+func valueSize(v reflect.Value) int {
+	if !v.IsValid() {
+		return 0
+	}
+
+	switch v.Type() {
+	case timeType:
+		return 8
+	case uuidType:
+		return 16
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return valueSize(v.Elem())
+	case reflect.String:
+		return v.Len()
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len()
+		}
+		size := 4
+		for i := 0; i < v.Len(); i++ {
+			size += 4 + valueSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		size := 4
+		iter := v.MapRange()
+		for iter.Next() {
+			size += 8 + valueSize(iter.Key()) + valueSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				size += 4 + valueSize(v.Field(i))
+			}
+		}
+		return size
+	default:
+		return 8
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// The buffers used to read and write the frames are pooled by size class,
+// the powers of two from 1KiB to 16MiB, so that the requests reuse them
+// instead of allocating buffers for every frame. Larger frames are rare
+// enough not to be pooled.
+const (
+	minBufferClassShift = 10
+	maxBufferClassShift = 24
+)
+
+var bufferPools [maxBufferClassShift - minBufferClassShift + 1]sync.Pool
+
+// bufferClass returns the smallest size class holding size bytes, or -1 when
+// size is too large to be pooled.
+func bufferClass(size int) int {
+	if size <= 1<<minBufferClassShift {
+		return 0
+	}
+
+	class := bits.Len(uint(size-1)) - minBufferClassShift
+	if class >= len(bufferPools) {
+		return -1
+	}
+	return class
+}
+
+// getBuffer returns a buffer of length size, from the pool of its size class
+// when there is one.
+func getBuffer(size int) []byte {
+	class := bufferClass(size)
+	if class < 0 {
+		return make([]byte, size)
+	}
+
+	if buf, ok := bufferPools[class].Get().(*[]byte); ok {
+		return (*buf)[:size]
+	}
+	return make([]byte, size, 1<<(minBufferClassShift+class))
+}
+
+// putBuffer returns buf to the pool of its size class, it must not be used
+// afterwards. Only the buffers with the capacity of a size class, that is
+// those returned by getBuffer, are pooled.
+func putBuffer(buf []byte) {
+	class := bufferClass(cap(buf))
+	if class < 0 || cap(buf) != 1<<(minBufferClassShift+class) {
+		return
+	}
+
+	buf = buf[:0]
+	bufferPools[class].Put(&buf)
+}
@@ -0,0 +1,39 @@
+package gocql
+
+import "testing"
+
+func TestBufferClass(t *testing.T) {
+	tests := []struct {
+		size  int
+		class int
+	}{
+		{0, 0},
+		{1, 0},
+		{1024, 0},
+		{1025, 1},
+		{2048, 1},
+		{1 << 24, maxBufferClassShift - minBufferClassShift},
+		{1<<24 + 1, -1},
+	}
+
+	for _, test := range tests {
+		if class := bufferClass(test.size); class != test.class {
+			t.Errorf("size %d: expected class %d got %d", test.size, test.class, class)
+		}
+	}
+}
+
+func TestGetBuffer(t *testing.T) {
+	buf := getBuffer(1500)
+	if len(buf) != 1500 || cap(buf) != 2048 {
+		t.Fatalf("expected a buffer of length 1500 and capacity 2048, got %d and %d", len(buf), cap(buf))
+	}
+	putBuffer(buf)
+
+	// the buffers which are not from the pools are dropped
+	putBuffer(make([]byte, 1500))
+
+	if buf := getBuffer(1 << 25); len(buf) != 1<<25 {
+		t.Fatalf("expected a buffer of length %d got %d", 1<<25, len(buf))
+	}
+}
@@ -4,6 +4,7 @@ package gocql
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -18,6 +19,7 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/gocql/gocql/lz4"
 	"gopkg.in/inf.v0"
 )
 
@@ -77,6 +79,8 @@ func createCluster() *ClusterConfig {
 	switch *flagCompressTest {
 	case "snappy":
 		cluster.Compressor = &SnappyCompressor{}
+	case "lz4":
+		cluster.Compressor = lz4.LZ4Compressor{}
 	case "":
 	default:
 		panic("invalid compressor: " + *flagCompressTest)
@@ -163,19 +167,24 @@ func TestRingDiscovery(t *testing.T) {
 	if err != nil {
 		t.Fatalf("got error connecting to the cluster %v", err)
 	}
+	defer session.Close()
 
-	if *clusterSize > 1 {
-		// wait for autodiscovery to update the pool with the list of known hosts
-		time.Sleep(*flagAutoWait)
-	}
-
+	// the hosts are discovered when the session is created
 	size := len(session.Pool.(*SimplePool).connPool)
 
 	if *clusterSize != size {
 		t.Logf("WARN: Expected a cluster size of %d, but actual size was %d", *clusterSize, size)
 	}
 
-	session.Close()
+	hosts, _, err := session.hostSource.GetHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hosts {
+		if host.Peer == "" || host.BroadcastAddress == "" || host.DataCenter == "" || host.Version == "" {
+			t.Errorf("incomplete host info: %+v", host)
+		}
+	}
 }
 
 func TestEmptyHosts(t *testing.T) {
@@ -244,6 +253,36 @@ func TestTracing(t *testing.T) {
 	}
 }
 
+func TestFetchTrace(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	var traceId []byte
+	tracer := tracerFunc(func(id []byte) { traceId = id })
+	if err := session.Query(`SELECT keyspace_name FROM system.schema_keyspaces`).Trace(tracer).Exec(); err != nil {
+		t.Fatal("select:", err)
+	} else if len(traceId) == 0 {
+		t.Fatal("select: no trace id")
+	}
+
+	trace, err := session.FetchTrace(traceId, 5*time.Second)
+	if err != nil {
+		t.Fatal("fetch trace:", err)
+	}
+	if trace.Coordinator == "" || trace.Duration <= 0 {
+		t.Errorf("expected a complete trace got %+v", trace)
+	}
+	if len(trace.Events) == 0 {
+		t.Error("expected trace events")
+	}
+}
+
+type tracerFunc func(traceId []byte)
+
+func (f tracerFunc) Trace(traceId []byte) {
+	f(traceId)
+}
+
 func TestPaging(t *testing.T) {
 	if *flagProto == 1 {
 		t.Skip("Paging not supported. Please use Cassandra >= 2.0")
@@ -1128,7 +1167,7 @@ func TestReprepareBatch(t *testing.T) {
 	stmt, conn := injectInvalidPreparedStatement(t, session, "test_reprepare_statement_batch")
 	batch := session.NewBatch(UnloggedBatch)
 	batch.Query(stmt, "bar")
-	if err := conn.executeBatch(batch); err != nil {
+	if err := conn.executeBatch(batch).Close(); err != nil {
 		t.Fatalf("Failed to execute query for reprepare statement: %v", err)
 	}
 
@@ -1139,7 +1178,7 @@ func TestQueryInfo(t *testing.T) {
 	defer session.Close()
 
 	conn := session.Pool.Pick(nil)
-	info, err := conn.prepareStatement("SELECT release_version, host_id FROM system.local WHERE key = ?", nil)
+	info, err := conn.prepareStatement(context.Background(), "SELECT release_version, host_id FROM system.local WHERE key = ?", "", nil)
 
 	if err != nil {
 		t.Fatalf("Failed to execute query for preparing statement: %v", err)
@@ -2018,7 +2057,7 @@ func TestStream0(t *testing.T) {
 
 	const expErr = "gocql: error on stream 0:"
 	// need to write out an invalid frame, which we need a connection to do
-	frame, err := conn.exec(writer, nil)
+	frame, err := conn.exec(context.Background(), writer, nil)
 	if err == nil {
 		t.Fatal("expected to get an error on stream 0")
 	} else if !strings.HasPrefix(err.Error(), expErr) {
@@ -2051,10 +2090,43 @@ func TestNegativeStream(t *testing.T) {
 		return f.finishWrite()
 	})
 
-	frame, err := conn.exec(writer, nil)
+	frame, err := conn.exec(context.Background(), writer, nil)
 	if err == nil {
 		t.Fatalf("expected to get an error on stream %d", stream)
 	} else if frame != nil {
 		t.Fatalf("expected to get nil frame got %+v", frame)
 	}
 }
+
+func TestWithTimestamp(t *testing.T) {
+	if *flagProto < protoVersion3 {
+		t.Skip("default timestamps are only available on proto>=3")
+	}
+
+	session := createSession(t)
+	defer session.Close()
+
+	if err := createTable(session, "CREATE TABLE test_with_timestamp (id int, value int, PRIMARY KEY (id))"); err != nil {
+		t.Fatalf("failed to create table with error '%v'", err)
+	}
+
+	const ts = 1234567890123456
+	if err := session.Query("INSERT INTO test_with_timestamp (id, value) VALUES (?, ?)", 1, 1).WithTimestamp(ts).Exec(); err != nil {
+		t.Fatalf("failed to insert with err: %v", err)
+	}
+
+	batch := session.NewBatch(UnloggedBatch).WithTimestamp(ts + 1)
+	batch.Query("INSERT INTO test_with_timestamp (id, value) VALUES (?, ?)", 2, 2)
+	if err := session.ExecuteBatch(batch); err != nil {
+		t.Fatalf("failed to execute batch with err: %v", err)
+	}
+
+	for id, expected := range map[int]int64{1: ts, 2: ts + 1} {
+		var writetime int64
+		if err := session.Query("SELECT writetime(value) FROM test_with_timestamp WHERE id = ?", id).Scan(&writetime); err != nil {
+			t.Fatalf("failed to select with err: %v", err)
+		} else if writetime != expected {
+			t.Errorf("expected writetime of row %d to be %d got %d", id, expected, writetime)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.19
+
+package gocql
+
+import "crypto/x509"
+
+// cloneCertPool returns a copy of p which can be added to without modifying
+// p.
+func cloneCertPool(p *x509.CertPool) *x509.CertPool {
+	return p.Clone()
+}
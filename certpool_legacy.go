@@ -0,0 +1,16 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !go1.19
+
+package gocql
+
+import "crypto/x509"
+
+// cloneCertPool returns an empty pool as the certificates of a pool can not
+// be copied before Go 1.19, the CA of SslOptions.CaPath then replaces the
+// RootCAs of the tls.Config instead of being added to them.
+func cloneCertPool(p *x509.CertPool) *x509.CertPool {
+	return x509.NewCertPool()
+}
@@ -6,6 +6,7 @@ package gocql
 
 import (
 	"errors"
+	"net/url"
 	"sync"
 	"time"
 
@@ -21,6 +22,48 @@ var stmtsLRU preparedLRU
 type preparedLRU struct {
 	sync.Mutex
 	lru *lru.Cache
+
+	// tables are the keyspace and table of the prepared statements, by
+	// cache key, to invalidate them when the schema of a table changes
+	tables map[string]preparedTable
+}
+
+type preparedTable struct {
+	keyspace string
+	table    string
+}
+
+//track records the table a prepared statement refers to. Not concurrency safe.
+func (p *preparedLRU) track(key string, info *resultPreparedFrame) {
+	var col *ColumnInfo
+	if len(info.reqMeta.columns) > 0 {
+		col = &info.reqMeta.columns[0]
+	} else if len(info.respMeta.columns) > 0 {
+		col = &info.respMeta.columns[0]
+	} else {
+		return
+	}
+
+	if _, ok := p.lru.Get(key); !ok {
+		// already evicted
+		return
+	}
+
+	p.tables[key] = preparedTable{keyspace: col.Keyspace, table: col.Table}
+}
+
+//evictTable removes the prepared statements of a table from the cache, or of
+//every table of the keyspace when table is empty. Not concurrency safe.
+func (p *preparedLRU) evictTable(keyspace, table string) {
+	for key, t := range p.tables {
+		if t.keyspace == keyspace && (table == "" || t.table == table) {
+			p.lru.Remove(key)
+		}
+	}
+}
+
+func (p *preparedLRU) evicted(key lru.Key, value interface{}) {
+	delete(p.tables, key.(string))
 }
 
 //Max adjusts the maximum size of the cache and cleans up the oldest records if
@@ -37,17 +80,35 @@ func initStmtsLRU(max int) {
 		stmtsLRU.Max(max)
 	} else {
 		stmtsLRU.lru = lru.New(max)
+		stmtsLRU.lru.OnEvicted = stmtsLRU.evicted
+		stmtsLRU.tables = make(map[string]preparedTable)
 	}
 }
 
-// To enable periodic node discovery enable DiscoverHosts in ClusterConfig
+// To enable periodic node discovery enable DiscoverHosts in ClusterConfig,
+// the session then also listens to the topology, status and schema change
+// events of the cluster on a dedicated control connection.
 type DiscoveryConfig struct {
 	// If not empty will filter all discoverred hosts to a single Data Centre (default: "")
 	DcFilter string
 	// If not empty will filter all discoverred hosts to a single Rack (default: "")
 	RackFilter string
-	// The interval to check for new hosts (default: 30s)
+	// The interval of the refresh of the hosts and of their tokens, which
+	// recovers from the topology events missed (default: 30s)
 	Sleep time.Duration
+	// The interval at which the cached keyspace metadata, see
+	// Session.KeyspaceMetadata, and the routing key information of the
+	// statements are dropped to be read again on their next use, which
+	// recovers from the schema change events missed (default: 0, only
+	// dropped on schema change events)
+	MetadataRefreshInterval time.Duration
+	// The delay before refreshing the hosts after a topology change event,
+	// the events received meanwhile trigger a single refresh (default: 0)
+	TopologyEventDelay time.Duration
+	// The delay before marking a host down or up after a status change
+	// event, only the last status received meanwhile is applied which
+	// debounces flapping hosts (default: 0)
+	StatusEventDelay time.Duration
 }
 
 // ClusterConfig is a struct to configure the default cluster implementation
@@ -55,19 +116,21 @@ type DiscoveryConfig struct {
 // behavior to fit the most common use cases. Applications that requre a
 // different setup must implement their own cluster.
 type ClusterConfig struct {
-	Hosts             []string          // addresses for the initial connections
+	Hosts             []string          // addresses for the initial connections, or DNS SRV names prefixed with srv:
 	CQLVersion        string            // CQL version (default: 3.0.0)
 	ProtoVersion      int               // version of the native protocol (default: 2)
-	Timeout           time.Duration     // connection timeout (default: 600ms)
+	Timeout           time.Duration     // timeout of the wait for the response to a request (default: 600ms)
+	ConnectTimeout    time.Duration     // timeout of the dial and handshake of the connections (default: Timeout)
+	WriteTimeout      time.Duration     // timeout of the writes to the sockets (default: Timeout)
 	Port              int               // port (default: 9042)
-	Keyspace          string            // initial keyspace (optional)
+	Keyspace          string            // initial keyspace, see Session.SetKeyspace (optional)
 	NumConns          int               // number of connections per host (default: 2)
 	NumStreams        int               // number of streams per connection (default: max per protocol, either 128 or 32768)
 	Consistency       Consistency       // default consistency level (default: Quorum)
 	Compressor        Compressor        // compression algorithm (default: nil)
 	Authenticator     Authenticator     // authenticator (default: nil)
 	RetryPolicy       RetryPolicy       // Default retry policy to use for queries (default: 0)
-	SocketKeepalive   time.Duration     // The keepalive period to use, enabled if > 0 (default: 0)
+	SocketKeepalive   time.Duration     // TCP keepalive period of the connections, disabled if < 0 (default: 0, the default of the net package, 15s)
 	ConnPoolType      NewPoolFunc       // The function used to create the connection pool for the session (default: NewSimplePool)
 	DiscoverHosts     bool              // If set, gocql will attempt to automatically discover other members of the Cassandra cluster (default: false)
 	MaxPreparedStmts  int               // Sets the maximum cache size for prepared statements globally for gocql (default: 1000)
@@ -77,6 +140,169 @@ type ClusterConfig struct {
 	Discovery         DiscoveryConfig
 	SslOpts           *SslOptions
 	DefaultTimestamp  bool // Sends a client side timestamp for all requests which overrides the timestamp at which it arrives at the server. (default: true, only enabled for protocol 3 and above)
+
+	// CompressionThreshold is the minimum size in bytes of a frame body for it
+	// to be compressed when a Compressor is set, smaller frames gain little from
+	// compression and are sent as is. (default: 512)
+	CompressionThreshold int
+
+	// Compressors are tried in order when a host does not support
+	// Compressor. The compressor is negotiated with each host, whose
+	// connections are not compressed when it supports none of them, and
+	// reported by HostInfo.Compressor.
+	// (default: nil)
+	Compressors []Compressor
+
+	// HeartbeatInterval is the idle time after which a connection sends a
+	// heartbeat request to its host, connections whose heartbeat is not
+	// answered within Timeout are closed and replaced. Zero disables the
+	// heartbeats. (default: 30s)
+	HeartbeatInterval time.Duration
+
+	// MaxInFlightPerConn limits the requests waiting for a response on each
+	// connection, zero means the number of streams. (default: 0)
+	MaxInFlightPerConn int
+
+	// MaxQueuedPerConn is the number of requests which wait for one of the
+	// requests in flight to complete when a connection is at its limit, the
+	// others fail with ErrTooManyInFlight. The queued requests are sent by
+	// order of Priority, and when the queue is full a request takes the
+	// place of a queued one of lower priority. (default: 0, fail fast)
+	MaxQueuedPerConn int
+
+	// MaxQueueWait is the time the queued requests wait before failing
+	// with ErrTooManyInFlight. (default: 0, which waits up to Timeout)
+	MaxQueueWait time.Duration
+
+	// ReconnectionPolicy sets the delays between the attempts to connect to
+	// a host which could not be reached, and to reopen the control
+	// connection. (default: exponential from 100ms up to 10s)
+	ReconnectionPolicy ReconnectionPolicy
+
+	// QueryObserver is notified of every execution of the queries created
+	// by the session, it can be overridden per query with Query.Observer.
+	// (default: nil)
+	QueryObserver QueryObserver
+
+	// BatchObserver is notified of every execution of the batches created
+	// by the session, it can be overridden per batch with Batch.Observer.
+	// (default: nil)
+	BatchObserver BatchObserver
+
+	// ConnectObserver is notified of every connection attempt to the hosts
+	// of the cluster. (default: nil)
+	ConnectObserver ConnectObserver
+
+	// SRVRefreshInterval is the interval at which the contact points given
+	// as DNS SRV names, for instance srv:_cql._tcp.example.com, or as host
+	// names are resolved again. The host names are not resolved when the
+	// certificates of the hosts are verified against them. (default: 1 minute)
+	SRVRefreshInterval time.Duration
+
+	// AddressTranslator maps the addresses of the discovered hosts to the
+	// addresses the driver connects to. (default: nil, not translated)
+	AddressTranslator AddressTranslator
+
+	// Dialer opens the connections to the hosts, for instance through a
+	// tunnel, the shard-aware port of Scylla hosts requires the default
+	// dialer. (default: nil, a net.Dialer)
+	Dialer Dialer
+
+	// Proxy returns the URL of the proxy the connections are opened through,
+	// see ProxyFromEnvironment and ProxyURL. (default: nil, no proxy)
+	Proxy func() (*url.URL, error)
+
+	// DualStackFallbackDelay is the delay after which the dial to a host
+	// name resolving to IPv6 and IPv4 addresses races the IPv4 addresses
+	// against the IPv6 ones (RFC 8305), a negative delay disables it.
+	// (default: 0, 300ms)
+	DualStackFallbackDelay time.Duration
+
+	// HostStateListener is notified when hosts join or leave the cluster and
+	// when they go up or down, it requires DiscoverHosts. (default: nil)
+	HostStateListener HostStateListener
+
+	// FrameHeaderObserver is notified of the header of every frame received
+	// from the hosts of the cluster, it is meant for debugging protocol
+	// issues. (default: nil)
+	FrameHeaderObserver FrameHeaderObserver
+
+	// ExpvarName is the name under which the statistics of the session, see
+	// Session.Stats, are published with the expvar package. (default: "",
+	// not published)
+	ExpvarName string
+
+	// Logger receives the warnings and errors of the driver, see
+	// NewStdLogger and NewSlogLogger. (default: nil, discarded)
+	Logger Logger
+
+	// MaxWaitSchemaAgreement is how long the execution of a statement changing
+	// the schema waits for the hosts to agree on the new schema, see
+	// Session.AwaitSchemaAgreement. The statement returns an error wrapping
+	// ErrNoSchemaAgreement when they do not agree in time, or when the
+	// schema versions can not be read, even though it was applied.
+	// (default: 0, no wait)
+	MaxWaitSchemaAgreement time.Duration
+
+	// DisableNoDelay enables Nagle's algorithm on the connections, which
+	// then coalesce the small frames of concurrent requests into fewer TCP
+	// segments. The driver writes every frame at once, so this only saves
+	// packets under many concurrent requests, and it delays the requests
+	// sent while a previous segment is not acknowledged, by up to the
+	// delayed ACK timeout of the host (about 40ms on Linux). Run
+	// BenchmarkNoDelay to measure the tradeoff. (default: false, TCP_NODELAY
+	// is set)
+	DisableNoDelay bool
+
+	// SlowQueryThreshold enables the slow query log: the executions of
+	// queries and batches taking longer are reported to SlowQueryFunc, or
+	// logged to Logger when it is nil. (default: 0, disabled)
+	SlowQueryThreshold time.Duration
+
+	// SlowQueryFunc is called with every slow query. (default: nil)
+	SlowQueryFunc func(SlowQuery)
+
+	// SlowQueryRedact replaces the literals of the reported statements with
+	// "?" so they do not leak application data. (default: false)
+	SlowQueryRedact bool
+
+	// BatchSizeWarnThreshold and BatchSizeFailThreshold mirror the
+	// batch_size_warn_threshold and batch_size_fail_threshold settings of
+	// Cassandra on the client side: the batches whose bound values and
+	// unprepared statements are larger, in bytes, are logged to Logger, or
+	// fail with ErrBatchTooLarge without being sent. (default: 0, disabled)
+	BatchSizeWarnThreshold int
+	BatchSizeFailThreshold int
+
+	// BatchStatementsWarnThreshold and BatchStatementsFailThreshold do the
+	// same for the number of statements of the batches. (default: 0,
+	// disabled)
+	BatchStatementsWarnThreshold int
+	BatchStatementsFailThreshold int
+
+	// WarmupPool makes CreateSession open the NumConns connections to every
+	// host before returning, instead of opening them in the background, so
+	// the first requests do not wait for them. (default: false)
+	WarmupPool bool
+
+	// WarmupStatements are prepared on every host by CreateSession when
+	// WarmupPool is set, it fails when one of them can not be prepared.
+	// (default: nil)
+	WarmupStatements []string
+
+	// LazyConnect makes CreateSession return without opening the connections
+	// of the pool, the connections to a host are opened when it is first
+	// queried. Only the control connection is opened, CreateSession fails
+	// when it can not be, and the ring is queried on it when DiscoverHosts
+	// is set. WarmupPool is ignored. The simple pool opens the connections to
+	// all the hosts on first use.
+	// (default: false)
+	LazyConnect bool
+
+	// stats are created by NewSession and shared with the connections
+	stats *sessionStats
+	// hostOptions are created by NewSession and shared with the connections
+	hostOptions *hostOptions
 }
 
 // NewCluster generates a new config for the default cluster implementation.
@@ -95,6 +321,14 @@ func NewCluster(hosts ...string) *ClusterConfig {
 		MaxRoutingKeyInfo: 1000,
 		PageSize:          5000,
 		DefaultTimestamp:  true,
+
+		CompressionThreshold: 512,
+		HeartbeatInterval:    30 * time.Second,
+		SRVRefreshInterval:   time.Minute,
+		ReconnectionPolicy: &ExponentialReconnectionPolicy{
+			InitialInterval: 100 * time.Millisecond,
+			MaxInterval:     10 * time.Second,
+		},
 	}
 	return cfg
 }
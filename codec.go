@@ -0,0 +1,99 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// TypeCodec converts between the CQL encoding of a type and Go values. Codecs
+// are registered with RegisterCustomCodec or RegisterCodec and are used by
+// Marshal and Unmarshal instead of the built-in conversions, Marshaler and
+// Unmarshaler implementations still take precedence.
+type TypeCodec interface {
+	// New returns a pointer to an empty value which Unmarshal can decode
+	// into. It is used when the destination is not provided by the user, for
+	// instance by MapScan and SliceMap.
+	New(info TypeInfo) interface{}
+
+	Marshal(info TypeInfo, value interface{}) ([]byte, error)
+	Unmarshal(info TypeInfo, data []byte, value interface{}) error
+}
+
+type codecRegistry struct {
+	native map[Type]TypeCodec
+	custom map[string]TypeCodec
+}
+
+var (
+	codecsMu sync.Mutex
+	// codecs holds a *codecRegistry which is never modified once stored so
+	// that lookups, which happen for every marshaled value, do not need to
+	// take a lock.
+	codecs atomic.Value
+)
+
+func init() {
+	codecs.Store(&codecRegistry{})
+}
+
+func updateCodecs(fn func(r *codecRegistry)) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	old := codecs.Load().(*codecRegistry)
+	r := &codecRegistry{
+		native: make(map[Type]TypeCodec, len(old.native)),
+		custom: make(map[string]TypeCodec, len(old.custom)),
+	}
+	for k, v := range old.native {
+		r.native[k] = v
+	}
+	for k, v := range old.custom {
+		r.custom[k] = v
+	}
+
+	fn(r)
+	codecs.Store(r)
+}
+
+// RegisterCustomCodec registers codec for the server side custom type
+// implemented by the Java class named class, for example
+// "org.apache.cassandra.db.marshal.DynamicCompositeType". Registering a nil
+// codec removes any previously registered codec. Codecs are shared by all
+// sessions.
+func RegisterCustomCodec(class string, codec TypeCodec) {
+	updateCodecs(func(r *codecRegistry) {
+		if codec == nil {
+			delete(r.custom, class)
+		} else {
+			r.custom[class] = codec
+		}
+	})
+}
+
+// RegisterCodec registers codec for the native type typ, overriding the
+// built-in conversions. Registering a nil codec restores them. Codecs are
+// shared by all sessions.
+func RegisterCodec(typ Type, codec TypeCodec) {
+	updateCodecs(func(r *codecRegistry) {
+		if codec == nil {
+			delete(r.native, typ)
+		} else {
+			r.native[typ] = codec
+		}
+	})
+}
+
+func lookupCodec(info TypeInfo) TypeCodec {
+	r := codecs.Load().(*codecRegistry)
+	if typ := info.Type(); typ == TypeCustom {
+		return r.custom[info.Custom()]
+	} else if len(r.native) > 0 {
+		return r.native[typ]
+	}
+	return nil
+}
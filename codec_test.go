@@ -0,0 +1,104 @@
+// +build all unit
+
+package gocql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// upperCodec stores strings in upper case and returns them in lower case.
+type upperCodec struct{}
+
+func (upperCodec) New(info TypeInfo) interface{} {
+	return new(string)
+}
+
+func (upperCodec) Marshal(info TypeInfo, value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, marshalErrorf("can not marshal %T into %s", value, info)
+	}
+	return []byte(strings.ToUpper(s)), nil
+}
+
+func (upperCodec) Unmarshal(info TypeInfo, data []byte, value interface{}) error {
+	s, ok := value.(*string)
+	if !ok {
+		return unmarshalErrorf("can not unmarshal %s into %T", info, value)
+	}
+	*s = strings.ToLower(string(data))
+	return nil
+}
+
+func TestCustomCodec(t *testing.T) {
+	const class = "com.example.UpperType"
+	info := NativeType{proto: 3, typ: TypeCustom, custom: class}
+
+	// without a codec the raw bytes are passed through
+	data, err := Marshal(info, []byte("raw"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, []byte("raw")) {
+		t.Errorf("expected raw bytes got %q", data)
+	}
+	if _, ok := info.New().(*[]byte); !ok {
+		t.Errorf("expected New to return *[]byte got %T", info.New())
+	}
+
+	RegisterCustomCodec(class, upperCodec{})
+	defer RegisterCustomCodec(class, nil)
+
+	data, err = Marshal(info, "hello")
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "HELLO" {
+		t.Errorf("expected HELLO got %q", data)
+	}
+
+	v := info.New()
+	if err := Unmarshal(info, data, v); err != nil {
+		t.Fatal(err)
+	} else if s, ok := v.(*string); !ok || *s != "hello" {
+		t.Errorf("expected hello got %#v", v)
+	}
+
+	// codecs are used for elements of collections as well
+	list := CollectionType{
+		NativeType: NativeType{proto: 3, typ: TypeList},
+		Elem:       info,
+	}
+	if _, ok := list.New().(*[]string); !ok {
+		t.Errorf("expected New to return *[]string got %T", list.New())
+	}
+	data, err = Marshal(list, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	if err := Unmarshal(list, data, &out); err != nil {
+		t.Fatal(err)
+	} else if len(out) != 1 || out[0] != "a" {
+		t.Errorf("expected [a] got %v", out)
+	}
+}
+
+func TestNativeCodec(t *testing.T) {
+	info := NativeType{proto: 3, typ: TypeVarchar}
+
+	RegisterCodec(TypeVarchar, upperCodec{})
+	data, err := Marshal(info, "hello")
+	RegisterCodec(TypeVarchar, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "HELLO" {
+		t.Errorf("expected HELLO got %q", data)
+	}
+
+	if data, err := Marshal(info, "hello"); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "hello" {
+		t.Errorf("expected the builtin codec to be restored got %q", data)
+	}
+}
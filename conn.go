@@ -6,12 +6,13 @@ package gocql
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"strconv"
 	"strings"
@@ -30,11 +31,30 @@ func JoinHostPort(addr string, port int) string {
 	return addr
 }
 
+// Authenticator drives the SASL authentication handshake with a node. The
+// first call to Challenge receives the name of the authenticator class used
+// by the server and returns the initial response. Every further challenge
+// sent by the server is passed to the Authenticator returned by the previous
+// call to Challenge, which also receives the final token of the server with
+// Success. Mechanisms which need several rounds, such as GSSAPI, return
+// themselves or a new Authenticator to keep track of the exchange.
 type Authenticator interface {
 	Challenge(req []byte) (resp []byte, auth Authenticator, err error)
 	Success(data []byte) error
 }
 
+// HostAuthenticator is an Authenticator which creates a new Authenticator
+// for each connection. It should be implemented by authenticators which keep
+// state during the handshake or which need to know the address of the node,
+// for instance to build the Kerberos service principal of the node.
+type HostAuthenticator interface {
+	Authenticator
+
+	// ForHost returns the Authenticator used to authenticate the connection
+	// to the node at addr, in the host:port form.
+	ForHost(addr string) (Authenticator, error)
+}
+
 type PasswordAuthenticator struct {
 	Username string
 	Password string
@@ -56,9 +76,17 @@ func (p PasswordAuthenticator) Success(data []byte) error {
 	return nil
 }
 
+// SslOptions configures TLS for the connections to the cluster, starting
+// from the embedded tls.Config or from TLSConfig when it is set. The config is
+// copied and not modified. When its ServerName is empty the host part of the
+// address being dialed is used for SNI and host verification.
 type SslOptions struct {
 	tls.Config
 
+	// TLSConfig is a tls.Config used instead of the embedded one, so that
+	// an existing config can be provided without copying it.
+	TLSConfig *tls.Config
+
 	// CertPath and KeyPath are optional depending on server
 	// config, but both fields must be omitted to avoid using a
 	// client certificate
@@ -78,14 +106,137 @@ type ConnConfig struct {
 	NumStreams    int
 	Compressor    Compressor
 	Authenticator Authenticator
-	Keepalive     time.Duration
+	Keepalive     time.Duration // TCP keepalive period, negative disables it and 0 uses the default of the net package
 	tlsConfig     *tls.Config
+
+	// ConnectTimeout bounds the dial, the TLS handshake and the protocol
+	// handshake, WriteTimeout the writes to the socket. Both default to
+	// Timeout, which bounds the wait for the response to a request.
+	ConnectTimeout time.Duration
+	WriteTimeout   time.Duration
+
+	// DisableNoDelay enables Nagle's algorithm on the TCP connections.
+	DisableNoDelay bool
+
+	// HeartbeatInterval is the idle time after which an OPTIONS request is
+	// sent to the host, the connection is closed when it is not answered.
+	HeartbeatInterval time.Duration
+
+	// MaxInFlight limits the requests waiting for a response, up to
+	// MaxQueued requests wait at most MaxQueueWait for one of them to
+	// complete, the others fail with ErrTooManyInFlight.
+	MaxInFlight  int
+	MaxQueued    int
+	MaxQueueWait time.Duration
+
+	// CompressionThreshold is the minimum body size in bytes of the frames
+	// which are compressed.
+	CompressionThreshold int
+
+	// Compressors are tried in order when the host does not support
+	// Compressor.
+	Compressors []Compressor
+
+	ConnectObserver     ConnectObserver
+	FrameHeaderObserver FrameHeaderObserver
+	Logger              Logger
+
+	// Dialer opens the connections, nil uses a net.Dialer.
+	Dialer Dialer
+	// FallbackDelay is the delay before racing a dial to the IPv4 addresses
+	// of a host name against the IPv6 ones when the default dialer is used,
+	// see net.Dialer.FallbackDelay.
+	FallbackDelay time.Duration
+
+	stats *sessionStats
+	// hostOptions caches the options supported by the hosts, nil sends an
+	// OPTIONS request on every connection.
+	hostOptions *hostOptions
+	// eventHandler receives the events pushed by the host, it is called
+	// from the reading goroutine of the connection and must not block.
+	eventHandler func(frame)
+	// localPort is the port the connection is dialed from, the shard-aware
+	// port of Scylla hosts picks the shard from it. (default: 0, any port)
+	localPort int
+}
+
+func (cfg *ConnConfig) connectTimeout() time.Duration {
+	if cfg.ConnectTimeout > 0 {
+		return cfg.ConnectTimeout
+	}
+	return cfg.Timeout
+}
+
+func (cfg *ConnConfig) writeTimeout() time.Duration {
+	if cfg.WriteTimeout > 0 {
+		return cfg.WriteTimeout
+	}
+	return cfg.Timeout
+}
+
+// Dialer is the interface implemented by the dialers opening the connections
+// to the hosts, for instance to tunnel them or to replace them in tests.
+// *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
 }
 
 type ConnErrorHandler interface {
 	HandleError(conn *Conn, err error, closed bool)
 }
 
+// ObservedConnect describes a connection attempt, which includes dialing the
+// host and the protocol handshake.
+type ObservedConnect struct {
+	// Host is the address the connection was made to.
+	Host string
+
+	Start time.Time
+	End   time.Time
+
+	// Err is the error which made the attempt fail, if any.
+	Err error
+}
+
+// ConnectObserver is the interface implemented by connection observers, they
+// are notified after every connection attempt. ObserveConnect is called
+// synchronously from the goroutine connecting and must not block.
+type ConnectObserver interface {
+	ObserveConnect(c ObservedConnect)
+}
+
+// ObservedFrameHeader is the header of a frame received from a host.
+type ObservedFrameHeader struct {
+	Version protoVersion
+	Flags   byte
+	Stream  int16
+	Opcode  frameOp
+	Length  int32
+
+	// Start is the time the connection started waiting for the header and
+	// End the time the header was read, the body of the frame is read
+	// afterwards.
+	Start time.Time
+	End   time.Time
+
+	// Host is the address of the host which sent the frame.
+	Host string
+}
+
+func (f ObservedFrameHeader) String() string {
+	return fmt.Sprintf("[observed header version=%s flags=0x%x stream=%d op=%s length=%d host=%s]",
+		f.Version, f.Flags, f.Stream, f.Opcode, f.Length, f.Host)
+}
+
+// FrameHeaderObserver is the interface implemented by frame observers, they
+// are notified of the header of every frame received, including events and
+// frames which are not the response to a request. ObserveFrameHeader is
+// called synchronously from the goroutine reading the connection and must not
+// block.
+type FrameHeaderObserver interface {
+	ObserveFrameHeader(h ObservedFrameHeader)
+}
+
 // How many timeouts we will allow to occur before the connection is closed
 // and restarted. This is to prevent a single query timeout from killing a connection
 // which may be serving more queries just fine.
@@ -96,56 +247,146 @@ var TimeoutLimit int64 = 10
 // queries, but users are usually advised to use a more reliable, higher
 // level API.
 type Conn struct {
-	conn    net.Conn
-	r       *bufio.Reader
-	timeout time.Duration
+	conn         net.Conn
+	r            *bufio.Reader
+	timeout      time.Duration
+	writeTimeout time.Duration
 
 	headerBuf []byte
 
-	uniq  chan int
-	calls []callReq
-
-	errorHandler    ConnErrorHandler
-	compressor      Compressor
-	auth            Authenticator
-	addr            string
-	version         uint8
+	streams *streamIDs
+	limiter *requestLimiter
+	calls   []callReq
+	// protects the creation of the resp channels of calls
+	respMu sync.Mutex
+
+	errorHandler  ConnErrorHandler
+	compressor    Compressor
+	compressMin   int
+	frameObserver FrameHeaderObserver
+	stats         *sessionStats
+	logger        Logger
+	eventHandler  func(frame)
+	scylla        *scyllaShardInfo
+	auth          Authenticator
+	addr          string
+	version       uint8
+	started       bool
+
+	// segmented is set once the frames are wrapped in segments, after the
+	// handshake of protocol v5 connections, segmentComp compresses the
+	// segments
+	segmented   bool
+	segmentComp BlockCompressor
+
+	// protects currentKeyspace
+	keyspaceMu      sync.RWMutex
 	currentKeyspace string
-	started         bool
 
 	closed int32
 	quit   chan struct{}
 
 	timeouts int64
+	// lastRead is the time in unix nanoseconds of the last frame received
+	lastRead int64
 }
 
 // Connect establishes a connection to a Cassandra node.
 // You must also call the Serve method before you can execute any queries.
 func Connect(addr string, cfg ConnConfig, errorHandler ConnErrorHandler) (*Conn, error) {
-	var (
-		err  error
-		conn net.Conn
-	)
+	if cfg.ConnectObserver == nil {
+		return connect(addr, cfg, errorHandler)
+	}
 
-	dialer := &net.Dialer{
-		Timeout: cfg.Timeout,
+	start := time.Now()
+	c, err := connect(addr, cfg, errorHandler)
+	cfg.ConnectObserver.ObserveConnect(ObservedConnect{
+		Host:  addr,
+		Start: start,
+		End:   time.Now(),
+		Err:   err,
+	})
+
+	return c, err
+}
+
+// dial opens the network connection to addr with the dialer of cfg and
+// performs the TLS handshake, before the deadline of ctx.
+func dial(ctx context.Context, addr string, cfg *ConnConfig) (net.Conn, error) {
+	dialer := cfg.Dialer
+	if dialer == nil {
+		d := &net.Dialer{FallbackDelay: cfg.FallbackDelay, KeepAlive: cfg.Keepalive}
+		if cfg.localPort > 0 {
+			d.LocalAddr = &net.TCPAddr{Port: cfg.localPort}
+		}
+		dialer = d
 	}
 
-	if cfg.tlsConfig != nil {
-		// the TLS config is safe to be reused by connections but it must not
-		// be modified after being used.
-		conn, err = tls.DialWithDialer(dialer, "tcp", addr, cfg.tlsConfig)
-	} else {
-		conn, err = dialer.Dial("tcp", addr)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
 	}
 
+	if err := setNoDelay(conn, !cfg.DisableNoDelay); err != nil {
+		cfg.logger().Warn("gocql: unable to set TCP_NODELAY on the connection", "host", addr, "error", err)
+	}
+
+	if cfg.Dialer != nil && cfg.Keepalive != 0 {
+		// the keepalive of the connections of other dialers is set on the
+		// socket, before it is wrapped by TLS
+		if err := setKeepalive(conn, cfg.Keepalive); err != nil {
+			cfg.logger().Warn("gocql: unable to set the keepalive of the connection", "host", addr, "error", err)
+		}
+	}
+
+	if cfg.tlsConfig == nil {
+		return conn, nil
+	}
+
+	// the TLS config is safe to be reused by connections but it must not
+	// be modified after being used.
+	tlsConfig := cfg.tlsConfig
+	if tlsConfig.ServerName == "" {
+		// send the host for SNI and verify its certificate like tls.Dial
+		// does, SNI is needed even when the certificate is not verified
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+func connect(addr string, cfg ConnConfig, errorHandler ConnErrorHandler) (*Conn, error) {
+	// the connect timeout covers the dial and the protocol handshake
+	ctx := context.Background()
+	if timeout := cfg.connectTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn, err := dial(ctx, addr, &cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	// going to default to proto 2
-	if cfg.ProtoVersion < protoVersion1 || cfg.ProtoVersion > protoVersion3 {
-		log.Printf("unsupported protocol version: %d using 2\n", cfg.ProtoVersion)
+	if cfg.ProtoVersion < protoVersion1 || cfg.ProtoVersion > protoVersion5 {
+		cfg.logger().Warn("gocql: unsupported protocol version, using 2", "version", cfg.ProtoVersion)
 		cfg.ProtoVersion = 2
 	}
 
@@ -164,48 +405,107 @@ func Connect(addr string, cfg ConnConfig, errorHandler ConnErrorHandler) (*Conn,
 	}
 
 	c := &Conn{
-		conn:         conn,
-		r:            bufio.NewReader(conn),
-		uniq:         make(chan int, cfg.NumStreams),
-		calls:        make([]callReq, cfg.NumStreams),
-		timeout:      cfg.Timeout,
-		version:      uint8(cfg.ProtoVersion),
-		addr:         conn.RemoteAddr().String(),
-		errorHandler: errorHandler,
-		compressor:   cfg.Compressor,
-		auth:         cfg.Authenticator,
-		headerBuf:    make([]byte, headerSize),
-		quit:         make(chan struct{}),
-	}
-
-	if cfg.Keepalive > 0 {
-		c.setKeepalive(cfg.Keepalive)
+		conn:          conn,
+		r:             bufio.NewReader(conn),
+		streams:       newStreamIDs(cfg.NumStreams),
+		calls:         make([]callReq, cfg.NumStreams),
+		timeout:       cfg.Timeout,
+		writeTimeout:  cfg.writeTimeout(),
+		version:       uint8(cfg.ProtoVersion),
+		addr:          conn.RemoteAddr().String(),
+		errorHandler:  errorHandler,
+		compressMin:   cfg.CompressionThreshold,
+		frameObserver: cfg.FrameHeaderObserver,
+		stats:         cfg.stats,
+		logger:        cfg.logger(),
+		eventHandler:  cfg.eventHandler,
+		auth:          cfg.Authenticator,
+		headerBuf:     make([]byte, headerSize),
+		quit:          make(chan struct{}),
 	}
 
-	// reserve stream 0 incase cassandra returns an error on it without us sending
-	// a request.
-	for i := 1; i < cfg.NumStreams; i++ {
-		c.calls[i].resp = make(chan error)
-		c.uniq <- i
+	if cfg.MaxInFlight > 0 {
+		maxWait := cfg.MaxQueueWait
+		if maxWait <= 0 {
+			maxWait = cfg.Timeout
+		}
+		c.limiter = newRequestLimiter(cfg.MaxInFlight, cfg.MaxQueued, maxWait)
 	}
 
 	go c.serve()
 
-	if err := c.startup(&cfg); err != nil {
+	if err := c.startup(ctx, addr, &cfg); err != nil {
 		conn.Close()
 		return nil, err
 	}
 	c.started = true
 
+	if cfg.HeartbeatInterval > 0 {
+		go c.heartbeat(cfg.HeartbeatInterval)
+	}
+
 	return c, nil
 }
 
+// heartbeat sends an OPTIONS request when nothing was received from the host
+// for the given interval, which detects the half-open connections before a
+// query is sent on them. The connection is closed when the host does not
+// answer within the timeout of the connection.
+func (c *Conn) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+
+		lastRead := time.Unix(0, atomic.LoadInt64(&c.lastRead))
+		if time.Since(lastRead) < interval {
+			continue
+		}
+
+		// any response, including an error, shows the host is alive
+		if _, err := c.exec(context.Background(), &writeOptionsFrame{}, nil); err != nil {
+			if err == ErrConnectionClosed {
+				return
+			}
+
+			c.logger.Warn("gocql: heartbeat failed, closing the connection", "host", c.addr, "error", err)
+			c.closeWithError(err)
+			return
+		}
+	}
+}
+
 func (c *Conn) Write(p []byte) (int, error) {
-	if c.timeout > 0 {
-		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	if c.segmented {
+		// the segments of a frame are written at once so that they are not
+		// interleaved with the ones of other frames
+		segments := len(p)/maxSegmentPayload + 1
+		buf := bytes.NewBuffer(getBuffer(len(p) + segments*(compressedSegmentHeaderSize+4))[:0])
+		defer func() { putBuffer(buf.Bytes()) }()
+		if err := appendSegments(buf, p, c.segmentComp); err != nil {
+			return 0, err
+		}
+
+		n, err := c.conn.Write(buf.Bytes())
+		c.stats.written(n)
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
 	}
 
-	return c.conn.Write(p)
+	n, err := c.conn.Write(p)
+	c.stats.written(n)
+	return n, err
 }
 
 func (c *Conn) Read(p []byte) (n int, err error) {
@@ -218,6 +518,7 @@ func (c *Conn) Read(p []byte) (n int, err error) {
 		}
 
 		nn, err = io.ReadFull(c.r, p[n:])
+		c.stats.read(nn)
 		n += nn
 		if err == nil {
 			break
@@ -231,19 +532,71 @@ func (c *Conn) Read(p []byte) (n int, err error) {
 	return
 }
 
-func (c *Conn) startup(cfg *ConnConfig) error {
+func (c *Conn) startup(ctx context.Context, addr string, cfg *ConnConfig) error {
 	m := map[string]string{
 		"CQL_VERSION": cfg.CQLVersion,
 	}
 
-	if c.compressor != nil {
-		m["COMPRESSION"] = c.compressor.Name()
+	// the options are requested once per host, except from Scylla hosts
+	// which advertise the shard of each connection in them
+	supported, ok := cfg.hostOptions.supported(addr)
+	if _, scylla := parseScyllaShardInfo(supported); !ok || scylla {
+		var err error
+		if supported, err = c.options(ctx); err != nil {
+			return err
+		}
+		cfg.hostOptions.setSupported(addr, supported)
+	}
+
+	if info, ok := parseScyllaShardInfo(supported); ok {
+		c.scylla = &info
+	}
+
+	var compressors []Compressor
+	if cfg.Compressor != nil {
+		compressors = append(compressors, cfg.Compressor)
+	}
+	compressors = append(compressors, cfg.Compressors...)
+
+	if c.version >= protoVersion5 {
+		// the segments are compressed instead of the frames, which requires
+		// a block compressor
+		var blockCompressors []Compressor
+		for _, compressor := range compressors {
+			if _, ok := compressor.(BlockCompressor); ok {
+				blockCompressors = append(blockCompressors, compressor)
+			}
+		}
+		compressors = blockCompressors
+	}
+
+	if len(compressors) > 0 {
+		if compressor := c.negotiateCompression(supported["COMPRESSION"], compressors); compressor != nil {
+			m["COMPRESSION"] = compressor.Name()
+			if c.version >= protoVersion5 {
+				c.segmentComp = compressor.(BlockCompressor)
+			} else {
+				c.compressor = compressor
+			}
+		}
 	}
+	cfg.hostOptions.setCompressor(addr, m["COMPRESSION"])
 
-	frame, err := c.exec(&writeStartupFrame{opts: m}, nil)
+	frame, err := c.exec(ctx, &writeStartupFrame{opts: m}, nil)
 	if err != nil {
 		return err
 	}
+	if _, ok := frame.(error); ok {
+		// the host may have been upgraded since its options were cached
+		cfg.hostOptions.forget(addr)
+	}
+
+	switch frame.(type) {
+	case *readyFrame, *authenticateFrame:
+		// the frames following the answer to STARTUP are wrapped in
+		// segments
+		c.segmented = c.version >= protoVersion5
+	}
 
 	switch v := frame.(type) {
 	case error:
@@ -251,18 +604,59 @@ func (c *Conn) startup(cfg *ConnConfig) error {
 	case *readyFrame:
 		return nil
 	case *authenticateFrame:
-		return c.authenticateHandshake(v)
+		return c.authenticateHandshake(ctx, v)
 	default:
 		return NewErrProtocol("Unknown type of response to startup frame: %s", v)
 	}
 }
 
-func (c *Conn) authenticateHandshake(authFrame *authenticateFrame) error {
+// options returns the options supported by the host.
+func (c *Conn) options(ctx context.Context) (map[string][]string, error) {
+	frame, err := c.exec(ctx, &writeOptionsFrame{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := frame.(type) {
+	case error:
+		return nil, v
+	case *supportedFrame:
+		return v.supported, nil
+	default:
+		return nil, NewErrProtocol("Unknown type of response to options frame: %s", v)
+	}
+}
+
+// negotiateCompression returns the first of compressors supported by the
+// host, or nil if it supports none of them in which case the connection is
+// not compressed.
+func (c *Conn) negotiateCompression(supported []string, compressors []Compressor) Compressor {
+	for _, compressor := range compressors {
+		for _, name := range supported {
+			if compressor.Name() == name {
+				return compressor
+			}
+		}
+	}
+
+	c.logger.Warn("gocql: host does not support any of the configured compressors", "host", c.addr, "supported", supported)
+	return nil
+}
+
+func (c *Conn) authenticateHandshake(ctx context.Context, authFrame *authenticateFrame) error {
 	if c.auth == nil {
 		return fmt.Errorf("authentication required (using %q)", authFrame.class)
 	}
 
-	resp, challenger, err := c.auth.Challenge([]byte(authFrame.class))
+	auth := c.auth
+	if hostAuth, ok := auth.(HostAuthenticator); ok {
+		var err error
+		if auth, err = hostAuth.ForHost(c.addr); err != nil {
+			return err
+		}
+	}
+
+	resp, challenger, err := auth.Challenge([]byte(authFrame.class))
 	if err != nil {
 		return err
 	}
@@ -270,7 +664,7 @@ func (c *Conn) authenticateHandshake(authFrame *authenticateFrame) error {
 	req := &writeAuthResponseFrame{data: resp}
 
 	for {
-		frame, err := c.exec(req, nil)
+		frame, err := c.exec(ctx, req, nil)
 		if err != nil {
 			return err
 		}
@@ -284,6 +678,9 @@ func (c *Conn) authenticateHandshake(authFrame *authenticateFrame) error {
 			}
 			return nil
 		case *authChallengeFrame:
+			if challenger == nil {
+				return fmt.Errorf("authenticator for %q does not support challenges", authFrame.class)
+			}
 			resp, challenger, err = challenger.Challenge(v.data)
 			if err != nil {
 				return err
@@ -306,6 +703,7 @@ func (c *Conn) closeWithError(err error) {
 	if err != nil {
 		// we should attempt to deliver the error back to the caller if it
 		// exists
+		c.respMu.Lock()
 		for id := 0; id < len(c.calls); id++ {
 			req := &c.calls[id]
 			// we need to send the error to all waiting queries, put the state
@@ -317,6 +715,7 @@ func (c *Conn) closeWithError(err error) {
 				}
 			}
 		}
+		c.respMu.Unlock()
 	}
 
 	// if error was nil then unblock the quit channel
@@ -360,19 +759,47 @@ func (c *Conn) recv() error {
 	}
 
 	// were just reading headers over and over and copy bodies
+	headStart := time.Now()
 	head, err := readHeader(c.r, c.headerBuf)
 	if err != nil {
 		return err
 	}
+	c.stats.read(len(c.headerBuf))
+	atomic.StoreInt64(&c.lastRead, headStart.UnixNano())
+
+	if c.frameObserver != nil {
+		c.frameObserver.ObserveFrameHeader(ObservedFrameHeader{
+			Version: head.version,
+			Flags:   head.flags,
+			Stream:  int16(head.stream),
+			Opcode:  head.op,
+			Length:  int32(head.length),
+			Start:   headStart,
+			End:     time.Now(),
+			Host:    c.addr,
+		})
+	}
 
-	if head.stream > len(c.calls) {
+	if head.stream >= len(c.calls) {
 		return fmt.Errorf("gocql: frame header stream is beyond call exepected bounds: %d", head.stream)
 	} else if head.stream == -1 {
-		// TODO: handle cassandra event frames, we shouldnt get any currently
-		_, err := io.CopyN(ioutil.Discard, c, int64(head.length))
+		if c.eventHandler == nil {
+			// the connection is not registered for events
+			_, err := io.CopyN(ioutil.Discard, c, int64(head.length))
+			return err
+		}
+
+		framer := newFramer(c, c, c.compressor, c.version)
+		if err := framer.readFrame(&head); err != nil {
+			return err
+		}
+
+		frame, err := framer.parseFrame()
 		if err != nil {
 			return err
 		}
+
+		c.eventHandler(frame)
 		return nil
 	} else if head.stream <= 0 {
 		// reserved stream that we dont use, probably due to a protocol error
@@ -405,6 +832,12 @@ func (c *Conn) recv() error {
 		}
 	}
 
+	if c.version >= protoVersion5 && (head.op == opReady || head.op == opAuthenticate) {
+		// the host wraps the frames following the answer to STARTUP in
+		// segments
+		c.r = bufio.NewReader(newSegmentReader(c.r, c.segmentComp))
+	}
+
 	// we either, return a response to the caller, the caller timedout, or the
 	// connection has closed. Either way we should never block indefinatly here
 	select {
@@ -426,13 +859,10 @@ type callReq struct {
 
 func (c *Conn) releaseStream(stream int) {
 	call := &c.calls[stream]
-	framerPool.Put(call.framer)
+	call.framer.release()
 	call.framer = nil
 
-	select {
-	case c.uniq <- stream:
-	case <-c.quit:
-	}
+	c.streams.release(stream)
 }
 
 func (c *Conn) handleTimeout() {
@@ -441,18 +871,68 @@ func (c *Conn) handleTimeout() {
 	}
 }
 
-func (c *Conn) exec(req frameWriter, tracer Tracer) (frame, error) {
+func (c *Conn) exec(ctx context.Context, req frameWriter, tracer Tracer) (frame, error) {
+	return c.execWithOptions(ctx, req, tracer, execOptions{timeout: c.timeout})
+}
+
+// execOptions are the options of the requests made by the queries.
+type execOptions struct {
+	// timeout is the time to wait for the response. Only the timeouts at
+	// least as long as the one of the connection count towards
+	// TimeoutLimit, a shorter one is the choice of the caller rather than a
+	// sign of an unhealthy connection.
+	timeout time.Duration
+	// borrowBytes makes the values of the returned rows alias the buffer of
+	// the response, which is then owned by the rows frame.
+	borrowBytes bool
+	// priority orders the requests waiting for the in flight limit
+	priority Priority
+}
+
+func (c *Conn) execWithOptions(ctx context.Context, req frameWriter, tracer Tracer, opts execOptions) (frame, error) {
+	timeout := opts.timeout
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// TODO: move tracer onto conn
-	var stream int
-	select {
-	case stream = <-c.uniq:
-	case <-c.quit:
+	if c.limiter != nil {
+		// a queued request waits at most for its own timeout
+		waitCtx := ctx
+		if timeout > 0 && timeout < c.limiter.maxWait {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if err := c.limiter.acquire(waitCtx, opts.priority, c.quit); err != nil {
+			if ctx.Err() == nil && waitCtx.Err() != nil {
+				err = ErrTooManyInFlight
+			}
+			return nil, err
+		}
+		defer c.limiter.release()
+	}
+
+	stream, ok := c.streams.get(c.quit)
+	if !ok {
 		return nil, ErrConnectionClosed
 	}
 
+	c.stats.addInFlight(1)
+	defer c.stats.addInFlight(-1)
+
 	// resp is basically a waiting semaphore protecting the framer
 	framer := newFramer(c, c, c.compressor, c.version)
+	framer.compressThreshold = c.compressMin
+	framer.borrowBytes = opts.borrowBytes
 	call := &c.calls[stream]
+	if call.resp == nil {
+		// the channels are created on the first use of the stream, most
+		// connections only use a fraction of their streams
+		c.respMu.Lock()
+		call.resp = make(chan error)
+		c.respMu.Unlock()
+	}
 	call.framer = framer
 	call.timeout = make(chan struct{})
 
@@ -470,10 +950,18 @@ func (c *Conn) exec(req frameWriter, tracer Tracer) (frame, error) {
 		if err != nil {
 			return nil, err
 		}
-	case <-time.After(c.timeout):
+	case <-time.After(timeout):
 		close(call.timeout)
-		c.handleTimeout()
+		if timeout >= c.timeout {
+			c.handleTimeout()
+		}
+		c.stats.timeout()
 		return nil, ErrTimeoutNoResponse
+	case <-ctx.Done():
+		// the stream is parked like after a timeout, recv releases it when
+		// the late response arrives
+		close(call.timeout)
+		return nil, ctx.Err()
 	case <-c.quit:
 		return nil, ErrConnectionClosed
 	}
@@ -495,6 +983,12 @@ func (c *Conn) exec(req frameWriter, tracer Tracer) (frame, error) {
 		return nil, err
 	}
 
+	if rows, ok := frame.(*resultRowsFrame); ok && opts.borrowBytes {
+		// the rows keep the buffer, the framer must not reuse it
+		rows.buf = framer.readBuffer
+		framer.readBuffer = nil
+	}
+
 	if len(framer.traceID) > 0 {
 		tracer.Trace(framer.traceID)
 	}
@@ -502,13 +996,15 @@ func (c *Conn) exec(req frameWriter, tracer Tracer) (frame, error) {
 	return frame, nil
 }
 
-func (c *Conn) prepareStatement(stmt string, trace Tracer) (*resultPreparedFrame, error) {
+// prepareStatement prepares stmt in keyspace, or in the keyspace of the
+// connection when keyspace is empty.
+func (c *Conn) prepareStatement(ctx context.Context, stmt, keyspace string, trace Tracer) (*resultPreparedFrame, error) {
 	stmtsLRU.Lock()
 	if stmtsLRU.lru == nil {
 		initStmtsLRU(defaultMaxPreparedStmts)
 	}
 
-	stmtCacheKey := c.addr + c.currentKeyspace + stmt
+	stmtCacheKey := c.stmtCacheKey(stmt, keyspace)
 
 	if val, ok := stmtsLRU.lru.Get(stmtCacheKey); ok {
 		stmtsLRU.Unlock()
@@ -524,9 +1020,10 @@ func (c *Conn) prepareStatement(stmt string, trace Tracer) (*resultPreparedFrame
 
 	prep := &writePrepareFrame{
 		statement: stmt,
+		keyspace:  keyspace,
 	}
 
-	resp, err := c.exec(prep, trace)
+	resp, err := c.exec(ctx, prep, trace)
 	if err != nil {
 		flight.err = err
 		flight.wg.Done()
@@ -543,23 +1040,34 @@ func (c *Conn) prepareStatement(stmt string, trace Tracer) (*resultPreparedFrame
 	}
 	flight.wg.Done()
 
+	stmtsLRU.Lock()
 	if flight.err != nil {
-		stmtsLRU.Lock()
 		stmtsLRU.lru.Remove(stmtCacheKey)
-		stmtsLRU.Unlock()
+	} else {
+		stmtsLRU.track(stmtCacheKey, flight.info)
 	}
+	stmtsLRU.Unlock()
 
 	return flight.info, flight.err
 }
 
 func (c *Conn) executeQuery(qry *Query) *Iter {
+	if (qry.keyspace != "" || qry.nowInSeconds) && c.version < protoVersion5 {
+		return &Iter{err: ErrUnsupported}
+	}
+
 	params := queryParams{
 		consistency: qry.cons,
+		keyspace:    qry.keyspace,
+
+		nowInSeconds:      qry.nowInSeconds,
+		nowInSecondsValue: qry.nowInSecondsValue,
 	}
 
 	// frame checks that it is not 0
 	params.serialConsistency = qry.serialCons
 	params.defaultTimestamp = qry.defaultTimestamp
+	params.defaultTimestampValue = qry.defaultTimestampValue
 
 	if len(qry.pageState) > 0 {
 		params.pagingState = qry.pageState
@@ -571,7 +1079,7 @@ func (c *Conn) executeQuery(qry *Query) *Iter {
 	var frame frameWriter
 	if qry.shouldPrepare() {
 		// Prepare all DML queries. Other queries can not be prepared.
-		info, err := c.prepareStatement(qry.stmt, qry.trace)
+		info, err := c.prepareStatement(qry.Context(), qry.stmt, qry.keyspace, qry.trace)
 		if err != nil {
 			return &Iter{err: err}
 		}
@@ -598,39 +1106,46 @@ func (c *Conn) executeQuery(qry *Query) *Iter {
 		}
 		params.values = make([]queryValues, len(values))
 		for i := 0; i < len(values); i++ {
-			val, err := Marshal(info.reqMeta.columns[i].TypeInfo, values[i])
-			if err != nil {
+			// TODO: handle query binding names
+			if err := marshalQueryValue(info.reqMeta.columns[i].TypeInfo, values[i], &params.values[i]); err != nil {
 				return &Iter{err: err}
 			}
-
-			v := &params.values[i]
-			v.value = val
-			// TODO: handle query binding names
 		}
 
 		frame = &writeExecuteFrame{
-			preparedID: info.preparedID,
-			params:     params,
+			preparedID:       info.preparedID,
+			resultMetadataID: info.resultMetadataID,
+			params:           params,
+			customPayload:    qry.customPayload,
 		}
 	} else {
 		frame = &writeQueryFrame{
-			statement: qry.stmt,
-			params:    params,
+			statement:     qry.stmt,
+			params:        params,
+			customPayload: qry.customPayload,
 		}
 	}
 
-	resp, err := c.exec(frame, qry.trace)
+	opts := execOptions{timeout: c.timeout, borrowBytes: qry.borrowBytes, priority: qry.priority}
+	if qry.timeout > 0 {
+		opts.timeout = qry.timeout
+	}
+
+	resp, err := c.execWithOptions(qry.Context(), frame, qry.trace, opts)
 	if err != nil {
 		return &Iter{err: err}
 	}
 
 	switch x := resp.(type) {
 	case *resultVoidFrame:
-		return &Iter{}
+		return &Iter{warnings: x.warnings, customPayload: x.customPayload}
 	case *resultRowsFrame:
 		iter := &Iter{
-			meta: x.meta,
-			rows: x.rows,
+			meta:          x.meta,
+			rows:          x.rows,
+			borrowed:      x.buf,
+			warnings:      x.warnings,
+			customPayload: x.customPayload,
 		}
 
 		if len(x.meta.pagingState) > 0 {
@@ -646,14 +1161,21 @@ func (c *Conn) executeQuery(qry *Query) *Iter {
 		}
 
 		return iter
-	case *resultKeyspaceFrame, *resultSchemaChangeFrame:
-		return &Iter{}
+	case *resultKeyspaceFrame:
+		// a USE statement changed the keyspace of the connection
+		c.keyspaceMu.Lock()
+		c.currentKeyspace = x.keyspace
+		c.keyspaceMu.Unlock()
+		return &Iter{warnings: x.warnings, customPayload: x.customPayload}
+	case *resultSchemaChangeFrame:
+		return &Iter{schemaChanged: true, warnings: x.warnings, customPayload: x.customPayload}
 	case *RequestErrUnprepared:
 		stmtsLRU.Lock()
-		stmtCacheKey := c.addr + c.currentKeyspace + qry.stmt
+		stmtCacheKey := c.stmtCacheKey(qry.stmt, qry.keyspace)
 		if _, ok := stmtsLRU.lru.Get(stmtCacheKey); ok {
 			stmtsLRU.lru.Remove(stmtCacheKey)
 			stmtsLRU.Unlock()
+			c.logger.Debug("gocql: statement unprepared by host, preparing it again", "host", c.addr, "statement", qry.stmt)
 			return c.executeQuery(qry)
 		}
 		stmtsLRU.Unlock()
@@ -665,6 +1187,25 @@ func (c *Conn) executeQuery(qry *Query) *Iter {
 	}
 }
 
+// marshalQueryValue marshals the value bound to a variable of the given type
+// into dst.
+func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error {
+	if _, ok := value.(unsetColumn); ok {
+		if typ.Version() < protoVersion4 {
+			return ErrUnsupported
+		}
+		dst.isUnset = true
+		return nil
+	}
+
+	val, err := Marshal(typ, value)
+	if err != nil {
+		return err
+	}
+	dst.value = val
+	return nil
+}
+
 func (c *Conn) Pick(qry *Query) *Conn {
 	if c.Closed() {
 		return nil
@@ -676,19 +1217,30 @@ func (c *Conn) Closed() bool {
 	return atomic.LoadInt32(&c.closed) == 1
 }
 
+// Compressor returns the compressor negotiated with the host for this
+// connection, or nil if the connection is not compressed.
+func (c *Conn) Compressor() Compressor {
+	return c.compressor
+}
+
 func (c *Conn) Address() string {
 	return c.addr
 }
 
 func (c *Conn) AvailableStreams() int {
-	return len(c.uniq)
+	return c.streams.available()
+}
+
+// maxStreams is the number of streams which can be used, stream 0 is reserved.
+func (c *Conn) maxStreams() int {
+	return len(c.calls) - 1
 }
 
 func (c *Conn) UseKeyspace(keyspace string) error {
 	q := &writeQueryFrame{statement: `USE "` + keyspace + `"`}
 	q.params.consistency = Any
 
-	resp, err := c.exec(q, nil)
+	resp, err := c.exec(context.Background(), q, nil)
 	if err != nil {
 		return err
 	}
@@ -701,14 +1253,57 @@ func (c *Conn) UseKeyspace(keyspace string) error {
 		return NewErrProtocol("unknown frame in response to USE: %v", x)
 	}
 
+	// the prepared statements are cached by keyspace, the statements
+	// prepared in the previous keyspace are no longer used by the connection
+	c.keyspaceMu.Lock()
 	c.currentKeyspace = keyspace
+	c.keyspaceMu.Unlock()
 
 	return nil
 }
 
-func (c *Conn) executeBatch(batch *Batch) error {
+// keyspace returns the current keyspace of the connection.
+func (c *Conn) keyspace() string {
+	c.keyspaceMu.RLock()
+	defer c.keyspaceMu.RUnlock()
+
+	return c.currentKeyspace
+}
+
+// stmtCacheKey returns the key of the statement prepared in keyspace in the
+// prepared statement cache, the keyspace of the connection is used when
+// keyspace is empty.
+func (c *Conn) stmtCacheKey(stmt, keyspace string) string {
+	if keyspace == "" {
+		keyspace = c.keyspace()
+	}
+	return c.addr + keyspace + stmt
+}
+
+// register registers the connection for the given events, they are passed
+// to the event handler of the connection.
+func (c *Conn) register(events []string) error {
+	resp, err := c.exec(context.Background(), &writeRegisterFrame{events: events}, nil)
+	if err != nil {
+		return err
+	}
+
+	switch x := resp.(type) {
+	case *readyFrame:
+		return nil
+	case error:
+		return x
+	default:
+		return NewErrProtocol("unknown frame in response to REGISTER: %v", x)
+	}
+}
+
+func (c *Conn) executeBatch(batch *Batch) *Iter {
 	if c.version == protoVersion1 {
-		return ErrUnsupported
+		return &Iter{err: ErrUnsupported}
+	}
+	if (batch.keyspace != "" || batch.nowInSeconds) && c.version < protoVersion5 {
+		return &Iter{err: ErrUnsupported}
 	}
 
 	n := len(batch.Entries)
@@ -718,17 +1313,24 @@ func (c *Conn) executeBatch(batch *Batch) error {
 		consistency:       batch.Cons,
 		serialConsistency: batch.serialCons,
 		defaultTimestamp:  batch.defaultTimestamp,
+
+		defaultTimestampValue: batch.defaultTimestampValue,
+		customPayload:         batch.customPayload,
+		keyspace:              batch.keyspace,
+		nowInSeconds:          batch.nowInSeconds,
+		nowInSecondsValue:     batch.nowInSecondsValue,
 	}
 
 	stmts := make(map[string]string)
+	size := 0
 
 	for i := 0; i < n; i++ {
 		entry := &batch.Entries[i]
 		b := &req.statements[i]
 		if len(entry.Args) > 0 || entry.binding != nil {
-			info, err := c.prepareStatement(entry.Stmt, nil)
+			info, err := c.prepareStatement(batch.Context(), entry.Stmt, batch.keyspace, nil)
 			if err != nil {
-				return err
+				return &Iter{err: err}
 			}
 
 			var args []interface{}
@@ -742,12 +1344,12 @@ func (c *Conn) executeBatch(batch *Batch) error {
 				}
 				args, err = entry.binding(binding)
 				if err != nil {
-					return err
+					return &Iter{err: err}
 				}
 			}
 
 			if len(args) != len(info.reqMeta.columns) {
-				return ErrQueryArgLength
+				return &Iter{err: ErrQueryArgLength}
 			}
 
 			b.preparedID = info.preparedID
@@ -756,58 +1358,77 @@ func (c *Conn) executeBatch(batch *Batch) error {
 			b.values = make([]queryValues, len(info.reqMeta.columns))
 
 			for j := 0; j < len(info.reqMeta.columns); j++ {
-				val, err := Marshal(info.reqMeta.columns[j].TypeInfo, args[j])
-				if err != nil {
-					return err
-				}
-
-				b.values[j].value = val
 				// TODO: add names
+				if err := marshalQueryValue(info.reqMeta.columns[j].TypeInfo, args[j], &b.values[j]); err != nil {
+					return &Iter{err: err}
+				}
+				size += len(b.values[j].value)
 			}
 		} else {
 			b.statement = entry.Stmt
+			size += len(entry.Stmt)
 		}
 	}
 
+	batch.size = size
+	if batch.sizeLimit > 0 && size > batch.sizeLimit {
+		return &Iter{err: fmt.Errorf("%w: %d bytes, the limit is %d", ErrBatchTooLarge, size, batch.sizeLimit)}
+	}
+
 	// TODO: should batch support tracing?
-	resp, err := c.exec(req, nil)
+	resp, err := c.execWithOptions(batch.Context(), req, nil, execOptions{timeout: c.timeout, priority: batch.priority})
 	if err != nil {
-		return err
+		return &Iter{err: err}
 	}
 
 	switch x := resp.(type) {
 	case *resultVoidFrame:
-		return nil
+		return &Iter{warnings: x.warnings, customPayload: x.customPayload}
 	case *RequestErrUnprepared:
 		stmt, found := stmts[string(x.StatementId)]
 		if found {
 			stmtsLRU.Lock()
-			stmtsLRU.lru.Remove(c.addr + c.currentKeyspace + stmt)
+			stmtsLRU.lru.Remove(c.stmtCacheKey(stmt, batch.keyspace))
 			stmtsLRU.Unlock()
 		}
 		if found {
+			c.logger.Debug("gocql: statement unprepared by host, preparing it again", "host", c.addr, "statement", stmt)
 			return c.executeBatch(batch)
 		} else {
-			return x
+			return &Iter{err: x}
 		}
 	case error:
-		return x
+		return &Iter{err: x}
 	default:
-		return NewErrProtocol("Unknown type in response to batch statement: %s", x)
+		return &Iter{err: NewErrProtocol("Unknown type in response to batch statement: %s", x)}
 	}
 }
 
-func (c *Conn) setKeepalive(d time.Duration) error {
-	if tc, ok := c.conn.(*net.TCPConn); ok {
-		err := tc.SetKeepAlivePeriod(d)
-		if err != nil {
-			return err
-		}
+// setNoDelay sets TCP_NODELAY on conn, which disables Nagle's algorithm. It
+// does nothing on other connections than TCP.
+func setNoDelay(conn net.Conn, noDelay bool) error {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		return tc.SetNoDelay(noDelay)
+	}
+	return nil
+}
 
-		return tc.SetKeepAlive(true)
+// setKeepalive sets the TCP keepalive period of conn, a negative period
+// disables the keepalives. It does nothing on other connections than TCP.
+func setKeepalive(conn net.Conn, d time.Duration) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
 	}
 
-	return nil
+	if d < 0 {
+		return tc.SetKeepAlive(false)
+	}
+
+	if err := tc.SetKeepAlivePeriod(d); err != nil {
+		return err
+	}
+	return tc.SetKeepAlive(true)
 }
 
 type inflightPrepare struct {
@@ -821,4 +1442,5 @@ var (
 	ErrTimeoutNoResponse = errors.New("gocql: no response received from cassandra within timeout period")
 	ErrTooManyTimeouts   = errors.New("gocql: too many query timeouts on the connection")
 	ErrConnectionClosed  = errors.New("gocql: connection closed waiting for response")
+	ErrTooManyInFlight   = errors.New("gocql: too many requests in flight on the connection")
 )
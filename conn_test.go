@@ -6,12 +6,19 @@
 package gocql
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net"
+	"reflect"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -82,6 +89,1845 @@ func TestSSLSimpleNoClientCert(t *testing.T) {
 	}
 }
 
+func TestSSLRawConfig(t *testing.T) {
+	srv := NewSSLTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	config := &tls.Config{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.SslOpts = &SslOptions{
+		TLSConfig: config,
+		CaPath:    "testdata/pki/ca.crt",
+		CertPath:  "testdata/pki/gocql.crt",
+		KeyPath:   "testdata/pki/gocql.key",
+	}
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("0x%x: NewCluster: %v", defaultProto, err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatalf("0x%x: %v", defaultProto, err)
+	}
+
+	if config.RootCAs != nil || len(config.Certificates) > 0 || config.InsecureSkipVerify {
+		t.Fatal("the provided tls.Config must not be modified")
+	}
+}
+
+func TestSetupTLSConfigCopy(t *testing.T) {
+	pem, err := ioutil.ReadFile("testdata/pki/gocql.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		t.Fatal("failed to parse the certificate")
+	}
+	cert, err := tls.LoadX509KeyPair("testdata/pki/gocql.crt", "testdata/pki/gocql.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the spare capacity must not be written to by the appended certificate
+	certs := make([]tls.Certificate, 1, 2)
+	certs[0] = cert
+
+	for _, sslOpts := range []*SslOptions{
+		{TLSConfig: &tls.Config{RootCAs: pool, Certificates: certs}},
+		{Config: tls.Config{RootCAs: pool, Certificates: certs}},
+	} {
+		sslOpts.CaPath = "testdata/pki/ca.crt"
+		sslOpts.CertPath = "testdata/pki/gocql.crt"
+		sslOpts.KeyPath = "testdata/pki/gocql.key"
+
+		config, err := setupTLSConfig(sslOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.RootCAs == pool || len(config.Certificates) != 2 {
+			t.Fatalf("unexpected config: %+v", config)
+		}
+		if n := len(pool.Subjects()); n != 1 {
+			t.Errorf("expected the provided CertPool to be unchanged, it has %d certificates", n)
+		}
+		if certs[:2][1].Certificate != nil {
+			t.Error("expected the provided certificates to be unchanged")
+		}
+	}
+}
+
+// testHostAuthenticator records the handshake of each connection.
+type testHostAuthenticator struct {
+	mu    sync.Mutex
+	hosts []string
+	steps []string
+}
+
+func (a *testHostAuthenticator) ForHost(addr string) (Authenticator, error) {
+	a.mu.Lock()
+	a.hosts = append(a.hosts, addr)
+	a.mu.Unlock()
+	return &testHostAuthenticatorConn{parent: a}, nil
+}
+
+func (a *testHostAuthenticator) Challenge(req []byte) ([]byte, Authenticator, error) {
+	return nil, nil, errors.New("ForHost must be used")
+}
+
+func (a *testHostAuthenticator) Success(data []byte) error {
+	return errors.New("ForHost must be used")
+}
+
+func (a *testHostAuthenticator) record(step string) {
+	a.mu.Lock()
+	a.steps = append(a.steps, step)
+	a.mu.Unlock()
+}
+
+type testHostAuthenticatorConn struct {
+	parent *testHostAuthenticator
+}
+
+func (a *testHostAuthenticatorConn) Challenge(req []byte) ([]byte, Authenticator, error) {
+	a.parent.record("challenge " + string(req))
+	if string(req) == "challenge" {
+		return []byte("response"), a, nil
+	}
+	return []byte("initial"), a, nil
+}
+
+func (a *testHostAuthenticatorConn) Success(data []byte) error {
+	a.parent.record("success " + string(data))
+	return nil
+}
+
+func TestHostAuthenticator(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	srv.authenticator = "com.example.Authenticator"
+	defer srv.Stop()
+
+	auth := &testHostAuthenticator{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.Authenticator = auth
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("0x%x: NewCluster: %v", defaultProto, err)
+	}
+	defer db.Close()
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	if len(auth.hosts) == 0 || auth.hosts[0] != srv.Address {
+		t.Errorf("expected ForHost to be called with %q got %v", srv.Address, auth.hosts)
+	}
+	expected := []string{
+		"challenge com.example.Authenticator",
+		"challenge challenge",
+		"success done",
+	}
+	if len(auth.steps) < len(expected) {
+		t.Fatalf("expected handshake %v got %v", expected, auth.steps)
+	}
+	for i, step := range expected {
+		if auth.steps[i] != step {
+			t.Fatalf("expected handshake %v got %v", expected, auth.steps)
+		}
+	}
+}
+
+type unsupportedCompressor struct {
+	SnappyCompressor
+}
+
+func (unsupportedCompressor) Name() string {
+	return "unsupported"
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		server   Compressor
+		expected string
+	}{
+		{SnappyCompressor{}, "snappy"},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		srv := NewTestServer(t, defaultProto)
+		srv.compressor = test.server
+
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = int(defaultProto)
+		cluster.NumConns = 3
+		cluster.Compressor = unsupportedCompressor{}
+		cluster.Compressors = []Compressor{SnappyCompressor{}}
+		// compress every frame to check the negotiated compressor is used
+		cluster.CompressionThreshold = 0
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			srv.Stop()
+			t.Fatalf("server compressor %v: NewCluster: %v", test.server, err)
+		}
+
+		var name string
+		if compressor := db.Pool.Pick(nil).Compressor(); compressor != nil {
+			name = compressor.Name()
+		}
+		if name != test.expected {
+			t.Errorf("server compressor %v: expected compressor %q got %q", test.server, test.expected, name)
+		}
+
+		// the options are requested once for the connections of the host
+		if n := atomic.LoadUint64(&srv.noptions); n != 1 {
+			t.Errorf("server compressor %v: expected 1 OPTIONS request got %d", test.server, n)
+		}
+		if name := db.cfg.hostOptions.compressor(srv.Address); name != test.expected {
+			t.Errorf("server compressor %v: expected the compressor %q for the host got %q", test.server, test.expected, name)
+		}
+
+		if err := db.Query("void").Exec(); err != nil {
+			t.Errorf("server compressor %v: %v", test.server, err)
+		}
+
+		db.Close()
+		srv.Stop()
+	}
+}
+
+func TestLogger(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	var buf bytes.Buffer
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.Compressor = SnappyCompressor{}
+	cluster.Logger = NewStdLogger(log.New(&buf, "", 0))
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	db.Close()
+
+	expected := fmt.Sprintf("WARN gocql: host does not support any of the configured compressors host=%s supported=[]\n", srv.Address)
+	if got := buf.String(); got != expected {
+		t.Fatalf("expected log %q got %q", expected, got)
+	}
+}
+
+type testErrorHandler struct {
+	errs chan error
+}
+
+func (h *testErrorHandler) HandleError(conn *Conn, err error, closed bool) {
+	if closed {
+		h.errs <- err
+	}
+}
+
+type testDialer struct {
+	dialed []string
+}
+
+func (d *testDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dialed = append(d.dialed, addr)
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func TestDialer(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	dialer := &testDialer{}
+	cfg := ConnConfig{
+		ProtoVersion: int(defaultProto),
+		Timeout:      time.Second,
+		Dialer:       dialer,
+	}
+
+	conn, err := Connect(srv.Address, cfg, &testErrorHandler{errs: make(chan error, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if len(dialer.dialed) != 1 || dialer.dialed[0] != srv.Address {
+		t.Errorf("expected %s to be dialed with the dialer, got %v", srv.Address, dialer.dialed)
+	}
+}
+
+// redirectDialer dials addr whatever the address of the host is.
+type redirectDialer struct {
+	addr string
+}
+
+func (d redirectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, network, d.addr)
+}
+
+func TestDialServerName(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("testdata/pki/cassandra.crt", "testdata/pki/cassandra.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverNames := make(chan string, 1)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// the host is sent for SNI even when its certificate is not verified
+	cfg := ConnConfig{
+		Dialer:    redirectDialer{addr: ln.Addr().String()},
+		tlsConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx, "db.example.com:9042", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if name := <-serverNames; name != "db.example.com" {
+		t.Errorf("expected the server name db.example.com got %q", name)
+	}
+	if cfg.tlsConfig.ServerName != "" {
+		t.Error("the TLS config of the connections must not be modified")
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// the host accepts the connection but never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := ConnConfig{
+		ProtoVersion:   int(defaultProto),
+		Timeout:        5 * time.Second,
+		ConnectTimeout: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err = Connect(ln.Addr().String(), cfg, &testErrorHandler{errs: make(chan error, 1)})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("expected the handshake to time out after the connect timeout, it took %v", d)
+	}
+}
+
+func TestDialerKeepalive(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	for _, keepalive := range []time.Duration{-1, 30 * time.Second} {
+		var buf bytes.Buffer
+		cfg := ConnConfig{
+			ProtoVersion: int(defaultProto),
+			Timeout:      time.Second,
+			Dialer:       &testDialer{},
+			Keepalive:    keepalive,
+			Logger:       NewStdLogger(log.New(&buf, "", 0)),
+		}
+
+		conn, err := Connect(srv.Address, cfg, &testErrorHandler{errs: make(chan error, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		if buf.Len() > 0 {
+			t.Errorf("unexpected log setting the keepalive to %v: %s", keepalive, buf.String())
+		}
+	}
+
+	// the keepalive is only set on TCP connections
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if err := setKeepalive(client, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialDualStack(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	_, port, err := net.SplitHostPort(srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// localhost may resolve to ::1 on which the server does not listen
+	cfg := ConnConfig{
+		ProtoVersion:  int(defaultProto),
+		Timeout:       time.Second,
+		FallbackDelay: 10 * time.Millisecond,
+	}
+
+	conn, err := Connect(net.JoinHostPort("localhost", port), cfg, &testErrorHandler{errs: make(chan error, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestHeartbeat(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	cfg := ConnConfig{
+		ProtoVersion:      int(defaultProto),
+		Timeout:           50 * time.Millisecond,
+		HeartbeatInterval: 20 * time.Millisecond,
+	}
+	handler := &testErrorHandler{errs: make(chan error, 1)}
+
+	conn, err := Connect(srv.Address, cfg, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the heartbeats keep the idle connection open
+	time.Sleep(100 * time.Millisecond)
+	if conn.Closed() {
+		t.Fatal("expected the connection to be open")
+	}
+
+	atomic.StoreInt32(&srv.ignoreOptions, 1)
+
+	select {
+	case err := <-handler.errs:
+		if err != ErrTimeoutNoResponse {
+			t.Errorf("expected %v got %v", ErrTimeoutNoResponse, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to be closed when the heartbeat is not answered")
+	}
+
+	if !conn.Closed() {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	tests := []struct {
+		queued  int
+		wait    time.Duration
+		wantErr error
+	}{
+		{0, 0, ErrTooManyInFlight},
+		{1, 500 * time.Millisecond, nil},
+		{1, 10 * time.Millisecond, ErrTooManyInFlight},
+	}
+
+	for i, test := range tests {
+		cluster := NewCluster(srv.Address)
+		cluster.NumConns = 1
+		cluster.MaxInFlightPerConn = 1
+		cluster.MaxQueuedPerConn = test.queued
+		cluster.MaxQueueWait = test.wait
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatalf("%d: NewCluster: %v", i, err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- db.Query("slow").Exec()
+		}()
+
+		// wait for the slow query to be sent
+		time.Sleep(10 * time.Millisecond)
+
+		if err := db.Query("void").Exec(); err != test.wantErr {
+			t.Errorf("%d: expected %v got %v", i, test.wantErr, err)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("%d: slow query: %v", i, err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestQueryPriority(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	cluster := NewCluster(srv.Address)
+	cluster.NumConns = 1
+	cluster.MaxInFlightPerConn = 1
+	cluster.MaxQueuedPerConn = 1
+	cluster.MaxQueueWait = time.Second
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	slow := make(chan error, 1)
+	go func() {
+		slow <- db.Query("slow").Exec()
+	}()
+	// wait for the slow query to be sent
+	time.Sleep(10 * time.Millisecond)
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- db.Query("void").Priority(PriorityBatch).Exec()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the interactive query takes the place of the queued batch one
+	if err := db.Query("void").Priority(PriorityInteractive).Exec(); err != nil {
+		t.Errorf("interactive query: %v", err)
+	}
+	if err := <-queued; err != ErrTooManyInFlight {
+		t.Errorf("expected the batch query to fail with %v got %v", ErrTooManyInFlight, err)
+	}
+	if err := <-slow; err != nil {
+		t.Errorf("slow query: %v", err)
+	}
+}
+
+type testQueryObserver struct {
+	mu      sync.Mutex
+	queries []ObservedQuery
+}
+
+func (o *testQueryObserver) ObserveQuery(q ObservedQuery) {
+	o.mu.Lock()
+	o.queries = append(o.queries, q)
+	o.mu.Unlock()
+}
+
+func TestQueryObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	observer := &testQueryObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.QueryObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("kill").Exec(); err == nil {
+		t.Fatal("expected the query to be killed")
+	}
+
+	override := &testQueryObserver{}
+	if err := db.Query("void").Observer(override).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(observer.queries) != 2 {
+		t.Fatalf("expected 2 observed queries got %d", len(observer.queries))
+	}
+	for i, stmt := range []string{"void", "kill"} {
+		q := observer.queries[i]
+		if q.Statement != stmt || q.Host != srv.Address || q.Attempt != 1 {
+			t.Errorf("expected query %q to %s on the first attempt, got %+v", stmt, srv.Address, q)
+		}
+		if q.End.Before(q.Start) {
+			t.Errorf("query %q ended at %v before it started at %v", stmt, q.End, q.Start)
+		}
+	}
+	if observer.queries[0].Err != nil {
+		t.Errorf("expected no error got %v", observer.queries[0].Err)
+	}
+	if observer.queries[1].Err == nil {
+		t.Error("expected the error of the killed query")
+	}
+
+	if len(override.queries) != 1 {
+		t.Fatalf("expected the query observer to be overridden, got %d observed queries", len(override.queries))
+	}
+}
+
+type testBatchObserver struct {
+	mu      sync.Mutex
+	batches []ObservedBatch
+}
+
+func (o *testBatchObserver) ObserveBatch(b ObservedBatch) {
+	o.mu.Lock()
+	o.batches = append(o.batches, b)
+	o.mu.Unlock()
+}
+
+func TestBatchObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	observer := &testBatchObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.BatchObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	batch := db.NewBatch(LoggedBatch)
+	batch.Query("void")
+	batch.Query("void")
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(observer.batches) != 1 {
+		t.Fatalf("expected 1 observed batch got %d", len(observer.batches))
+	}
+	b := observer.batches[0]
+	if b.Statements != 2 || b.Host != srv.Address || b.Attempt != 1 || b.Err != nil {
+		t.Errorf("expected a successful batch of 2 statements to %s on the first attempt, got %+v", srv.Address, b)
+	}
+
+	override := &testBatchObserver{}
+	batch = db.NewBatch(LoggedBatch).Observer(override)
+	batch.Query("void")
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(observer.batches) != 1 || len(override.batches) != 1 {
+		t.Fatalf("expected the batch observer to be overridden, got %d and %d observed batches", len(observer.batches), len(override.batches))
+	}
+}
+
+func TestExecuteChunked(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	observer := &testBatchObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.BatchObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	entries := make([]BatchEntry, 7)
+	for i := range entries {
+		entries[i] = BatchEntry{Stmt: "void"}
+	}
+	entries[4].Stmt = "kill"
+
+	// 2 statements of 4 bytes per batch
+	err = db.ExecuteChunked(context.Background(), entries, ChunkOptions{MaxStatements: 3, MaxSize: 10, Concurrency: 2})
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected a *ChunkError got %v", err)
+	}
+	if chunkErr.Batches != 4 || len(chunkErr.Failures) != 1 || !reflect.DeepEqual(chunkErr.Failures[0].Entries, []int{4, 5}) {
+		t.Errorf("expected the batch of the statements 4 and 5 to fail got %+v", chunkErr)
+	}
+	if !errors.Is(err, ErrCodeOverloaded) {
+		t.Errorf("expected the error of the failed batch got %v", err)
+	}
+
+	observer.mu.Lock()
+	statements := 0
+	for _, b := range observer.batches {
+		statements += b.Statements
+	}
+	observer.mu.Unlock()
+	if len(observer.batches) != 4 || statements != 7 {
+		t.Errorf("expected 7 statements in 4 batches got %d batches of %d statements", len(observer.batches), statements)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.ExecuteChunked(ctx, entries[:3], ChunkOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+}
+
+func TestBatchSizeThresholds(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	var buf bytes.Buffer
+	observer := &testBatchObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.BatchObserver = observer
+	cluster.Logger = NewStdLogger(log.New(&buf, "", 0))
+	cluster.BatchSizeWarnThreshold = 6
+	cluster.BatchSizeFailThreshold = 10
+	cluster.BatchStatementsWarnThreshold = 1
+	cluster.BatchStatementsFailThreshold = 3
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	newBatch := func(n int) *Batch {
+		batch := db.NewBatch(UnloggedBatch)
+		for i := 0; i < n; i++ {
+			batch.Query("void")
+		}
+		return batch
+	}
+
+	if err := db.ExecuteBatch(newBatch(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(observer.batches) != 1 || observer.batches[0].Size != 8 {
+		t.Fatalf("expected a batch of 8 bytes to be observed got %+v", observer.batches)
+	}
+
+	expected := "WARN gocql: batch with too many statements statements=2 threshold=1\n" +
+		"WARN gocql: large batch size=8 threshold=6 statements=2\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("expected log %q got %q", expected, got)
+	}
+
+	// 12 bytes
+	if err := db.ExecuteBatch(newBatch(3)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected %v got %v", ErrBatchTooLarge, err)
+	}
+	if err := db.ExecuteBatch(newBatch(4)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected %v got %v", ErrBatchTooLarge, err)
+	}
+	if len(observer.batches) != 2 {
+		t.Errorf("expected the batch over the statements threshold not to be sent got %d observed batches", len(observer.batches))
+	}
+}
+
+func TestConsistencyLadder(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	observer := &testQueryObserver{}
+	qry := db.Query("unavailable").ConsistencyLadder(Quorum, LocalQuorum, One).Observer(observer)
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if qry.GetConsistency() != One {
+		t.Errorf("expected the query to be executed at %v got %v", One, qry.GetConsistency())
+	}
+
+	var levels []Consistency
+	for _, q := range observer.queries {
+		levels = append(levels, q.Consistency)
+	}
+	if expected := []Consistency{Quorum, LocalQuorum, One}; !reflect.DeepEqual(levels, expected) {
+		t.Errorf("expected the executions at %v got %v", expected, levels)
+	}
+
+	// every execution starts at the first level
+	observer.queries = nil
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if len(observer.queries) != 3 || observer.queries[0].Consistency != Quorum {
+		t.Errorf("expected the execution to start at %v got %+v", Quorum, observer.queries)
+	}
+
+	var unavailable *RequestErrUnavailable
+	err = db.Query("unavailable").ConsistencyLadder(Quorum, LocalQuorum).Exec()
+	if !errors.As(err, &unavailable) || unavailable.Consistency != LocalQuorum {
+		t.Errorf("expected the last level to be unavailable got %v", err)
+	}
+}
+
+func TestSpeculativeExecution(t *testing.T) {
+	srv1 := NewTestServer(t, defaultProto)
+	defer srv1.Stop()
+	srv2 := NewTestServer(t, defaultProto)
+	defer srv2.Stop()
+
+	cluster := NewCluster(srv1.Address, srv2.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := db.Query("void").Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := func() uint64 {
+		return atomic.LoadUint64(&srv1.nreq) + atomic.LoadUint64(&srv2.nreq)
+	}
+
+	// too few recent responses, the fallback delay is above the latency of
+	// the query
+	policy := &PercentileSpeculativeExecution{
+		NumAttempts: 1,
+		Percentile:  0.99,
+		MinSamples:  1000,
+		Fallback:    time.Second,
+	}
+	nreq := requests()
+	if err := db.Query("slow").SpeculativeExecutionPolicy(policy).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests() - nreq; n != 1 {
+		t.Errorf("expected the query to be executed once got %d executions", n)
+	}
+
+	// without fallback the hosts with too few recent responses are not
+	// sent speculative executions
+	policy.Fallback = 0
+	nreq = requests()
+	if err := db.Query("slow").SpeculativeExecutionPolicy(policy).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests() - nreq; n != 1 {
+		t.Errorf("expected the query to be executed once without fallback got %d executions", n)
+	}
+
+	// the slow query is well above the median of the void queries, the
+	// slow queries above are also recent responses
+	policy.Percentile = 0.5
+	policy.MinSamples = 5
+	nreq = requests()
+	qry := db.Query("slow").SpeculativeExecutionPolicy(policy)
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests() - nreq; n != 2 {
+		t.Errorf("expected the query to be executed on both hosts got %d executions", n)
+	}
+	if qry.Attempts() != 1 {
+		t.Errorf("expected the speculative execution not to count as an attempt got %d attempts", qry.Attempts())
+	}
+
+	// the losing execution is still pending, it is waited for
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.CloseWithContext(ctx); err != nil {
+		t.Errorf("expected the pending execution to complete got %v", err)
+	}
+}
+
+func TestInvalidConsistency(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	nreq := atomic.LoadUint64(&srv.nreq)
+	if err := db.Query("SELECT * FROM t").Consistency(Any).Exec(); !errors.Is(err, ErrInvalidConsistency) {
+		t.Errorf("expected %v got %v", ErrInvalidConsistency, err)
+	}
+	if err := db.ExecuteBatch(db.NewBatch(LoggedBatch).Consistency(Consistency(Serial))); !errors.Is(err, ErrInvalidConsistency) {
+		t.Errorf("expected %v got %v", ErrInvalidConsistency, err)
+	}
+	if n := atomic.LoadUint64(&srv.nreq); n != nreq {
+		t.Errorf("expected the invalid requests not to be sent got %d requests", n-nreq)
+	}
+
+	if err := db.Query("void").Consistency(Any).Exec(); err != nil {
+		t.Errorf("expected ANY to be valid for writes got %v", err)
+	}
+	batch := db.NewBatch(LoggedBatch).Consistency(Any)
+	batch.Query("void")
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Errorf("expected ANY to be valid for batches got %v", err)
+	}
+}
+
+type testConnectObserver struct {
+	mu       sync.Mutex
+	connects []ObservedConnect
+}
+
+func (o *testConnectObserver) ObserveConnect(c ObservedConnect) {
+	o.mu.Lock()
+	o.connects = append(o.connects, c)
+	o.mu.Unlock()
+}
+
+func TestConnectObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	observer := &testConnectObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.ConnectObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	db.Close()
+
+	observer.mu.Lock()
+	if len(observer.connects) == 0 {
+		observer.mu.Unlock()
+		t.Fatal("expected the connection to be observed")
+	}
+	c := observer.connects[0]
+	observer.mu.Unlock()
+	if c.Host != srv.Address || c.Err != nil || c.End.Before(c.Start) {
+		t.Errorf("expected a successful connection to %s, got %+v", srv.Address, c)
+	}
+
+	// failed attempts are observed as well
+	srv.authenticator = "com.example.Authenticator"
+	if _, err := cluster.CreateSession(); err == nil {
+		t.Fatal("expected the connection to fail without an authenticator")
+	}
+
+	observer.mu.Lock()
+	c = observer.connects[len(observer.connects)-1]
+	observer.mu.Unlock()
+	if c.Err == nil {
+		t.Errorf("expected the failed connection to be observed, got %+v", c)
+	}
+}
+
+type testFrameHeaderObserver struct {
+	mu      sync.Mutex
+	headers []ObservedFrameHeader
+}
+
+func (o *testFrameHeaderObserver) ObserveFrameHeader(h ObservedFrameHeader) {
+	o.mu.Lock()
+	o.headers = append(o.headers, h)
+	o.mu.Unlock()
+}
+
+func TestFrameHeaderObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	observer := &testFrameHeaderObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.FrameHeaderObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+
+	if len(observer.headers) != 3 {
+		t.Fatalf("expected 3 frames got %v", observer.headers)
+	}
+	for i, op := range []frameOp{opSupported, opReady, opResult} {
+		h := observer.headers[i]
+		if h.Opcode != op || !h.Version.response() || h.Stream <= 0 || h.Host != srv.Address {
+			t.Errorf("expected a %s response from %s, got %v", op, srv.Address, h)
+		}
+	}
+	if h := observer.headers[2]; h.Length != 4 {
+		t.Errorf("expected a void result of length 4, got %v", h)
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	for _, poolType := range []NewPoolFunc{NewSimplePool, NewRoundRobinConnPool} {
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = int(defaultProto)
+		cluster.NumConns = 1
+		cluster.NumStreams = 16
+		cluster.ConnPoolType = poolType
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatalf("NewCluster: %v", err)
+		}
+
+		inUse, total := db.Pool.(StreamUsage).StreamUsage()
+		if inUse != 0 || total != 16 {
+			t.Errorf("expected 0 of 16 streams in use got %d of %d", inUse, total)
+		}
+		db.Close()
+	}
+}
+
+func TestProtocolV5(t *testing.T) {
+	srv := NewTestServer(t, protoVersion5)
+	defer srv.Stop()
+
+	// the large values are split in several segments
+	large := bytes.Repeat([]byte{'a'}, 3*maxSegmentPayload)
+	srv.queryRows = func(query string) *testRows {
+		if !strings.HasPrefix(query, "SELECT") {
+			return nil
+		}
+		return &testRows{
+			columns: []string{"value"},
+			types:   []Type{TypeBlob},
+			rows:    [][][]byte{{large}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Keyspace("ks").WithNowInSeconds(1600000000).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("void " + string(large)).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	var value []byte
+	if err := db.Query("SELECT value FROM t").Keyspace("ks").Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, large) {
+		t.Errorf("expected a value of %d bytes got %d", len(large), len(value))
+	}
+}
+
+func TestBorrowBytes(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key", "value"},
+			types:   []Type{TypeVarchar, TypeBlob},
+			rows:    [][][]byte{{[]byte("a"), []byte("1")}, {[]byte("b"), []byte("2")}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// aliases reports whether p points into buf
+	aliases := func(buf, p []byte) bool {
+		buf = buf[:cap(buf)]
+		for i := range buf {
+			if &buf[i] == &p[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	iter := db.Query("SELECT key, value FROM t").BorrowBytes(true).Iter()
+	var key, value []byte
+	for _, expected := range []string{"a1", "b2"} {
+		if !iter.Scan(&key, &value) {
+			t.Fatal(iter.Close())
+		}
+		if got := string(key) + string(value); got != expected {
+			t.Errorf("expected %q got %q", expected, got)
+		}
+		if !aliases(iter.borrowed, key) || !aliases(iter.borrowed, value) {
+			t.Error("expected the values to alias the buffer of the response")
+		}
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if iter.borrowed != nil || iter.Scan(&key, &value) {
+		t.Error("expected the buffer to be released by Close")
+	}
+
+	// the values are copied by default
+	iter = db.Query("SELECT key, value FROM t").Iter()
+	if !iter.Scan(&key, &value) {
+		t.Fatal(iter.Close())
+	}
+	if iter.borrowed != nil {
+		t.Error("expected the values to be copied")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "a" || string(value) != "1" {
+		t.Errorf("expected the copied values to outlive the iterator, got %q and %q", key, value)
+	}
+
+	// Query.Scan closes the iterator, it copies the values
+	qry := db.Query("SELECT key, value FROM t").BorrowBytes(true)
+	if err := qry.Scan(&key, &value); err != nil {
+		t.Fatal(err)
+	}
+	iter = db.Query("SELECT key, value FROM t").BorrowBytes(true).Iter()
+	if aliases(iter.borrowed, key) || aliases(iter.borrowed, value) {
+		t.Error("expected the values scanned by Query.Scan to be copied")
+	}
+	iter.Close()
+	if string(key) != "a" || string(value) != "1" {
+		t.Errorf("expected the scanned values to outlive the query, got %q and %q", key, value)
+	}
+	if !qry.borrowBytes {
+		t.Error("expected Query.Scan to keep the borrowing of the query")
+	}
+
+	// as does Query.StructScan
+	var row struct {
+		Key   []byte
+		Value []byte
+	}
+	if err := db.Query("SELECT key, value FROM t").BorrowBytes(true).StructScan(&row); err != nil {
+		t.Fatal(err)
+	}
+	iter = db.Query("SELECT key, value FROM t").BorrowBytes(true).Iter()
+	if aliases(iter.borrowed, row.Key) || aliases(iter.borrowed, row.Value) {
+		t.Error("expected the values scanned by Query.StructScan to be copied")
+	}
+	iter.Close()
+	if string(row.Key) != "a" || string(row.Value) != "1" {
+		t.Errorf("expected the scanned values to outlive the query, got %q and %q", row.Key, row.Value)
+	}
+}
+
+// testRow is a RowDecoder as generated by gocqlgen.
+type testRow struct {
+	Key   string
+	Value int
+}
+
+func (x *testRow) DecodeRow(columns []ColumnInfo, row [][]byte) error {
+	for i, col := range columns {
+		var err error
+		switch col.Name {
+		case "key":
+			err = Unmarshal(col.TypeInfo, row[i], &x.Key)
+		case "value":
+			err = Unmarshal(col.TypeInfo, row[i], &x.Value)
+		default:
+			return fmt.Errorf("gocql: no field of testRow for column %q", col.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRowDecoder(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key", "value"},
+			types:   []Type{TypeVarchar, TypeInt},
+			rows:    [][][]byte{{[]byte("a"), {0, 0, 0, 1}}, {[]byte("b"), {0, 0, 0, 2}}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	iter := db.Query("SELECT key, value FROM t").Iter()
+	var rows []testRow
+	for {
+		var row testRow
+		if !iter.Scan(&row) {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []testRow{{"a", 1}, {"b", 2}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v got %v", expected, rows)
+	}
+}
+
+func TestIterRows(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key", "value"},
+			types:   []Type{TypeVarchar, TypeInt},
+			rows:    [][][]byte{{[]byte("a"), {0, 0, 0, 1}}, {[]byte("b"), {0, 0, 0, 2}}, {[]byte("c"), {0, 0, 0, 3}}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var keys []interface{}
+	for row := range db.Query("SELECT key, value FROM t").Iter().Rows(context.Background()) {
+		if row.Err != nil {
+			t.Fatal(row.Err)
+		}
+		keys = append(keys, row.Values["key"])
+	}
+	if expected := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v got %v", expected, keys)
+	}
+
+	var rows []Row
+	for row := range db.Query("kill").Iter().Rows(context.Background()) {
+		rows = append(rows, row)
+	}
+	if len(rows) != 1 || !errors.Is(rows[0].Err, ErrCodeOverloaded) {
+		t.Errorf("expected the error of the query got %+v", rows)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := db.Query("SELECT key, value FROM t").Iter().Rows(ctx)
+	<-ch
+	cancel()
+	for row := range ch {
+		if row.Err != nil {
+			t.Errorf("expected no error after the cancellation got %v", row.Err)
+		}
+	}
+}
+
+func TestExecuteAsync(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	futures := make([]*Future, 10)
+	start := time.Now()
+	for i := range futures {
+		futures[i] = db.ExecuteAsync(db.Query("slow"))
+	}
+	for _, f := range futures {
+		if err := f.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the slow queries take 50ms each
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("expected the queries to run concurrently, they took %v", elapsed)
+	}
+
+	f := db.ExecuteAsync(db.Query("kill"))
+	if err := f.Result().Close(); !errors.Is(err, ErrCodeOverloaded) {
+		t.Errorf("expected %v got %v", ErrCodeOverloaded, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	f = db.ExecuteAsync(db.Query("slow"))
+	if err := f.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+	<-f.Done()
+	if err := f.Result().Close(); err != nil {
+		t.Errorf("expected the query to complete got %v", err)
+	}
+}
+
+// testUser is a struct scanned by reflection, unlike testRow.
+type testUser struct {
+	Key   string
+	Value int
+}
+
+func TestQueryForEach(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key", "value"},
+			types:   []Type{TypeVarchar, TypeInt},
+			rows:    [][][]byte{{[]byte("a"), {0, 0, 0, 1}}, {[]byte("b"), {0, 0, 0, 2}}, {[]byte("c"), {0, 0, 0, 3}}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		keys   []string
+		values []int
+		users  []testUser
+	)
+	err = db.Query("SELECT key, value FROM t").ForEach(context.Background(), func(row RowView) error {
+		var (
+			key   string
+			value int
+			user  testUser
+		)
+		if err := row.Scan(&key, &value); err != nil {
+			return err
+		}
+		if err := row.StructScan(&user); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) || !reflect.DeepEqual(values, []int{1, 2, 3}) {
+		t.Errorf("unexpected rows %v %v", keys, values)
+	}
+	if expected := []testUser{{"a", 1}, {"b", 2}, {"c", 3}}; !reflect.DeepEqual(users, expected) {
+		t.Errorf("expected %v got %v", expected, users)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = db.Query("SELECT key, value FROM t").ForEach(context.Background(), func(row RowView) error {
+		n++
+		m := make(map[string]interface{})
+		if err := row.MapScan(m); err != nil {
+			return err
+		}
+		if m["key"] != "b" {
+			return nil
+		}
+		return stop
+	})
+	if err != stop || n != 2 {
+		t.Errorf("expected the iteration to stop at the second row with %v got %v after %d rows", stop, err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = db.Query("SELECT key, value FROM t").ForEach(ctx, func(row RowView) error {
+		n++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || n != 1 {
+		t.Errorf("expected %v after 1 row got %v after %d rows", context.Canceled, err, n)
+	}
+
+	if err := db.Query("kill").ForEach(context.Background(), func(RowView) error { return nil }); !errors.Is(err, ErrCodeOverloaded) {
+		t.Errorf("expected %v got %v", ErrCodeOverloaded, err)
+	}
+}
+
+func TestWarmupPool(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	const stmt = "SELECT key FROM warm WHERE key = ?"
+	for _, poolType := range []NewPoolFunc{NewSimplePool, NewRoundRobinConnPool} {
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = protoVersion4
+		cluster.NumConns = 3
+		cluster.ConnPoolType = poolType
+		cluster.WarmupPool = true
+		cluster.WarmupStatements = []string{stmt}
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size := db.Pool.Size(); size != 3 {
+			t.Errorf("expected 3 connections when the session is returned got %d", size)
+		}
+
+		conn := db.Pool.Pick(nil)
+		stmtsLRU.Lock()
+		_, ok := stmtsLRU.lru.Get(conn.stmtCacheKey(stmt, ""))
+		stmtsLRU.Unlock()
+		if !ok {
+			t.Errorf("expected %q to be prepared when the session is returned", stmt)
+		}
+
+		db.Close()
+	}
+}
+
+func TestLazyConnect(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	for _, poolType := range []NewPoolFunc{NewSimplePool, NewRoundRobinConnPool} {
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = protoVersion4
+		cluster.ConnPoolType = poolType
+		cluster.LazyConnect = true
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size := db.Pool.Size(); size != 0 {
+			t.Errorf("expected no connection before the first query got %d", size)
+		}
+
+		// the concurrent first queries wait for the first connection
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- db.Query("void").Exec()
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("first query: %v", err)
+			}
+		}
+		if size := db.Pool.Size(); size == 0 {
+			t.Error("expected the first query to open a connection")
+		}
+
+		db.Close()
+	}
+
+	// the control connection checks that the cluster can be reached
+	cluster := NewCluster("127.0.0.1:1")
+	cluster.ProtoVersion = protoVersion4
+	cluster.ConnectTimeout = 100 * time.Millisecond
+	cluster.LazyConnect = true
+	if db, err := cluster.CreateSession(); err == nil {
+		db.Close()
+		t.Error("expected the session creation to fail")
+	}
+}
+
+func TestCloseWithContext(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	// waitInFlight starts query and waits for it to be sent
+	waitInFlight := func(db *Session, query string) <-chan error {
+		errs := make(chan error, 1)
+		go func() {
+			errs <- db.Query(query).Exec()
+		}()
+		for {
+			if inUse, _ := db.Pool.(StreamUsage).StreamUsage(); inUse > 0 {
+				return errs
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := waitInFlight(db, "slow")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.CloseWithContext(ctx); err != nil {
+		t.Fatalf("expected the in-flight query to be waited for got %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("expected the in-flight query to complete got %v", err)
+	}
+	if err := db.Query("void").Exec(); err != ErrSessionClosed {
+		t.Errorf("expected %v got %v", ErrSessionClosed, err)
+	}
+
+	db, err = newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs = waitInFlight(db, "timeout")
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.CloseWithContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+	if err := <-errs; err == nil {
+		t.Error("expected the in-flight query to be aborted")
+	}
+}
+
+func TestSessionInterface(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key"},
+			types:   []Type{TypeVarchar},
+			rows:    [][][]byte{{[]byte("a")}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var s SessionInterface = NewSessionInterface(db)
+	if values := s.Query("SELECT key FROM t WHERE key = ?").Bind("a").Values(); !reflect.DeepEqual(values, []interface{}{"a"}) {
+		t.Errorf("expected the bound values got %v", values)
+	}
+
+	q := s.Query("SELECT key FROM t").Consistency(One)
+	if q.Statement() != "SELECT key FROM t" {
+		t.Errorf("unexpected statement %q", q.Statement())
+	}
+
+	var key string
+	if err := q.Scan(&key); err != nil {
+		t.Fatal(err)
+	}
+	if key != "a" {
+		t.Errorf("expected a got %q", key)
+	}
+}
+
+func TestCustomPayload(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	payload := map[string][]byte{"k": []byte("v")}
+	iter := db.Query("payload").CustomPayload(payload).Iter()
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := iter.GetCustomPayload(); !reflect.DeepEqual(got, payload) {
+		t.Errorf("expected the custom payload %v got %v", payload, got)
+	}
+
+	iter = db.Query("void").Iter()
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := iter.GetCustomPayload(); got != nil {
+		t.Errorf("expected no custom payload got %v", got)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	observer := &testQueryObserver{}
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(protoVersion4)
+	cluster.NumConns = 1
+	cluster.QueryObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	expected := []string{"test warning"}
+	iter := db.Query("warning").Iter()
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := iter.Warnings(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the warnings %v got %v", expected, got)
+	}
+
+	if len(observer.queries) != 1 {
+		t.Fatalf("expected 1 observed query got %d", len(observer.queries))
+	}
+	if got := observer.queries[0].Warnings; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the observed warnings %v got %v", expected, got)
+	}
+}
+
+func TestQueryV5OptionsUnsupported(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Keyspace("ks").Exec(); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported got %v", err)
+	}
+	if err := db.Query("void").WithNowInSeconds(1600000000).Exec(); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported got %v", err)
+	}
+}
+
+// poolConns returns the connections of a SimplePool or of a policyConnPool.
+func poolConns(pool ConnectionPool) []*Conn {
+	var conns []*Conn
+	switch p := pool.(type) {
+	case *SimplePool:
+		p.mu.Lock()
+		for conn := range p.conns {
+			conns = append(conns, conn)
+		}
+		p.mu.Unlock()
+	case *policyConnPool:
+		p.mu.RLock()
+		for _, hostPool := range p.hostConnPools {
+			hostPool.mu.RLock()
+			conns = append(conns, hostPool.conns...)
+			hostPool.mu.RUnlock()
+		}
+		p.mu.RUnlock()
+	}
+	return conns
+}
+
+func TestSetKeyspace(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	for _, poolType := range []NewPoolFunc{NewSimplePool, NewRoundRobinConnPool} {
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = int(defaultProto)
+		cluster.NumConns = 2
+		cluster.Keyspace = "ks1"
+		cluster.ConnPoolType = poolType
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatalf("NewCluster: %v", err)
+		}
+		// let the pool fill
+		time.Sleep(50 * time.Millisecond)
+
+		conns := poolConns(db.Pool)
+		if len(conns) != 2 {
+			t.Fatalf("expected 2 connections got %d", len(conns))
+		}
+		for _, conn := range conns {
+			if ks := conn.keyspace(); ks != "ks1" {
+				t.Errorf("expected the keyspace ks1 got %q", ks)
+			}
+		}
+
+		if err := db.SetKeyspace("ks2"); err != nil {
+			t.Fatal(err)
+		}
+		for _, conn := range poolConns(db.Pool) {
+			if ks := conn.keyspace(); ks != "ks2" {
+				t.Errorf("expected the keyspace ks2 got %q", ks)
+			}
+		}
+
+		if err := db.Query("USE ks3").Exec(); err != ErrUseStmt {
+			t.Errorf("expected ErrUseStmt got %v", err)
+		}
+		db.Close()
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.ExpvarName = "gocql_test_session"
+	cluster.RetryPolicy = &SimpleRetryPolicy{NumRetries: 2}
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("kill").Exec(); err == nil {
+		t.Fatal("expected the query to be killed")
+	}
+
+	stats := db.Stats()
+	if stats.OpenConnections != 1 || stats.InFlight != 0 || stats.Retries != 2 {
+		t.Errorf("expected 1 connection, no requests in flight and 2 retries, got %+v", stats)
+	}
+	if stats.BytesIn == 0 || stats.BytesOut == 0 {
+		t.Errorf("expected bytes to be read and written, got %+v", stats)
+	}
+
+	v := expvar.Get("gocql_test_session")
+	if v == nil {
+		t.Fatal("expected the stats to be published")
+	}
+	var published SessionStats
+	if err := json.Unmarshal([]byte(v.String()), &published); err != nil {
+		t.Fatal(err)
+	} else if published.Retries != 2 {
+		t.Errorf("expected the published stats to be %+v, got %+v", stats, published)
+	}
+}
+
+func TestPoolSnapshot(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	for _, poolType := range []NewPoolFunc{NewSimplePool, NewRoundRobinConnPool} {
+		cluster := NewCluster(srv.Address)
+		cluster.ProtoVersion = protoVersion4
+		cluster.NumConns = 1
+		cluster.ConnPoolType = poolType
+
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			if err := db.Query("kill").Exec(); err == nil {
+				t.Fatal("expected the query to be killed")
+			}
+		}
+
+		snapshot := db.PoolSnapshot()
+		stats, ok := snapshot[srv.Address]
+		if !ok || len(snapshot) != 1 {
+			t.Fatalf("expected the stats of %s got %+v", srv.Address, snapshot)
+		}
+		if stats.OpenConnections != 1 || stats.Streams != 32767 || stats.InFlight != 0 || stats.StreamUtilization != 0 {
+			t.Errorf("expected 1 idle connection got %+v", stats)
+		}
+		if stats.ConsecutiveErrors != 2 || stats.LastError.Before(start) {
+			t.Errorf("expected 2 errors since %v got %+v", start, stats)
+		}
+
+		if err := db.Query("void").Exec(); err != nil {
+			t.Fatal(err)
+		}
+		if stats := db.PoolSnapshot()[srv.Address]; stats.ConsecutiveErrors != 0 || stats.LastError.IsZero() {
+			t.Errorf("expected the errors to be reset and the last error kept got %+v", stats)
+		}
+
+		db.Close()
+	}
+}
+
 func createTestSslCluster(hosts string, proto uint8, useClientCert bool) *ClusterConfig {
 	cluster := NewCluster(hosts)
 	sslOpts := &SslOptions{
@@ -125,6 +1971,62 @@ func newTestSession(addr string, proto uint8) (*Session, error) {
 	return cluster.CreateSession()
 }
 
+// newIncompleteTraceServer returns a server whose traces are never complete.
+func newIncompleteTraceServer(t *testing.T) *TestServer {
+	srv := NewTestServer(t, defaultProto)
+	srv.queryRows = func(query string) *testRows {
+		switch {
+		case strings.Contains(query, "system_traces.sessions"):
+			return &testRows{
+				columns: []string{"coordinator", "duration"},
+				types:   []Type{TypeInet, TypeInt},
+				rows:    [][][]byte{{[]byte{127, 0, 0, 1}, encInt(0)}},
+			}
+		case strings.Contains(query, "system_traces.events"):
+			return &testRows{
+				columns: []string{"event_id", "activity", "source", "source_elapsed"},
+				types:   []Type{TypeTimeUUID, TypeVarchar, TypeInet, TypeInt},
+			}
+		}
+		return nil
+	}
+	return srv
+}
+
+func TestTraceWriterTimeout(t *testing.T) {
+	srv := newIncompleteTraceServer(t)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	traceID := TimeUUID().Bytes()
+
+	// the traces are read once unless waiting for them is requested
+	var buf bytes.Buffer
+	start := time.Now()
+	NewTraceWriter(db, &buf).Trace(traceID)
+	if d := time.Since(start); d >= DefaultTraceTimeout/2 {
+		t.Errorf("expected the traces to be read at once, it took %v", d)
+	}
+	if !strings.Contains(buf.String(), ErrTraceIncomplete.Error()) {
+		t.Errorf("expected the trace to be reported incomplete got %q", buf.String())
+	}
+
+	buf.Reset()
+	start = time.Now()
+	NewTraceWriterTimeout(db, &buf, 100*time.Millisecond).Trace(traceID)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("expected the traces to be waited for, it took %v", d)
+	}
+	if !strings.Contains(buf.String(), ErrTraceIncomplete.Error()) {
+		t.Errorf("expected the trace to be reported incomplete got %q", buf.String())
+	}
+}
+
 func TestTimeout(t *testing.T) {
 
 	srv := NewTestServer(t, defaultProto)
@@ -378,6 +2280,38 @@ func BenchmarkProtocolV3(b *testing.B) {
 	}
 }
 
+// BenchmarkNoDelay compares the latency of concurrent queries with and
+// without Nagle's algorithm.
+func BenchmarkNoDelay(b *testing.B) {
+	srv := NewTestServer(b, protoVersion3)
+	defer srv.Stop()
+
+	for _, disable := range []bool{false, true} {
+		b.Run(fmt.Sprintf("DisableNoDelay=%v", disable), func(b *testing.B) {
+			cluster := NewCluster(srv.Address)
+			cluster.NumConns = 1
+			cluster.ProtoVersion = 3
+			cluster.DisableNoDelay = disable
+
+			db, err := cluster.CreateSession()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := db.Query("void").Exec(); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
 func TestRoundRobinConnPoolRoundRobin(t *testing.T) {
 	// create 5 test servers
 	servers := make([]*TestServer, 5)
@@ -508,6 +2442,34 @@ func TestQueryTimeout(t *testing.T) {
 	}
 }
 
+func TestQueryTimeoutOverride(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.Timeout = 5 * time.Second
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	if err := db.Query("timeout").Timeout(10 * time.Millisecond).Exec(); err != ErrTimeoutNoResponse {
+		t.Fatalf("expected to get %v for timeout got %v", ErrTimeoutNoResponse, err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("expected the query to time out after 10ms, it took %v", d)
+	}
+
+	// the slow query is answered after 50ms
+	if err := db.Query("slow").Timeout(time.Second).Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestQueryTimeoutReuseStream(t *testing.T) {
 	srv := NewTestServer(t, defaultProto)
 	defer srv.Stop()
@@ -533,6 +2495,46 @@ func TestQueryTimeoutReuseStream(t *testing.T) {
 	}
 }
 
+func TestQueryContextCancel(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.NumStreams = 1
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	start := time.Now()
+	qry := db.Query("slow").WithContext(ctx).RetryPolicy(&SimpleRetryPolicy{NumRetries: 3})
+	if err := qry.Exec(); err != context.Canceled {
+		t.Fatalf("expected %v got %v", context.Canceled, err)
+	}
+	if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Errorf("expected the query to return when cancelled, it took %v", d)
+	}
+	if qry.Attempts() != 1 {
+		t.Errorf("expected the cancelled query not to be retried, got %d attempts", qry.Attempts())
+	}
+
+	// the only stream is released when the late response arrives
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Query("void").WithContext(ctx).Exec(); err != context.Canceled {
+		t.Fatalf("expected %v for a cancelled context got %v", context.Canceled, err)
+	}
+}
+
 func TestQueryTimeoutClose(t *testing.T) {
 	srv := NewTestServer(t, defaultProto)
 	defer srv.Stop()
@@ -690,6 +2692,18 @@ type TestServer struct {
 	listen     net.Listener
 	nKillReq   int64
 	compressor Compressor
+	// when set the server requires clients to authenticate using a two
+	// round handshake with the given authenticator class
+	authenticator string
+	// when set to 1 the server does not answer OPTIONS requests
+	ignoreOptions int32
+	// number of OPTIONS requests received
+	noptions uint64
+	// options advertised in the answers to OPTIONS requests
+	supported map[string][]string
+	// when set the rows it returns are the answer to the queries not
+	// handled by the server
+	queryRows func(query string) *testRows
 
 	protocol   byte
 	headerSize int
@@ -706,8 +2720,11 @@ func (srv *TestServer) serve() {
 		}
 		go func(conn net.Conn) {
 			defer conn.Close()
+
+			var r io.Reader = conn
+			w := &testSegmentWriter{conn: conn}
 			for {
-				framer, err := srv.readFrame(conn)
+				framer, err := srv.readFrame(r, w)
 				if err != nil {
 					if err == io.EOF {
 						return
@@ -719,6 +2736,12 @@ func (srv *TestServer) serve() {
 
 				atomic.AddUint64(&srv.nreq, 1)
 
+				if srv.protocol >= protoVersion5 && framer.header.op == opStartup {
+					// the client wraps the frames following STARTUP in
+					// segments once it is answered
+					r = newSegmentReader(conn, nil)
+				}
+
 				go srv.process(framer)
 			}
 		}(conn)
@@ -737,12 +2760,50 @@ func (srv *TestServer) process(f *framer) {
 		return
 	}
 
+	var payload map[string][]byte
+	if head.flags&flagCustomPayload == flagCustomPayload {
+		payload = f.readBytesMap()
+	}
+
 	switch head.op {
 	case opStartup:
-		f.writeHeader(0, opReady, head.stream)
+		if srv.authenticator != "" {
+			f.writeHeader(0, opAuthenticate, head.stream)
+			f.writeString(srv.authenticator)
+		} else {
+			f.writeHeader(0, opReady, head.stream)
+		}
+	case opAuthResponse:
+		switch resp := string(f.readBytes()); resp {
+		case "initial":
+			f.writeHeader(0, opAuthChallenge, head.stream)
+			f.writeBytes([]byte("challenge"))
+		case "response":
+			f.writeHeader(0, opAuthSuccess, head.stream)
+			f.writeBytes([]byte("done"))
+		default:
+			f.writeHeader(0, opError, head.stream)
+			f.writeInt(0x0100)
+			f.writeString("bad credentials: " + resp)
+		}
 	case opOptions:
+		atomic.AddUint64(&srv.noptions, 1)
+		if atomic.LoadInt32(&srv.ignoreOptions) == 1 {
+			return
+		}
 		f.writeHeader(0, opSupported, head.stream)
-		f.writeShort(0)
+		supported := make(map[string][]string)
+		for k, v := range srv.supported {
+			supported[k] = v
+		}
+		if srv.compressor != nil {
+			supported["COMPRESSION"] = []string{srv.compressor.Name()}
+		}
+		f.writeShort(uint16(len(supported)))
+		for k, v := range supported {
+			f.writeString(k)
+			f.writeStringList(v)
+		}
 	case opQuery:
 		query := f.readLongString()
 		first := query
@@ -756,11 +2817,43 @@ func (srv *TestServer) process(f *framer) {
 			f.writeInt(0x1001)
 			f.writeString("query killed")
 		case "use":
+			f.writeHeader(0, opResult, head.stream)
 			f.writeInt(resultKindKeyspace)
-			f.writeString(strings.TrimSpace(query[3:]))
+			f.writeString(strings.Trim(strings.TrimSpace(query[3:]), `"`))
 		case "void":
 			f.writeHeader(0, opResult, head.stream)
 			f.writeInt(resultKindVoid)
+		case "unavailable":
+			// the replicas are unavailable unless the consistency is ONE
+			if cons := f.readConsistency(); cons != One {
+				f.writeHeader(0, opError, head.stream)
+				f.writeInt(int32(ErrCodeUnavailable))
+				f.writeString("not enough replicas")
+				f.writeConsistency(cons)
+				f.writeInt(2)
+				f.writeInt(1)
+				break
+			}
+			f.writeHeader(0, opResult, head.stream)
+			f.writeInt(resultKindVoid)
+		case "warning":
+			f.writeHeader(flagWarning, opResult, head.stream)
+			f.writeStringList([]string{"test warning"})
+			f.writeInt(resultKindVoid)
+		case "payload":
+			// echo the custom payload of the request
+			f.writeHeader(flagCustomPayload, opResult, head.stream)
+			f.writeBytesMap(payload)
+			f.writeInt(resultKindVoid)
+		case "create":
+			f.writeHeader(0, opResult, head.stream)
+			f.writeInt(resultKindSchemaChanged)
+			f.writeString("CREATED")
+			if srv.protocol >= protoVersion3 {
+				f.writeString("TABLE")
+			}
+			f.writeString("ks")
+			f.writeString("t")
 		case "timeout":
 			<-srv.quit
 			return
@@ -778,8 +2871,65 @@ func (srv *TestServer) process(f *framer) {
 			return
 		default:
 			f.writeHeader(0, opResult, head.stream)
-			f.writeInt(resultKindVoid)
+			srv.writeRows(f, query)
+		}
+	case opPrepare:
+		// the statement is its own prepared ID, the rows of its executions
+		// are those of queryRows
+		query := f.readLongString()
+		f.writeHeader(0, opResult, head.stream)
+		f.writeInt(resultKindPrepared)
+		f.writeShortBytes([]byte(query))
+		if srv.protocol >= protoVersion5 {
+			f.writeShortBytes([]byte("metadata"))
+		}
+		// the bound variables are blobs
+		if n := strings.Count(query, "?"); n > 0 {
+			f.writeInt(int32(flagGlobalTableSpec))
+			f.writeInt(int32(n))
+			if srv.protocol >= protoVersion4 {
+				f.writeInt(0)
+			}
+			f.writeString("ks")
+			f.writeString("tbl")
+			for i := 0; i < n; i++ {
+				f.writeString(fmt.Sprintf("v%d", i))
+				f.writeShort(uint16(TypeBlob))
+			}
+		} else {
+			f.writeInt(0)
+			f.writeInt(0)
+			if srv.protocol >= protoVersion4 {
+				f.writeInt(0)
+			}
+		}
+		if srv.protocol >= protoVersion2 {
+			f.writeInt(0)
+			f.writeInt(0)
+		}
+	case opExecute:
+		query := string(f.readShortBytes())
+		if srv.protocol >= protoVersion5 {
+			if id := string(f.readShortBytes()); id != "metadata" {
+				srv.t.Errorf("unexpected result metadata ID %q", id)
+			}
+		}
+		f.writeHeader(0, opResult, head.stream)
+		srv.writeRows(f, query)
+	case opRegister:
+		f.writeHeader(0, opReady, head.stream)
+	case opBatch:
+		// the batches starting with a kill statement fail like the kill
+		// queries
+		f.readByte()
+		if f.readShort() > 0 && f.readByte() == 0 && strings.HasPrefix(f.readLongString(), "kill") {
+			f.writeHeader(0, opError, head.stream)
+			f.writeInt(0x1001)
+			f.writeString("batch killed")
+			break
 		}
+		f.writeHeader(0, opResult, head.stream)
+		f.writeInt(resultKindVoid)
 	default:
 		f.writeHeader(0, opError, head.stream)
 		f.writeInt(0)
@@ -793,13 +2943,81 @@ func (srv *TestServer) process(f *framer) {
 	}
 }
 
-func (srv *TestServer) readFrame(conn net.Conn) (*framer, error) {
+// writeRows writes the rows of queryRows for query, or a void result.
+func (srv *TestServer) writeRows(f *framer, query string) {
+	if srv.queryRows == nil {
+		f.writeInt(resultKindVoid)
+	} else if rows := srv.queryRows(query); rows == nil {
+		f.writeInt(resultKindVoid)
+	} else {
+		rows.write(f)
+	}
+}
+
+// testRows are the rows of a result sent by the TestServer.
+type testRows struct {
+	columns []string
+	types   []Type
+	rows    [][][]byte
+}
+
+func (r *testRows) write(f *framer) {
+	f.writeInt(resultKindRows)
+	f.writeInt(int32(flagGlobalTableSpec))
+	f.writeInt(int32(len(r.columns)))
+	f.writeString("ks")
+	f.writeString("t")
+	for i, name := range r.columns {
+		f.writeString(name)
+		f.writeShort(uint16(r.types[i]))
+	}
+
+	f.writeInt(int32(len(r.rows)))
+	for _, row := range r.rows {
+		for _, cell := range row {
+			f.writeBytes(cell)
+		}
+	}
+}
+
+// testSegmentWriter writes the frames of the TestServer, wrapped in segments
+// after the answer to STARTUP with protocol v5.
+type testSegmentWriter struct {
+	conn net.Conn
+
+	mu        sync.Mutex
+	segmented bool
+}
+
+func (w *testSegmentWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.segmented {
+		if p[0]&protoVersionMask >= protoVersion5 {
+			op := frameOp(p[4])
+			w.segmented = op == opReady || op == opAuthenticate
+		}
+		return w.conn.Write(p)
+	}
+
+	var buf bytes.Buffer
+	if err := appendSegments(&buf, p, nil); err != nil {
+		return 0, err
+	}
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (srv *TestServer) readFrame(r io.Reader, w io.Writer) (*framer, error) {
 	buf := make([]byte, srv.headerSize)
-	head, err := readHeader(conn, buf)
+	head, err := readHeader(r, buf)
 	if err != nil {
 		return nil, err
 	}
-	framer := newFramer(conn, conn, nil, srv.protocol)
+	framer := newFramer(r, w, srv.compressor, srv.protocol)
 
 	err = framer.readFrame(&head)
 	if err != nil {
@@ -10,8 +10,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"math/rand"
 	"net"
 	"sync"
 	"time"
@@ -110,6 +108,60 @@ type SetPartitioner interface {
 	SetPartitioner(partitioner string)
 }
 
+// interface to implement to receive the logger of the cluster config
+type SetLogger interface {
+	SetLogger(logger Logger)
+}
+
+// interface to implement to be notified of hosts going down and coming back
+// up, the address is the one of the HostInfo of the host
+type HostStatus interface {
+	HostDown(addr string)
+	HostUp(addr string)
+}
+
+// interface to implement to change the keyspace of the connections of the
+// pool, the new connections are opened in the keyspace
+type SetKeyspace interface {
+	SetKeyspace(keyspace string) error
+}
+
+// interface to implement to report how many streams of the connections of
+// the pool are in use, implemented by the built-in pools
+type StreamUsage interface {
+	StreamUsage() (inUse, total int)
+}
+
+// interface to implement to open the connections of the pool before the
+// session is returned, see ClusterConfig.WarmupPool. It returns a connection
+// to each of the hosts reached, implemented by the built-in pools
+type Warmup interface {
+	Warmup() []*Conn
+}
+
+// interface to implement to list the connections of the pool by host
+// address, the hosts without connections are listed too, implemented by the
+// built-in pools
+type HostConns interface {
+	HostConns() map[string][]*Conn
+}
+
+// useKeyspace changes the keyspace of the connections, the connections which
+// can not change keyspace are closed so that no query runs in the previous
+// keyspace. It returns the first error.
+func useKeyspace(conns []*Conn, keyspace string) error {
+	var err error
+	for _, conn := range conns {
+		if connErr := conn.UseKeyspace(keyspace); connErr != nil {
+			conn.Close()
+			if err == nil {
+				err = connErr
+			}
+		}
+	}
+	return err
+}
+
 //NewPoolFunc is the type used by ClusterConfig to create a pool of a specific type.
 type NewPoolFunc func(*ClusterConfig) (ConnectionPool, error)
 
@@ -126,6 +178,13 @@ type SimplePool struct {
 	hostMu sync.RWMutex
 	// this is the set of current hosts which the pool will attempt to connect to
 	hosts map[string]*HostInfo
+	// hosts reported down, the pool does not connect to them until they are
+	// reported up again
+	down map[string]struct{}
+
+	// reconnection state of the hosts which could not be reached
+	backoffMu sync.Mutex
+	backoff   map[string]*hostBackoff
 
 	// protects hostpool, connPoll, conns, quit
 	mu sync.Mutex
@@ -139,19 +198,35 @@ type SimplePool struct {
 	tlsConfig *tls.Config
 }
 
+// baseConfig returns the tls.Config the config of the connections is made
+// from.
+func (o *SslOptions) baseConfig() *tls.Config {
+	if o.TLSConfig != nil {
+		return o.TLSConfig
+	}
+	return &o.Config
+}
+
 func setupTLSConfig(sslOpts *SslOptions) (*tls.Config, error) {
+	// the user provided config is shared with every pool created from the
+	// cluster config, so it must not be modified. Clone is shallow, the
+	// root CAs and the certificates are copied before being added to.
+	tlsConfig := sslOpts.baseConfig().Clone()
+
 	// ca cert is optional
 	if sslOpts.CaPath != "" {
-		if sslOpts.RootCAs == nil {
-			sslOpts.RootCAs = x509.NewCertPool()
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		} else {
+			tlsConfig.RootCAs = cloneCertPool(tlsConfig.RootCAs)
 		}
 
 		pem, err := ioutil.ReadFile(sslOpts.CaPath)
 		if err != nil {
-			return nil, fmt.Errorf("connectionpool: unable to open CA certs: %v", err)
+			return nil, fmt.Errorf("connectionpool: unable to open CA certs: %w", err)
 		}
 
-		if !sslOpts.RootCAs.AppendCertsFromPEM(pem) {
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
 			return nil, errors.New("connectionpool: failed parsing or CA certs")
 		}
 	}
@@ -159,14 +234,15 @@ func setupTLSConfig(sslOpts *SslOptions) (*tls.Config, error) {
 	if sslOpts.CertPath != "" || sslOpts.KeyPath != "" {
 		mycert, err := tls.LoadX509KeyPair(sslOpts.CertPath, sslOpts.KeyPath)
 		if err != nil {
-			return nil, fmt.Errorf("connectionpool: unable to load X509 key pair: %v", err)
+			return nil, fmt.Errorf("connectionpool: unable to load X509 key pair: %w", err)
 		}
-		sslOpts.Certificates = append(sslOpts.Certificates, mycert)
+		certs := make([]tls.Certificate, 0, len(tlsConfig.Certificates)+1)
+		tlsConfig.Certificates = append(append(certs, tlsConfig.Certificates...), mycert)
 	}
 
-	sslOpts.InsecureSkipVerify = !sslOpts.EnableHostVerification
+	tlsConfig.InsecureSkipVerify = !sslOpts.EnableHostVerification
 
-	return &sslOpts.Config, nil
+	return tlsConfig, nil
 }
 
 //NewSimplePool is the function used by gocql to create the simple connection pool.
@@ -181,6 +257,8 @@ func NewSimplePool(cfg *ClusterConfig) (ConnectionPool, error) {
 		cFillingPool: make(chan int, 1),
 		keyspace:     cfg.Keyspace,
 		hosts:        make(map[string]*HostInfo),
+		down:         make(map[string]struct{}),
+		backoff:      make(map[string]*hostBackoff),
 	}
 
 	for _, host := range cfg.Hosts {
@@ -197,6 +275,12 @@ func NewSimplePool(cfg *ClusterConfig) (ConnectionPool, error) {
 		pool.tlsConfig = config
 	}
 
+	if cfg.LazyConnect {
+		// the pool is filled when it is first picked from
+		pool.cFillingPool <- 1
+		return pool, nil
+	}
+
 	//Walk through connecting to hosts. As soon as one host connects
 	//defer the remaining connections to cluster.fillPool()
 	for i := 0; i < len(cfg.Hosts); i++ {
@@ -223,11 +307,28 @@ func (c *SimplePool) connect(addr string) error {
 		Authenticator: c.cfg.Authenticator,
 		Keepalive:     c.cfg.SocketKeepalive,
 		tlsConfig:     c.tlsConfig,
+
+		ConnectTimeout:       c.cfg.ConnectTimeout,
+		WriteTimeout:         c.cfg.WriteTimeout,
+		DisableNoDelay:       c.cfg.DisableNoDelay,
+		CompressionThreshold: c.cfg.CompressionThreshold,
+		HeartbeatInterval:    c.cfg.HeartbeatInterval,
+		MaxInFlight:          c.cfg.MaxInFlightPerConn,
+		MaxQueued:            c.cfg.MaxQueuedPerConn,
+		MaxQueueWait:         c.cfg.MaxQueueWait,
+		Compressors:          c.cfg.Compressors,
+		ConnectObserver:      c.cfg.ConnectObserver,
+		FrameHeaderObserver:  c.cfg.FrameHeaderObserver,
+		Logger:               c.cfg.Logger,
+		Dialer:               c.cfg.Dialer,
+		FallbackDelay:        c.cfg.DualStackFallbackDelay,
+		stats:                c.cfg.stats,
+		hostOptions:          c.cfg.hostOptions,
 	}
 
 	conn, err := Connect(addr, cfg, c)
 	if err != nil {
-		log.Printf("connect: failed to connect to %q: %v", addr, err)
+		c.cfg.logger().Warn("gocql: failed to connect", "host", addr, "error", err)
 		return err
 	}
 
@@ -245,7 +346,7 @@ func (c *SimplePool) addConn(conn *Conn) error {
 	//Set the connection's keyspace if any before adding it to the pool
 	if c.keyspace != "" {
 		if err := conn.UseKeyspace(c.keyspace); err != nil {
-			log.Printf("error setting connection keyspace. %v", err)
+			c.cfg.logger().Error("gocql: unable to set the connection keyspace", "host", conn.Address(), "keyspace", c.keyspace, "error", err)
 			conn.Close()
 			return err
 		}
@@ -276,6 +377,33 @@ func (c *SimplePool) fillPool() {
 		defer func() { c.cFillingPool <- 1 }()
 	}
 
+	c.fillHosts()
+}
+
+// Warmup opens the missing connections to the hosts of the pool and waits
+// for them, it returns a connection to each of the hosts reached.
+func (c *SimplePool) Warmup() []*Conn {
+	// wait for the filling started by NewSimplePool or SetHosts
+	<-c.cFillingPool
+	c.fillHosts()
+	c.cFillingPool <- 1
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hosts := make(map[string]*Conn)
+	for conn := range c.conns {
+		hosts[conn.Address()] = conn
+	}
+	conns := make([]*Conn, 0, len(hosts))
+	for _, conn := range hosts {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// fillHosts opens the missing connections to the hosts, the caller must hold
+// the cFillingPool token.
+func (c *SimplePool) fillHosts() {
 	c.mu.Lock()
 	isClosed := c.quit
 	c.mu.Unlock()
@@ -289,8 +417,20 @@ func (c *SimplePool) fillPool() {
 	//Walk through list of defined hosts
 	var wg sync.WaitGroup
 	for host := range c.hosts {
+		if _, down := c.down[host]; down {
+			continue
+		}
+
 		addr := JoinHostPort(host, c.cfg.Port)
 
+		c.backoffMu.Lock()
+		backoff := c.backoff[host]
+		c.backoffMu.Unlock()
+		if backoff != nil && time.Now().Before(backoff.next) {
+			// wait for the delay of the reconnection policy
+			continue
+		}
+
 		numConns := 1
 		//See if the host already has connections in the pool
 		c.mu.Lock()
@@ -306,8 +446,13 @@ func (c *SimplePool) fillPool() {
 		} else {
 			//See if the host is reachable
 			if err := c.connect(addr); err != nil {
+				c.connectFailed(host)
 				continue
 			}
+
+			c.backoffMu.Lock()
+			delete(c.backoff, host)
+			c.backoffMu.Unlock()
 		}
 
 		//This is reached if the host is responsive and needs more connections
@@ -327,6 +472,28 @@ func (c *SimplePool) fillPool() {
 	wg.Wait()
 }
 
+// hostBackoff is the reconnection state of a host which could not be reached.
+type hostBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// connectFailed delays the next attempt to connect to the host according to
+// the reconnection policy.
+func (c *SimplePool) connectFailed(host string) {
+	c.backoffMu.Lock()
+	defer c.backoffMu.Unlock()
+
+	backoff := c.backoff[host]
+	if backoff == nil {
+		backoff = &hostBackoff{}
+		c.backoff[host] = backoff
+	}
+
+	backoff.failures++
+	backoff.next = time.Now().Add(c.cfg.reconnectionPolicy().GetInterval(backoff.failures))
+}
+
 // Should only be called if c.mu is locked
 func (c *SimplePool) removeConnLocked(conn *Conn) {
 	conn.Close()
@@ -372,7 +539,9 @@ func (c *SimplePool) Pick(qry *Query) *Conn {
 	conns := len(c.conns)
 	c.mu.Unlock()
 
-	if conns == 0 {
+	if conns == 0 && c.cfg.LazyConnect {
+		c.fillLazy()
+	} else if conns == 0 {
 		//try to populate the pool before returning.
 		c.fillPool()
 	}
@@ -380,6 +549,33 @@ func (c *SimplePool) Pick(qry *Query) *Conn {
 	return c.hostPool.Pick(qry)
 }
 
+// fillLazy opens the connections of an empty lazy pool, or waits at most the
+// connect timeout for a concurrent pick to open them.
+func (c *SimplePool) fillLazy() {
+	timeout := c.cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = c.cfg.Timeout
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-c.cFillingPool:
+		defer func() { c.cFillingPool <- 1 }()
+	case <-expired:
+		return
+	}
+
+	if c.Size() == 0 {
+		c.fillHosts()
+	}
+}
+
 //Size returns the number of connections currently active in the pool
 func (p *SimplePool) Size() int {
 	p.mu.Lock()
@@ -388,6 +584,37 @@ func (p *SimplePool) Size() int {
 	return conns
 }
 
+//StreamUsage returns the number of streams in use and the total number of
+//streams of the connections of the pool.
+func (p *SimplePool) StreamUsage() (inUse, total int) {
+	p.mu.Lock()
+	for conn := range p.conns {
+		total += conn.maxStreams()
+		inUse += conn.maxStreams() - conn.AvailableStreams()
+	}
+	p.mu.Unlock()
+	return
+}
+
+// HostConns returns the connections of the pool by host address.
+func (c *SimplePool) HostConns() map[string][]*Conn {
+	conns := make(map[string][]*Conn)
+
+	c.hostMu.RLock()
+	for host := range c.hosts {
+		conns[JoinHostPort(host, c.cfg.Port)] = nil
+	}
+	c.hostMu.RUnlock()
+
+	c.mu.Lock()
+	for conn := range c.conns {
+		conns[conn.Address()] = append(conns[conn.Address()], conn)
+	}
+	c.mu.Unlock()
+
+	return conns
+}
+
 //Close kills the pool and all associated connections.
 func (c *SimplePool) Close() {
 	c.quitOnce.Do(func() {
@@ -428,14 +655,79 @@ func (c *SimplePool) SetHosts(hosts []HostInfo) {
 	}
 	c.hostMu.Unlock()
 
+	if c.cfg.LazyConnect && c.Size() == 0 {
+		// not used yet, the pool is filled on first use
+		return
+	}
 	c.fillPool()
 }
 
+// SetKeyspace changes the keyspace of the connections, the connections which
+// can not change keyspace are closed.
+func (c *SimplePool) SetKeyspace(keyspace string) error {
+	c.mu.Lock()
+	c.keyspace = keyspace
+	conns := make([]*Conn, 0, len(c.conns))
+	for conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.mu.Unlock()
+
+	return useKeyspace(conns, keyspace)
+}
+
+func (c *SimplePool) isHostDown(addr string) bool {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+
+	_, down := c.down[addr]
+	return down
+}
+
+// HostDown closes the connections to the host and stops reconnecting to it
+// until HostUp is called.
+func (c *SimplePool) HostDown(addr string) {
+	c.hostMu.Lock()
+	if _, ok := c.hosts[addr]; !ok {
+		c.hostMu.Unlock()
+		return
+	}
+	c.down[addr] = struct{}{}
+	c.hostMu.Unlock()
+
+	hostAddr := JoinHostPort(addr, c.cfg.Port)
+
+	c.mu.Lock()
+	for conn := range c.conns {
+		if conn.Address() == hostAddr {
+			c.removeConnLocked(conn)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// HostUp reconnects to a host previously reported down.
+func (c *SimplePool) HostUp(addr string) {
+	c.hostMu.Lock()
+	_, down := c.down[addr]
+	delete(c.down, addr)
+	c.hostMu.Unlock()
+
+	if down {
+		c.fillPool()
+	}
+}
+
 func (c *SimplePool) removeHostLocked(addr string) {
 	if _, ok := c.hosts[addr]; !ok {
 		return
 	}
 	delete(c.hosts, addr)
+	delete(c.down, addr)
+
+	c.backoffMu.Lock()
+	delete(c.backoff, addr)
+	c.backoffMu.Unlock()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -461,6 +753,17 @@ func NewRoundRobinConnPool(cfg *ClusterConfig) (ConnectionPool, error) {
 	)
 }
 
+//NewLeastInFlightConnPool creates a connection pool which selects hosts by
+//round-robin, and then selects the connection to that host with the fewest
+//requests in flight.
+func NewLeastInFlightConnPool(cfg *ClusterConfig) (ConnectionPool, error) {
+	return NewPolicyConnPool(
+		cfg,
+		NewRoundRobinHostPolicy(),
+		NewLeastInFlightConnPolicy,
+	)
+}
+
 //NewTokenAwareConnPool creates a connection pool which selects hosts by
 //a token aware policy, and then selects a connection for that host by
 //round-robin.
@@ -473,10 +776,12 @@ func NewTokenAwareConnPool(cfg *ClusterConfig) (ConnectionPool, error) {
 }
 
 type policyConnPool struct {
-	port     int
-	numConns int
-	connCfg  ConnConfig
-	keyspace string
+	port      int
+	numConns  int
+	connCfg   ConnConfig
+	keyspace  string
+	reconnect ReconnectionPolicy
+	lazy      bool
 
 	mu            sync.RWMutex
 	hostPolicy    HostSelectionPolicy
@@ -517,13 +822,36 @@ func NewPolicyConnPool(
 			Authenticator: cfg.Authenticator,
 			Keepalive:     cfg.SocketKeepalive,
 			tlsConfig:     tlsConfig,
+
+			ConnectTimeout:       cfg.ConnectTimeout,
+			WriteTimeout:         cfg.WriteTimeout,
+			DisableNoDelay:       cfg.DisableNoDelay,
+			CompressionThreshold: cfg.CompressionThreshold,
+			HeartbeatInterval:    cfg.HeartbeatInterval,
+			MaxInFlight:          cfg.MaxInFlightPerConn,
+			MaxQueued:            cfg.MaxQueuedPerConn,
+			MaxQueueWait:         cfg.MaxQueueWait,
+			Compressors:          cfg.Compressors,
+			ConnectObserver:      cfg.ConnectObserver,
+			FrameHeaderObserver:  cfg.FrameHeaderObserver,
+			Logger:               cfg.Logger,
+			Dialer:               cfg.Dialer,
+			FallbackDelay:        cfg.DualStackFallbackDelay,
+			stats:                cfg.stats,
+			hostOptions:          cfg.hostOptions,
 		},
 		keyspace:      cfg.Keyspace,
+		reconnect:     cfg.reconnectionPolicy(),
+		lazy:          cfg.LazyConnect,
 		hostPolicy:    hostPolicy,
 		connPolicy:    connPolicy,
 		hostConnPools: map[string]*hostConnPool{},
 	}
 
+	if setter, ok := hostPolicy.(SetLogger); ok {
+		setter.SetLogger(cfg.logger())
+	}
+
 	hosts := make([]HostInfo, len(cfg.Hosts))
 	for i, hostAddr := range cfg.Hosts {
 		hosts[i].Peer = hostAddr
@@ -556,6 +884,8 @@ func (p *policyConnPool) SetHosts(hosts []HostInfo) {
 				p.connCfg,
 				p.keyspace,
 				p.connPolicy(),
+				p.reconnect,
+				p.lazy,
 			)
 			p.hostConnPools[hosts[i].Peer] = pool
 		} else {
@@ -580,6 +910,61 @@ func (p *policyConnPool) SetPartitioner(partitioner string) {
 	p.hostPolicy.SetPartitioner(partitioner)
 }
 
+func (p *policyConnPool) HostDown(addr string) {
+	p.mu.RLock()
+	pool := p.hostConnPools[addr]
+	p.mu.RUnlock()
+
+	if pool != nil {
+		pool.setDown(true)
+	}
+}
+
+// SetKeyspace changes the keyspace of the connections to every host, the
+// connections which can not change keyspace are closed.
+func (p *policyConnPool) SetKeyspace(keyspace string) error {
+	p.mu.Lock()
+	p.keyspace = keyspace
+	pools := make([]*hostConnPool, 0, len(p.hostConnPools))
+	for _, pool := range p.hostConnPools {
+		pools = append(pools, pool)
+	}
+	p.mu.Unlock()
+
+	var err error
+	for _, pool := range pools {
+		if poolErr := pool.setKeyspace(keyspace); err == nil {
+			err = poolErr
+		}
+	}
+	return err
+}
+
+func (p *policyConnPool) isHostDown(addr string) bool {
+	p.mu.RLock()
+	pool := p.hostConnPools[addr]
+	p.mu.RUnlock()
+
+	if pool == nil {
+		return false
+	}
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.down
+}
+
+func (p *policyConnPool) HostUp(addr string) {
+	p.mu.RLock()
+	pool := p.hostConnPools[addr]
+	p.mu.RUnlock()
+
+	if pool != nil {
+		pool.setDown(false)
+	}
+}
+
 func (p *policyConnPool) Size() int {
 	p.mu.RLock()
 	count := 0
@@ -591,12 +976,32 @@ func (p *policyConnPool) Size() int {
 	return count
 }
 
+func (p *policyConnPool) StreamUsage() (inUse, total int) {
+	p.mu.RLock()
+	for _, pool := range p.hostConnPools {
+		pool.mu.RLock()
+		for _, conn := range pool.conns {
+			total += conn.maxStreams()
+			inUse += conn.maxStreams() - conn.AvailableStreams()
+		}
+		pool.mu.RUnlock()
+	}
+	p.mu.RUnlock()
+
+	return
+}
+
 func (p *policyConnPool) Pick(qry *Query) *Conn {
 	nextHost := p.hostPolicy.Pick(qry)
 
 	p.mu.RLock()
 	var host *HostInfo
 	var conn *Conn
+	if qry != nil && qry.host != "" {
+		if pool, ok := p.hostConnPools[qry.host]; ok {
+			conn = pool.Pick(qry)
+		}
+	}
 	for conn == nil {
 		host = nextHost()
 		if host == nil {
@@ -608,6 +1013,45 @@ func (p *policyConnPool) Pick(qry *Query) *Conn {
 	return conn
 }
 
+// HostConns returns the connections of the pool by host address.
+func (p *policyConnPool) HostConns() map[string][]*Conn {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	conns := make(map[string][]*Conn, len(p.hostConnPools))
+	for _, pool := range p.hostConnPools {
+		pool.mu.RLock()
+		conns[pool.addr] = append([]*Conn(nil), pool.conns...)
+		pool.mu.RUnlock()
+	}
+	return conns
+}
+
+// Warmup opens the missing connections to the hosts of the pool, it returns
+// a connection to each of the hosts reached. The connections to the hosts
+// are opened when they are added to the pool, only the hosts which could
+// not be reached then are waited for.
+func (p *policyConnPool) Warmup() []*Conn {
+	p.mu.RLock()
+	pools := make([]*hostConnPool, 0, len(p.hostConnPools))
+	for _, pool := range p.hostConnPools {
+		pools = append(pools, pool)
+	}
+	p.mu.RUnlock()
+
+	var conns []*Conn
+	for _, pool := range pools {
+		pool.fill()
+
+		pool.mu.RLock()
+		if len(pool.conns) > 0 {
+			conns = append(conns, pool.conns[0])
+		}
+		pool.mu.RUnlock()
+	}
+	return conns
+}
+
 func (p *policyConnPool) Close() {
 	p.mu.Lock()
 
@@ -625,18 +1069,36 @@ func (p *policyConnPool) Close() {
 // hostConnPool is a connection pool for a single host.
 // Connection selection is based on a provided ConnSelectionPolicy
 type hostConnPool struct {
-	host     string
-	port     int
-	addr     string
-	size     int
-	connCfg  ConnConfig
-	keyspace string
-	policy   ConnSelectionPolicy
-	// protection for conns, closed, filling
-	mu      sync.RWMutex
-	conns   []*Conn
-	closed  bool
-	filling bool
+	host      string
+	port      int
+	addr      string
+	size      int
+	connCfg   ConnConfig
+	keyspace  string
+	policy    ConnSelectionPolicy
+	reconnect ReconnectionPolicy
+	// lazy pools are filled when they are first picked from, the first
+	// connection is opened synchronously and the others in the background
+	lazy bool
+	// protection for conns, sharding, shards, size, closed, filling, down,
+	// failures, noShardAwarePort, keyspace
+	mu    sync.RWMutex
+	conns []*Conn
+	// shards holds the connection to each shard of a Scylla host, the pool
+	// opens a connection per shard
+	sharding scyllaShardInfo
+	shards   []*Conn
+	closed   bool
+	filling  bool
+	down     bool
+	failures int
+	// firstConn is closed once the filling of an empty pool opened its
+	// first connection, or failed to
+	firstConn chan struct{}
+
+	// noShardAwarePort is set when the shard-aware port of the host can not
+	// be reached, the connections are then opened to the regular port
+	noShardAwarePort bool
 }
 
 func newHostConnPool(
@@ -646,23 +1108,29 @@ func newHostConnPool(
 	connCfg ConnConfig,
 	keyspace string,
 	policy ConnSelectionPolicy,
+	reconnect ReconnectionPolicy,
+	lazy bool,
 ) *hostConnPool {
 
 	pool := &hostConnPool{
-		host:     host,
-		port:     port,
-		addr:     JoinHostPort(host, port),
-		size:     size,
-		connCfg:  connCfg,
-		keyspace: keyspace,
-		policy:   policy,
-		conns:    make([]*Conn, 0, size),
-		filling:  false,
-		closed:   false,
+		host:      host,
+		port:      port,
+		addr:      JoinHostPort(host, port),
+		size:      size,
+		connCfg:   connCfg,
+		keyspace:  keyspace,
+		policy:    policy,
+		reconnect: reconnect,
+		lazy:      lazy,
+		conns:     make([]*Conn, 0, size),
+		filling:   false,
+		closed:    false,
 	}
 
 	// fill the pool with the initial connections before returning
-	pool.fill()
+	if !lazy {
+		pool.fill()
+	}
 
 	return pool
 }
@@ -670,23 +1138,77 @@ func newHostConnPool(
 // Pick a connection from this connection pool for the given query.
 func (pool *hostConnPool) Pick(qry *Query) *Conn {
 	pool.mu.RLock()
-	if pool.closed {
+	if pool.closed || pool.down {
 		pool.mu.RUnlock()
 		return nil
 	}
 
 	empty := len(pool.conns) == 0
+	sharded := len(pool.shards) > 0
 	pool.mu.RUnlock()
 
-	if empty {
+	if empty && pool.lazy {
+		pool.fill()
+
+		// the first connection may be opened by a concurrent pick
+		pool.mu.RLock()
+		first := pool.firstConn
+		pool.mu.RUnlock()
+		if first != nil {
+			pool.waitFirstConn(first)
+		}
+
+		pool.mu.RLock()
+		empty = len(pool.conns) == 0
+		sharded = len(pool.shards) > 0
+		pool.mu.RUnlock()
+		if empty {
+			return nil
+		}
+	} else if empty {
 		// try to fill the empty pool
 		go pool.fill()
 		return nil
 	}
 
+	if sharded {
+		if conn := pool.pickShard(qry); conn != nil {
+			return conn
+		}
+	}
+
 	return pool.policy.Pick(qry)
 }
 
+// pickShard returns the connection to the shard owning the partition of the
+// query, or nil if the pool has no connection to it.
+func (pool *hostConnPool) pickShard(qry *Query) *Conn {
+	if qry == nil {
+		return nil
+	}
+
+	routingKey, err := qry.GetRoutingKey()
+	if err != nil || routingKey == nil {
+		return nil
+	}
+	token := murmur3Partitioner{}.Hash(routingKey).(murmur3Token)
+
+	pool.mu.RLock()
+	var conn *Conn
+	if len(pool.shards) > 0 {
+		conn = pool.shards[pool.sharding.shardOf(token)]
+	}
+	pool.mu.RUnlock()
+
+	if conn == nil || conn.Closed() {
+		// connect to the missing shard
+		go pool.fill()
+		return nil
+	}
+
+	return conn
+}
+
 //Size returns the number of connections currently active in the pool
 func (pool *hostConnPool) Size() int {
 	pool.mu.RLock()
@@ -709,11 +1231,56 @@ func (pool *hostConnPool) Close() {
 	go pool.drain()
 }
 
+// setKeyspace changes the keyspace of the connections of the pool.
+func (pool *hostConnPool) setKeyspace(keyspace string) error {
+	pool.mu.Lock()
+	pool.keyspace = keyspace
+	conns := make([]*Conn, len(pool.conns))
+	copy(conns, pool.conns)
+	pool.mu.Unlock()
+
+	return useKeyspace(conns, keyspace)
+}
+
+// setDown marks the host down, which closes the connections of the pool, or
+// back up, which fills the pool again.
+func (pool *hostConnPool) setDown(down bool) {
+	pool.mu.Lock()
+	if pool.closed || pool.down == down {
+		pool.mu.Unlock()
+		return
+	}
+	pool.down = down
+	pool.mu.Unlock()
+
+	if down {
+		pool.drain()
+	} else {
+		pool.fill()
+	}
+}
+
+// waitFirstConn waits at most the connect timeout for the first connection
+// of the pool to be opened.
+func (pool *hostConnPool) waitFirstConn(first <-chan struct{}) {
+	var timeout <-chan time.Time
+	if d := pool.connCfg.connectTimeout(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-first:
+	case <-timeout:
+	}
+}
+
 // Fill the connection pool
 func (pool *hostConnPool) fill() {
 	pool.mu.RLock()
-	// avoid filling a closed pool, or concurrent filling
-	if pool.closed || pool.filling {
+	// avoid filling a closed or down pool, or concurrent filling
+	if pool.closed || pool.down || pool.filling {
 		pool.mu.RUnlock()
 		return
 	}
@@ -735,7 +1302,7 @@ func (pool *hostConnPool) fill() {
 	// double check everything since the lock was released
 	startCount = len(pool.conns)
 	fillCount = pool.size - startCount
-	if pool.closed || pool.filling || fillCount <= 0 {
+	if pool.closed || pool.down || pool.filling || fillCount <= 0 {
 		// looks like another goroutine already beat this
 		// goroutine to the filling
 		pool.mu.Unlock()
@@ -744,6 +1311,11 @@ func (pool *hostConnPool) fill() {
 
 	// ok fill the pool
 	pool.filling = true
+	var first chan struct{}
+	if startCount == 0 {
+		first = make(chan struct{})
+		pool.firstConn = first
+	}
 
 	// allow others to access the pool while filling
 	pool.mu.Unlock()
@@ -755,27 +1327,32 @@ func (pool *hostConnPool) fill() {
 	if startCount == 0 {
 		err := pool.connect()
 		pool.logConnectErr(err)
+		close(first)
 
 		if err != nil {
 			// probably unreachable host
-			go pool.fillingStopped()
+			go pool.fillingStopped(true)
 			return
 		}
 
-		// filled one
-		fillCount--
+		// filled one, the size of the pool changes when the host is sharded
+		pool.mu.RLock()
+		fillCount = pool.size - len(pool.conns)
+		pool.mu.RUnlock()
 
-		// connect all connections to this host in sync
-		for fillCount > 0 {
-			err := pool.connect()
-			pool.logConnectErr(err)
+		if !pool.lazy {
+			// connect all connections to this host in sync
+			for fillCount > 0 {
+				err := pool.connect()
+				pool.logConnectErr(err)
 
-			// decrement, even on error
-			fillCount--
-		}
+				// decrement, even on error
+				fillCount--
+			}
 
-		go pool.fillingStopped()
-		return
+			go pool.fillingStopped(false)
+			return
+		}
 	}
 
 	// fill the rest of the pool asynchronously
@@ -789,7 +1366,7 @@ func (pool *hostConnPool) fill() {
 		}
 
 		// mark the end of filling
-		pool.fillingStopped()
+		pool.fillingStopped(false)
 	}()
 }
 
@@ -799,33 +1376,107 @@ func (pool *hostConnPool) logConnectErr(err error) {
 		// these are typical during a node outage so avoid log spam.
 	} else if err != nil {
 		// unexpected error
-		log.Printf("error: failed to connect to %s due to error: %v", pool.addr, err)
+		pool.connCfg.logger().Warn("gocql: failed to connect", "host", pool.addr, "error", err)
 	}
 }
 
-// transition back to a not-filling state.
-func (pool *hostConnPool) fillingStopped() {
-	// wait for some time to avoid back-to-back filling
-	// this provides some time between failed attempts
-	// to fill the pool for the host to recover
-	time.Sleep(time.Duration(rand.Int31n(100)+31) * time.Millisecond)
+// transition back to a not-filling state, when the host could not be
+// reached this happens after the delay of the reconnection policy which
+// gives the host some time to recover.
+func (pool *hostConnPool) fillingStopped(failed bool) {
+	pool.mu.Lock()
+	if failed {
+		pool.failures++
+	} else {
+		pool.failures = 0
+	}
+	failures := pool.failures
+	pool.mu.Unlock()
+
+	if failed {
+		time.Sleep(pool.reconnect.GetInterval(failures))
+	}
 
 	pool.mu.Lock()
 	pool.filling = false
 	pool.mu.Unlock()
 }
 
+// dial opens a connection to the host. The connections to a Scylla host
+// listening on the shard-aware port are opened to a shard which has none.
+func (pool *hostConnPool) dial() (*Conn, error) {
+	pool.mu.RLock()
+	sharding := pool.sharding
+	shard := -1
+	if !pool.noShardAwarePort {
+		for i, conn := range pool.shards {
+			if conn == nil {
+				shard = i
+				break
+			}
+		}
+	}
+	pool.mu.RUnlock()
+
+	port := sharding.shardAwarePort
+	if pool.connCfg.tlsConfig != nil {
+		port = sharding.shardAwarePortSSL
+	}
+	if shard < 0 || port <= 0 || pool.connCfg.Dialer != nil {
+		// the source port can only be picked with the default dialer
+		return Connect(pool.addr, pool.connCfg, pool)
+	}
+
+	// the translated address of the host may include a port
+	host, _, err := net.SplitHostPort(pool.addr)
+	if err != nil {
+		return nil, err
+	}
+	addr := JoinHostPort(host, port)
+	cfg := pool.connCfg
+
+	for _, localPort := range sharding.localPorts(shard) {
+		cfg.localPort = localPort
+
+		var conn *Conn
+		conn, err = Connect(addr, cfg, pool)
+		if err == nil {
+			return conn, nil
+		}
+		if !isLocalPortInUse(err) {
+			break
+		}
+	}
+
+	conn, fallbackErr := Connect(pool.addr, pool.connCfg, pool)
+	if fallbackErr != nil {
+		return nil, fallbackErr
+	}
+
+	// the host is reachable on the regular port only
+	pool.connCfg.logger().Debug("gocql: unable to connect to the shard-aware port", "host", addr, "error", err)
+	pool.mu.Lock()
+	pool.noShardAwarePort = true
+	pool.mu.Unlock()
+
+	return conn, nil
+}
+
 // create a new connection to the host and add it to the pool
 func (pool *hostConnPool) connect() error {
 	// try to connect
-	conn, err := Connect(pool.addr, pool.connCfg, pool)
+	conn, err := pool.dial()
 	if err != nil {
 		return err
 	}
 
-	if pool.keyspace != "" {
+	pool.mu.RLock()
+	keyspace := pool.keyspace
+	pool.mu.RUnlock()
+
+	if keyspace != "" {
 		// set the keyspace
-		if err := conn.UseKeyspace(pool.keyspace); err != nil {
+		if err := conn.UseKeyspace(keyspace); err != nil {
 			conn.Close()
 			return err
 		}
@@ -840,6 +1491,22 @@ func (pool *hostConnPool) connect() error {
 		return nil
 	}
 
+	if info := conn.scylla; info != nil {
+		if len(pool.shards) != info.nrShards {
+			pool.sharding = *info
+			pool.shards = make([]*Conn, info.nrShards)
+			pool.size = info.nrShards
+		}
+
+		if pool.shards[info.shard] != nil {
+			// the host picked a shard which already has a connection, a
+			// later fill connects to the missing shards
+			conn.Close()
+			return nil
+		}
+		pool.shards[info.shard] = conn
+	}
+
 	pool.conns = append(pool.conns, conn)
 	pool.policy.SetConns(pool.conns)
 	return nil
@@ -869,6 +1536,10 @@ func (pool *hostConnPool) HandleError(conn *Conn, err error, closed bool) {
 			// update the policy
 			pool.policy.SetConns(pool.conns)
 
+			if info := conn.scylla; info != nil && info.shard < len(pool.shards) && pool.shards[info.shard] == conn {
+				pool.shards[info.shard] = nil
+			}
+
 			// lost a connection, so fill the pool
 			go pool.fill()
 			break
@@ -888,6 +1559,10 @@ func (pool *hostConnPool) drain() {
 	// update the policy
 	pool.policy.SetConns(pool.conns)
 
+	for i := range pool.shards {
+		pool.shards[i] = nil
+	}
+
 	// close the connections
 	for _, conn := range conns {
 		conn.Close()
@@ -0,0 +1,231 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// srvPrefix marks the contact points which are DNS SRV names, for instance
+// srv:_cql._tcp.example.com.
+const srvPrefix = "srv:"
+
+// contactPoints are the contact points of a session, the SRV names among the
+// configured hosts are replaced by the targets of their records and the host
+// names by all their addresses.
+type contactPoints struct {
+	names []string
+	// resolveNames is false when the host names must be kept to verify the
+	// certificates of the hosts
+	resolveNames bool
+	// lookupSRV and lookupHost are net.LookupSRV and net.LookupHost,
+	// replaced in tests
+	lookupSRV  func(service, proto, name string) (string, []*net.SRV, error)
+	lookupHost func(host string) ([]string, error)
+
+	mu    sync.RWMutex
+	hosts []string
+
+	quit chan struct{}
+}
+
+func newContactPoints(names []string, resolveNames bool) *contactPoints {
+	return &contactPoints{
+		names:        names,
+		resolveNames: resolveNames,
+		lookupSRV:    net.LookupSRV,
+		lookupHost:   net.LookupHost,
+		hosts:        names,
+		quit:         make(chan struct{}),
+	}
+}
+
+// resolvable returns true if some of the contact points are SRV names, or
+// host names which are resolved.
+func (c *contactPoints) resolvable() bool {
+	for _, name := range c.names {
+		if strings.HasPrefix(name, srvPrefix) {
+			return true
+		}
+		if c.resolveNames && net.ParseIP(splitHost(name)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHost returns the host of an address with an optional port.
+func splitHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// get returns the resolved contact points.
+func (c *contactPoints) get() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.hosts
+}
+
+// resolve looks the SRV names and the host names up, it returns true when the
+// contact points changed. The targets of an SRV name are ordered by priority
+// and randomly by weight, see net.LookupSRV, the addresses of a host name are
+// shuffled so the sessions do not all start with the same host.
+func (c *contactPoints) resolve() (bool, error) {
+	hosts := make([]string, 0, len(c.names))
+	for _, name := range c.names {
+		if !strings.HasPrefix(name, srvPrefix) {
+			hosts = append(hosts, c.resolveHost(name)...)
+			continue
+		}
+
+		_, records, err := c.lookupSRV("", "", strings.TrimPrefix(name, srvPrefix))
+		if err != nil {
+			return false, err
+		}
+
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+	}
+
+	if len(hosts) == 0 {
+		return false, ErrNoHosts
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := !sameHosts(c.hosts, hosts)
+	// keep the current order when the targets did not change, the weights
+	// shuffle them on every lookup
+	if changed {
+		c.hosts = hosts
+	}
+	return changed, nil
+}
+
+// resolveHost returns the addresses of a host name in random order, with the
+// port of the name if any. Names which can not be resolved are kept, dialing
+// them reports the error.
+func (c *contactPoints) resolveHost(name string) []string {
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		host, port = name, ""
+	}
+
+	if !c.resolveNames || net.ParseIP(host) != nil {
+		return []string{name}
+	}
+
+	addrs, err := c.lookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		return []string{name}
+	}
+
+	shuffled := make([]string, len(addrs))
+	for i, j := range rand.Perm(len(addrs)) {
+		shuffled[i] = addrs[j]
+	}
+
+	hosts := interleaveFamilies(shuffled)
+	if port != "" {
+		for i, addr := range hosts {
+			hosts[i] = net.JoinHostPort(addr, port)
+		}
+	}
+	return hosts
+}
+
+// interleaveFamilies orders the IPv6 and IPv4 addresses alternately starting
+// with IPv6 as recommended by RFC 8305, so the contact points of a dual-stack
+// host name are not all tried on an unreachable family first.
+func interleaveFamilies(addrs []string) []string {
+	var v6, v4 []string
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+
+	hosts := make([]string, 0, len(addrs))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			hosts = append(hosts, v6[i])
+		}
+		if i < len(v4) {
+			hosts = append(hosts, v4[i])
+		}
+	}
+	return hosts
+}
+
+// sameHosts returns true if a and b hold the same hosts in any order.
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := make(map[string]int, len(a))
+	for _, host := range a {
+		count[host]++
+	}
+	for _, host := range b {
+		if count[host] == 0 {
+			return false
+		}
+		count[host]--
+	}
+	return true
+}
+
+// refresh resolves the contact points at the given interval. The hosts of the
+// pool are replaced when they change, unless the hosts are discovered from
+// the ring in which case the new contact points are only used by the control
+// connection.
+func (c *contactPoints) refresh(s *Session, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-c.quit:
+			return
+		}
+
+		changed, err := c.resolve()
+		if err != nil {
+			s.cfg.logger().Warn("gocql: unable to resolve the contact points", "error", err)
+			continue
+		}
+		if !changed || s.hostSource != nil {
+			continue
+		}
+
+		hosts := c.get()
+		infos := make([]HostInfo, len(hosts))
+		for i, host := range hosts {
+			infos[i] = HostInfo{Peer: host}
+		}
+		s.Pool.SetHosts(infos)
+	}
+}
+
+func (c *contactPoints) close() {
+	close(c.quit)
+}
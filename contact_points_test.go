@@ -0,0 +1,109 @@
+// +build all unit
+
+package gocql
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestContactPointsSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "cass1.example.com.", Port: 9042, Priority: 10},
+		{Target: "cass2.example.com.", Port: 9043, Priority: 20},
+	}
+
+	c := newContactPoints([]string{"10.0.0.1", "srv:_cql._tcp.example.com"}, false)
+	c.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_cql._tcp.example.com" {
+			t.Errorf("unexpected SRV lookup of %q", name)
+		}
+		return "", records, nil
+	}
+
+	if !c.resolvable() {
+		t.Fatal("expected the contact points to have SRV names")
+	}
+
+	changed, err := c.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected the contact points to change")
+	}
+
+	expected := []string{"10.0.0.1", "cass1.example.com:9042", "cass2.example.com:9043"}
+	if hosts := c.get(); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %v got %v", expected, hosts)
+	}
+
+	// the same targets in another order do not change the contact points
+	records[0], records[1] = records[1], records[0]
+	if changed, err := c.resolve(); err != nil || changed {
+		t.Errorf("expected no change got %v, %v", changed, err)
+	}
+	if hosts := c.get(); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %v got %v", expected, hosts)
+	}
+
+	records = records[:1]
+	if changed, err := c.resolve(); err != nil || !changed {
+		t.Errorf("expected a change got %v, %v", changed, err)
+	}
+	if hosts := c.get(); len(hosts) != 2 {
+		t.Errorf("expected 2 contact points got %v", hosts)
+	}
+}
+
+func TestContactPointsMultipleAddresses(t *testing.T) {
+	c := newContactPoints([]string{"10.0.0.1", "cassandra.example.com:9043"}, true)
+	c.lookupHost = func(host string) ([]string, error) {
+		if host != "cassandra.example.com" {
+			t.Errorf("unexpected lookup of %q", host)
+		}
+		return []string{"10.0.1.1", "10.0.1.2", "10.0.1.3"}, nil
+	}
+
+	if !c.resolvable() {
+		t.Fatal("expected the host names to be resolved")
+	}
+	if _, err := c.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := c.get()
+	expected := []string{"10.0.0.1", "10.0.1.1:9043", "10.0.1.2:9043", "10.0.1.3:9043"}
+	if !sameHosts(hosts, expected) {
+		t.Errorf("expected %v in any order got %v", expected, hosts)
+	}
+
+	// the shuffled addresses are not a change
+	if changed, err := c.resolve(); err != nil || changed {
+		t.Errorf("expected no change got %v, %v", changed, err)
+	}
+}
+
+func TestContactPointsNotResolved(t *testing.T) {
+	if c := newContactPoints([]string{"10.0.0.1", "[::1]:9042"}, true); c.resolvable() {
+		t.Error("expected the addresses not to be resolved")
+	}
+
+	c := newContactPoints([]string{"cassandra.example.com"}, false)
+	if c.resolvable() {
+		t.Error("expected the host names not to be resolved")
+	}
+	if hosts := c.resolveHost("cassandra.example.com"); !reflect.DeepEqual(hosts, []string{"cassandra.example.com"}) {
+		t.Errorf("expected the host name to be kept got %v", hosts)
+	}
+}
+
+func TestInterleaveFamilies(t *testing.T) {
+	addrs := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "2001:db8::1", "2001:db8::2"}
+	expected := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2", "10.0.0.3"}
+
+	if hosts := interleaveFamilies(addrs); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %v got %v", expected, hosts)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// controlConn is a connection dedicated to receiving the events of the
+// cluster, it is not part of the pool of the session. When the connection is
+// lost another one is opened at once to one of the known hosts, preferably
+// one the pool is connected to, and the events missed meanwhile are
+// reconciled by refreshing the ring and the schema metadata.
+type controlConn struct {
+	session   *Session
+	tlsConfig *tls.Config
+
+	mu     sync.Mutex
+	conn   *Conn
+	closed bool
+	quit   chan struct{}
+	// lost is the address of the last connection lost, the host is tried
+	// last when reconnecting
+	lost string
+
+	// events received within the configured delays are coalesced
+	eventMu      sync.Mutex
+	refreshTimer *time.Timer
+	statusTimers map[string]*time.Timer
+	statusUp     map[string]bool
+}
+
+func newControlConn(session *Session) (*controlConn, error) {
+	c := &controlConn{
+		session:      session,
+		quit:         make(chan struct{}),
+		statusTimers: make(map[string]*time.Timer),
+		statusUp:     make(map[string]bool),
+	}
+
+	if session.cfg.SslOpts != nil {
+		tlsConfig, err := setupTLSConfig(session.cfg.SslOpts)
+		if err != nil {
+			return nil, err
+		}
+		c.tlsConfig = tlsConfig
+	}
+
+	return c, nil
+}
+
+// hosts returns the addresses of the hosts to connect to in order: the hosts
+// the pool is connected to, the contact points, then the discovered hosts.
+// The host of the connection lost is tried last.
+func (c *controlConn) hosts() []string {
+	cfg := &c.session.cfg
+
+	var hosts []string
+	if p, ok := c.session.Pool.(HostConns); ok {
+		for addr, conns := range p.HostConns() {
+			if len(conns) > 0 {
+				hosts = append(hosts, addr)
+			}
+		}
+	}
+
+	if c.session.contactPoints != nil {
+		hosts = append(hosts, c.session.contactPoints.get()...)
+	} else {
+		hosts = append(hosts, cfg.Hosts...)
+	}
+	if c.session.hostSource != nil {
+		for _, host := range c.session.hostSource.knownHosts() {
+			hosts = append(hosts, host.Peer)
+		}
+	}
+
+	c.mu.Lock()
+	lost := c.lost
+	c.mu.Unlock()
+
+	addrs := make([]string, 0, len(hosts)+1)
+	seen := make(map[string]bool, len(hosts)+1)
+	seen[lost] = lost != ""
+	for _, host := range hosts {
+		addr := JoinHostPort(host, cfg.Port)
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	if lost != "" {
+		addrs = append(addrs, lost)
+	}
+	return addrs
+}
+
+// connect opens a connection to the first reachable host, see hosts.
+func (c *controlConn) connect() error {
+	cfg := &c.session.cfg
+
+	connCfg := ConnConfig{
+		ProtoVersion:  cfg.ProtoVersion,
+		CQLVersion:    cfg.CQLVersion,
+		Timeout:       cfg.Timeout,
+		Compressor:    cfg.Compressor,
+		Authenticator: cfg.Authenticator,
+		Keepalive:     cfg.SocketKeepalive,
+		tlsConfig:     c.tlsConfig,
+
+		ConnectTimeout:       cfg.ConnectTimeout,
+		WriteTimeout:         cfg.WriteTimeout,
+		DisableNoDelay:       cfg.DisableNoDelay,
+		CompressionThreshold: cfg.CompressionThreshold,
+		HeartbeatInterval:    cfg.HeartbeatInterval,
+		MaxInFlight:          cfg.MaxInFlightPerConn,
+		MaxQueued:            cfg.MaxQueuedPerConn,
+		MaxQueueWait:         cfg.MaxQueueWait,
+		Compressors:          cfg.Compressors,
+		ConnectObserver:      cfg.ConnectObserver,
+		FrameHeaderObserver:  cfg.FrameHeaderObserver,
+		Logger:               cfg.Logger,
+		Dialer:               cfg.Dialer,
+		FallbackDelay:        cfg.DualStackFallbackDelay,
+		eventHandler:         c.handleEvent,
+		hostOptions:          cfg.hostOptions,
+	}
+
+	var err error
+	for _, addr := range c.hosts() {
+		var conn *Conn
+		conn, err = Connect(addr, connCfg, c)
+		if err != nil {
+			continue
+		}
+
+		if err = conn.register([]string{"TOPOLOGY_CHANGE", "STATUS_CHANGE", "SCHEMA_CHANGE"}); err != nil {
+			conn.Close()
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.conn = conn
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	if err == nil {
+		err = ErrNoConnections
+	}
+	return err
+}
+
+// getConn returns the connection, or nil while it is reopened.
+func (c *controlConn) getConn() *Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// reconnect opens a new connection, retrying with the delays of the
+// reconnection policy until it succeeds or the control connection is closed.
+func (c *controlConn) reconnect() {
+	policy := c.session.cfg.reconnectionPolicy()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.quit:
+			return
+		case <-time.After(policy.GetInterval(attempt)):
+		}
+
+		err := c.connect()
+		if err == nil {
+			c.reconcile()
+			return
+		}
+
+		c.session.cfg.logger().Warn("gocql: unable to open the control connection", "error", err)
+	}
+}
+
+// failover opens a connection to another host at once, as the other hosts
+// are likely up, then reconnects with the delays of the reconnection policy.
+func (c *controlConn) failover() {
+	if err := c.connect(); err != nil {
+		c.session.cfg.logger().Warn("gocql: unable to open the control connection", "error", err)
+		c.reconnect()
+		return
+	}
+	c.reconcile()
+}
+
+// reconcile refreshes the ring and drops the cached schema metadata once
+// the connection is reopened, the events sent meanwhile were missed.
+func (c *controlConn) reconcile() {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return
+	}
+
+	if c.session.hostSource != nil {
+		if err := c.session.hostSource.refresh(); err != nil {
+			c.session.cfg.logger().Warn("gocql: unable to get the ring topology", "error", err)
+		}
+	}
+	c.session.clearMetadata()
+}
+
+func (c *controlConn) HandleError(conn *Conn, err error, closed bool) {
+	if !closed {
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed || c.conn != conn {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	c.lost = conn.Address()
+	c.mu.Unlock()
+
+	c.session.cfg.logger().Warn("gocql: control connection lost", "host", conn.Address(), "error", err)
+	go c.failover()
+}
+
+func (c *controlConn) handleEvent(f frame) {
+	switch v := f.(type) {
+	case *topologyChangeEventFrame:
+		c.handleTopologyChange(v)
+	case *statusChangeEventFrame:
+		c.handleStatusChange(v)
+	case *resultSchemaChangeFrame:
+		c.session.handleSchemaChange(v.keyspace, v.table)
+	}
+}
+
+// handleTopologyChange refreshes the hosts of the ring, which adds new hosts
+// to the pool and removes the decommissioned ones.
+func (c *controlConn) handleTopologyChange(f *topologyChangeEventFrame) {
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+
+	if c.refreshTimer != nil {
+		// a refresh is already scheduled
+		return
+	}
+
+	c.refreshTimer = time.AfterFunc(c.session.cfg.Discovery.TopologyEventDelay, func() {
+		c.eventMu.Lock()
+		c.refreshTimer = nil
+		c.eventMu.Unlock()
+
+		if c.session.hostSource == nil {
+			return
+		}
+		if err := c.session.hostSource.refresh(); err != nil {
+			c.session.cfg.logger().Warn("gocql: unable to get the ring topology", "error", err)
+		}
+	})
+}
+
+// handleStatusChange marks the host up or down in the pool, once the status
+// of the host did not change for the configured delay.
+func (c *controlConn) handleStatusChange(f *statusChangeEventFrame) {
+	addr := c.session.cfg.translateAddress(f.host.String())
+
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+
+	c.statusUp[addr] = f.change == "UP"
+	if _, ok := c.statusTimers[addr]; ok {
+		// the last status is applied when the timer fires
+		return
+	}
+
+	c.statusTimers[addr] = time.AfterFunc(c.session.cfg.Discovery.StatusEventDelay, func() {
+		c.eventMu.Lock()
+		up := c.statusUp[addr]
+		delete(c.statusUp, addr)
+		delete(c.statusTimers, addr)
+		c.eventMu.Unlock()
+
+		if pool, ok := c.session.Pool.(HostStatus); ok {
+			if up {
+				pool.HostUp(addr)
+			} else {
+				pool.HostDown(addr)
+			}
+		}
+
+		if c.session.hostSource != nil {
+			c.session.hostSource.notifyStatus(addr, up)
+		}
+	})
+}
+
+func (c *controlConn) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.quit)
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	c.eventMu.Lock()
+	if c.refreshTimer != nil {
+		c.refreshTimer.Stop()
+	}
+	for _, timer := range c.statusTimers {
+		timer.Stop()
+	}
+	c.eventMu.Unlock()
+}
@@ -0,0 +1,224 @@
+// +build all unit
+
+package gocql
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type hostStatusPool struct {
+	ConnectionPool
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (p *hostStatusPool) HostDown(addr string) {
+	p.mu.Lock()
+	p.events = append(p.events, "down "+addr)
+	p.mu.Unlock()
+}
+
+func (p *hostStatusPool) HostUp(addr string) {
+	p.mu.Lock()
+	p.events = append(p.events, "up "+addr)
+	p.mu.Unlock()
+}
+
+func TestControlConnStatusChange(t *testing.T) {
+	pool := &hostStatusPool{}
+	session := &Session{Pool: pool}
+	session.cfg.Discovery.StatusEventDelay = 50 * time.Millisecond
+
+	control, err := newControlConn(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.close()
+
+	event := func(change, host string) {
+		control.handleEvent(&statusChangeEventFrame{change: change, host: net.ParseIP(host), port: 9042})
+	}
+
+	// flapping host, only its last status is applied
+	event("DOWN", "10.0.0.1")
+	event("UP", "10.0.0.1")
+	event("DOWN", "10.0.0.1")
+	event("UP", "10.0.0.2")
+
+	time.Sleep(200 * time.Millisecond)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if len(pool.events) != 2 {
+		t.Fatalf("expected 2 status changes got %v", pool.events)
+	}
+
+	got := map[string]bool{pool.events[0]: true, pool.events[1]: true}
+	for _, expected := range []string{"down 10.0.0.1", "up 10.0.0.2"} {
+		if !got[expected] {
+			t.Errorf("expected %q in %v", expected, pool.events)
+		}
+	}
+}
+
+func TestHostConnPoolDown(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	host, portStr, err := net.SplitHostPort(srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := net.LookupPort("tcp", portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := NewCluster(host)
+	cluster.Port = port
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 2
+
+	pool, err := NewRoundRobinConnPool(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if size := pool.Size(); size != 2 {
+		t.Fatalf("expected 2 connections got %d", size)
+	}
+
+	status := pool.(HostStatus)
+
+	status.HostDown(host)
+	if size := pool.Size(); size != 0 {
+		t.Errorf("expected no connection to a down host got %d", size)
+	}
+	if conn := pool.Pick(nil); conn != nil {
+		t.Errorf("expected no connection to be picked for a down host")
+	}
+
+	status.HostUp(host)
+
+	// the pool may still be backing off from its previous fill, picking a
+	// connection fills it again
+	deadline := time.Now().Add(time.Second)
+	for pool.Size() < 2 && time.Now().Before(deadline) {
+		pool.Pick(nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if size := pool.Size(); size != 2 {
+		t.Errorf("expected 2 connections once the host is up got %d", size)
+	}
+}
+
+func TestControlConnSchemaChange(t *testing.T) {
+	control, err := newControlConn(&Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.close()
+
+	prepared := func(keyspace, table string) *resultPreparedFrame {
+		return &resultPreparedFrame{
+			reqMeta: resultMetadata{
+				columns: []ColumnInfo{{Keyspace: keyspace, Table: table, Name: "id"}},
+			},
+		}
+	}
+
+	stmts := map[string]*resultPreparedFrame{
+		"schema_change_ks_t1": prepared("schema_change_ks", "t1"),
+		"schema_change_ks_t2": prepared("schema_change_ks", "t2"),
+		"schema_change_other": prepared("schema_change_other", "t1"),
+	}
+
+	stmtsLRU.Lock()
+	if stmtsLRU.lru == nil {
+		initStmtsLRU(defaultMaxPreparedStmts)
+	}
+	for key, info := range stmts {
+		stmtsLRU.lru.Add(key, &inflightPrepare{info: info})
+		stmtsLRU.track(key, info)
+	}
+	stmtsLRU.Unlock()
+
+	cached := func(key string) bool {
+		stmtsLRU.Lock()
+		defer stmtsLRU.Unlock()
+		_, ok := stmtsLRU.lru.Get(key)
+		return ok
+	}
+
+	control.handleEvent(&resultSchemaChangeFrame{change: "UPDATED", keyspace: "schema_change_ks", table: "t1"})
+	if cached("schema_change_ks_t1") {
+		t.Error("expected the statement of the updated table to be evicted")
+	}
+	if !cached("schema_change_ks_t2") || !cached("schema_change_other") {
+		t.Error("expected the statements of the other tables to be cached")
+	}
+
+	control.handleEvent(&resultSchemaChangeFrame{change: "DROPPED", keyspace: "schema_change_ks"})
+	if cached("schema_change_ks_t2") {
+		t.Error("expected the statements of the dropped keyspace to be evicted")
+	}
+	if !cached("schema_change_other") {
+		t.Error("expected the statement of the other keyspace to be cached")
+	}
+
+	stmtsLRU.Lock()
+	stmtsLRU.lru.Remove("schema_change_other")
+	if _, ok := stmtsLRU.tables["schema_change_other"]; ok {
+		t.Error("expected the tables of the evicted statements to be forgotten")
+	}
+	stmtsLRU.Unlock()
+}
+
+func TestControlConnFailover(t *testing.T) {
+	srv1 := NewTestServer(t, defaultProto)
+	defer srv1.Stop()
+	srv2 := NewTestServer(t, defaultProto)
+	defer srv2.Stop()
+
+	cluster := NewCluster(srv1.Address, srv2.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	session := &Session{Pool: &hostStatusPool{}, cfg: *cluster}
+
+	control, err := newControlConn(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.close()
+
+	if err := control.connect(); err != nil {
+		t.Fatal(err)
+	}
+	lost := control.getConn()
+	if lost.Address() != srv1.Address {
+		t.Fatalf("expected the control connection to %s got %s", srv1.Address, lost.Address())
+	}
+
+	// the host dies, another one takes over at once
+	lost.conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn := control.getConn()
+		if conn != nil && conn != lost {
+			if conn.Address() != srv2.Address {
+				t.Errorf("expected the control connection to fail over to %s got %s", srv2.Address, conn.Address())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the control connection to be reopened")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
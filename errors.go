@@ -2,24 +2,64 @@ package gocql
 
 import "fmt"
 
+// ErrorCode is the code of the errors returned by the hosts. The codes are
+// errors themselves so that the request errors can be matched with
+// errors.Is, for example errors.Is(err, ErrCodeWriteTimeout).
+type ErrorCode int
+
 const (
-	errServer        = 0x0000
-	errProtocol      = 0x000A
-	errCredentials   = 0x0100
-	errUnavailable   = 0x1000
-	errOverloaded    = 0x1001
-	errBootstrapping = 0x1002
-	errTruncate      = 0x1003
-	errWriteTimeout  = 0x1100
-	errReadTimeout   = 0x1200
-	errSyntax        = 0x2000
-	errUnauthorized  = 0x2100
-	errInvalid       = 0x2200
-	errConfig        = 0x2300
-	errAlreadyExists = 0x2400
-	errUnprepared    = 0x2500
+	ErrCodeServer          ErrorCode = 0x0000
+	ErrCodeProtocol        ErrorCode = 0x000A
+	ErrCodeCredentials     ErrorCode = 0x0100
+	ErrCodeUnavailable     ErrorCode = 0x1000
+	ErrCodeOverloaded      ErrorCode = 0x1001
+	ErrCodeBootstrapping   ErrorCode = 0x1002
+	ErrCodeTruncate        ErrorCode = 0x1003
+	ErrCodeWriteTimeout    ErrorCode = 0x1100
+	ErrCodeReadTimeout     ErrorCode = 0x1200
+	ErrCodeReadFailure     ErrorCode = 0x1300
+	ErrCodeFunctionFailure ErrorCode = 0x1400
+	ErrCodeWriteFailure    ErrorCode = 0x1500
+	ErrCodeCDCWriteFailure ErrorCode = 0x1600
+	ErrCodeCASWriteUnknown ErrorCode = 0x1700
+	ErrCodeSyntax          ErrorCode = 0x2000
+	ErrCodeUnauthorized    ErrorCode = 0x2100
+	ErrCodeInvalid         ErrorCode = 0x2200
+	ErrCodeConfig          ErrorCode = 0x2300
+	ErrCodeAlreadyExists   ErrorCode = 0x2400
+	ErrCodeUnprepared      ErrorCode = 0x2500
 )
 
+var errorCodeNames = map[ErrorCode]string{
+	ErrCodeServer:          "server error",
+	ErrCodeProtocol:        "protocol error",
+	ErrCodeCredentials:     "bad credentials",
+	ErrCodeUnavailable:     "unavailable",
+	ErrCodeOverloaded:      "overloaded",
+	ErrCodeBootstrapping:   "bootstrapping",
+	ErrCodeTruncate:        "truncate error",
+	ErrCodeWriteTimeout:    "write timeout",
+	ErrCodeReadTimeout:     "read timeout",
+	ErrCodeReadFailure:     "read failure",
+	ErrCodeFunctionFailure: "function failure",
+	ErrCodeWriteFailure:    "write failure",
+	ErrCodeCDCWriteFailure: "cdc write failure",
+	ErrCodeCASWriteUnknown: "cas write unknown",
+	ErrCodeSyntax:          "syntax error",
+	ErrCodeUnauthorized:    "unauthorized",
+	ErrCodeInvalid:         "invalid query",
+	ErrCodeConfig:          "config error",
+	ErrCodeAlreadyExists:   "already exists",
+	ErrCodeUnprepared:      "unprepared",
+}
+
+func (c ErrorCode) Error() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return "gocql: " + name
+	}
+	return fmt.Sprintf("gocql: unknown error code 0x%04x", int(c))
+}
+
 type RequestError interface {
 	Code() int
 	Message() string
@@ -37,6 +77,23 @@ func (e errorFrame) Code() int {
 	return e.code
 }
 
+// ErrorCode returns the code of the error.
+func (e errorFrame) ErrorCode() ErrorCode {
+	return ErrorCode(e.code)
+}
+
+// Is reports whether the error has the code of target, which is either an
+// ErrorCode or another RequestError.
+func (e errorFrame) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCode:
+		return ErrorCode(e.code) == t
+	case RequestError:
+		return e.code == t.Code()
+	}
+	return false
+}
+
 func (e errorFrame) Message() string {
 	return e.message
 }
@@ -86,3 +143,51 @@ type RequestErrUnprepared struct {
 	errorFrame
 	StatementId []byte
 }
+
+// ErrorMap maps the addresses of the replicas which failed a request to the
+// code of their failure, it is only sent by protocol 5 and above.
+type ErrorMap map[string]uint16
+
+type RequestErrReadFailure struct {
+	errorFrame
+	Consistency Consistency
+	Received    int
+	BlockFor    int
+	NumFailures int
+	DataPresent byte
+	// v5+
+	ErrorMap ErrorMap
+}
+
+type RequestErrWriteFailure struct {
+	errorFrame
+	Consistency Consistency
+	Received    int
+	BlockFor    int
+	NumFailures int
+	WriteType   string
+	// v5+
+	ErrorMap ErrorMap
+}
+
+type RequestErrFunctionFailure struct {
+	errorFrame
+	Keyspace string
+	Function string
+	ArgTypes []string
+}
+
+// RequestErrCDCWriteFailure is returned when a write to a table with CDC
+// enabled failed because the CDC space is full, it requires protocol 5.
+type RequestErrCDCWriteFailure struct {
+	errorFrame
+}
+
+// RequestErrCASWriteUnknown is returned when the outcome of a lightweight
+// transaction is unknown because of contention, it requires protocol 5.
+type RequestErrCASWriteUnknown struct {
+	errorFrame
+	Consistency Consistency
+	Received    int
+	BlockFor    int
+}
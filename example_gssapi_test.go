@@ -0,0 +1,96 @@
+// +build all unit
+
+package gocql
+
+import (
+	"fmt"
+	"net"
+)
+
+// GSSAPIClient is implemented by a Kerberos library which provides the
+// GSSAPI SASL mechanism, it is used by the example authenticator below.
+type GSSAPIClient interface {
+	// Start begins a new security context with the given service principal
+	// and returns the initial token.
+	Start(service string) ([]byte, error)
+	// Step processes a token received from the server and returns the
+	// token to send back, it is called until the server accepts the
+	// security context.
+	Step(token []byte) ([]byte, error)
+}
+
+// DSEGSSAPIAuthenticator authenticates with the DseAuthenticator of
+// DataStax Enterprise nodes configured for Kerberos.
+type DSEGSSAPIAuthenticator struct {
+	// NewClient returns a new GSSAPI client for every connection.
+	NewClient func() GSSAPIClient
+	// Service is the service part of the principal of the nodes, the
+	// principal is Service/host (default: "dse").
+	Service string
+}
+
+func (a DSEGSSAPIAuthenticator) ForHost(addr string) (Authenticator, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	service := a.Service
+	if service == "" {
+		service = "dse"
+	}
+
+	return &dseGSSAPIConn{
+		client:    a.NewClient(),
+		principal: service + "/" + host,
+	}, nil
+}
+
+func (a DSEGSSAPIAuthenticator) Challenge(req []byte) ([]byte, Authenticator, error) {
+	return nil, nil, fmt.Errorf("gssapi: authenticator must be used per host")
+}
+
+func (a DSEGSSAPIAuthenticator) Success(data []byte) error {
+	return nil
+}
+
+// dseGSSAPIConn keeps track of the handshake of a single connection.
+type dseGSSAPIConn struct {
+	client    GSSAPIClient
+	principal string
+}
+
+func (c *dseGSSAPIConn) Challenge(req []byte) ([]byte, Authenticator, error) {
+	switch string(req) {
+	case "com.datastax.bdp.cassandra.auth.DseAuthenticator":
+		// select the SASL mechanism, the server acknowledges it with an
+		// empty GSSAPI-START challenge
+		return []byte("GSSAPI"), c, nil
+	case "GSSAPI-START":
+		token, err := c.client.Start(c.principal)
+		return token, c, err
+	}
+
+	token, err := c.client.Step(req)
+	return token, c, err
+}
+
+func (c *dseGSSAPIConn) Success(data []byte) error {
+	return nil
+}
+
+func ExampleHostAuthenticator() {
+	cluster := NewCluster("dse1.example.com", "dse2.example.com")
+	cluster.ProtoVersion = 3
+	cluster.Authenticator = DSEGSSAPIAuthenticator{
+		NewClient: func() GSSAPIClient {
+			// return a client backed by the Kerberos library of
+			// your choice here
+			return nil
+		},
+	}
+
+	// connections now authenticate as the Kerberos principal of the
+	// current user against dse/dse1.example.com and dse/dse2.example.com
+	_ = cluster
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+)
+
+// RowView is the current row of Query.ForEach, it is only valid during the
+// call of the callback.
+type RowView struct {
+	iter *Iter
+}
+
+// Columns returns the name and type of the selected columns.
+func (r RowView) Columns() []ColumnInfo {
+	return r.iter.meta.columns
+}
+
+// Scan copies the columns of the row into the values pointed at by dest,
+// see Iter.Scan.
+func (r RowView) Scan(dest ...interface{}) error {
+	r.iter.pos, r.iter.err = 0, nil
+	r.iter.Scan(dest...)
+	return r.iter.err
+}
+
+// MapScan copies the columns of the row into m, see Iter.MapScan.
+func (r RowView) MapScan(m map[string]interface{}) error {
+	r.iter.pos, r.iter.err = 0, nil
+	r.iter.MapScan(m)
+	return r.iter.err
+}
+
+// StructScan copies the columns of the row into the fields of the struct
+// pointed at by dest, see Iter.StructScan.
+func (r RowView) StructScan(dest interface{}) error {
+	r.iter.pos, r.iter.err = 0, nil
+	r.iter.StructScan(dest)
+	return r.iter.err
+}
+
+// rowViewDecoder makes the rows decoded by an iterator the single row of
+// the iterator of a RowView.
+type rowViewDecoder struct {
+	view *Iter
+}
+
+func (d rowViewDecoder) DecodeRow(columns []ColumnInfo, row [][]byte) error {
+	count := len(columns)
+	for _, col := range columns {
+		if tuple, ok := col.TypeInfo.(TupleTypeInfo); ok {
+			count += len(tuple.Elems) - 1
+		}
+	}
+
+	d.view.meta = resultMetadata{columns: columns, actualColCount: count}
+	d.view.rows = [][][]byte{row}
+	return nil
+}
+
+// ForEach executes the query with ctx and calls fn with each selected row,
+// the next pages are fetched in the background as set by Query.Prefetch.
+// The iteration stops at the first error returned by fn, which ForEach
+// returns, or when ctx is done. It returns the error of the query
+// otherwise.
+func (q *Query) ForEach(ctx context.Context, fn func(row RowView) error) error {
+	iter := q.WithContext(ctx).Iter()
+
+	view := &Iter{}
+	for iter.Scan(rowViewDecoder{view: view}) {
+		if err := fn(RowView{iter: view}); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
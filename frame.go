@@ -21,6 +21,8 @@ const (
 	protoVersion1      = 0x01
 	protoVersion2      = 0x02
 	protoVersion3      = 0x03
+	protoVersion4      = 0x04
+	protoVersion5      = 0x05
 
 	maxFrameSize = 256 * 1024 * 1024
 )
@@ -121,19 +123,27 @@ const (
 	flagGlobalTableSpec int = 0x01
 	flagHasMorePages        = 0x02
 	flagNoMetaData          = 0x04
-
-	// query flags
-	flagValues                byte = 0x01
-	flagSkipMetaData               = 0x02
-	flagPageSize                   = 0x04
-	flagWithPagingState            = 0x08
-	flagWithSerialConsistency      = 0x10
-	flagDefaultTimestamp           = 0x20
-	flagWithNameValues             = 0x40
+	flagMetaDataChanged     = 0x08
+
+	// query flags, written as a byte before protocol v5
+	flagValues                uint32 = 0x01
+	flagSkipMetaData                 = 0x02
+	flagPageSize                     = 0x04
+	flagWithPagingState              = 0x08
+	flagWithSerialConsistency        = 0x10
+	flagDefaultTimestamp             = 0x20
+	flagWithNameValues               = 0x40
+	flagWithKeyspace                 = 0x80
+	flagWithNowInSeconds             = 0x100
+
+	// prepare flags, v5+
+	flagPrepareWithKeyspace = 0x01
 
 	// header flags
-	flagCompress byte = 0x01
-	flagTracing       = 0x02
+	flagCompress      byte = 0x01
+	flagTracing            = 0x02
+	flagCustomPayload      = 0x04
+	flagWarning            = 0x08
 )
 
 type Consistency uint16
@@ -227,6 +237,10 @@ type frameHeader struct {
 	stream  int
 	op      frameOp
 	length  int
+
+	// v4+
+	warnings      []string
+	customPayload map[string][]byte
 }
 
 func (f frameHeader) String() string {
@@ -239,6 +253,10 @@ func (f frameHeader) Header() frameHeader {
 
 const defaultBufSize = 128
 
+// maxFramerBufSize is the size of the largest buffers kept by the framers
+// returned to framerPool, the larger ones go back to the buffer pools.
+const maxFramerBufSize = 64 * 1024
+
 var framerPool = sync.Pool{
 	New: func() interface{} {
 		return &framer{
@@ -258,12 +276,18 @@ type framer struct {
 	flags    byte
 	compres  Compressor
 	headSize int
+	// outgoing frames with a smaller body are not compressed
+	compressThreshold int
 	// if this frame was read then the header will be here
 	header *frameHeader
 
 	// if tracing flag is set this is not nil
 	traceID []byte
 
+	// borrowBytes makes the values of the rows alias rbuf instead of being
+	// copied
+	borrowBytes bool
+
 	// holds a ref to the whole byte slice for rbuf so that it can be reset to
 	// 0 after a read.
 	readBuffer []byte
@@ -290,6 +314,7 @@ func newFramer(r io.Reader, w io.Writer, compressor Compressor, version byte) *f
 	f.proto = version
 	f.flags = flags
 	f.headSize = headSize
+	f.compressThreshold = 0
 
 	f.r = r
 	f.rbuf = f.readBuffer[:0]
@@ -299,10 +324,46 @@ func newFramer(r io.Reader, w io.Writer, compressor Compressor, version byte) *f
 
 	f.header = nil
 	f.traceID = nil
+	f.borrowBytes = false
 
 	return f
 }
 
+// release returns the framer to framerPool and its large buffers to the
+// buffer pools, neither it nor the slices of its buffers can be used
+// afterwards.
+func (f *framer) release() {
+	if cap(f.readBuffer) > maxFramerBufSize {
+		putBuffer(f.readBuffer)
+		f.readBuffer = nil
+	}
+	if cap(f.wbuf) > maxFramerBufSize {
+		putBuffer(f.wbuf)
+		f.wbuf = nil
+	}
+	f.rbuf = nil
+
+	framerPool.Put(f)
+}
+
+// grow makes room for n more bytes in the write buffer, taking the larger
+// buffer from the buffer pools.
+func (f *framer) grow(n int) {
+	if cap(f.wbuf)-len(f.wbuf) >= n {
+		return
+	}
+
+	size := 2 * cap(f.wbuf)
+	if size < len(f.wbuf)+n {
+		size = len(f.wbuf) + n
+	}
+
+	buf := getBuffer(size)[:len(f.wbuf)]
+	copy(buf, f.wbuf)
+	putBuffer(f.wbuf)
+	f.wbuf = buf
+}
+
 type frame interface {
 	Header() frameHeader
 }
@@ -315,7 +376,7 @@ func readHeader(r io.Reader, p []byte) (head frameHeader, err error) {
 
 	version := p[0] & protoVersionMask
 
-	if version < protoVersion1 || version > protoVersion3 {
+	if version < protoVersion1 || version > protoVersion5 {
 		err = fmt.Errorf("invalid version: %x", version)
 		return
 	}
@@ -357,17 +418,16 @@ func (f *framer) readFrame(head *frameHeader) error {
 		// need to free up the connection to be used again
 		_, err := io.CopyN(ioutil.Discard, f.r, int64(head.length))
 		if err != nil {
-			return fmt.Errorf("error whilst trying to discard frame with invalid length: %v", err)
+			return fmt.Errorf("error whilst trying to discard frame with invalid length: %w", err)
 		}
 		return ErrFrameTooBig
 	}
 
-	if cap(f.readBuffer) >= head.length {
-		f.rbuf = f.readBuffer[:head.length]
-	} else {
-		f.readBuffer = make([]byte, head.length)
-		f.rbuf = f.readBuffer
+	if cap(f.readBuffer) < head.length {
+		putBuffer(f.readBuffer)
+		f.readBuffer = getBuffer(head.length)
 	}
+	f.rbuf = f.readBuffer[:head.length]
 
 	// assume the underlying reader takes care of timeouts and retries
 	_, err := io.ReadFull(f.r, f.rbuf)
@@ -408,6 +468,14 @@ func (f *framer) parseFrame() (frame frame, err error) {
 		f.readTrace()
 	}
 
+	if f.header.flags&flagWarning == flagWarning {
+		f.header.warnings = f.readStringList()
+	}
+
+	if f.header.flags&flagCustomPayload == flagCustomPayload {
+		f.header.customPayload = f.readBytesMap()
+	}
+
 	// asumes that the frame body has been read into rbuf
 	switch f.header.op {
 	case opError:
@@ -424,6 +492,8 @@ func (f *framer) parseFrame() (frame frame, err error) {
 		frame = f.parseAuthChallengeFrame()
 	case opAuthSuccess:
 		frame = f.parseAuthSuccessFrame()
+	case opEvent:
+		frame = f.parseEventFrame()
 	default:
 		return nil, NewErrProtocol("unknown op in frame header: %s", f.header.op)
 	}
@@ -441,8 +511,8 @@ func (f *framer) parseErrorFrame() frame {
 		message:     msg,
 	}
 
-	switch code {
-	case errUnavailable:
+	switch ErrorCode(code) {
+	case ErrCodeUnavailable:
 		cl := f.readConsistency()
 		required := f.readInt()
 		alive := f.readInt()
@@ -452,7 +522,7 @@ func (f *framer) parseErrorFrame() frame {
 			Required:    required,
 			Alive:       alive,
 		}
-	case errWriteTimeout:
+	case ErrCodeWriteTimeout:
 		cl := f.readConsistency()
 		received := f.readInt()
 		blockfor := f.readInt()
@@ -464,7 +534,7 @@ func (f *framer) parseErrorFrame() frame {
 			BlockFor:    blockfor,
 			WriteType:   writeType,
 		}
-	case errReadTimeout:
+	case ErrCodeReadTimeout:
 		cl := f.readConsistency()
 		received := f.readInt()
 		blockfor := f.readInt()
@@ -476,7 +546,51 @@ func (f *framer) parseErrorFrame() frame {
 			BlockFor:    blockfor,
 			DataPresent: dataPresent,
 		}
-	case errAlreadyExists:
+	case ErrCodeReadFailure:
+		res := &RequestErrReadFailure{
+			errorFrame: errD,
+		}
+		res.Consistency = f.readConsistency()
+		res.Received = f.readInt()
+		res.BlockFor = f.readInt()
+		res.NumFailures, res.ErrorMap = f.readFailures()
+		res.DataPresent = f.readByte()
+		return res
+	case ErrCodeWriteFailure:
+		res := &RequestErrWriteFailure{
+			errorFrame: errD,
+		}
+		res.Consistency = f.readConsistency()
+		res.Received = f.readInt()
+		res.BlockFor = f.readInt()
+		res.NumFailures, res.ErrorMap = f.readFailures()
+		res.WriteType = f.readString()
+		return res
+	case ErrCodeFunctionFailure:
+		ks := f.readString()
+		function := f.readString()
+		argTypes := f.readStringList()
+		return &RequestErrFunctionFailure{
+			errorFrame: errD,
+			Keyspace:   ks,
+			Function:   function,
+			ArgTypes:   argTypes,
+		}
+	case ErrCodeCDCWriteFailure:
+		return &RequestErrCDCWriteFailure{
+			errorFrame: errD,
+		}
+	case ErrCodeCASWriteUnknown:
+		cl := f.readConsistency()
+		received := f.readInt()
+		blockfor := f.readInt()
+		return &RequestErrCASWriteUnknown{
+			errorFrame:  errD,
+			Consistency: cl,
+			Received:    received,
+			BlockFor:    blockfor,
+		}
+	case ErrCodeAlreadyExists:
 		ks := f.readString()
 		table := f.readString()
 		return &RequestErrAlreadyExists{
@@ -484,7 +598,7 @@ func (f *framer) parseErrorFrame() frame {
 			Keyspace:   ks,
 			Table:      table,
 		}
-	case errUnprepared:
+	case ErrCodeUnprepared:
 		stmtId := f.readShortBytes()
 		return &RequestErrUnprepared{
 			errorFrame:  errD,
@@ -495,7 +609,37 @@ func (f *framer) parseErrorFrame() frame {
 	}
 }
 
+// readFailures reads the failures of a read or write failure error, protocol
+// 5 sends the address and the reason of each failure while the older ones
+// only send their number.
+func (f *framer) readFailures() (int, ErrorMap) {
+	if f.proto < protoVersion5 {
+		return f.readInt(), nil
+	}
+
+	n := f.readInt()
+	errMap := make(ErrorMap, n)
+	for i := 0; i < n; i++ {
+		size := int(f.readByte())
+		if size != 4 && size != 16 {
+			panic(fmt.Errorf("invalid IP size: %d", size))
+		}
+		if len(f.rbuf) < size {
+			panic(fmt.Errorf("not enough bytes in buffer to read inet require %d got: %d", size, len(f.rbuf)))
+		}
+		ip := net.IP(f.rbuf[:size]).String()
+		f.rbuf = f.rbuf[size:]
+
+		errMap[ip] = f.readShort()
+	}
+
+	return n, errMap
+}
+
 func (f *framer) writeHeader(flags byte, op frameOp, stream int) {
+	if f.wbuf == nil {
+		f.wbuf = make([]byte, 0, defaultBufSize)
+	}
 	f.wbuf = f.wbuf[:0]
 	f.wbuf = append(f.wbuf,
 		f.proto,
@@ -523,6 +667,18 @@ func (f *framer) writeHeader(flags byte, op frameOp, stream int) {
 	)
 }
 
+// writeCustomPayload writes the custom payload of a request, it must be
+// called directly after writeHeader. Custom payloads are only supported by
+// protocol 4 and above and are silently dropped for older versions.
+func (f *framer) writeCustomPayload(payload map[string][]byte) {
+	if len(payload) == 0 || f.proto < protoVersion4 {
+		return
+	}
+
+	f.wbuf[1] |= flagCustomPayload
+	f.writeBytesMap(payload)
+}
+
 func (f *framer) setLength(length int) {
 	p := 4
 	if f.proto > protoVersion2 {
@@ -542,12 +698,17 @@ func (f *framer) finishWrite() error {
 		return ErrFrameTooBig
 	}
 
+	if f.wbuf[1]&flagCompress == flagCompress && len(f.wbuf)-f.headSize < f.compressThreshold {
+		// the flag is per frame so small frames, which do not compress well,
+		// can be sent as is
+		f.wbuf[1] &^= flagCompress
+	}
+
 	if f.wbuf[1]&flagCompress == flagCompress {
 		if f.compres == nil {
 			panic("compress flag set with no compressor")
 		}
 
-		// TODO: only compress frames which are big enough
 		compressed, err := f.compres.Encode(f.wbuf[f.headSize:])
 		if err != nil {
 			return err
@@ -596,6 +757,78 @@ func (f *framer) parseSupportedFrame() frame {
 	}
 }
 
+type writeOptionsFrame struct{}
+
+func (w *writeOptionsFrame) writeFrame(framer *framer, streamID int) error {
+	return framer.writeOptionsFrame(streamID)
+}
+
+func (f *framer) writeOptionsFrame(streamID int) error {
+	f.writeHeader(f.flags&^flagCompress, opOptions, streamID)
+	return f.finishWrite()
+}
+
+type writeRegisterFrame struct {
+	events []string
+}
+
+func (w *writeRegisterFrame) writeFrame(framer *framer, streamID int) error {
+	return framer.writeRegisterFrame(streamID, w.events)
+}
+
+func (f *framer) writeRegisterFrame(streamID int, events []string) error {
+	f.writeHeader(f.flags, opRegister, streamID)
+	f.writeStringList(events)
+
+	return f.finishWrite()
+}
+
+type topologyChangeEventFrame struct {
+	frameHeader
+
+	change string
+	host   net.IP
+	port   int
+}
+
+func (t *topologyChangeEventFrame) String() string {
+	return fmt.Sprintf("[topology_change change=%s host=%v port=%d]", t.change, t.host, t.port)
+}
+
+type statusChangeEventFrame struct {
+	frameHeader
+
+	change string
+	host   net.IP
+	port   int
+}
+
+func (t *statusChangeEventFrame) String() string {
+	return fmt.Sprintf("[status_change change=%s host=%v port=%d]", t.change, t.host, t.port)
+}
+
+func (f *framer) parseEventFrame() frame {
+	eventType := f.readString()
+
+	switch eventType {
+	case "TOPOLOGY_CHANGE":
+		frame := &topologyChangeEventFrame{frameHeader: *f.header}
+		frame.change = f.readString()
+		frame.host, frame.port = f.readInet()
+		return frame
+	case "STATUS_CHANGE":
+		frame := &statusChangeEventFrame{frameHeader: *f.header}
+		frame.change = f.readString()
+		frame.host, frame.port = f.readInet()
+		return frame
+	case "SCHEMA_CHANGE":
+		// the body of the event is the one of a schema change result
+		return f.parseResultSchemaChange()
+	default:
+		panic(fmt.Errorf("gocql: unknown event type: %q", eventType))
+	}
+}
+
 type writeStartupFrame struct {
 	opts map[string]string
 }
@@ -613,15 +846,26 @@ func (f *framer) writeStartupFrame(streamID int, options map[string]string) erro
 
 type writePrepareFrame struct {
 	statement string
+
+	// v5+
+	keyspace string
 }
 
 func (w *writePrepareFrame) writeFrame(framer *framer, streamID int) error {
-	return framer.writePrepareFrame(streamID, w.statement)
+	return framer.writePrepareFrame(streamID, w.statement, w.keyspace)
 }
 
-func (f *framer) writePrepareFrame(stream int, statement string) error {
+func (f *framer) writePrepareFrame(stream int, statement, keyspace string) error {
 	f.writeHeader(f.flags, opPrepare, stream)
 	f.writeLongString(statement)
+	if f.proto >= protoVersion5 {
+		if keyspace != "" {
+			f.writeInt(flagPrepareWithKeyspace)
+			f.writeString(keyspace)
+		} else {
+			f.writeInt(0)
+		}
+	}
 	return f.finishWrite()
 }
 
@@ -697,6 +941,9 @@ type resultMetadata struct {
 
 	columns []ColumnInfo
 
+	// v4+, the indexes of the partition key columns in the bound variables
+	pkeyColumns []int
+
 	// this is a count of the total number of columns which can be scanned,
 	// it is at minimum len(columns) but may be larger, for instance when a column
 	// is a UDT or tuple.
@@ -741,10 +988,55 @@ func (f *framer) parseResultMetadata() resultMetadata {
 		meta.pagingState = f.readBytes()
 	}
 
+	if meta.flags&flagMetaDataChanged == flagMetaDataChanged {
+		// the metadata is always sent with the rows, the new ID of the
+		// metadata of the prepared statement is not needed
+		f.readShortBytes()
+	}
+
 	if meta.flags&flagNoMetaData == flagNoMetaData {
 		return meta
 	}
 
+	f.readColumns(&meta, colCount)
+
+	return meta
+}
+
+// parsePreparedMetadata reads the metadata of the bound variables of a
+// prepared statement. The partition key indexes must be read to parse the
+// prepared results of protocol v4, they are used to compute the routing keys.
+func (f *framer) parsePreparedMetadata() resultMetadata {
+	// the metadata of the bound variables has no paging state, and has the
+	// partition key indexes in v4+
+	meta := resultMetadata{
+		flags: f.readInt(),
+	}
+
+	colCount := f.readInt()
+	if colCount < 0 {
+		panic(fmt.Errorf("received negative column count: %d", colCount))
+	}
+	meta.actualColCount = colCount
+
+	if f.proto >= protoVersion4 {
+		pkeyCount := f.readInt()
+		if pkeyCount < 0 {
+			panic(fmt.Errorf("received negative partition key count: %d", pkeyCount))
+		}
+
+		meta.pkeyColumns = make([]int, pkeyCount)
+		for i := range meta.pkeyColumns {
+			meta.pkeyColumns[i] = int(f.readShort())
+		}
+	}
+
+	f.readColumns(&meta, colCount)
+
+	return meta
+}
+
+func (f *framer) readColumns(meta *resultMetadata, colCount int) {
 	var keyspace, table string
 	globalSpec := meta.flags&flagGlobalTableSpec == flagGlobalTableSpec
 	if globalSpec {
@@ -757,7 +1049,7 @@ func (f *framer) parseResultMetadata() resultMetadata {
 		// preallocate columninfo to avoid excess copying
 		cols = make([]ColumnInfo, colCount)
 		for i := 0; i < colCount; i++ {
-			f.readCol(&cols[i], &meta, globalSpec, keyspace, table)
+			f.readCol(&cols[i], meta, globalSpec, keyspace, table)
 		}
 
 	} else {
@@ -765,14 +1057,12 @@ func (f *framer) parseResultMetadata() resultMetadata {
 		// just a huge row.
 		for i := 0; i < colCount; i++ {
 			var col ColumnInfo
-			f.readCol(&col, &meta, globalSpec, keyspace, table)
+			f.readCol(&col, meta, globalSpec, keyspace, table)
 			cols = append(cols, col)
 		}
 	}
 
 	meta.columns = cols
-
-	return meta
 }
 
 type resultVoidFrame struct {
@@ -807,6 +1097,9 @@ type resultRowsFrame struct {
 
 	meta resultMetadata
 	rows [][][]byte
+	// buf is the buffer the values of the rows alias when the framer
+	// borrowed them
+	buf []byte
 }
 
 func (f *resultRowsFrame) String() string {
@@ -827,7 +1120,7 @@ func (f *framer) parseResultRows() frame {
 	for i := 0; i < numRows; i++ {
 		rows[i] = make([][]byte, colCount)
 		for j := 0; j < colCount; j++ {
-			rows[i][j] = f.readBytes()
+			rows[i][j] = f.readRowValue()
 		}
 	}
 
@@ -858,16 +1151,21 @@ type resultPreparedFrame struct {
 	frameHeader
 
 	preparedID []byte
-	reqMeta    resultMetadata
-	respMeta   resultMetadata
+	// v5+, the ID of respMeta sent when executing the statement
+	resultMetadataID []byte
+	reqMeta          resultMetadata
+	respMeta         resultMetadata
 }
 
 func (f *framer) parseResultPrepared() frame {
 	frame := &resultPreparedFrame{
 		frameHeader: *f.header,
 		preparedID:  f.readShortBytes(),
-		reqMeta:     f.parseResultMetadata(),
 	}
+	if f.proto >= protoVersion5 {
+		frame.resultMetadataID = f.readShortBytes()
+	}
+	frame.reqMeta = f.parsePreparedMetadata()
 
 	if f.proto < protoVersion2 {
 		return frame
@@ -988,6 +1286,8 @@ type queryValues struct {
 	value []byte
 	// optional name, will set With names for values flag
 	name string
+	// isUnset leaves the column untouched, v4+
+	isUnset bool
 }
 
 type queryParams struct {
@@ -999,12 +1299,27 @@ type queryParams struct {
 	pagingState       []byte
 	serialConsistency SerialConsistency
 	// v3+
-	defaultTimestamp bool
+	defaultTimestamp      bool
+	defaultTimestampValue int64
+	// v5+
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int
 }
 
 func (q queryParams) String() string {
-	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v values=%v]",
-		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.values)
+	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v keyspace=%q now_in_seconds=%v values=%v]",
+		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.keyspace, q.nowInSeconds, q.values)
+}
+
+// writeQueryFlags writes the flags of a query, an execution or a batch, which
+// are an int from protocol v5.
+func (f *framer) writeQueryFlags(flags uint32) {
+	if f.proto >= protoVersion5 {
+		f.writeInt(int32(flags))
+	} else {
+		f.writeByte(byte(flags))
+	}
 }
 
 func (f *framer) writeQueryParams(opts *queryParams) {
@@ -1014,7 +1329,7 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 		return
 	}
 
-	var flags byte
+	var flags uint32
 	if len(opts.values) > 0 {
 		flags |= flagValues
 	}
@@ -1045,7 +1360,16 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 		}
 	}
 
-	f.writeByte(flags)
+	if f.proto >= protoVersion5 {
+		if opts.keyspace != "" {
+			flags |= flagWithKeyspace
+		}
+		if opts.nowInSeconds {
+			flags |= flagWithNowInSeconds
+		}
+	}
+
+	f.writeQueryFlags(flags)
 
 	if n := len(opts.values); n > 0 {
 		f.writeShort(uint16(n))
@@ -1053,7 +1377,7 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 			if names {
 				f.writeString(opts.values[i].name)
 			}
-			f.writeBytes(opts.values[i].value)
+			f.writeValue(&opts.values[i])
 		}
 	}
 
@@ -1071,14 +1395,28 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 
 	if f.proto > protoVersion2 && opts.defaultTimestamp {
 		// timestamp in microseconds
-		ts := time.Now().UnixNano() / 1000
+		ts := opts.defaultTimestampValue
+		if ts == 0 {
+			ts = time.Now().UnixNano() / 1000
+		}
 		f.writeLong(ts)
 	}
+
+	if flags&flagWithKeyspace == flagWithKeyspace {
+		f.writeString(opts.keyspace)
+	}
+
+	if flags&flagWithNowInSeconds == flagWithNowInSeconds {
+		f.writeInt(int32(opts.nowInSecondsValue))
+	}
 }
 
 type writeQueryFrame struct {
 	statement string
 	params    queryParams
+
+	// v4+
+	customPayload map[string][]byte
 }
 
 func (w *writeQueryFrame) String() string {
@@ -1086,11 +1424,12 @@ func (w *writeQueryFrame) String() string {
 }
 
 func (w *writeQueryFrame) writeFrame(framer *framer, streamID int) error {
-	return framer.writeQueryFrame(streamID, w.statement, &w.params)
+	return framer.writeQueryFrame(streamID, w.statement, &w.params, w.customPayload)
 }
 
-func (f *framer) writeQueryFrame(streamID int, statement string, params *queryParams) error {
+func (f *framer) writeQueryFrame(streamID int, statement string, params *queryParams, customPayload map[string][]byte) error {
 	f.writeHeader(f.flags, opQuery, streamID)
+	f.writeCustomPayload(customPayload)
 	f.writeLongString(statement)
 	f.writeQueryParams(params)
 
@@ -1104,6 +1443,12 @@ type frameWriter interface {
 type writeExecuteFrame struct {
 	preparedID []byte
 	params     queryParams
+
+	// v5+
+	resultMetadataID []byte
+
+	// v4+
+	customPayload map[string][]byte
 }
 
 func (e *writeExecuteFrame) String() string {
@@ -1111,12 +1456,16 @@ func (e *writeExecuteFrame) String() string {
 }
 
 func (e *writeExecuteFrame) writeFrame(fr *framer, streamID int) error {
-	return fr.writeExecuteFrame(streamID, e.preparedID, &e.params)
+	return fr.writeExecuteFrame(streamID, e.preparedID, e.resultMetadataID, &e.params, e.customPayload)
 }
 
-func (f *framer) writeExecuteFrame(streamID int, preparedID []byte, params *queryParams) error {
+func (f *framer) writeExecuteFrame(streamID int, preparedID, resultMetadataID []byte, params *queryParams, customPayload map[string][]byte) error {
 	f.writeHeader(f.flags, opExecute, streamID)
+	f.writeCustomPayload(customPayload)
 	f.writeShortBytes(preparedID)
+	if f.proto >= protoVersion5 {
+		f.writeShortBytes(resultMetadataID)
+	}
 	if f.proto > protoVersion1 {
 		f.writeQueryParams(params)
 	} else {
@@ -1145,8 +1494,17 @@ type writeBatchFrame struct {
 	consistency Consistency
 
 	// v3+
-	serialConsistency SerialConsistency
-	defaultTimestamp  bool
+	serialConsistency     SerialConsistency
+	defaultTimestamp      bool
+	defaultTimestampValue int64
+
+	// v4+
+	customPayload map[string][]byte
+
+	// v5+
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int
 }
 
 func (w *writeBatchFrame) writeFrame(framer *framer, streamID int) error {
@@ -1155,12 +1513,13 @@ func (w *writeBatchFrame) writeFrame(framer *framer, streamID int) error {
 
 func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame) error {
 	f.writeHeader(f.flags, opBatch, streamID)
+	f.writeCustomPayload(w.customPayload)
 	f.writeByte(byte(w.typ))
 
 	n := len(w.statements)
 	f.writeShort(uint16(n))
 
-	var flags byte
+	var flags uint32
 
 	for i := 0; i < n; i++ {
 		b := &w.statements[i]
@@ -1181,7 +1540,7 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame) error {
 				flags |= flagWithNameValues
 				f.writeString(col.name)
 			}
-			f.writeBytes(col.value)
+			f.writeValue(col)
 		}
 	}
 
@@ -1194,15 +1553,32 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame) error {
 		if w.defaultTimestamp {
 			flags |= flagDefaultTimestamp
 		}
+		if f.proto >= protoVersion5 {
+			if w.keyspace != "" {
+				flags |= flagWithKeyspace
+			}
+			if w.nowInSeconds {
+				flags |= flagWithNowInSeconds
+			}
+		}
 
-		f.writeByte(flags)
+		f.writeQueryFlags(flags)
 
 		if w.serialConsistency > 0 {
 			f.writeConsistency(Consistency(w.serialConsistency))
 		}
 		if w.defaultTimestamp {
-			now := time.Now().UnixNano() / 1000
-			f.writeLong(now)
+			ts := w.defaultTimestampValue
+			if ts == 0 {
+				ts = time.Now().UnixNano() / 1000
+			}
+			f.writeLong(ts)
+		}
+		if flags&flagWithKeyspace == flagWithKeyspace {
+			f.writeString(w.keyspace)
+		}
+		if flags&flagWithNowInSeconds == flagWithNowInSeconds {
+			f.writeInt(int32(w.nowInSecondsValue))
 		}
 	}
 
@@ -1316,6 +1692,27 @@ func (f *framer) readBytes() []byte {
 	return l
 }
 
+// readRowValue reads a value of a row, which aliases the read buffer instead
+// of being copied when the framer borrows the bytes of the rows.
+func (f *framer) readRowValue() []byte {
+	if !f.borrowBytes {
+		return f.readBytes()
+	}
+
+	size := f.readInt()
+	if size < 0 {
+		return nil
+	}
+
+	if len(f.rbuf) < size {
+		panic(fmt.Errorf("not enough bytes in buffer to read bytes require %d got: %d", size, len(f.rbuf)))
+	}
+
+	p := f.rbuf[:size:size]
+	f.rbuf = f.rbuf[size:]
+	return p
+}
+
 func (f *framer) readShortBytes() []byte {
 	size := f.readShort()
 	if len(f.rbuf) < int(size) {
@@ -1383,6 +1780,19 @@ func (f *framer) readStringMultiMap() map[string][]string {
 	return m
 }
 
+func (f *framer) readBytesMap() map[string][]byte {
+	size := f.readShort()
+	m := make(map[string][]byte)
+
+	for i := 0; i < int(size); i++ {
+		k := f.readString()
+		v := f.readBytes()
+		m[k] = v
+	}
+
+	return m
+}
+
 func (f *framer) writeByte(b byte) {
 	f.wbuf = append(f.wbuf, b)
 }
@@ -1424,6 +1834,7 @@ func (f *framer) writeString(s string) {
 
 func (f *framer) writeLongString(s string) {
 	f.writeInt(int32(len(s)))
+	f.grow(len(s))
 	f.wbuf = append(f.wbuf, s...)
 }
 
@@ -1446,10 +1857,20 @@ func (f *framer) writeBytes(p []byte) {
 		f.writeInt(-1)
 	} else {
 		f.writeInt(int32(len(p)))
+		f.grow(len(p))
 		f.wbuf = append(f.wbuf, p...)
 	}
 }
 
+// writeValue writes a bound value, or the unset marker.
+func (f *framer) writeValue(v *queryValues) {
+	if v.isUnset {
+		f.writeInt(-2)
+	} else {
+		f.writeBytes(v.value)
+	}
+}
+
 func (f *framer) writeShortBytes(p []byte) {
 	f.writeShort(uint16(len(p)))
 	f.wbuf = append(f.wbuf, p...)
@@ -1478,3 +1899,11 @@ func (f *framer) writeStringMap(m map[string]string) {
 		f.writeString(v)
 	}
 }
+
+func (f *framer) writeBytesMap(m map[string][]byte) {
+	f.writeShort(uint16(len(m)))
+	for k, v := range m {
+		f.writeString(k)
+		f.writeBytes(v)
+	}
+}
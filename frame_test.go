@@ -2,6 +2,9 @@ package gocql
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -96,3 +99,447 @@ func TestFrameReadTooLong(t *testing.T) {
 		t.Fatalf("expected to get header %v got %v", opReady, head.op)
 	}
 }
+
+func TestFrameWriteTimestamp(t *testing.T) {
+	const ts = 1234567890123456
+	expected := []byte{0x00, 0x04, 0x62, 0xd5, 0x3c, 0x8a, 0xba, 0xc0}
+
+	framer := newFramer(nil, nil, nil, 3)
+	framer.writeQueryParams(&queryParams{
+		consistency:           One,
+		defaultTimestamp:      true,
+		defaultTimestampValue: ts,
+	})
+	if buf := framer.wbuf; !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected query params %x to end with timestamp %x", buf, expected)
+	}
+
+	framer = newFramer(nil, &bytes.Buffer{}, nil, 3)
+	err := framer.writeBatchFrame(1, &writeBatchFrame{
+		consistency:           One,
+		defaultTimestamp:      true,
+		defaultTimestampValue: ts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf := framer.wbuf; !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected batch frame %x to end with timestamp %x", buf, expected)
+	}
+}
+
+func TestFrameWriteCustomPayload(t *testing.T) {
+	payload := map[string][]byte{"ProxyExecute": []byte("alice")}
+	expected := []byte{
+		0x00, 0x01,
+		0x00, 0x0c, 'P', 'r', 'o', 'x', 'y', 'E', 'x', 'e', 'c', 'u', 't', 'e',
+		0x00, 0x00, 0x00, 0x05, 'a', 'l', 'i', 'c', 'e',
+	}
+
+	w := &bytes.Buffer{}
+	framer := newFramer(nil, w, nil, protoVersion4)
+	if err := framer.writeQueryFrame(1, "SELECT", &queryParams{consistency: One}, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := w.Bytes()
+	if buf[1]&flagCustomPayload != flagCustomPayload {
+		t.Fatalf("expected the custom payload flag to be set, got flags 0x%x", buf[1])
+	}
+	if body := buf[9:]; !bytes.HasPrefix(body, expected) {
+		t.Fatalf("expected frame body %x to start with custom payload %x", body, expected)
+	}
+
+	w.Reset()
+	framer = newFramer(nil, w, nil, protoVersion4)
+	if err := framer.writeBatchFrame(1, &writeBatchFrame{consistency: One, customPayload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if body := w.Bytes()[9:]; !bytes.HasPrefix(body, expected) {
+		t.Fatalf("expected batch frame body %x to start with custom payload %x", body, expected)
+	}
+
+	// custom payloads are not supported before v4
+	w.Reset()
+	framer = newFramer(nil, w, nil, protoVersion3)
+	if err := framer.writeQueryFrame(1, "SELECT", &queryParams{consistency: One}, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	buf = w.Bytes()
+	if buf[1]&flagCustomPayload != 0 {
+		t.Fatalf("expected the custom payload flag not to be set, got flags 0x%x", buf[1])
+	}
+	if bytes.Contains(buf, expected) {
+		t.Fatalf("expected frame %x not to contain the custom payload", buf)
+	}
+}
+
+func TestFrameWriteKeyspace(t *testing.T) {
+	keyspace := []byte{0x00, 0x02, 'k', 's'}
+
+	framer := newFramer(nil, nil, nil, protoVersion5)
+	framer.writeQueryParams(&queryParams{consistency: One, keyspace: "ks"})
+	expected := append([]byte{0x00, 0x01, 0x00, 0x00, 0x00, byte(flagWithKeyspace)}, keyspace...)
+	if buf := framer.wbuf; !bytes.Equal(buf, expected) {
+		t.Errorf("expected query params %x got %x", expected, buf)
+	}
+
+	// the keyspace is not sent before v5
+	framer = newFramer(nil, nil, nil, protoVersion4)
+	framer.writeQueryParams(&queryParams{consistency: One, keyspace: "ks"})
+	if buf := framer.wbuf; !bytes.Equal(buf, []byte{0x00, 0x01, 0x00}) {
+		t.Errorf("expected query params without keyspace got %x", buf)
+	}
+
+	w := &bytes.Buffer{}
+	framer = newFramer(nil, w, nil, protoVersion5)
+	if err := framer.writePrepareFrame(1, "SELECT", "ks"); err != nil {
+		t.Fatal(err)
+	}
+	expected = append([]byte{0x00, 0x00, 0x00, 0x01}, keyspace...)
+	if buf := w.Bytes(); !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected prepare frame %x to end with %x", buf, expected)
+	}
+
+	w.Reset()
+	framer = newFramer(nil, w, nil, protoVersion5)
+	if err := framer.writeBatchFrame(1, &writeBatchFrame{consistency: One, keyspace: "ks"}); err != nil {
+		t.Fatal(err)
+	}
+	expected = append([]byte{0x00, 0x00, 0x00, byte(flagWithKeyspace)}, keyspace...)
+	if buf := w.Bytes(); !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected batch frame %x to end with %x", buf, expected)
+	}
+}
+
+func TestFrameWriteNowInSeconds(t *testing.T) {
+	const now = 1600000000
+	expected := []byte{0x5f, 0x5e, 0x10, 0x00}
+
+	framer := newFramer(nil, nil, nil, protoVersion5)
+	framer.writeQueryParams(&queryParams{
+		consistency:       One,
+		keyspace:          "ks",
+		nowInSeconds:      true,
+		nowInSecondsValue: now,
+	})
+	// the time follows the keyspace
+	expectedParams := append([]byte{0x00, 0x01, 0x00, 0x00, 0x01, 0x80, 0x00, 0x02, 'k', 's'}, expected...)
+	if buf := framer.wbuf; !bytes.Equal(buf, expectedParams) {
+		t.Errorf("expected query params %x got %x", expectedParams, buf)
+	}
+
+	framer = newFramer(nil, &bytes.Buffer{}, nil, protoVersion5)
+	err := framer.writeBatchFrame(1, &writeBatchFrame{
+		consistency:       One,
+		nowInSeconds:      true,
+		nowInSecondsValue: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append([]byte{0x00, 0x00, 0x01, 0x00}, expected...)
+	if buf := framer.wbuf; !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected batch frame %x to end with %x", buf, expected)
+	}
+}
+
+func TestFrameWriteUnsetValue(t *testing.T) {
+	values := make([]queryValues, 2)
+	if err := marshalQueryValue(NativeType{proto: protoVersion4, typ: TypeInt}, UnsetValue, &values[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := marshalQueryValue(NativeType{proto: protoVersion4, typ: TypeInt}, nil, &values[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	framer := newFramer(nil, nil, nil, protoVersion4)
+	framer.writeQueryParams(&queryParams{consistency: One, values: values})
+	// the unset marker is a length of -2, null a length of -1
+	expected := []byte{0x00, 0x02, 0xff, 0xff, 0xff, 0xfe, 0xff, 0xff, 0xff, 0xff}
+	if buf := framer.wbuf; !bytes.HasSuffix(buf, expected) {
+		t.Errorf("expected query params %x to end with %x", buf, expected)
+	}
+
+	var v queryValues
+	if err := marshalQueryValue(NativeType{proto: protoVersion3, typ: TypeInt}, UnsetValue, &v); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported before v4 got %v", err)
+	}
+}
+
+func TestFrameReadPreparedV4(t *testing.T) {
+	body := []byte{
+		0x00, 0x00, 0x00, 0x04, // kind prepared
+		0x00, 0x01, 0xab, // id
+		0x00, 0x00, 0x00, 0x01, // flags global table spec
+		0x00, 0x00, 0x00, 0x02, // columns count
+		0x00, 0x00, 0x00, 0x01, // pk count
+		0x00, 0x01, // pk index
+		0x00, 0x02, 'k', 's', 0x00, 0x01, 't',
+		0x00, 0x01, 'a', 0x00, byte(TypeInt),
+		0x00, 0x01, 'b', 0x00, byte(TypeVarchar),
+		0x00, 0x00, 0x00, 0x04, // result metadata flags no metadata
+		0x00, 0x00, 0x00, 0x00, // columns count
+	}
+
+	r := &bytes.Buffer{}
+	r.Write([]byte{0x84, flagCustomPayload, 0x00, 0x01, opResult, 0x00, 0x00, 0x00, 0x00})
+	r.Write([]byte{0x00, 0x01, 0x00, 0x01, 'k', 0x00, 0x00, 0x00, 0x01, 'v'})
+	r.Write(body)
+	buf := r.Bytes()
+	buf[8] = byte(len(buf) - 9)
+
+	head, err := readHeader(r, make([]byte, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	framer := newFramer(r, nil, nil, byte(head.version))
+	if err := framer.readFrame(&head); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := framer.parseFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepared, ok := frame.(*resultPreparedFrame)
+	if !ok {
+		t.Fatalf("expected a prepared result, got %T", frame)
+	}
+	if v := string(prepared.customPayload["k"]); v != "v" {
+		t.Errorf("expected custom payload value 'v', got '%s'", v)
+	}
+	if pk := prepared.reqMeta.pkeyColumns; len(pk) != 1 || pk[0] != 1 {
+		t.Errorf("expected partition key columns [1], got %v", pk)
+	}
+	if cols := prepared.reqMeta.columns; len(cols) != 2 || cols[1].Name != "b" {
+		t.Errorf("expected 2 bound columns, got %v", cols)
+	}
+}
+
+func TestFrameCompressionThreshold(t *testing.T) {
+	w := &bytes.Buffer{}
+	framer := newFramer(nil, w, SnappyCompressor{}, protoVersion3)
+	framer.compressThreshold = 64
+
+	if err := framer.writeQueryFrame(1, "SELECT", &queryParams{consistency: One}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if flags := w.Bytes()[1]; flags&flagCompress != 0 {
+		t.Fatalf("expected a small frame not to be compressed, got flags 0x%x", flags)
+	}
+
+	w.Reset()
+	stmt := "SELECT * FROM " + string(bytes.Repeat([]byte("a"), 128))
+	if err := framer.writeQueryFrame(1, stmt, &queryParams{consistency: One}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := w.Bytes()
+	if buf[1]&flagCompress != flagCompress {
+		t.Fatalf("expected a large frame to be compressed, got flags 0x%x", buf[1])
+	}
+
+	head, err := readHeader(bytes.NewReader(buf), make([]byte, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	framer = newFramer(bytes.NewReader(buf[9:]), nil, SnappyCompressor{}, protoVersion3)
+	if err := framer.readFrame(&head); err != nil {
+		t.Fatal(err)
+	}
+	if s := framer.readLongString(); s != stmt {
+		t.Fatalf("expected to read back statement %q, got %q", stmt, s)
+	}
+}
+
+func TestFrameParseEvent(t *testing.T) {
+	tests := []struct {
+		body     []byte
+		expected string
+	}{
+		{
+			[]byte{
+				0x00, 0x0f, 'T', 'O', 'P', 'O', 'L', 'O', 'G', 'Y', '_', 'C', 'H', 'A', 'N', 'G', 'E',
+				0x00, 0x08, 'N', 'E', 'W', '_', 'N', 'O', 'D', 'E',
+				0x04, 10, 0, 0, 1, 0x00, 0x00, 0x23, 0x52,
+			},
+			"[topology_change change=NEW_NODE host=10.0.0.1 port=9042]",
+		},
+		{
+			[]byte{
+				0x00, 0x0d, 'S', 'T', 'A', 'T', 'U', 'S', '_', 'C', 'H', 'A', 'N', 'G', 'E',
+				0x00, 0x04, 'D', 'O', 'W', 'N',
+				0x04, 10, 0, 0, 2, 0x00, 0x00, 0x23, 0x52,
+			},
+			"[status_change change=DOWN host=10.0.0.2 port=9042]",
+		},
+		{
+			[]byte{
+				0x00, 0x0d, 'S', 'C', 'H', 'E', 'M', 'A', '_', 'C', 'H', 'A', 'N', 'G', 'E',
+				0x00, 0x07, 'U', 'P', 'D', 'A', 'T', 'E', 'D',
+				0x00, 0x05, 'T', 'A', 'B', 'L', 'E',
+				0x00, 0x02, 'k', 's',
+				0x00, 0x01, 't',
+			},
+			"[result_schema_change change=UPDATED keyspace=ks table=t]",
+		},
+	}
+
+	for _, test := range tests {
+		r := &bytes.Buffer{}
+		r.Write([]byte{0x83, 0x00, 0xff, 0xff, opEvent, 0x00, 0x00, 0x00, byte(len(test.body))})
+		r.Write(test.body)
+
+		head, err := readHeader(r, make([]byte, 9))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.stream != -1 {
+			t.Fatalf("expected stream -1 got %d", head.stream)
+		}
+
+		framer := newFramer(r, nil, nil, byte(head.version))
+		if err := framer.readFrame(&head); err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := framer.parseFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := frame.(fmt.Stringer).String(); s != test.expected {
+			t.Errorf("expected %s got %s", test.expected, s)
+		}
+	}
+}
+
+func TestFrameParseErrors(t *testing.T) {
+	errFrame := func(proto byte, code ErrorCode) errorFrame {
+		return errorFrame{
+			frameHeader: frameHeader{version: protoVersion(proto | 0x80), op: opError},
+			code:        int(code),
+			message:     "m",
+		}
+	}
+
+	tests := []struct {
+		proto    byte
+		body     []byte
+		expected error
+	}{
+		{
+			protoVersion4,
+			[]byte{
+				0x00, 0x00, 0x15, 0x00, 0x00, 0x01, 'm',
+				0x00, 0x04, // consistency quorum
+				0x00, 0x00, 0x00, 0x01, // received
+				0x00, 0x00, 0x00, 0x02, // block for
+				0x00, 0x00, 0x00, 0x01, // failures
+				0x00, 0x06, 'S', 'I', 'M', 'P', 'L', 'E',
+			},
+			&RequestErrWriteFailure{
+				errorFrame:  errFrame(protoVersion4, ErrCodeWriteFailure),
+				Consistency: Quorum,
+				Received:    1,
+				BlockFor:    2,
+				NumFailures: 1,
+				WriteType:   "SIMPLE",
+			},
+		},
+		{
+			protoVersion5,
+			[]byte{
+				0x00, 0x00, 0x13, 0x00, 0x00, 0x01, 'm',
+				0x00, 0x01, // consistency one
+				0x00, 0x00, 0x00, 0x00, // received
+				0x00, 0x00, 0x00, 0x01, // block for
+				0x00, 0x00, 0x00, 0x01, // reason map
+				0x04, 10, 0, 0, 1, 0x00, 0x01,
+				0x01, // data present
+			},
+			&RequestErrReadFailure{
+				errorFrame:  errFrame(protoVersion5, ErrCodeReadFailure),
+				Consistency: One,
+				BlockFor:    1,
+				NumFailures: 1,
+				DataPresent: 1,
+				ErrorMap:    ErrorMap{"10.0.0.1": 1},
+			},
+		},
+		{
+			protoVersion4,
+			[]byte{
+				0x00, 0x00, 0x14, 0x00, 0x00, 0x01, 'm',
+				0x00, 0x02, 'k', 's',
+				0x00, 0x01, 'f',
+				0x00, 0x01, 0x00, 0x03, 'i', 'n', 't',
+			},
+			&RequestErrFunctionFailure{
+				errorFrame: errFrame(protoVersion4, ErrCodeFunctionFailure),
+				Keyspace:   "ks",
+				Function:   "f",
+				ArgTypes:   []string{"int"},
+			},
+		},
+		{
+			protoVersion5,
+			[]byte{
+				0x00, 0x00, 0x17, 0x00, 0x00, 0x01, 'm',
+				0x00, 0x04, // consistency quorum
+				0x00, 0x00, 0x00, 0x00, // received
+				0x00, 0x00, 0x00, 0x02, // block for
+			},
+			&RequestErrCASWriteUnknown{
+				errorFrame:  errFrame(protoVersion5, ErrCodeCASWriteUnknown),
+				Consistency: Quorum,
+				BlockFor:    2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		framer := newFramer(nil, nil, nil, test.proto)
+		framer.header = &frameHeader{version: protoVersion(test.proto | 0x80), op: opError}
+		framer.rbuf = test.body
+
+		frame, err := framer.parseFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(frame, test.expected) {
+			t.Errorf("expected %#v got %#v", test.expected, frame)
+		}
+	}
+}
+
+func TestRequestErrorIs(t *testing.T) {
+	var err error = &RequestErrWriteTimeout{
+		errorFrame: errorFrame{code: int(ErrCodeWriteTimeout), message: "timeout"},
+		WriteType:  "SIMPLE",
+	}
+	wrapped := fmt.Errorf("insert failed: %w", err)
+
+	if !errors.Is(wrapped, ErrCodeWriteTimeout) {
+		t.Error("expected the wrapped error to match ErrCodeWriteTimeout")
+	}
+	if errors.Is(wrapped, ErrCodeReadTimeout) {
+		t.Error("expected the wrapped error not to match ErrCodeReadTimeout")
+	}
+
+	var writeTimeout *RequestErrWriteTimeout
+	if !errors.As(wrapped, &writeTimeout) || writeTimeout.WriteType != "SIMPLE" {
+		t.Errorf("expected to find the write timeout in %v", wrapped)
+	}
+
+	var reqErr RequestError
+	if !errors.As(wrapped, &reqErr) || reqErr.(*RequestErrWriteTimeout).ErrorCode() != ErrCodeWriteTimeout {
+		t.Errorf("expected to find the request error in %v", wrapped)
+	}
+}
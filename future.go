@@ -0,0 +1,68 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+)
+
+// Future is the pending result of a query executed by Session.ExecuteAsync.
+type Future struct {
+	done chan struct{}
+	iter *Iter
+}
+
+// ExecuteAsync executes the query in the background and returns at once the
+// future of its result, so that many queries can be sent over the
+// multiplexed connections of the session and their results harvested
+// later:
+//
+//	futures := make([]*gocql.Future, len(ids))
+//	for i, id := range ids {
+//		futures[i] = session.ExecuteAsync(session.Query(stmt, id))
+//	}
+//	for _, f := range futures {
+//		if err := f.Wait(ctx); err != nil {
+//			...
+//		}
+//		iter := f.Result()
+//		...
+//	}
+//
+// The query is retried and paged as with Query.Iter, it must not be used
+// until the future is done. The query can be cancelled with
+// Query.WithContext.
+func (s *Session) ExecuteAsync(q *Query) *Future {
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		f.iter = q.Iter()
+		close(f.done)
+	}()
+	return f
+}
+
+// Done returns a channel which is closed when the result of the query is
+// available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the query to complete and returns its error. It returns
+// ctx.Err() when ctx is done first, the query then keeps running.
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.iter.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Result waits for the query to complete and returns the iterator of its
+// rows, Close returns the error of the query.
+func (f *Future) Result() *Iter {
+	<-f.done
+	return f.iter
+}
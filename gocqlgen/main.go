@@ -0,0 +1,233 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command gocqlgen generates the methods decoding the rows of a table into a
+// struct and binding its fields, so that the rows are scanned without the
+// reflection of Iter.Scan:
+//
+//	//go:generate gocqlgen -type User
+//	type User struct {
+//		ID      gocql.UUID `cql:"id"`
+//		Name    string
+//		Ignored int `cql:"-"`
+//	}
+//
+// The column of a field is the name in its cql tag, or its lower cased name.
+// The generated methods of User are:
+//
+//	// DecodeRow implements gocql.RowDecoder, rows are scanned with
+//	// iter.Scan(&user).
+//	func (x *User) DecodeRow(columns []gocql.ColumnInfo, row [][]byte) error
+//
+//	// Columns returns the columns of the fields, "id" and "name".
+//	func (x *User) Columns() []string
+//
+//	// BindValues returns the values of the fields in the order of Columns,
+//	// for instance for session.Query(insert, user.BindValues()...).
+//	func (x *User) BindValues() []interface{}
+//
+// The methods are written to <type>_gocql.go, in lower case, next to the
+// source files of the package, or to the file given with -output.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	flagTypes  = flag.String("type", "", "comma separated names of the struct types, required")
+	flagOutput = flag.String("output", "", "output file, <type>_gocql.go by default")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gocqlgen: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gocqlgen -type T[,T...] [-output file] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *flagTypes == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	names := strings.Split(*flagTypes, ",")
+	pkg, structs, err := parseStructs(dir, names)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(pkg, structs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output := *flagOutput
+	if output == "" {
+		output = filepath.Join(dir, strings.ToLower(names[0])+"_gocql.go")
+	}
+	if err := ioutil.WriteFile(output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// structType is a struct the methods are generated for.
+type structType struct {
+	name   string
+	fields []field
+}
+
+// field is a field of a struct mapped to a column.
+type field struct {
+	name   string
+	column string
+}
+
+// parseStructs returns the package name and the structs named names of the
+// package in dir.
+func parseStructs(dir string, names []string) (string, []structType, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pkgs) != 1 {
+		return "", nil, fmt.Errorf("expected a single package in %s, found %d", dir, len(pkgs))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	found := make(map[string]*ast.StructType)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				found[spec.Name.Name] = st
+			}
+			return false
+		})
+	}
+
+	structs := make([]structType, 0, len(names))
+	for _, name := range names {
+		st, ok := found[name]
+		if !ok {
+			return "", nil, fmt.Errorf("struct type %s not found in %s", name, dir)
+		}
+
+		s, err := newStructType(name, st)
+		if err != nil {
+			return "", nil, err
+		}
+		structs = append(structs, s)
+	}
+
+	return pkg.Name, structs, nil
+}
+
+func newStructType(name string, st *ast.StructType) (structType, error) {
+	s := structType{name: name}
+	columns := make(map[string]string)
+
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			v, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return s, err
+			}
+			tag = reflect.StructTag(v)
+		}
+
+		column := tag.Get("cql")
+		if column == "-" {
+			continue
+		}
+
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+
+			c := column
+			if c == "" {
+				c = strings.ToLower(ident.Name)
+			}
+			if other, ok := columns[c]; ok {
+				return s, fmt.Errorf("fields %s and %s of %s have the same column %q", other, ident.Name, name, c)
+			}
+			columns[c] = ident.Name
+
+			s.fields = append(s.fields, field{name: ident.Name, column: c})
+		}
+	}
+
+	if len(s.fields) == 0 {
+		return s, fmt.Errorf("struct type %s has no exported fields", name)
+	}
+	return s, nil
+}
+
+// generate returns the formatted source of the methods of structs.
+func generate(pkg string, structs []structType) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by gocqlgen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import (\n\t\"fmt\"\n\n\t\"github.com/gocql/gocql\"\n)\n")
+
+	for _, s := range structs {
+		fmt.Fprintf(&buf, "\n// DecodeRow implements gocql.RowDecoder.\n")
+		fmt.Fprintf(&buf, "func (x *%s) DecodeRow(columns []gocql.ColumnInfo, row [][]byte) error {\n", s.name)
+		fmt.Fprintf(&buf, "for i, col := range columns {\nvar err error\nswitch col.Name {\n")
+		for _, f := range s.fields {
+			fmt.Fprintf(&buf, "case %q:\nerr = gocql.Unmarshal(col.TypeInfo, row[i], &x.%s)\n", f.column, f.name)
+		}
+		fmt.Fprintf(&buf, "default:\nreturn fmt.Errorf(\"gocql: no field of %s for column %%q\", col.Name)\n}\n", s.name)
+		fmt.Fprintf(&buf, "if err != nil {\nreturn err\n}\n}\nreturn nil\n}\n")
+
+		columns := make([]string, len(s.fields))
+		values := make([]string, len(s.fields))
+		for i, f := range s.fields {
+			columns[i] = strconv.Quote(f.column)
+			values[i] = "x." + f.name
+		}
+
+		fmt.Fprintf(&buf, "\n// Columns returns the columns of the fields of %s.\n", s.name)
+		fmt.Fprintf(&buf, "func (x *%s) Columns() []string {\nreturn []string{%s}\n}\n", s.name, strings.Join(columns, ", "))
+
+		fmt.Fprintf(&buf, "\n// BindValues returns the values of the fields of %s, in the order of Columns.\n", s.name)
+		fmt.Fprintf(&buf, "func (x *%s) BindValues() []interface{} {\nreturn []interface{}{%s}\n}\n", s.name, strings.Join(values, ", "))
+	}
+
+	return format.Source(buf.Bytes())
+}
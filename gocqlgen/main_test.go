@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSource = `package models
+
+import "github.com/gocql/gocql"
+
+type User struct {
+	ID       gocql.UUID ` + "`cql:\"id\"`" + `
+	Name     string
+	Ignored  int ` + "`cql:\"-\"`" + `
+	internal int
+}
+
+type Empty struct {
+	internal int
+}
+`
+
+func writeTestPackage(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gocqlgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "models.go"), []byte(testSource), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeTestPackage(t)
+	defer os.RemoveAll(dir)
+
+	pkg, structs, err := parseStructs(dir, []string{"User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != "models" {
+		t.Errorf("expected package models got %s", pkg)
+	}
+
+	expected := []field{{name: "ID", column: "id"}, {name: "Name", column: "name"}}
+	if len(structs) != 1 || len(structs[0].fields) != len(expected) {
+		t.Fatalf("expected the fields %v got %v", expected, structs)
+	}
+	for i, f := range structs[0].fields {
+		if f != expected[i] {
+			t.Errorf("expected field %v got %v", expected[i], f)
+		}
+	}
+
+	src, err := generate(pkg, structs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"func (x *User) DecodeRow(columns []gocql.ColumnInfo, row [][]byte) error {",
+		`case "id":` + "\n\t\t\terr = gocql.Unmarshal(col.TypeInfo, row[i], &x.ID)",
+		`return []string{"id", "name"}`,
+		"return []interface{}{x.ID, x.Name}",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Errorf("expected the generated code to contain %q:\n%s", s, src)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := writeTestPackage(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"Missing", "Empty"} {
+		if _, _, err := parseStructs(dir, []string{name}); err == nil {
+			t.Errorf("expected an error generating the methods of %s", name)
+		}
+	}
+}
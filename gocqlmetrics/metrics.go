@@ -0,0 +1,168 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gocqlmetrics exposes the metrics of a gocql session to Prometheus.
+// The Collector implements the observer interfaces of gocql and must be set
+// on the cluster config before the session is created:
+//
+//	collector := gocqlmetrics.New("myapp")
+//	cluster := gocql.NewCluster("127.0.0.1")
+//	cluster.QueryObserver = collector
+//	cluster.BatchObserver = collector
+//	cluster.ConnectObserver = collector
+//
+//	session, err := cluster.CreateSession()
+//	...
+//	collector.SetSession(session)
+//	prometheus.MustRegister(collector)
+package gocqlmetrics
+
+import (
+	"sync"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector gathering the latency of queries and
+// batches, per host request and error counts, as well as the size of the
+// connection pool and the usage of its streams.
+type Collector struct {
+	queryLatency *prometheus.HistogramVec
+	batchLatency *prometheus.HistogramVec
+	requests     *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	connects     *prometheus.CounterVec
+	connectFails *prometheus.CounterVec
+
+	poolSize    *prometheus.Desc
+	streamsUsed *prometheus.Desc
+	streamsMax  *prometheus.Desc
+
+	mu      sync.RWMutex
+	session *gocql.Session
+}
+
+// New returns a collector whose metrics are prefixed with namespace.
+func New(namespace string) *Collector {
+	return &Collector{
+		queryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of the query executions, per host.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"host"}),
+		batchLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "batch_duration_seconds",
+			Help:      "Latency of the batch executions, per host.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"host"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "requests_total",
+			Help:      "Number of queries and batches executed, per host.",
+		}, []string{"host", "kind"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "request_errors_total",
+			Help:      "Number of queries and batches which failed, per host.",
+		}, []string{"host", "kind"}),
+		connects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "connects_total",
+			Help:      "Number of connection attempts, per host.",
+		}, []string{"host"}),
+		connectFails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "gocql",
+			Name:      "connect_errors_total",
+			Help:      "Number of failed connection attempts, per host.",
+		}, []string{"host"}),
+
+		poolSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "gocql", "pool_connections"),
+			"Number of open connections in the pool.", nil, nil),
+		streamsUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "gocql", "pool_streams_in_use"),
+			"Number of streams in use on the connections of the pool.", nil, nil),
+		streamsMax: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "gocql", "pool_streams"),
+			"Number of streams of the connections of the pool.", nil, nil),
+	}
+}
+
+// SetSession sets the session whose pool is reported.
+func (c *Collector) SetSession(session *gocql.Session) {
+	c.mu.Lock()
+	c.session = session
+	c.mu.Unlock()
+}
+
+func (c *Collector) ObserveQuery(q gocql.ObservedQuery) {
+	c.queryLatency.WithLabelValues(q.Host).Observe(q.End.Sub(q.Start).Seconds())
+	c.requests.WithLabelValues(q.Host, "query").Inc()
+	if q.Err != nil {
+		c.errors.WithLabelValues(q.Host, "query").Inc()
+	}
+}
+
+func (c *Collector) ObserveBatch(b gocql.ObservedBatch) {
+	c.batchLatency.WithLabelValues(b.Host).Observe(b.End.Sub(b.Start).Seconds())
+	c.requests.WithLabelValues(b.Host, "batch").Inc()
+	if b.Err != nil {
+		c.errors.WithLabelValues(b.Host, "batch").Inc()
+	}
+}
+
+func (c *Collector) ObserveConnect(o gocql.ObservedConnect) {
+	c.connects.WithLabelValues(o.Host).Inc()
+	if o.Err != nil {
+		c.connectFails.WithLabelValues(o.Host).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.queryLatency.Describe(ch)
+	c.batchLatency.Describe(ch)
+	c.requests.Describe(ch)
+	c.errors.Describe(ch)
+	c.connects.Describe(ch)
+	c.connectFails.Describe(ch)
+	ch <- c.poolSize
+	ch <- c.streamsUsed
+	ch <- c.streamsMax
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.queryLatency.Collect(ch)
+	c.batchLatency.Collect(ch)
+	c.requests.Collect(ch)
+	c.errors.Collect(ch)
+	c.connects.Collect(ch)
+	c.connectFails.Collect(ch)
+
+	c.mu.RLock()
+	session := c.session
+	c.mu.RUnlock()
+
+	if session == nil || session.Closed() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.poolSize, prometheus.GaugeValue, float64(session.Pool.Size()))
+
+	if pool, ok := session.Pool.(gocql.StreamUsage); ok {
+		inUse, total := pool.StreamUsage()
+		ch <- prometheus.MustNewConstMetric(c.streamsUsed, prometheus.GaugeValue, float64(inUse))
+		ch <- prometheus.MustNewConstMetric(c.streamsMax, prometheus.GaugeValue, float64(total))
+	}
+}
@@ -0,0 +1,57 @@
+// +build all unit
+
+package gocqlmetrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	_ gocql.QueryObserver   = &Collector{}
+	_ gocql.BatchObserver   = &Collector{}
+	_ gocql.ConnectObserver = &Collector{}
+	_ prometheus.Collector  = &Collector{}
+)
+
+func TestCollector(t *testing.T) {
+	c := New("test")
+
+	start := time.Now()
+	c.ObserveQuery(gocql.ObservedQuery{Host: "a", Start: start, End: start.Add(time.Millisecond)})
+	c.ObserveQuery(gocql.ObservedQuery{Host: "a", Start: start, End: start.Add(time.Millisecond), Err: errors.New("failed")})
+	c.ObserveQuery(gocql.ObservedQuery{Host: "b", Start: start, End: start.Add(time.Millisecond)})
+	c.ObserveBatch(gocql.ObservedBatch{Host: "a", Start: start, End: start.Add(time.Millisecond)})
+	c.ObserveConnect(gocql.ObservedConnect{Host: "a", Err: errors.New("failed")})
+
+	tests := []struct {
+		metric   prometheus.Collector
+		expected float64
+	}{
+		{c.requests.WithLabelValues("a", "query"), 2},
+		{c.requests.WithLabelValues("b", "query"), 1},
+		{c.requests.WithLabelValues("a", "batch"), 1},
+		{c.errors.WithLabelValues("a", "query"), 1},
+		{c.connects.WithLabelValues("a"), 1},
+		{c.connectFails.WithLabelValues("a"), 1},
+	}
+
+	for i, test := range tests {
+		if v := testutil.ToFloat64(test.metric); v != test.expected {
+			t.Errorf("%d: expected %v got %v", i, test.expected, v)
+		}
+	}
+
+	// no pool metrics without a session
+	if n := testutil.CollectAndCount(c, "test_gocql_pool_connections"); n != 0 {
+		t.Errorf("expected no pool metrics got %d", n)
+	}
+	if n := testutil.CollectAndCount(c, "test_gocql_query_duration_seconds"); n != 2 {
+		t.Errorf("expected latency histograms for 2 hosts got %d", n)
+	}
+}
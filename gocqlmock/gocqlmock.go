@@ -0,0 +1,352 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gocqlmock is a fake gocql.SessionInterface for the unit tests of
+// applications, which run without a Cassandra cluster. The results of the
+// statements are programmed beforehand and the executed statements are
+// recorded:
+//
+//	session := gocqlmock.NewSession()
+//	session.On("SELECT name FROM users WHERE id = ?").
+//		Rows([]string{"name"}, []interface{}{"alice"})
+//	session.On("INSERT INTO users (id, name) VALUES (?, ?)").
+//		Error(&gocql.RequestErrWriteTimeout{})
+//
+//	err := app.Run(session)
+//	for _, stmt := range session.Statements() {
+//		...
+//	}
+//
+// The statements are matched with their programmed results ignoring the
+// differences of whitespace. Statements without a result succeed without
+// selecting any rows.
+package gocqlmock
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var _ gocql.SessionInterface = (*Session)(nil)
+
+// Statement is an executed statement.
+type Statement struct {
+	Stmt        string
+	Values      []interface{}
+	Consistency gocql.Consistency
+	// Batch is the type of the batch of the statement, nil for queries.
+	Batch *gocql.BatchType
+}
+
+// Result is the programmed result of a statement.
+type Result struct {
+	stmt    string
+	columns []string
+	rows    [][]interface{}
+	err     error
+	once    bool
+	used    bool
+}
+
+// Rows sets the rows selected by the statement, the values of each row are
+// those of the columns, in order.
+func (r *Result) Rows(columns []string, rows ...[]interface{}) *Result {
+	r.columns = columns
+	r.rows = rows
+	return r
+}
+
+// Error sets the error returned by the statement.
+func (r *Result) Error(err error) *Result {
+	r.err = err
+	return r
+}
+
+// Once only returns the result for the first execution of the statement,
+// the following ones get the next result programmed for the statement.
+func (r *Result) Once() *Result {
+	r.once = true
+	return r
+}
+
+// Session is a fake gocql.SessionInterface.
+type Session struct {
+	mu         sync.Mutex
+	results    []*Result
+	statements []Statement
+	closed     bool
+}
+
+// NewSession returns a Session without programmed results.
+func NewSession() *Session {
+	return &Session{}
+}
+
+// normalize collapses the whitespace of stmt.
+func normalize(stmt string) string {
+	return strings.Join(strings.Fields(stmt), " ")
+}
+
+// On programs the result of the statement stmt. The results are matched in
+// the order they were programmed.
+func (s *Session) On(stmt string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &Result{stmt: normalize(stmt)}
+	s.results = append(s.results, r)
+	return r
+}
+
+// Statements returns the executed statements, in order.
+func (s *Session) Statements() []Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Statement(nil), s.statements...)
+}
+
+// Reset forgets the programmed results and the executed statements.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	s.results = nil
+	s.statements = nil
+	s.mu.Unlock()
+}
+
+// execute records the statement and returns its result.
+func (s *Session) execute(stmt Statement) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statements = append(s.statements, stmt)
+
+	key := normalize(stmt.Stmt)
+	for _, r := range s.results {
+		if r.stmt != key || r.once && r.used {
+			continue
+		}
+		r.used = true
+		return r
+	}
+	return &Result{}
+}
+
+func (s *Session) Query(stmt string, values ...interface{}) gocql.QueryInterface {
+	return &Query{session: s, stmt: stmt, values: values, cons: gocql.Quorum}
+}
+
+func (s *Session) NewBatch(typ gocql.BatchType) *gocql.Batch {
+	return &gocql.Batch{Type: typ, Cons: gocql.Quorum}
+}
+
+// ExecuteBatch records the statements of the batch and returns the first
+// error programmed for them.
+func (s *Session) ExecuteBatch(batch *gocql.Batch) error {
+	if s.Closed() {
+		return gocql.ErrSessionClosed
+	}
+	if err := batch.Context().Err(); err != nil {
+		return err
+	}
+
+	var err error
+	for _, entry := range batch.Entries {
+		typ := batch.Type
+		r := s.execute(Statement{Stmt: entry.Stmt, Values: entry.Args, Consistency: batch.Cons, Batch: &typ})
+		if err == nil {
+			err = r.err
+		}
+	}
+	return err
+}
+
+func (s *Session) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+func (s *Session) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Query is a fake gocql.QueryInterface.
+type Query struct {
+	session *Session
+	stmt    string
+	values  []interface{}
+	cons    gocql.Consistency
+	ctx     context.Context
+}
+
+func (q *Query) Bind(v ...interface{}) gocql.QueryInterface {
+	q.values = v
+	return q
+}
+
+func (q *Query) Consistency(c gocql.Consistency) gocql.QueryInterface {
+	q.cons = c
+	return q
+}
+
+func (q *Query) SerialConsistency(cons gocql.SerialConsistency) gocql.QueryInterface {
+	return q
+}
+
+func (q *Query) PageSize(n int) gocql.QueryInterface {
+	return q
+}
+
+func (q *Query) Timeout(timeout time.Duration) gocql.QueryInterface {
+	return q
+}
+
+func (q *Query) WithContext(ctx context.Context) gocql.QueryInterface {
+	q.ctx = ctx
+	return q
+}
+
+func (q *Query) Statement() string {
+	return q.stmt
+}
+
+func (q *Query) Values() []interface{} {
+	return q.values
+}
+
+func (q *Query) Exec() error {
+	return q.Iter().Close()
+}
+
+func (q *Query) Iter() gocql.IterInterface {
+	if q.session.Closed() {
+		return &Iter{err: gocql.ErrSessionClosed}
+	}
+	if q.ctx != nil && q.ctx.Err() != nil {
+		return &Iter{err: q.ctx.Err()}
+	}
+
+	r := q.session.execute(Statement{Stmt: q.stmt, Values: q.values, Consistency: q.cons})
+	return &Iter{columns: r.columns, rows: r.rows, err: r.err}
+}
+
+func (q *Query) Scan(dest ...interface{}) error {
+	iter := q.Iter().(*Iter)
+	if iter.err == nil && len(iter.rows) == 0 {
+		return gocql.ErrNotFound
+	}
+	iter.Scan(dest...)
+	return iter.Close()
+}
+
+// ScanCAS scans the first column of the selected row, which must be the
+// [applied] column, into applied and the other ones into dest.
+func (q *Query) ScanCAS(dest ...interface{}) (applied bool, err error) {
+	err = q.Scan(append([]interface{}{&applied}, dest...)...)
+	return applied, err
+}
+
+func (q *Query) MapScan(m map[string]interface{}) error {
+	iter := q.Iter().(*Iter)
+	if iter.err == nil && len(iter.rows) == 0 {
+		return gocql.ErrNotFound
+	}
+	iter.MapScan(m)
+	return iter.Close()
+}
+
+// Iter is a fake gocql.IterInterface.
+type Iter struct {
+	columns []string
+	rows    [][]interface{}
+	pos     int
+	err     error
+}
+
+func (iter *Iter) Columns() []gocql.ColumnInfo {
+	columns := make([]gocql.ColumnInfo, len(iter.columns))
+	for i, name := range iter.columns {
+		columns[i] = gocql.ColumnInfo{Name: name}
+	}
+	return columns
+}
+
+// Scan copies the values of the next row into dest, the values must be
+// assignable or convertible to the types pointed at by dest. Nil values set
+// the destinations to their zero value.
+func (iter *Iter) Scan(dest ...interface{}) bool {
+	if iter.err != nil || iter.pos >= len(iter.rows) {
+		return false
+	}
+
+	row := iter.rows[iter.pos]
+	if len(dest) != len(row) {
+		iter.err = fmt.Errorf("gocqlmock: expected %d destinations got %d", len(row), len(dest))
+		return false
+	}
+
+	for i, d := range dest {
+		if d == nil {
+			continue
+		}
+		if iter.err = assign(d, row[i]); iter.err != nil {
+			return false
+		}
+	}
+
+	iter.pos++
+	return true
+}
+
+func assign(dest, value interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("gocqlmock: can not scan into %T", dest)
+	}
+	dv = dv.Elem()
+
+	if value == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(dv.Type()):
+		dv.Set(v)
+	case v.Type().ConvertibleTo(dv.Type()):
+		dv.Set(v.Convert(dv.Type()))
+	default:
+		return fmt.Errorf("gocqlmock: can not scan %T into %T", value, dest)
+	}
+	return nil
+}
+
+func (iter *Iter) MapScan(m map[string]interface{}) bool {
+	if iter.err != nil || iter.pos >= len(iter.rows) {
+		return false
+	}
+
+	for i, name := range iter.columns {
+		m[name] = iter.rows[iter.pos][i]
+	}
+	iter.pos++
+	return true
+}
+
+func (iter *Iter) Warnings() []string {
+	return nil
+}
+
+func (iter *Iter) Close() error {
+	return iter.err
+}
@@ -0,0 +1,130 @@
+// +build all unit
+
+package gocqlmock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+// userName is application code depending on gocql.SessionInterface.
+func userName(s gocql.SessionInterface, id int) (string, error) {
+	var name string
+	err := s.Query("SELECT name FROM users WHERE id = ?", id).Consistency(gocql.One).Scan(&name)
+	return name, err
+}
+
+func TestSession(t *testing.T) {
+	s := NewSession()
+	s.On("SELECT name FROM users   WHERE id = ?").Rows([]string{"name"}, []interface{}{"alice"})
+	s.On("INSERT INTO users (id, name) VALUES (?, ?)").Error(errors.New("timeout")).Once()
+
+	name, err := userName(s, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice" {
+		t.Errorf("expected alice got %q", name)
+	}
+
+	insert := s.Query("INSERT INTO users (id, name) VALUES (?, ?)", 2, "bob")
+	if err := insert.Exec(); err == nil || err.Error() != "timeout" {
+		t.Errorf("expected the programmed error got %v", err)
+	}
+	if err := insert.Exec(); err != nil {
+		t.Errorf("expected the error to be returned once got %v", err)
+	}
+
+	if err := s.Query("SELECT name FROM users WHERE id = 3").Scan(&name); err != gocql.ErrNotFound {
+		t.Errorf("expected %v got %v", gocql.ErrNotFound, err)
+	}
+
+	expected := []Statement{
+		{Stmt: "SELECT name FROM users WHERE id = ?", Values: []interface{}{1}, Consistency: gocql.One},
+		{Stmt: "INSERT INTO users (id, name) VALUES (?, ?)", Values: []interface{}{2, "bob"}, Consistency: gocql.Quorum},
+		{Stmt: "INSERT INTO users (id, name) VALUES (?, ?)", Values: []interface{}{2, "bob"}, Consistency: gocql.Quorum},
+		{Stmt: "SELECT name FROM users WHERE id = 3", Consistency: gocql.Quorum},
+	}
+	if stmts := s.Statements(); !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected the statements %+v got %+v", expected, stmts)
+	}
+}
+
+func TestIter(t *testing.T) {
+	s := NewSession()
+	s.On("SELECT id, name, age FROM users").Rows([]string{"id", "name", "age"},
+		[]interface{}{1, "alice", nil},
+		[]interface{}{2, "bob", 42},
+	)
+
+	iter := s.Query("SELECT id, name, age FROM users").Iter()
+	if n := len(iter.Columns()); n != 3 {
+		t.Errorf("expected 3 columns got %d", n)
+	}
+
+	var (
+		ids   []int64
+		names []string
+		ages  []int
+	)
+	var (
+		id   int64
+		name string
+		age  int
+	)
+	for iter.Scan(&id, &name, &age) {
+		ids = append(ids, id)
+		names = append(names, name)
+		ages = append(ages, age)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2}) || !reflect.DeepEqual(names, []string{"alice", "bob"}) || !reflect.DeepEqual(ages, []int{0, 42}) {
+		t.Errorf("unexpected rows %v %v %v", ids, names, ages)
+	}
+
+	m := make(map[string]interface{})
+	if err := s.Query("SELECT id, name, age FROM users").MapScan(m); err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "alice" {
+		t.Errorf("expected alice got %v", m["name"])
+	}
+
+	var b []byte
+	iter = s.Query("SELECT id, name, age FROM users").Iter()
+	if iter.Scan(&b, &name, &age) || iter.Close() == nil {
+		t.Error("expected an error scanning an int into a []byte")
+	}
+}
+
+func TestBatchAndContext(t *testing.T) {
+	s := NewSession()
+	s.On("UPDATE t SET a = ? WHERE k = ?").Error(gocql.ErrTimeoutNoResponse)
+
+	b := s.NewBatch(gocql.LoggedBatch)
+	b.Query("INSERT INTO t (k) VALUES (?)", 1)
+	b.Query("UPDATE t SET a = ? WHERE k = ?", 2, 1)
+	if err := s.ExecuteBatch(b); err != gocql.ErrTimeoutNoResponse {
+		t.Errorf("expected %v got %v", gocql.ErrTimeoutNoResponse, err)
+	}
+	if stmts := s.Statements(); len(stmts) != 2 || stmts[0].Batch == nil || *stmts[0].Batch != gocql.LoggedBatch {
+		t.Errorf("expected the statements of the batch to be recorded got %+v", stmts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Query("SELECT * FROM t").WithContext(ctx).Exec(); err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+
+	s.Close()
+	if err := s.Query("SELECT * FROM t").Exec(); err != gocql.ErrSessionClosed {
+		t.Errorf("expected %v got %v", gocql.ErrSessionClosed, err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocqltest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+const (
+	minProtoVersion = 2
+	maxProtoVersion = 4
+
+	maxFrameSize = 256 * 1024 * 1024
+)
+
+const (
+	opError        = 0x00
+	opStartup      = 0x01
+	opReady        = 0x02
+	opOptions      = 0x05
+	opSupported    = 0x06
+	opQuery        = 0x07
+	opResult       = 0x08
+	opPrepare      = 0x09
+	opExecute      = 0x0A
+	opRegister     = 0x0B
+	opEvent        = 0x0C
+	opBatch        = 0x0D
+	opAuthResponse = 0x0F
+)
+
+const (
+	flagCompress      = 0x01
+	flagTracing       = 0x02
+	flagCustomPayload = 0x04
+	flagWarning       = 0x08
+
+	resultKindVoid          = 1
+	resultKindRows          = 2
+	resultKindKeyspace      = 3
+	resultKindPrepared      = 4
+	resultKindSchemaChanged = 5
+
+	rowsFlagGlobalTableSpec = 0x01
+	rowsFlagHasMorePages    = 0x02
+	rowsFlagNoMetaData      = 0x04
+
+	queryFlagValues            = 0x01
+	queryFlagPageSize          = 0x04
+	queryFlagWithPagingState   = 0x08
+	queryFlagSerialConsistency = 0x10
+	queryFlagDefaultTimestamp  = 0x20
+	queryFlagWithNameValues    = 0x40
+)
+
+var errShortFrame = errors.New("gocqltest: frame too short")
+
+// header is the header of a frame, the stream is a single byte before
+// protocol v3.
+type header struct {
+	response bool
+	version  byte
+	flags    byte
+	stream   int
+	op       byte
+	length   int
+}
+
+func headerSize(version byte) int {
+	if version < 3 {
+		return 8
+	}
+	return 9
+}
+
+// readFrame reads the header and the body of a request frame.
+func readFrame(r io.Reader) (header, []byte, error) {
+	var buf [9]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return header{}, nil, err
+	}
+
+	h := header{response: buf[0]&0x80 != 0, version: buf[0] & 0x7f}
+	size := headerSize(h.version)
+	if _, err := io.ReadFull(r, buf[1:size]); err != nil {
+		return header{}, nil, err
+	}
+
+	h.flags = buf[1]
+	if h.version < 3 {
+		h.stream = int(int8(buf[2]))
+		h.op = buf[3]
+	} else {
+		h.stream = int(int16(binary.BigEndian.Uint16(buf[2:])))
+		h.op = buf[4]
+	}
+	h.length = int(binary.BigEndian.Uint32(buf[size-4:]))
+	if h.length < 0 || h.length > maxFrameSize {
+		return header{}, nil, errors.New("gocqltest: invalid frame length")
+	}
+
+	body := make([]byte, h.length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return header{}, nil, err
+	}
+	return h, body, nil
+}
+
+// appendFrame appends the frame of header h and of body to b.
+func appendFrame(b []byte, h header, body []byte) []byte {
+	version := h.version
+	if h.response {
+		version |= 0x80
+	}
+
+	b = append(b, version, h.flags)
+	if h.version < 3 {
+		b = append(b, byte(h.stream))
+	} else {
+		b = append(b, byte(h.stream>>8), byte(h.stream))
+	}
+	b = append(b, h.op, byte(len(body)>>24), byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+	return append(b, body...)
+}
+
+// reader reads the values of a frame body, the first error is kept and the
+// following reads return zero values.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = errShortFrame
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *reader) byte() byte {
+	if p := r.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *reader) short() int {
+	if p := r.next(2); p != nil {
+		return int(binary.BigEndian.Uint16(p))
+	}
+	return 0
+}
+
+func (r *reader) int() int {
+	if p := r.next(4); p != nil {
+		return int(int32(binary.BigEndian.Uint32(p)))
+	}
+	return 0
+}
+
+func (r *reader) long() int64 {
+	if p := r.next(8); p != nil {
+		return int64(binary.BigEndian.Uint64(p))
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.next(r.short()))
+}
+
+func (r *reader) longString() string {
+	return string(r.next(r.int()))
+}
+
+// bytes reads [bytes], the null and unset values are returned as nil.
+func (r *reader) bytes() []byte {
+	n := r.int()
+	if n < 0 {
+		return nil
+	}
+	return r.next(n)
+}
+
+func (r *reader) shortBytes() []byte {
+	return r.next(r.short())
+}
+
+func (r *reader) stringList() []string {
+	n := r.short()
+	list := make([]string, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		list = append(list, r.string())
+	}
+	return list
+}
+
+func (r *reader) stringMap() map[string]string {
+	n := r.short()
+	m := make(map[string]string, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		k := r.string()
+		m[k] = r.string()
+	}
+	return m
+}
+
+func (r *reader) bytesMap() map[string][]byte {
+	n := r.short()
+	m := make(map[string][]byte, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		k := r.string()
+		m[k] = r.bytes()
+	}
+	return m
+}
+
+// writer writes the body of a response frame after its header.
+type writer struct {
+	version byte
+	b       []byte
+}
+
+func newWriter(version byte, flags byte, stream int, op byte) *writer {
+	w := &writer{version: version}
+	w.b = append(w.b, version|0x80, flags)
+	if version < 3 {
+		w.b = append(w.b, byte(stream))
+	} else {
+		w.b = append(w.b, byte(stream>>8), byte(stream))
+	}
+	w.b = append(w.b, op, 0, 0, 0, 0)
+	return w
+}
+
+// frame returns the frame with the length of its body set.
+func (w *writer) frame() []byte {
+	size := headerSize(w.version)
+	binary.BigEndian.PutUint32(w.b[size-4:], uint32(len(w.b)-size))
+	return w.b
+}
+
+func (w *writer) byte(v byte) {
+	w.b = append(w.b, v)
+}
+
+func (w *writer) short(v int) {
+	w.b = append(w.b, byte(v>>8), byte(v))
+}
+
+func (w *writer) int(v int) {
+	w.b = append(w.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *writer) string(s string) {
+	w.short(len(s))
+	w.b = append(w.b, s...)
+}
+
+// bytes writes [bytes], nil is written as a null value.
+func (w *writer) bytes(p []byte) {
+	if p == nil {
+		w.int(-1)
+		return
+	}
+	w.int(len(p))
+	w.b = append(w.b, p...)
+}
+
+func (w *writer) shortBytes(p []byte) {
+	w.short(len(p))
+	w.b = append(w.b, p...)
+}
+
+func (w *writer) stringList(list []string) {
+	w.short(len(list))
+	for _, s := range list {
+		w.string(s)
+	}
+}
+
+func (w *writer) stringMultimap(m map[string][]string) {
+	w.short(len(m))
+	for k, v := range m {
+		w.string(k)
+		w.stringList(v)
+	}
+}
+
+func (w *writer) inet(ip net.IP, port int) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	w.byte(byte(len(ip)))
+	w.b = append(w.b, ip...)
+	w.int(port)
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocqltest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Interaction is a request forwarded to a cluster by a Recorder and the
+// response of the cluster.
+type Interaction struct {
+	Version byte `json:"version"`
+	// Op is the operation of the request: QUERY, PREPARE, EXECUTE or BATCH.
+	// The statements of batches are joined with "; " and their values
+	// concatenated.
+	Op          string   `json:"op"`
+	Stmt        string   `json:"stmt"`
+	Values      [][]byte `json:"values,omitempty"`
+	PagingState []byte   `json:"paging_state,omitempty"`
+
+	ResponseOp    byte   `json:"response_op"`
+	ResponseFlags byte   `json:"response_flags,omitempty"`
+	Response      []byte `json:"response"`
+}
+
+// interactionKey returns the key matching a request with its recorded
+// interactions, the consistency of the requests is ignored.
+func interactionKey(version byte, op, stmt string, values [][]byte, pagingState []byte) string {
+	var b strings.Builder
+	b.WriteByte('0' + version)
+	b.WriteByte(' ')
+	b.WriteString(op)
+	b.WriteByte(' ')
+	b.WriteString(normalize(stmt))
+	for _, v := range values {
+		b.WriteByte(' ')
+		if v == nil {
+			b.WriteString("null")
+		} else {
+			b.WriteString(hex.EncodeToString(v))
+		}
+	}
+	b.WriteString(" @")
+	b.WriteString(hex.EncodeToString(pagingState))
+	return b.String()
+}
+
+// batchKey returns the statement and the values of the interaction of a
+// batch.
+func batchKey(entries []batchEntry) (string, [][]byte) {
+	stmts := make([]string, len(entries))
+	var values [][]byte
+	for i, e := range entries {
+		stmts[i] = e.stmt
+		values = append(values, e.values...)
+	}
+	return strings.Join(stmts, "; "), values
+}
+
+// Cassette is the list of the interactions recorded by a Recorder, which
+// are replayed by a Server, see Server.Replay.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// ReadCassette reads a cassette written by Cassette.Write.
+func ReadCassette(r io.Reader) (*Cassette, error) {
+	var c Cassette
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Write writes the cassette as JSON.
+func (c *Cassette) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(c)
+}
+
+// preparedID returns the id of the statement prepared by the result
+// response body, or nil if it is not a prepared result.
+func preparedID(flags byte, body []byte) []byte {
+	r := &reader{b: body}
+	if flags&flagTracing != 0 {
+		r.next(16)
+	}
+	if flags&flagWarning != 0 {
+		r.stringList()
+	}
+	if flags&flagCustomPayload != 0 {
+		r.bytesMap()
+	}
+
+	if r.int() != resultKindPrepared {
+		return nil
+	}
+	id := r.shortBytes()
+	if r.err != nil {
+		return nil
+	}
+	return append([]byte(nil), id...)
+}
+
+// replay is the recorded interactions of a request.
+type replay struct {
+	interactions []Interaction
+	next         int
+}
+
+// Replay makes the server answer the requests recorded in the cassette c
+// with their recorded responses, whatever their consistency. The responses
+// to a request recorded several times are replayed in order, the last one
+// being repeated. The requests which were not recorded are answered with
+// the programmed results.
+func (s *Server) Replay(c *Cassette) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.replays == nil {
+		s.replays = make(map[string]*replay)
+	}
+	for _, i := range c.Interactions {
+		key := interactionKey(i.Version, i.Op, i.Stmt, i.Values, i.PagingState)
+		rp := s.replays[key]
+		if rp == nil {
+			rp = &replay{}
+			s.replays[key] = rp
+		}
+		rp.interactions = append(rp.interactions, i)
+	}
+}
+
+// replay returns the recorded response to the request, or nil if it was
+// not recorded.
+func (c *serverConn) replay(h header, op, stmt string, params queryParams) *writer {
+	key := interactionKey(h.version, op, stmt, params.values, params.pagingState)
+
+	c.srv.mu.Lock()
+	rp := c.srv.replays[key]
+	if rp == nil {
+		c.srv.mu.Unlock()
+		return nil
+	}
+
+	i := rp.interactions[rp.next]
+	if rp.next < len(rp.interactions)-1 {
+		rp.next++
+	}
+	if op == "PREPARE" {
+		if id := preparedID(i.ResponseFlags, i.Response); id != nil {
+			c.srv.prepared[string(id)] = stmt
+		}
+	}
+	c.srv.mu.Unlock()
+
+	if op == "QUERY" || op == "EXECUTE" {
+		c.srv.record(Request{
+			Op:          op,
+			Stmt:        stmt,
+			Values:      params.values,
+			Consistency: params.consistency,
+			PageSize:    params.pageSize,
+			PagingState: params.pagingState,
+		})
+	}
+
+	w := newWriter(h.version, i.ResponseFlags, h.stream, i.ResponseOp)
+	w.b = append(w.b, i.Response...)
+	return w
+}
+
+// Recorder is a proxy between the sessions and a cluster recording the
+// requests and their responses, which a Server replays afterwards to run
+// tests without the cluster:
+//
+//	rec, err := gocqltest.NewRecorder("cassandra:9042")
+//	...
+//	session, err := rec.Cluster().CreateSession()
+//	...
+//	session.Close()
+//	rec.Close()
+//	err = rec.Cassette().Write(f)
+//
+//	cassette, err := gocqltest.ReadCassette(f)
+//	...
+//	srv.Replay(cassette)
+//
+// The recorder supports the protocol versions 2 to 4 without compression.
+// The queries of system.local and system.peers are not recorded, the
+// replaying server describes itself.
+type Recorder struct {
+	listener net.Listener
+	upstream string
+	wg       sync.WaitGroup
+
+	mu           sync.Mutex
+	interactions []Interaction
+	prepared     map[string]string
+	conns        map[net.Conn]struct{}
+}
+
+// NewRecorder returns a Recorder listening on a random port of 127.0.0.1
+// and forwarding the connections to the host upstream.
+func NewRecorder(upstream string) (*Recorder, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		listener: listener,
+		upstream: upstream,
+		prepared: make(map[string]string),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	r.wg.Add(1)
+	go r.serve()
+	return r, nil
+}
+
+// Addr returns the host:port address of the recorder.
+func (r *Recorder) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Cluster returns the configuration of a cluster reached through the
+// recorder, the hosts must not be discovered.
+func (r *Recorder) Cluster() *gocql.ClusterConfig {
+	return newCluster(r.listener.Addr())
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.interactions...)}
+}
+
+// Close stops the recorder and closes its connections.
+func (r *Recorder) Close() error {
+	err := r.listener.Close()
+
+	r.mu.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *Recorder) serve() {
+	defer r.wg.Done()
+
+	for {
+		client, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		upstream, err := net.DialTimeout("tcp", r.upstream, 10*time.Second)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		r.mu.Lock()
+		r.conns[client] = struct{}{}
+		r.conns[upstream] = struct{}{}
+		r.mu.Unlock()
+
+		p := &proxyConn{rec: r, client: client, upstream: upstream, pending: make(map[int]*Interaction)}
+		r.wg.Add(2)
+		go p.forwardRequests()
+		go p.forwardResponses()
+	}
+}
+
+// proxyConn is a connection of a session proxied to the cluster.
+type proxyConn struct {
+	rec      *Recorder
+	client   net.Conn
+	upstream net.Conn
+
+	mu      sync.Mutex
+	pending map[int]*Interaction
+}
+
+func (p *proxyConn) close() {
+	p.client.Close()
+	p.upstream.Close()
+
+	p.rec.mu.Lock()
+	delete(p.rec.conns, p.client)
+	delete(p.rec.conns, p.upstream)
+	p.rec.mu.Unlock()
+}
+
+func (p *proxyConn) forwardRequests() {
+	defer p.rec.wg.Done()
+	defer p.close()
+
+	for {
+		h, body, err := readFrame(p.client)
+		if err != nil {
+			return
+		}
+
+		if i := p.rec.parseRequest(h, body); i != nil {
+			p.mu.Lock()
+			p.pending[h.stream] = i
+			p.mu.Unlock()
+		}
+
+		if _, err := p.upstream.Write(appendFrame(nil, h, body)); err != nil {
+			return
+		}
+	}
+}
+
+func (p *proxyConn) forwardResponses() {
+	defer p.rec.wg.Done()
+	defer p.close()
+
+	for {
+		h, body, err := readFrame(p.upstream)
+		if err != nil {
+			return
+		}
+
+		p.mu.Lock()
+		i := p.pending[h.stream]
+		delete(p.pending, h.stream)
+		p.mu.Unlock()
+
+		if i != nil && h.flags&flagCompress == 0 {
+			i.ResponseOp = h.op
+			i.ResponseFlags = h.flags
+			i.Response = body
+
+			p.rec.mu.Lock()
+			if i.Op == "PREPARE" {
+				if id := preparedID(h.flags, body); id != nil {
+					p.rec.prepared[string(id)] = i.Stmt
+				}
+			}
+			p.rec.interactions = append(p.rec.interactions, *i)
+			p.rec.mu.Unlock()
+		}
+
+		if _, err := p.client.Write(appendFrame(nil, h, body)); err != nil {
+			return
+		}
+	}
+}
+
+// parseRequest returns the interaction of the request, or nil if it is not
+// recorded.
+func (r *Recorder) parseRequest(h header, body []byte) *Interaction {
+	if h.version < minProtoVersion || h.version > maxProtoVersion || h.flags&flagCompress != 0 {
+		return nil
+	}
+
+	rd := &reader{b: body}
+	if h.version >= 4 && h.flags&flagCustomPayload != 0 {
+		rd.bytesMap()
+	}
+
+	i := &Interaction{Version: h.version}
+	switch h.op {
+	case opQuery:
+		i.Op = "QUERY"
+		i.Stmt = rd.longString()
+		params := readParams(rd)
+		i.Values, i.PagingState = params.values, params.pagingState
+	case opPrepare:
+		i.Op = "PREPARE"
+		i.Stmt = rd.longString()
+	case opExecute:
+		i.Op = "EXECUTE"
+		id := rd.shortBytes()
+		params := readParams(rd)
+		i.Values, i.PagingState = params.values, params.pagingState
+
+		r.mu.Lock()
+		stmt, ok := r.prepared[string(id)]
+		r.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		i.Stmt = stmt
+	case opBatch:
+		i.Op = "BATCH"
+		entries, _ := readBatch(rd, h.version)
+
+		r.mu.Lock()
+		for j, e := range entries {
+			if e.id == nil {
+				continue
+			}
+			stmt, ok := r.prepared[string(e.id)]
+			if !ok {
+				r.mu.Unlock()
+				return nil
+			}
+			entries[j].stmt = stmt
+		}
+		r.mu.Unlock()
+
+		i.Stmt, i.Values = batchKey(entries)
+	default:
+		return nil
+	}
+
+	if rd.err != nil || isPeersTable(i.Stmt) {
+		return nil
+	}
+	return i
+}
+
+// isPeersTable returns whether stmt selects from system.local or
+// system.peers.
+func isPeersTable(stmt string) bool {
+	m := selectRe.FindStringSubmatch(stmt)
+	if m == nil {
+		return false
+	}
+
+	table := strings.ToLower(strings.Replace(m[2], `"`, "", -1))
+	return table == "system.local" || table == "system.peers"
+}
@@ -0,0 +1,184 @@
+// +build all unit
+
+package gocqltest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type usersResult struct {
+	name  string
+	ids   []int
+	value int
+}
+
+// queryUsers runs the statements recorded and replayed by TestRecorder.
+func queryUsers(t *testing.T, cluster *gocql.ClusterConfig) []usersResult {
+	t.Helper()
+
+	cluster.Timeout = time.Second
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	var results []usersResult
+	for i := 0; i < 2; i++ {
+		var res usersResult
+		if err := session.Query("SELECT name FROM users WHERE id = ?", 1).Scan(&res.name); err != nil {
+			t.Fatal(err)
+		}
+
+		iter := session.Query("SELECT id FROM users").PageSize(2).Iter()
+		var id int
+		for iter.Scan(&id) {
+			res.ids = append(res.ids, id)
+		}
+		if err := iter.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := session.Query("SELECT v FROM counters").Scan(&res.value); err != nil {
+			t.Fatal(err)
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query("INSERT INTO users (id, name) VALUES (?, ?)", 4, "dave")
+		batch.Query("UPDATE counters SET v = v + 1")
+		if err := session.ExecuteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+
+		results = append(results, res)
+	}
+	return results
+}
+
+func TestRecorder(t *testing.T) {
+	origin, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+
+	origin.On("SELECT name FROM users WHERE id = ?").
+		Params(Col("id", gocql.TypeInt)).
+		Rows([]Column{Col("name", gocql.TypeVarchar)}, []interface{}{"alice"})
+	origin.On("SELECT id FROM users").
+		Rows([]Column{Col("id", gocql.TypeInt)}, []interface{}{1}, []interface{}{2}, []interface{}{3})
+	origin.On("SELECT v FROM counters").Once().
+		Rows([]Column{Col("v", gocql.TypeInt)}, []interface{}{1})
+	origin.On("SELECT v FROM counters").
+		Rows([]Column{Col("v", gocql.TypeInt)}, []interface{}{2})
+	origin.On("INSERT INTO users (id, name) VALUES (?, ?)").
+		Params(Col("id", gocql.TypeInt), Col("name", gocql.TypeVarchar))
+
+	rec, err := NewRecorder(origin.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := queryUsers(t, rec.Cluster())
+	rec.Close()
+	origin.Close()
+
+	expected := []usersResult{
+		{name: "alice", ids: []int{1, 2, 3}, value: 1},
+		{name: "alice", ids: []int{1, 2, 3}, value: 2},
+	}
+	if !reflect.DeepEqual(recorded, expected) {
+		t.Fatalf("expected %+v got %+v", expected, recorded)
+	}
+
+	var buf bytes.Buffer
+	if err := rec.Cassette().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := ReadCassette(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make(map[string]int)
+	for _, i := range cassette.Interactions {
+		if strings.Contains(i.Stmt, "system.") {
+			t.Errorf("expected the queries of the system tables not to be recorded got %q", i.Stmt)
+		}
+		ops[i.Op]++
+	}
+	if ops["PREPARE"] == 0 || ops["EXECUTE"] == 0 || ops["BATCH"] != 2 {
+		t.Errorf("unexpected recorded operations %v", ops)
+	}
+
+	replayer, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayer.Close()
+	replayer.Replay(cassette)
+
+	if replayed := queryUsers(t, replayer.Cluster()); !reflect.DeepEqual(replayed, expected) {
+		t.Errorf("expected the replayed results %+v got %+v", expected, replayed)
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	body := func(v int) []byte {
+		w := &writer{}
+		w.int(resultKindRows)
+		w.int(rowsFlagGlobalTableSpec)
+		w.int(1)
+		w.string("ks")
+		w.string("t")
+		w.string("v")
+		w.short(int(gocql.TypeInt))
+		w.int(1)
+		w.bytes([]byte{0, 0, 0, byte(v)})
+		return w.b
+	}
+
+	prepared := &writer{}
+	prepared.int(resultKindPrepared)
+	prepared.shortBytes([]byte("id"))
+	prepared.int(0)
+	prepared.int(0)
+	prepared.int(0)
+	prepared.int(rowsFlagNoMetaData)
+	prepared.int(0)
+
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Replay(&Cassette{Interactions: []Interaction{
+		{Version: 4, Op: "PREPARE", Stmt: "SELECT v FROM ks.t", ResponseOp: opResult, Response: prepared.b},
+		{Version: 4, Op: "EXECUTE", Stmt: "SELECT v FROM ks.t", ResponseOp: opResult, Response: body(1)},
+		{Version: 4, Op: "EXECUTE", Stmt: "SELECT v FROM ks.t", ResponseOp: opResult, Response: body(2)},
+	}})
+
+	session, err := srv.Cluster().CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	var values []int
+	for i := 0; i < 3; i++ {
+		var v int
+		if err := session.Query("SELECT  v FROM ks.t").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	if expected := []int{1, 2, 2}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+}
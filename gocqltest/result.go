@@ -0,0 +1,291 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocqltest
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Column is a column of the rows of a result, or a bound variable of a
+// statement.
+type Column struct {
+	Name string
+	Type gocql.TypeInfo
+}
+
+// Col returns the column name of the native type typ.
+func Col(name string, typ gocql.Type) Column {
+	return Column{Name: name, Type: Native(typ)}
+}
+
+// Native returns the native type typ. The protocol version of the types is
+// the one of the connections they are sent on.
+func Native(typ gocql.Type) gocql.TypeInfo {
+	return gocql.NewNativeType(maxProtoVersion, typ, "")
+}
+
+// List returns the type list<elem>.
+func List(elem gocql.TypeInfo) gocql.TypeInfo {
+	return gocql.CollectionType{NativeType: gocql.NewNativeType(maxProtoVersion, gocql.TypeList, ""), Elem: elem}
+}
+
+// Set returns the type set<elem>.
+func Set(elem gocql.TypeInfo) gocql.TypeInfo {
+	return gocql.CollectionType{NativeType: gocql.NewNativeType(maxProtoVersion, gocql.TypeSet, ""), Elem: elem}
+}
+
+// Map returns the type map<key, elem>.
+func Map(key, elem gocql.TypeInfo) gocql.TypeInfo {
+	return gocql.CollectionType{NativeType: gocql.NewNativeType(maxProtoVersion, gocql.TypeMap, ""), Key: key, Elem: elem}
+}
+
+// withProto returns the type info with the protocol version proto, which
+// changes the encoding of the collections.
+func withProto(info gocql.TypeInfo, proto byte) gocql.TypeInfo {
+	if c, ok := info.(gocql.CollectionType); ok {
+		t := gocql.CollectionType{NativeType: gocql.NewNativeType(proto, c.Type(), c.Custom())}
+		if c.Key != nil {
+			t.Key = withProto(c.Key, proto)
+		}
+		if c.Elem != nil {
+			t.Elem = withProto(c.Elem, proto)
+		}
+		return t
+	}
+	return gocql.NewNativeType(proto, info.Type(), info.Custom())
+}
+
+func writeType(w *writer, info gocql.TypeInfo) {
+	w.short(int(info.Type()))
+	switch info.Type() {
+	case gocql.TypeCustom:
+		w.string(info.Custom())
+	case gocql.TypeList, gocql.TypeSet:
+		writeType(w, info.(gocql.CollectionType).Elem)
+	case gocql.TypeMap:
+		c := info.(gocql.CollectionType)
+		writeType(w, c.Key)
+		writeType(w, c.Elem)
+	}
+}
+
+// Result is the programmed result of a statement.
+type Result struct {
+	stmt    string
+	columns []Column
+	rows    [][]interface{}
+	params  []Column
+	err     error
+	delay   time.Duration
+	once    bool
+	used    bool
+}
+
+// Rows sets the rows selected by the statement, the values of each row are
+// those of the columns, in order, and are marshalled with gocql.Marshal.
+func (r *Result) Rows(columns []Column, rows ...[]interface{}) *Result {
+	r.columns = columns
+	r.rows = rows
+	return r
+}
+
+// Params sets the bound variables of the statement when it is prepared. By
+// default the bound variables are varchar, one for each ? marker.
+func (r *Result) Params(params ...Column) *Result {
+	r.params = params
+	return r
+}
+
+// Error sets the error returned for the statement. The errors of gocql, such
+// as *gocql.RequestErrWriteTimeout or gocql.ErrCodeOverloaded, are returned
+// with their error code and fields, the other ones as server errors.
+func (r *Result) Error(err error) *Result {
+	r.err = err
+	return r
+}
+
+// Delay delays the response to the statement.
+func (r *Result) Delay(d time.Duration) *Result {
+	r.delay = d
+	return r
+}
+
+// Once only returns the result for the first execution of the statement,
+// the following ones get the next result programmed for the statement.
+func (r *Result) Once() *Result {
+	r.once = true
+	return r
+}
+
+// Request is a statement received by the server.
+type Request struct {
+	// Op is the operation of the request: QUERY, EXECUTE or BATCH.
+	Op          string
+	Stmt        string
+	Values      [][]byte
+	Consistency gocql.Consistency
+	PageSize    int
+	PagingState []byte
+}
+
+// Event is an event sent to the connections registered for its type, see
+// TopologyEvent, StatusEvent and SchemaEvent.
+type Event struct {
+	Type   string
+	Change string
+
+	// Addr and Port are the address of the host of topology and status
+	// events.
+	Addr net.IP
+	Port int
+
+	// Target, Keyspace and Name are the changed element of schema events,
+	// Name is empty for keyspaces.
+	Target   string
+	Keyspace string
+	Name     string
+}
+
+// TopologyEvent returns the event of the host addr being added or removed,
+// change is NEW_NODE, REMOVED_NODE or MOVED_NODE.
+func TopologyEvent(change string, addr net.IP, port int) Event {
+	return Event{Type: "TOPOLOGY_CHANGE", Change: change, Addr: addr, Port: port}
+}
+
+// StatusEvent returns the event of the host addr going UP or DOWN.
+func StatusEvent(change string, addr net.IP, port int) Event {
+	return Event{Type: "STATUS_CHANGE", Change: change, Addr: addr, Port: port}
+}
+
+// SchemaEvent returns the event of a schema change, change is CREATED,
+// UPDATED or DROPPED and target is KEYSPACE, TABLE or TYPE.
+func SchemaEvent(change, target, keyspace, name string) Event {
+	return Event{Type: "SCHEMA_CHANGE", Change: change, Target: target, Keyspace: keyspace, Name: name}
+}
+
+// writeSchemaChange writes the body of a schema change result or event.
+func writeSchemaChange(w *writer, e Event) {
+	w.string(e.Change)
+	if w.version < 3 {
+		w.string(e.Keyspace)
+		w.string(e.Name)
+		return
+	}
+
+	w.string(e.Target)
+	w.string(e.Keyspace)
+	if e.Target != "KEYSPACE" {
+		w.string(e.Name)
+	}
+}
+
+func writeEvent(w *writer, e Event) {
+	w.string(e.Type)
+	if e.Type == "SCHEMA_CHANGE" {
+		writeSchemaChange(w, e)
+		return
+	}
+	w.string(e.Change)
+	w.inet(e.Addr, e.Port)
+}
+
+// writeError writes the body of the error frame of err.
+func writeError(w *writer, err error) {
+	var (
+		code        = gocql.ErrCodeServer
+		cons        gocql.Consistency
+		received    int
+		blockFor    int
+		alive       int
+		numFailures int
+		dataPresent byte
+		writeType   string
+		keyspace    string
+		name        string
+		argTypes    []string
+		stmtID      []byte
+	)
+
+	switch e := err.(type) {
+	case gocql.ErrorCode:
+		code = e
+	case protocolError:
+		code = gocql.ErrCodeProtocol
+	case *gocql.RequestErrUnavailable:
+		code, cons, blockFor, alive = gocql.ErrCodeUnavailable, e.Consistency, e.Required, e.Alive
+	case *gocql.RequestErrWriteTimeout:
+		code, cons, received, blockFor, writeType = gocql.ErrCodeWriteTimeout, e.Consistency, e.Received, e.BlockFor, e.WriteType
+	case *gocql.RequestErrReadTimeout:
+		code, cons, received, blockFor, dataPresent = gocql.ErrCodeReadTimeout, e.Consistency, e.Received, e.BlockFor, e.DataPresent
+	case *gocql.RequestErrReadFailure:
+		code, cons, received, blockFor, numFailures, dataPresent = gocql.ErrCodeReadFailure, e.Consistency, e.Received, e.BlockFor, e.NumFailures, e.DataPresent
+	case *gocql.RequestErrWriteFailure:
+		code, cons, received, blockFor, numFailures, writeType = gocql.ErrCodeWriteFailure, e.Consistency, e.Received, e.BlockFor, e.NumFailures, e.WriteType
+	case *gocql.RequestErrCASWriteUnknown:
+		code, cons, received, blockFor = gocql.ErrCodeCASWriteUnknown, e.Consistency, e.Received, e.BlockFor
+	case *gocql.RequestErrFunctionFailure:
+		code, keyspace, name, argTypes = gocql.ErrCodeFunctionFailure, e.Keyspace, e.Function, e.ArgTypes
+	case *gocql.RequestErrAlreadyExists:
+		code, keyspace, name = gocql.ErrCodeAlreadyExists, e.Keyspace, e.Table
+	case *gocql.RequestErrUnprepared:
+		code, stmtID = gocql.ErrCodeUnprepared, e.StatementId
+	case *gocql.RequestErrCDCWriteFailure:
+		code = gocql.ErrCodeCDCWriteFailure
+	}
+
+	msg := err.Error()
+	if msg == "" {
+		msg = strings.TrimPrefix(code.Error(), "gocql: ")
+	}
+
+	w.int(int(code))
+	w.string(msg)
+
+	switch code {
+	case gocql.ErrCodeUnavailable:
+		w.short(int(cons))
+		w.int(blockFor)
+		w.int(alive)
+	case gocql.ErrCodeWriteTimeout:
+		w.short(int(cons))
+		w.int(received)
+		w.int(blockFor)
+		w.string(writeType)
+	case gocql.ErrCodeReadTimeout:
+		w.short(int(cons))
+		w.int(received)
+		w.int(blockFor)
+		w.byte(dataPresent)
+	case gocql.ErrCodeReadFailure:
+		w.short(int(cons))
+		w.int(received)
+		w.int(blockFor)
+		w.int(numFailures)
+		w.byte(dataPresent)
+	case gocql.ErrCodeWriteFailure:
+		w.short(int(cons))
+		w.int(received)
+		w.int(blockFor)
+		w.int(numFailures)
+		w.string(writeType)
+	case gocql.ErrCodeCASWriteUnknown:
+		w.short(int(cons))
+		w.int(received)
+		w.int(blockFor)
+	case gocql.ErrCodeFunctionFailure:
+		w.string(keyspace)
+		w.string(name)
+		w.stringList(argTypes)
+	case gocql.ErrCodeAlreadyExists:
+		w.string(keyspace)
+		w.string(name)
+	case gocql.ErrCodeUnprepared:
+		w.shortBytes(stmtID)
+	}
+}
@@ -0,0 +1,875 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gocqltest is an in-process server implementing enough of the CQL
+// native protocol, versions 2 to 4, to run end to end tests of gocql
+// sessions without a Cassandra cluster:
+//
+//	srv, err := gocqltest.NewServer()
+//	...
+//	defer srv.Close()
+//
+//	srv.On("SELECT name FROM users WHERE id = ?").
+//		Params(gocqltest.Col("id", gocql.TypeInt)).
+//		Rows([]gocqltest.Column{gocqltest.Col("name", gocql.TypeVarchar)},
+//			[]interface{}{"alice"})
+//
+//	session, err := srv.Cluster().CreateSession()
+//
+// The server answers the statements with their programmed results, matched
+// ignoring the differences of whitespace. It supports preparing and
+// executing statements, batches, paging, errors and events. It does not
+// store any data: the statements without a result succeed, USE changes the
+// keyspace of the connection and the schema changes are answered and
+// broadcast as events. The system.local and system.peers tables describe a
+// single node cluster so that sessions can discover the hosts.
+//
+// The Recorder records the interactions of sessions with a real cluster,
+// which the server replays afterwards, see Server.Replay.
+//
+// Compression, authentication, tuples and user defined types are not
+// supported.
+package gocqltest
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Server is an in-process CQL server listening on the loopback interface.
+type Server struct {
+	listener net.Listener
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	hostID        gocql.UUID
+	schemaVersion gocql.UUID
+
+	mu       sync.Mutex
+	results  []*Result
+	replays  map[string]*replay
+	prepared map[string]string
+	requests []Request
+	conns    map[*serverConn]struct{}
+}
+
+// NewServer returns a Server listening on a random port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:      listener,
+		quit:          make(chan struct{}),
+		hostID:        gocql.TimeUUID(),
+		schemaVersion: gocql.TimeUUID(),
+		prepared:      make(map[string]string),
+		conns:         make(map[*serverConn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port address of the server.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Cluster returns the configuration of a cluster made of the server.
+func (s *Server) Cluster() *gocql.ClusterConfig {
+	return newCluster(s.listener.Addr())
+}
+
+func newCluster(addr net.Addr) *gocql.ClusterConfig {
+	tcpAddr := addr.(*net.TCPAddr)
+
+	cluster := gocql.NewCluster(tcpAddr.IP.String())
+	cluster.Port = tcpAddr.Port
+	cluster.ProtoVersion = maxProtoVersion
+	return cluster
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// On programs the result of the statement stmt. The results are matched in
+// the order they were programmed.
+func (s *Server) On(stmt string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &Result{stmt: normalize(stmt)}
+	s.results = append(s.results, r)
+	return r
+}
+
+// Requests returns the statements received by the server, in order. They
+// include the statements sent by the sessions themselves, such as the
+// queries of system.local.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ForgetPrepared forgets the prepared statements as if the server had been
+// restarted, their next executions fail with an unprepared error.
+func (s *Server) ForgetPrepared() {
+	s.mu.Lock()
+	s.prepared = make(map[string]string)
+	s.mu.Unlock()
+}
+
+// SendEvent sends the event e to the connections registered for its type.
+func (s *Server) SendEvent(e Event) {
+	s.mu.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.sendEvent(e)
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &serverConn{srv: s, conn: conn, events: make(map[string]bool)}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go c.serve()
+	}
+}
+
+// normalize collapses the whitespace of stmt.
+func normalize(stmt string) string {
+	return strings.Join(strings.Fields(stmt), " ")
+}
+
+// match returns the result programmed for stmt, or nil.
+func (s *Server) match(stmt string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := normalize(stmt)
+	for _, r := range s.results {
+		if r.stmt != key || r.once && r.used {
+			continue
+		}
+		r.used = true
+		return r
+	}
+	return nil
+}
+
+func (s *Server) record(req Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+}
+
+type serverConn struct {
+	srv  *Server
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	proto    byte
+	keyspace string
+	events   map[string]bool
+}
+
+func (c *serverConn) serve() {
+	defer c.srv.wg.Done()
+	defer func() {
+		c.conn.Close()
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c)
+		c.srv.mu.Unlock()
+	}()
+
+	for {
+		h, body, err := readFrame(c.conn)
+		if err != nil {
+			return
+		}
+
+		c.srv.wg.Add(1)
+		go func() {
+			defer c.srv.wg.Done()
+			c.handle(h, body)
+		}()
+	}
+}
+
+func (c *serverConn) write(w *writer) {
+	c.writeMu.Lock()
+	c.conn.Write(w.frame())
+	c.writeMu.Unlock()
+}
+
+func (c *serverConn) writeError(h header, err error) {
+	w := newWriter(h.version, 0, h.stream, opError)
+	writeError(w, err)
+	c.write(w)
+}
+
+func (c *serverConn) sendEvent(e Event) {
+	c.mu.Lock()
+	registered, proto := c.events[e.Type], c.proto
+	c.mu.Unlock()
+	if !registered {
+		return
+	}
+
+	w := newWriter(proto, 0, -1, opEvent)
+	writeEvent(w, e)
+	c.write(w)
+}
+
+// protocolError is the error of a malformed or unsupported request.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+func (c *serverConn) handle(h header, body []byte) {
+	if h.version < minProtoVersion || h.version > maxProtoVersion {
+		c.writeError(h, protocolError(fmt.Sprintf("Invalid or unsupported protocol version (%d); supported versions are (2/v2, 3/v3, 4/v4)", h.version)))
+		return
+	}
+	if h.flags&flagCompress != 0 {
+		c.writeError(h, protocolError("compression is not supported"))
+		return
+	}
+
+	r := &reader{b: body}
+	if h.version >= 4 && h.flags&flagCustomPayload != 0 {
+		r.bytesMap()
+	}
+
+	var w *writer
+	switch h.op {
+	case opStartup:
+		r.stringMap()
+		c.mu.Lock()
+		c.proto = h.version
+		c.mu.Unlock()
+		w = newWriter(h.version, 0, h.stream, opReady)
+	case opOptions:
+		w = newWriter(h.version, 0, h.stream, opSupported)
+		w.stringMultimap(map[string][]string{
+			"CQL_VERSION":       {"3.4.5"},
+			"COMPRESSION":       {},
+			"PROTOCOL_VERSIONS": {"2/v2", "3/v3", "4/v4"},
+		})
+	case opRegister:
+		events := r.stringList()
+		c.mu.Lock()
+		for _, e := range events {
+			c.events[e] = true
+		}
+		c.mu.Unlock()
+		w = newWriter(h.version, 0, h.stream, opReady)
+	case opQuery:
+		stmt := r.longString()
+		params := readParams(r)
+		if r.err != nil {
+			break
+		}
+		if w = c.replay(h, "QUERY", stmt, params); w == nil {
+			w = c.execute(h, "QUERY", stmt, params)
+		}
+	case opPrepare:
+		stmt := r.longString()
+		if r.err != nil {
+			break
+		}
+		if w = c.replay(h, "PREPARE", stmt, queryParams{}); w == nil {
+			w = c.prepare(h, stmt)
+		}
+	case opExecute:
+		id := r.shortBytes()
+		params := readParams(r)
+		if r.err != nil {
+			break
+		}
+
+		c.srv.mu.Lock()
+		stmt, ok := c.srv.prepared[string(id)]
+		c.srv.mu.Unlock()
+		if !ok {
+			c.writeError(h, &gocql.RequestErrUnprepared{StatementId: id})
+			return
+		}
+		if w = c.replay(h, "EXECUTE", stmt, params); w == nil {
+			w = c.execute(h, "EXECUTE", stmt, params)
+		}
+	case opBatch:
+		w = c.batch(h, r)
+	default:
+		c.writeError(h, protocolError(fmt.Sprintf("unsupported operation 0x%02x", h.op)))
+		return
+	}
+
+	if r.err != nil {
+		c.writeError(h, protocolError(r.err.Error()))
+		return
+	}
+	if w != nil {
+		c.write(w)
+	}
+}
+
+// queryParams are the parameters of QUERY and EXECUTE requests.
+type queryParams struct {
+	consistency gocql.Consistency
+	values      [][]byte
+	pageSize    int
+	pagingState []byte
+}
+
+func readParams(r *reader) queryParams {
+	var p queryParams
+	p.consistency = gocql.Consistency(r.short())
+
+	flags := r.byte()
+	if flags&queryFlagValues != 0 {
+		n := r.short()
+		for i := 0; i < n && r.err == nil; i++ {
+			if flags&queryFlagWithNameValues != 0 {
+				r.string()
+			}
+			p.values = append(p.values, r.bytes())
+		}
+	}
+	if flags&queryFlagPageSize != 0 {
+		p.pageSize = r.int()
+	}
+	if flags&queryFlagWithPagingState != 0 {
+		p.pagingState = r.bytes()
+	}
+	if flags&queryFlagSerialConsistency != 0 {
+		r.short()
+	}
+	if flags&queryFlagDefaultTimestamp != 0 {
+		r.long()
+	}
+	return p
+}
+
+// delay waits for the delay of the result, it returns false when the server
+// is closed in the meantime.
+func (c *serverConn) delay(res *Result) bool {
+	if res == nil || res.delay <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(res.delay):
+		return true
+	case <-c.srv.quit:
+		return false
+	}
+}
+
+func (c *serverConn) execute(h header, op, stmt string, params queryParams) *writer {
+	c.srv.record(Request{
+		Op:          op,
+		Stmt:        stmt,
+		Values:      params.values,
+		Consistency: params.consistency,
+		PageSize:    params.pageSize,
+		PagingState: params.pagingState,
+	})
+
+	res := c.srv.match(stmt)
+	if !c.delay(res) {
+		return nil
+	}
+
+	w := newWriter(h.version, 0, h.stream, opResult)
+	switch {
+	case res != nil && res.err != nil:
+		w = newWriter(h.version, 0, h.stream, opError)
+		writeError(w, res.err)
+	case res != nil && res.columns != nil:
+		keyspace, table := c.table(stmt)
+		if err := c.writeRows(w, keyspace, table, res.columns, res.rows, params); err != nil {
+			w = newWriter(h.version, 0, h.stream, opError)
+			writeError(w, err)
+		}
+	case res != nil:
+		w.int(resultKindVoid)
+	default:
+		if err := c.writeDefault(w, stmt, params); err != nil {
+			w = newWriter(h.version, 0, h.stream, opError)
+			writeError(w, err)
+		}
+	}
+	return w
+}
+
+var (
+	selectRe = regexp.MustCompile(`(?is)^\s*SELECT\s+(.*?)\s+FROM\s+([\w."]+)`)
+	schemaRe = regexp.MustCompile(`(?is)^\s*(CREATE|ALTER|DROP)\s+(KEYSPACE|TABLE|COLUMNFAMILY|TYPE)\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?([\w."]+)`)
+)
+
+// table returns the keyspace and the table of the statement stmt.
+func (c *serverConn) table(stmt string) (string, string) {
+	c.mu.Lock()
+	keyspace := c.keyspace
+	c.mu.Unlock()
+
+	m := selectRe.FindStringSubmatch(stmt)
+	if m == nil {
+		return keyspace, ""
+	}
+
+	name := strings.Replace(m[2], `"`, "", -1)
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return keyspace, name
+}
+
+// writeDefault writes the result of the statements without a programmed
+// result.
+func (c *serverConn) writeDefault(w *writer, stmt string, params queryParams) error {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		w.int(resultKindVoid)
+		return nil
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "USE":
+		keyspace := strings.Trim(strings.TrimSuffix(fields[len(fields)-1], ";"), `"`)
+		c.mu.Lock()
+		c.keyspace = keyspace
+		c.mu.Unlock()
+
+		w.int(resultKindKeyspace)
+		w.string(keyspace)
+		return nil
+	case "SELECT":
+		m := selectRe.FindStringSubmatch(stmt)
+		if m == nil {
+			w.int(resultKindVoid)
+			return nil
+		}
+
+		keyspace, table := c.table(stmt)
+		columns, rows := c.srv.systemTable(keyspace, table)
+
+		var selected []Column
+		var indexes []int
+		for _, name := range strings.Split(m[1], ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				for i, col := range columns {
+					selected = append(selected, col)
+					indexes = append(indexes, i)
+				}
+				continue
+			}
+
+			i := columnIndex(columns, name)
+			if i < 0 {
+				selected = append(selected, Col(name, gocql.TypeVarchar))
+			} else {
+				selected = append(selected, columns[i])
+			}
+			indexes = append(indexes, i)
+		}
+
+		projected := make([][]interface{}, len(rows))
+		for i, row := range rows {
+			projected[i] = make([]interface{}, len(indexes))
+			for j, k := range indexes {
+				if k >= 0 {
+					projected[i][j] = row[k]
+				}
+			}
+		}
+
+		return c.writeRows(w, keyspace, table, selected, projected, params)
+	case "CREATE", "ALTER", "DROP":
+		m := schemaRe.FindStringSubmatch(stmt)
+		if m == nil {
+			w.int(resultKindVoid)
+			return nil
+		}
+
+		e := Event{
+			Type:   "SCHEMA_CHANGE",
+			Change: map[string]string{"CREATE": "CREATED", "ALTER": "UPDATED", "DROP": "DROPPED"}[strings.ToUpper(m[1])],
+			Target: strings.ToUpper(m[2]),
+		}
+		if e.Target == "COLUMNFAMILY" {
+			e.Target = "TABLE"
+		}
+
+		name := strings.Replace(m[3], `"`, "", -1)
+		if e.Target == "KEYSPACE" {
+			e.Keyspace = name
+		} else if i := strings.IndexByte(name, '.'); i >= 0 {
+			e.Keyspace, e.Name = name[:i], name[i+1:]
+		} else {
+			c.mu.Lock()
+			e.Keyspace, e.Name = c.keyspace, name
+			c.mu.Unlock()
+		}
+
+		w.int(resultKindSchemaChanged)
+		writeSchemaChange(w, e)
+		go c.srv.SendEvent(e)
+		return nil
+	default:
+		w.int(resultKindVoid)
+		return nil
+	}
+}
+
+func columnIndex(columns []Column, name string) int {
+	for i, col := range columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// systemTable returns the columns and the rows of the tables of the system
+// keyspace describing the cluster, or no columns for the other tables.
+func (s *Server) systemTable(keyspace, table string) ([]Column, [][]interface{}) {
+	if !strings.EqualFold(keyspace, "system") {
+		return nil, nil
+	}
+
+	addr := s.listener.Addr().(*net.TCPAddr).IP
+	tokens := Set(Native(gocql.TypeVarchar))
+
+	switch strings.ToLower(table) {
+	case "local":
+		columns := []Column{
+			Col("key", gocql.TypeVarchar),
+			Col("broadcast_address", gocql.TypeInet),
+			Col("listen_address", gocql.TypeInet),
+			Col("rpc_address", gocql.TypeInet),
+			Col("cluster_name", gocql.TypeVarchar),
+			Col("cql_version", gocql.TypeVarchar),
+			Col("data_center", gocql.TypeVarchar),
+			Col("rack", gocql.TypeVarchar),
+			Col("host_id", gocql.TypeUUID),
+			{Name: "tokens", Type: tokens},
+			Col("release_version", gocql.TypeVarchar),
+			Col("partitioner", gocql.TypeVarchar),
+			Col("schema_version", gocql.TypeUUID),
+		}
+		row := []interface{}{
+			"local", addr, addr, addr, "gocqltest", "3.4.5", "datacenter1", "rack1",
+			s.hostID, []string{"0"}, "3.11.4", "org.apache.cassandra.dht.Murmur3Partitioner",
+			s.schemaVersion,
+		}
+		return columns, [][]interface{}{row}
+	case "peers":
+		return []Column{
+			Col("peer", gocql.TypeInet),
+			Col("rpc_address", gocql.TypeInet),
+			Col("data_center", gocql.TypeVarchar),
+			Col("rack", gocql.TypeVarchar),
+			Col("host_id", gocql.TypeUUID),
+			{Name: "tokens", Type: tokens},
+			Col("release_version", gocql.TypeVarchar),
+			Col("schema_version", gocql.TypeUUID),
+		}, nil
+	}
+	return nil, nil
+}
+
+// writeRows writes the page of the rows requested by params, the paging
+// state is the index of the first row of the page.
+func (c *serverConn) writeRows(w *writer, keyspace, table string, columns []Column, rows [][]interface{}, params queryParams) error {
+	start := 0
+	if len(params.pagingState) > 0 {
+		n, err := strconv.Atoi(string(params.pagingState))
+		if err != nil || n < 0 || n > len(rows) {
+			return protocolError("invalid paging state")
+		}
+		start = n
+	}
+
+	end := len(rows)
+	if params.pageSize > 0 && start+params.pageSize < end {
+		end = start + params.pageSize
+	}
+
+	types := make([]gocql.TypeInfo, len(columns))
+	for i, col := range columns {
+		types[i] = withProto(col.Type, w.version)
+	}
+
+	values := make([][][]byte, 0, end-start)
+	for _, row := range rows[start:end] {
+		if len(row) != len(columns) {
+			return fmt.Errorf("gocqltest: expected %d values in row got %d", len(columns), len(row))
+		}
+
+		encoded := make([][]byte, len(row))
+		for i, v := range row {
+			if v == nil {
+				continue
+			}
+			b, err := gocql.Marshal(types[i], v)
+			if err != nil {
+				return err
+			}
+			if b == nil {
+				b = []byte{}
+			}
+			encoded[i] = b
+		}
+		values = append(values, encoded)
+	}
+
+	flags := rowsFlagGlobalTableSpec
+	if end < len(rows) {
+		flags |= rowsFlagHasMorePages
+	}
+
+	w.int(resultKindRows)
+	w.int(flags)
+	w.int(len(columns))
+	if end < len(rows) {
+		w.bytes([]byte(strconv.Itoa(end)))
+	}
+	w.string(keyspace)
+	w.string(table)
+	for i, col := range columns {
+		w.string(col.Name)
+		writeType(w, types[i])
+	}
+
+	w.int(len(values))
+	for _, row := range values {
+		for _, v := range row {
+			w.bytes(v)
+		}
+	}
+	return nil
+}
+
+func (c *serverConn) prepare(h header, stmt string) *writer {
+	sum := md5.Sum([]byte(stmt))
+	id := sum[:]
+
+	c.srv.mu.Lock()
+	c.srv.prepared[string(id)] = stmt
+	c.srv.mu.Unlock()
+
+	var params []Column
+	if res := c.srv.peek(stmt); res != nil && res.params != nil {
+		params = res.params
+	} else {
+		for i := 0; i < countMarkers(stmt); i++ {
+			params = append(params, Col("arg"+strconv.Itoa(i), gocql.TypeVarchar))
+		}
+	}
+
+	keyspace, table := c.table(stmt)
+
+	w := newWriter(h.version, 0, h.stream, opResult)
+	w.int(resultKindPrepared)
+	w.shortBytes(id)
+
+	// the bound variables
+	w.int(rowsFlagGlobalTableSpec)
+	w.int(len(params))
+	if h.version >= 4 {
+		// no partition key indexes
+		w.int(0)
+	}
+	w.string(keyspace)
+	w.string(table)
+	for _, p := range params {
+		w.string(p.Name)
+		writeType(w, withProto(p.Type, h.version))
+	}
+
+	// the metadata of the rows is sent with them
+	w.int(rowsFlagNoMetaData)
+	w.int(0)
+	return w
+}
+
+// peek returns the result programmed for stmt without using it.
+func (s *Server) peek(stmt string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := normalize(stmt)
+	for _, r := range s.results {
+		if r.stmt == key && !(r.once && r.used) {
+			return r
+		}
+	}
+	return nil
+}
+
+// countMarkers returns the number of ? bind markers of stmt outside of its
+// strings.
+func countMarkers(stmt string) int {
+	n := 0
+	var quote byte
+	for i := 0; i < len(stmt); i++ {
+		switch c := stmt[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+		}
+	}
+	return n
+}
+
+// batchEntry is a statement of a batch, either a query or the id of a
+// prepared statement.
+type batchEntry struct {
+	stmt   string
+	id     []byte
+	values [][]byte
+}
+
+func readBatch(r *reader, version byte) ([]batchEntry, gocql.Consistency) {
+	r.byte()
+	n := r.short()
+
+	entries := make([]batchEntry, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		var e batchEntry
+		if r.byte() == 0 {
+			e.stmt = r.longString()
+		} else {
+			e.id = r.shortBytes()
+		}
+
+		nv := r.short()
+		for j := 0; j < nv && r.err == nil; j++ {
+			e.values = append(e.values, r.bytes())
+		}
+		entries = append(entries, e)
+	}
+
+	cons := gocql.Consistency(r.short())
+	if version > 2 && r.err == nil {
+		flags := r.byte()
+		if flags&queryFlagSerialConsistency != 0 {
+			r.short()
+		}
+		if flags&queryFlagDefaultTimestamp != 0 {
+			r.long()
+		}
+	}
+	return entries, cons
+}
+
+func (c *serverConn) batch(h header, r *reader) *writer {
+	entries, cons := readBatch(r, h.version)
+	if r.err != nil {
+		return nil
+	}
+
+	for i, e := range entries {
+		if e.id == nil {
+			continue
+		}
+
+		c.srv.mu.Lock()
+		stmt, ok := c.srv.prepared[string(e.id)]
+		c.srv.mu.Unlock()
+		if !ok {
+			w := newWriter(h.version, 0, h.stream, opError)
+			writeError(w, &gocql.RequestErrUnprepared{StatementId: e.id})
+			return w
+		}
+		entries[i].stmt = stmt
+	}
+
+	for _, e := range entries {
+		c.srv.record(Request{Op: "BATCH", Stmt: e.stmt, Values: e.values, Consistency: cons})
+	}
+
+	stmt, values := batchKey(entries)
+	if w := c.replay(h, "BATCH", stmt, queryParams{values: values}); w != nil {
+		return w
+	}
+
+	var err error
+	for _, e := range entries {
+		res := c.srv.match(e.stmt)
+		if !c.delay(res) {
+			return nil
+		}
+		if res != nil && res.err != nil && err == nil {
+			err = res.err
+		}
+	}
+
+	if err != nil {
+		w := newWriter(h.version, 0, h.stream, opError)
+		writeError(w, err)
+		return w
+	}
+
+	w := newWriter(h.version, 0, h.stream, opResult)
+	w.int(resultKindVoid)
+	return w
+}
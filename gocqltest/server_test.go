@@ -0,0 +1,221 @@
+// +build all unit
+
+package gocqltest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func createSession(t *testing.T, srv *Server, proto int) *gocql.Session {
+	t.Helper()
+
+	cluster := srv.Cluster()
+	cluster.ProtoVersion = proto
+	cluster.Timeout = time.Second
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestServerQuery(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.On("SELECT id, name, tags FROM ks.users").Rows(
+		[]Column{Col("id", gocql.TypeInt), Col("name", gocql.TypeVarchar), {Name: "tags", Type: Set(Native(gocql.TypeVarchar))}},
+		[]interface{}{1, "alice", []string{"admin"}},
+		[]interface{}{2, "bob", nil},
+		[]interface{}{3, "carol", []string{"a", "b"}},
+	)
+
+	for _, proto := range []int{2, 3, 4} {
+		session := createSession(t, srv, proto)
+
+		iter := session.Query("SELECT id, name, tags FROM ks.users").PageSize(2).Iter()
+		var (
+			id    int
+			name  string
+			tags  []string
+			names []string
+		)
+		for iter.Scan(&id, &name, &tags) {
+			names = append(names, name)
+		}
+		if err := iter.Close(); err != nil {
+			t.Fatalf("proto %d: %v", proto, err)
+		}
+		if expected := []string{"alice", "bob", "carol"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("proto %d: expected %v got %v", proto, expected, names)
+		}
+		if expected := []string{"a", "b"}; !reflect.DeepEqual(tags, expected) {
+			t.Errorf("proto %d: expected the tags %v got %v", proto, expected, tags)
+		}
+
+		session.Close()
+	}
+
+	var pages int
+	for _, req := range srv.Requests() {
+		if req.Stmt == "SELECT id, name, tags FROM ks.users" {
+			pages++
+		}
+	}
+	if pages != 6 {
+		t.Errorf("expected 2 pages per session got %d requests", pages)
+	}
+}
+
+func TestServerPrepared(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	const stmt = "SELECT name FROM users WHERE id = ?"
+	srv.On(stmt).
+		Params(Col("id", gocql.TypeInt)).
+		Rows([]Column{Col("name", gocql.TypeVarchar)}, []interface{}{"alice"})
+
+	session := createSession(t, srv, 4)
+	defer session.Close()
+
+	var name string
+	if err := session.Query(stmt, 1).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice" {
+		t.Errorf("expected alice got %q", name)
+	}
+
+	srv.ForgetPrepared()
+	if err := session.Query(stmt, 2).Scan(&name); err != nil {
+		t.Fatalf("expected the statement to be prepared again got %v", err)
+	}
+
+	var values [][][]byte
+	for _, req := range srv.Requests() {
+		if req.Op == "EXECUTE" && req.Stmt == stmt {
+			values = append(values, req.Values)
+		}
+	}
+	expected := [][][]byte{{{0, 0, 0, 1}}, {{0, 0, 0, 2}}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected the executions %v got %v", expected, values)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.On("INSERT INTO t (k) VALUES (1)").Error(&gocql.RequestErrWriteTimeout{
+		Consistency: gocql.Quorum,
+		Received:    1,
+		BlockFor:    2,
+		WriteType:   "SIMPLE",
+	})
+	srv.On("SELECT * FROM t").Error(gocql.ErrCodeOverloaded)
+	srv.On("UPDATE t SET v = 1 WHERE k = 1").Error(errors.New("boom"))
+
+	session := createSession(t, srv, 4)
+	defer session.Close()
+
+	err = session.Query("INSERT INTO t (k) VALUES (1)").Exec()
+	var timeout *gocql.RequestErrWriteTimeout
+	if !errors.As(err, &timeout) {
+		t.Fatalf("expected a write timeout got %v", err)
+	}
+	if timeout.Received != 1 || timeout.BlockFor != 2 || timeout.WriteType != "SIMPLE" {
+		t.Errorf("unexpected write timeout %+v", timeout)
+	}
+
+	if err := session.Query("SELECT * FROM t").Exec(); !errors.Is(err, gocql.ErrCodeOverloaded) {
+		t.Errorf("expected %v got %v", gocql.ErrCodeOverloaded, err)
+	}
+
+	err = session.Query("UPDATE t SET v = 1 WHERE k = 1").Exec()
+	if !errors.Is(err, gocql.ErrCodeServer) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected a server error got %v", err)
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch)
+	batch.Query("UPDATE t SET v = 2 WHERE k = 2")
+	batch.Query("INSERT INTO t (k) VALUES (1)")
+	if err := session.ExecuteBatch(batch); !errors.As(err, &timeout) {
+		t.Errorf("expected the batch to fail with a write timeout got %v", err)
+	}
+}
+
+func TestServerDelay(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.On("SELECT * FROM slow").Delay(time.Second)
+
+	cluster := srv.Cluster()
+	cluster.Timeout = 100 * time.Millisecond
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	if err := session.Query("SELECT * FROM slow").Exec(); err != gocql.ErrTimeoutNoResponse {
+		t.Errorf("expected %v got %v", gocql.ErrTimeoutNoResponse, err)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	cluster := srv.Cluster()
+	cluster.DiscoverHosts = true
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	peers := func() int {
+		n := 0
+		for _, req := range srv.Requests() {
+			if strings.Contains(req.Stmt, "system.peers") {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := peers()
+	srv.SendEvent(TopologyEvent("NEW_NODE", []byte{127, 0, 0, 2}, 9042))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for peers() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the topology event to refresh the ring")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
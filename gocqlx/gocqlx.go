@@ -0,0 +1,328 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gocqlx reduces the boilerplate of the CRUD statements: the values of
+// named queries are bound from the fields of structs or from maps, the
+// statements of a table are compiled from the fields of a struct and the
+// selected rows are copied into structs or slices of structs:
+//
+//	type Person struct {
+//		ID    gocql.UUID `cql:"id"`
+//		Name  string     `cql:"name"`
+//		Email string     `cql:"email"`
+//	}
+//
+//	people := gocqlx.NewTable("people", Person{}, []string{"id"}, nil)
+//
+//	stmt, names := people.Insert()
+//	err := gocqlx.Query(session.Query(stmt), names).BindStruct(&p).Exec()
+//
+//	q := gocqlx.NamedQuery(session, "SELECT * FROM people WHERE id = :id")
+//	err = q.BindMap(map[string]interface{}{"id": id}).Get(&p)
+//
+// The statements can also be built with the qb subpackage.
+//
+// Fields are mapped to the columns of their cql tag, or of their lower cased
+// name when they are not tagged, in the same way as Iter.StructScan. Fields
+// tagged with "-" and unexported fields are ignored.
+package gocqlx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gocql/gocql"
+)
+
+var ErrUnterminatedString = errors.New("gocqlx: unterminated string literal")
+
+// CompileNamedQuery replaces the :name bind markers of stmt with ? and returns
+// the names of the markers in the order they appear in the statement. The
+// markers of string literals, quoted identifiers and comments are left as is.
+func CompileNamedQuery(stmt string) (string, []string, error) {
+	var (
+		buf   strings.Builder
+		names []string
+	)
+	buf.Grow(len(stmt))
+
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case c == '\'' || c == '"':
+			// quoted strings and identifiers, quotes are escaped by doubling them
+			end := i + 1
+			for ; end < len(stmt); end++ {
+				if stmt[end] == c {
+					if end+1 < len(stmt) && stmt[end+1] == c {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(stmt) {
+				return "", nil, ErrUnterminatedString
+			}
+			buf.WriteString(stmt[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(stmt[i:], "--"), c == '/' && strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			buf.WriteString(stmt[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				buf.WriteString(stmt[i:])
+				i = len(stmt)
+				continue
+			}
+			buf.WriteString(stmt[i : i+end+4])
+			i += end + 3
+		case c == ':' && i+1 < len(stmt) && isNameChar(rune(stmt[i+1])):
+			end := i + 1
+			for end < len(stmt) && isNameChar(rune(stmt[end])) {
+				end++
+			}
+			names = append(names, stmt[i+1:end])
+			buf.WriteByte('?')
+			i = end - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String(), names, nil
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// Queryx is a gocql.Query whose values are bound by name.
+type Queryx struct {
+	*gocql.Query
+
+	// Names are the names of the values bound to the markers of the query,
+	// in order.
+	Names []string
+
+	err error
+}
+
+// Query returns a Queryx binding the values named names to q.
+func Query(q *gocql.Query, names []string) *Queryx {
+	return &Queryx{Query: q, Names: names}
+}
+
+// NamedQuery returns a Queryx of the statement stmt with :name bind markers,
+// see CompileNamedQuery. The error of an invalid statement is returned when
+// the query is executed.
+func NamedQuery(s *gocql.Session, stmt string) *Queryx {
+	cstmt, names, err := CompileNamedQuery(stmt)
+	if err != nil {
+		return &Queryx{Query: s.Query(stmt), err: err}
+	}
+	return Query(s.Query(cstmt), names)
+}
+
+// BindStruct binds the values of the query to the fields of the struct v,
+// which may be a struct or a pointer to a struct.
+func (q *Queryx) BindStruct(v interface{}) *Queryx {
+	return q.BindStructMap(v, nil)
+}
+
+// BindMap binds the values of the query to the values of m.
+func (q *Queryx) BindMap(m map[string]interface{}) *Queryx {
+	values := make([]interface{}, len(q.Names))
+	for i, name := range q.Names {
+		v, ok := m[name]
+		if !ok {
+			q.err = fmt.Errorf("gocqlx: missing value for %q", name)
+			return q
+		}
+		values[i] = v
+	}
+
+	q.Bind(values...)
+	return q
+}
+
+// BindStructMap binds the values of the query to the fields of the struct v,
+// or to the values of m for the names without a field.
+func (q *Queryx) BindStructMap(v interface{}, m map[string]interface{}) *Queryx {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		q.err = fmt.Errorf("gocqlx: expected a struct got %T", v)
+		return q
+	}
+
+	fields := structFields(rv.Type())
+	values := make([]interface{}, len(q.Names))
+	for i, name := range q.Names {
+		if f, ok := lookupField(fields, name); ok {
+			values[i] = fieldByIndex(rv, f.index).Interface()
+		} else if mv, ok := m[name]; ok {
+			values[i] = mv
+		} else {
+			q.err = fmt.Errorf("gocqlx: missing field for %q in %T", name, v)
+			return q
+		}
+	}
+
+	q.Bind(values...)
+	return q
+}
+
+// Err returns the error of the query building or binding.
+func (q *Queryx) Err() error {
+	return q.err
+}
+
+// Exec executes the query without returning any rows.
+func (q *Queryx) Exec() error {
+	if q.err != nil {
+		return q.err
+	}
+	return q.Query.Exec()
+}
+
+// Get executes the query and copies the first selected row into the struct
+// pointed at by dest. If no rows were selected, gocql.ErrNotFound is
+// returned.
+func (q *Queryx) Get(dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	return q.Query.StructScan(dest)
+}
+
+// Select executes the query and appends the selected rows to the slice of
+// structs, or of pointers to structs, pointed at by dest.
+func (q *Queryx) Select(dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("gocqlx: expected a pointer to a slice got %T", dest)
+	}
+
+	slice := rv.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("gocqlx: expected a slice of structs got %T", dest)
+	}
+
+	iter := q.Iter()
+	for {
+		row := reflect.New(elem)
+		if !iter.StructScan(row.Interface()) {
+			break
+		}
+		if isPtr {
+			slice = reflect.Append(slice, row)
+		} else {
+			slice = reflect.Append(slice, row.Elem())
+		}
+	}
+	rv.Elem().Set(slice)
+
+	return iter.Close()
+}
+
+// field is a field of a struct mapped to a column.
+type field struct {
+	column string
+	index  []int
+}
+
+// structFields returns the fields of the struct type t mapped to columns, the
+// fields of embedded structs are promoted unless a field of the outer struct
+// maps to the same column.
+func structFields(t reflect.Type) []field {
+	var (
+		fields   []field
+		embedded []field
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("cql")
+		if tag == "-" {
+			continue
+		}
+
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range structFields(sf.Type) {
+				embedded = append(embedded, field{column: f.column, index: append([]int{i}, f.index...)})
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		column := tag
+		if column == "" {
+			column = strings.ToLower(sf.Name)
+		}
+		fields = append(fields, field{column: column, index: []int{i}})
+	}
+
+	for _, f := range embedded {
+		if _, ok := lookupField(fields, f.column); !ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// lookupField finds the field mapped to the column name, column names are
+// matched case insensitively as they are lower case unless quoted.
+func lookupField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if strings.EqualFold(f.column, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		v = v.Field(i)
+	}
+	return v
+}
+
+// Columns returns the columns the fields of the struct v map to.
+func Columns(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := structFields(t)
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+	return columns
+}
@@ -0,0 +1,118 @@
+// +build all unit
+
+package gocqlx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+type base struct {
+	ID   gocql.UUID `cql:"id"`
+	Name string
+}
+
+type person struct {
+	base
+	Name     string
+	Email    string
+	Password string `cql:"-"`
+	age      int
+}
+
+func TestCompileNamedQuery(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+		names    []string
+	}{
+		{"SELECT * FROM t WHERE a = :a AND b=:b_2", "SELECT * FROM t WHERE a = ? AND b=?", []string{"a", "b_2"}},
+		{"INSERT INTO t (a, b) VALUES (:a, ?)", "INSERT INTO t (a, b) VALUES (?, ?)", []string{"a"}},
+		{"SELECT * FROM t WHERE a = ':a' AND b = 'it''s :b'", "SELECT * FROM t WHERE a = ':a' AND b = 'it''s :b'", nil},
+		{`SELECT ":a" FROM t -- :b` + "\nWHERE c = :c", `SELECT ":a" FROM t -- :b` + "\nWHERE c = ?", []string{"c"}},
+		{"SELECT /* :a */ * FROM t WHERE a = :a", "SELECT /* :a */ * FROM t WHERE a = ?", []string{"a"}},
+		{"SELECT * FROM t WHERE a IN :list", "SELECT * FROM t WHERE a IN ?", []string{"list"}},
+	}
+
+	for _, test := range tests {
+		stmt, names, err := CompileNamedQuery(test.stmt)
+		if err != nil {
+			t.Errorf("%q: %v", test.stmt, err)
+			continue
+		}
+		if stmt != test.expected {
+			t.Errorf("%q: expected %q got %q", test.stmt, test.expected, stmt)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%q: expected the names %v got %v", test.stmt, test.names, names)
+		}
+	}
+
+	if _, _, err := CompileNamedQuery("SELECT * FROM t WHERE a = 'a"); err != ErrUnterminatedString {
+		t.Errorf("expected %v got %v", ErrUnterminatedString, err)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	expected := []string{"name", "email", "id"}
+	if columns := Columns(&person{}); !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected %v got %v", expected, columns)
+	}
+}
+
+func TestBind(t *testing.T) {
+	p := person{base: base{ID: gocql.TimeUUID()}, Name: "Jane Doe", Email: "jane@example.com"}
+
+	q := Query(&gocql.Query{}, []string{"ID", "name", "limit"})
+	q.BindStructMap(&p, map[string]interface{}{"limit": 10})
+	if err := q.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{p.ID, p.Name, 10}
+	if values := q.Values(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+
+	q = Query(&gocql.Query{}, []string{"a", "b"})
+	q.BindMap(map[string]interface{}{"a": 1, "b": "2"})
+	if err := q.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if values := q.Values(); !reflect.DeepEqual(values, []interface{}{1, "2"}) {
+		t.Errorf("expected the values of the map got %v", values)
+	}
+
+	if err := Query(&gocql.Query{}, []string{"missing"}).BindStruct(p).Err(); err == nil {
+		t.Error("expected an error binding a missing field")
+	}
+	if err := Query(&gocql.Query{}, []string{"a"}).BindStruct(1).Err(); err == nil {
+		t.Error("expected an error binding a non struct")
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable("people", person{}, []string{"id"}, []string{"email"})
+
+	check := func(stmt string, names []string, expected string, expNames ...string) {
+		t.Helper()
+		if stmt != expected {
+			t.Errorf("expected %q got %q", expected, stmt)
+		}
+		if !reflect.DeepEqual(names, expNames) {
+			t.Errorf("%q: expected the names %v got %v", stmt, expNames, names)
+		}
+	}
+
+	stmt, names := table.Get()
+	check(stmt, names, "SELECT name,email,id FROM people WHERE id=? AND email=?", "id", "email")
+	stmt, names = table.Select("name")
+	check(stmt, names, "SELECT name FROM people WHERE id=?", "id")
+	stmt, names = table.Insert()
+	check(stmt, names, "INSERT INTO people (name,email,id) VALUES (?,?,?)", "name", "email", "id")
+	stmt, names = table.Update()
+	check(stmt, names, "UPDATE people SET name=? WHERE id=? AND email=?", "name", "id", "email")
+	stmt, names = table.Delete()
+	check(stmt, names, "DELETE FROM people WHERE id=? AND email=?", "id", "email")
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/gocqlx"
+)
+
+// DeleteBuilder builds DELETE statements.
+type DeleteBuilder struct {
+	table    string
+	columns  []string
+	where    []Cmp
+	ifs      []Cmp
+	existing bool
+	using    using
+}
+
+// Delete returns a builder of the DELETE statements of table.
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Columns sets the deleted columns, whole rows are deleted by default.
+func (b *DeleteBuilder) Columns(columns ...string) *DeleteBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *DeleteBuilder) Where(cmps ...Cmp) *DeleteBuilder {
+	b.where = append(b.where, cmps...)
+	return b
+}
+
+// If adds conditions to the IF clause, the deletion is then a lightweight
+// transaction.
+func (b *DeleteBuilder) If(cmps ...Cmp) *DeleteBuilder {
+	b.ifs = append(b.ifs, cmps...)
+	return b
+}
+
+// Existing only deletes the row if it exists, with IF EXISTS.
+func (b *DeleteBuilder) Existing() *DeleteBuilder {
+	b.existing = true
+	return b
+}
+
+// Timestamp sets the time of the deletion.
+func (b *DeleteBuilder) Timestamp(t time.Time) *DeleteBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampNamed binds the time of the deletion, in microseconds, to the bind
+// marker name.
+func (b *DeleteBuilder) TimestampNamed(name string) *DeleteBuilder {
+	b.using.setTimestampNamed(name)
+	return b
+}
+
+// ToCql returns the statement and the names of its bind markers.
+func (b *DeleteBuilder) ToCql() (stmt string, names []string) {
+	var buf strings.Builder
+	buf.WriteString("DELETE ")
+	if len(b.columns) > 0 {
+		buf.WriteString(strings.Join(b.columns, ","))
+		buf.WriteByte(' ')
+	}
+	buf.WriteString("FROM ")
+	buf.WriteString(b.table)
+	names = b.using.writeCql(&buf)
+
+	names = append(names, writeCmps(&buf, "WHERE", b.where)...)
+	if b.existing {
+		buf.WriteString(" IF EXISTS")
+	} else {
+		names = append(names, writeCmps(&buf, "IF", b.ifs)...)
+	}
+
+	return buf.String(), names
+}
+
+// Query returns the query of the statement on session s.
+func (b *DeleteBuilder) Query(s *gocql.Session) *gocqlx.Queryx {
+	stmt, names := b.ToCql()
+	return gocqlx.Query(s.Query(stmt), names)
+}
+
+// Validate checks that the table and the columns of the statement exist in
+// the keyspace km.
+func (b *DeleteBuilder) Validate(km *gocql.KeyspaceMetadata) error {
+	columns := append(append([]string(nil), b.columns...), cmpColumns(b.where)...)
+	columns = append(columns, cmpColumns(b.ifs)...)
+	return validate(km, b.table, columns)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/gocqlx"
+)
+
+// InsertBuilder builds INSERT statements.
+type InsertBuilder struct {
+	table   string
+	columns []string
+	unique  bool
+	using   using
+}
+
+// Insert returns a builder of the INSERT statements of table.
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns adds inserted columns, their bind markers are named after them.
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Unique only inserts the row if it does not exist yet, with IF NOT EXISTS.
+func (b *InsertBuilder) Unique() *InsertBuilder {
+	b.unique = true
+	return b
+}
+
+// TTL sets the time to live of the inserted values.
+func (b *InsertBuilder) TTL(d time.Duration) *InsertBuilder {
+	b.using.setTTL(d)
+	return b
+}
+
+// TTLNamed binds the time to live of the inserted values, in seconds, to the
+// bind marker name.
+func (b *InsertBuilder) TTLNamed(name string) *InsertBuilder {
+	b.using.setTTLNamed(name)
+	return b
+}
+
+// Timestamp sets the write time of the inserted values.
+func (b *InsertBuilder) Timestamp(t time.Time) *InsertBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampNamed binds the write time of the inserted values, in
+// microseconds, to the bind marker name.
+func (b *InsertBuilder) TimestampNamed(name string) *InsertBuilder {
+	b.using.setTimestampNamed(name)
+	return b
+}
+
+// ToCql returns the statement and the names of its bind markers.
+func (b *InsertBuilder) ToCql() (stmt string, names []string) {
+	var buf strings.Builder
+	buf.WriteString("INSERT INTO ")
+	buf.WriteString(b.table)
+	buf.WriteString(" (")
+	buf.WriteString(strings.Join(b.columns, ","))
+	buf.WriteString(") VALUES (")
+	buf.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(b.columns)), ","))
+	buf.WriteByte(')')
+	names = append(names, b.columns...)
+
+	if b.unique {
+		buf.WriteString(" IF NOT EXISTS")
+	}
+	names = append(names, b.using.writeCql(&buf)...)
+
+	return buf.String(), names
+}
+
+// Query returns the query of the statement on session s.
+func (b *InsertBuilder) Query(s *gocql.Session) *gocqlx.Queryx {
+	stmt, names := b.ToCql()
+	return gocqlx.Query(s.Query(stmt), names)
+}
+
+// Validate checks that the table and the columns of the statement exist in
+// the keyspace km.
+func (b *InsertBuilder) Validate(km *gocql.KeyspaceMetadata) error {
+	return validate(km, b.table, b.columns)
+}
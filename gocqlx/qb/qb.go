@@ -0,0 +1,254 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qb builds the CQL statements of gocqlx queries. The builders return
+// the statement along with the names of its bind markers, so that the values
+// are bound with Queryx.BindStruct or Queryx.BindMap:
+//
+//	stmt, names := qb.Select("people").
+//		Columns("id", "name").
+//		Where(qb.Eq("id"), qb.Gt("age")).
+//		Limit(10).
+//		ToCql()
+//	// SELECT id,name FROM people WHERE id=? AND age>? LIMIT 10
+//
+//	q := gocqlx.Query(session.Query(stmt), names).BindStruct(&p)
+//
+// The bind markers are named after their column unless the Named variants of
+// the comparisons are used. The builders can be checked against the schema of
+// the keyspace with Validate.
+package qb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrUnknownTable  = errors.New("qb: unknown table")
+	ErrUnknownColumn = errors.New("qb: unknown column")
+)
+
+// Cmp is a comparison of the WHERE or IF clause of a statement.
+type Cmp struct {
+	op     string
+	column string
+	name   string
+}
+
+func (c Cmp) writeCql(buf *strings.Builder) []string {
+	buf.WriteString(c.column)
+	buf.WriteString(c.op)
+	buf.WriteByte('?')
+	return []string{c.name}
+}
+
+// Eq returns the comparison column=?.
+func Eq(column string) Cmp {
+	return EqNamed(column, column)
+}
+
+// EqNamed returns the comparison column=? whose bind marker is named name.
+func EqNamed(column, name string) Cmp {
+	return Cmp{op: "=", column: column, name: name}
+}
+
+// Ne returns the comparison column!=?, only valid in IF clauses.
+func Ne(column string) Cmp {
+	return NeNamed(column, column)
+}
+
+// NeNamed returns the comparison column!=? whose bind marker is named name.
+func NeNamed(column, name string) Cmp {
+	return Cmp{op: "!=", column: column, name: name}
+}
+
+// Lt returns the comparison column<?.
+func Lt(column string) Cmp {
+	return LtNamed(column, column)
+}
+
+// LtNamed returns the comparison column<? whose bind marker is named name.
+func LtNamed(column, name string) Cmp {
+	return Cmp{op: "<", column: column, name: name}
+}
+
+// LtOrEq returns the comparison column<=?.
+func LtOrEq(column string) Cmp {
+	return LtOrEqNamed(column, column)
+}
+
+// LtOrEqNamed returns the comparison column<=? whose bind marker is named
+// name.
+func LtOrEqNamed(column, name string) Cmp {
+	return Cmp{op: "<=", column: column, name: name}
+}
+
+// Gt returns the comparison column>?.
+func Gt(column string) Cmp {
+	return GtNamed(column, column)
+}
+
+// GtNamed returns the comparison column>? whose bind marker is named name.
+func GtNamed(column, name string) Cmp {
+	return Cmp{op: ">", column: column, name: name}
+}
+
+// GtOrEq returns the comparison column>=?.
+func GtOrEq(column string) Cmp {
+	return GtOrEqNamed(column, column)
+}
+
+// GtOrEqNamed returns the comparison column>=? whose bind marker is named
+// name.
+func GtOrEqNamed(column, name string) Cmp {
+	return Cmp{op: ">=", column: column, name: name}
+}
+
+// In returns the comparison column IN ?, the value is bound to a slice.
+func In(column string) Cmp {
+	return InNamed(column, column)
+}
+
+// InNamed returns the comparison column IN ? whose bind marker is named name.
+func InNamed(column, name string) Cmp {
+	return Cmp{op: " IN ", column: column, name: name}
+}
+
+// Contains returns the comparison column CONTAINS ? of collections.
+func Contains(column string) Cmp {
+	return ContainsNamed(column, column)
+}
+
+// ContainsNamed returns the comparison column CONTAINS ? whose bind marker is
+// named name.
+func ContainsNamed(column, name string) Cmp {
+	return Cmp{op: " CONTAINS ", column: column, name: name}
+}
+
+// ContainsKey returns the comparison column CONTAINS KEY ? of maps.
+func ContainsKey(column string) Cmp {
+	return ContainsKeyNamed(column, column)
+}
+
+// ContainsKeyNamed returns the comparison column CONTAINS KEY ? whose bind
+// marker is named name.
+func ContainsKeyNamed(column, name string) Cmp {
+	return Cmp{op: " CONTAINS KEY ", column: column, name: name}
+}
+
+// writeCmps writes the clause of the comparisons, such as WHERE or IF, and
+// returns the names of their bind markers.
+func writeCmps(buf *strings.Builder, clause string, cmps []Cmp) []string {
+	var names []string
+	for i, c := range cmps {
+		if i == 0 {
+			buf.WriteByte(' ')
+			buf.WriteString(clause)
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteString(" AND ")
+		}
+		names = append(names, c.writeCql(buf)...)
+	}
+	return names
+}
+
+// using is the USING clause of the statements writing rows. The TTL and
+// timestamp are either literals or bind markers.
+type using struct {
+	ttl           string
+	ttlName       string
+	timestamp     string
+	timestampName string
+}
+
+func (u *using) setTTL(d time.Duration) {
+	u.ttl = strconv.FormatInt(int64(d/time.Second), 10)
+	u.ttlName = ""
+}
+
+func (u *using) setTTLNamed(name string) {
+	u.ttl = "?"
+	u.ttlName = name
+}
+
+func (u *using) setTimestamp(t time.Time) {
+	u.timestamp = strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), 10)
+	u.timestampName = ""
+}
+
+func (u *using) setTimestampNamed(name string) {
+	u.timestamp = "?"
+	u.timestampName = name
+}
+
+func (u *using) writeCql(buf *strings.Builder) []string {
+	var names []string
+	if u.ttl != "" {
+		buf.WriteString(" USING TTL ")
+		buf.WriteString(u.ttl)
+		if u.ttlName != "" {
+			names = append(names, u.ttlName)
+		}
+	}
+	if u.timestamp != "" {
+		if u.ttl != "" {
+			buf.WriteString(" AND TIMESTAMP ")
+		} else {
+			buf.WriteString(" USING TIMESTAMP ")
+		}
+		buf.WriteString(u.timestamp)
+		if u.timestampName != "" {
+			names = append(names, u.timestampName)
+		}
+	}
+	return names
+}
+
+// validate checks that the table and the columns exist in the keyspace. The
+// columns which are not identifiers, such as * or function calls, are not
+// checked.
+func validate(km *gocql.KeyspaceMetadata, table string, columns []string) error {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		table = table[i+1:]
+	}
+
+	t, ok := km.Tables[identifier(table)]
+	if !ok {
+		return fmt.Errorf("%w: %s.%s", ErrUnknownTable, km.Name, table)
+	}
+
+	for _, c := range columns {
+		if strings.ContainsAny(c, "*( ") {
+			continue
+		}
+		if _, ok := t.Columns[identifier(c)]; !ok {
+			return fmt.Errorf("%w: %s in %s.%s", ErrUnknownColumn, c, km.Name, t.Name)
+		}
+	}
+	return nil
+}
+
+// identifier returns the name of the identifier s, which is case sensitive
+// when quoted.
+func identifier(s string) string {
+	if len(s) > 1 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.Replace(s[1:len(s)-1], `""`, `"`, -1)
+	}
+	return strings.ToLower(s)
+}
+
+func cmpColumns(cmps []Cmp) []string {
+	columns := make([]string, len(cmps))
+	for i, c := range cmps {
+		columns[i] = c.column
+	}
+	return columns
+}
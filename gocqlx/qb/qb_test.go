@@ -0,0 +1,100 @@
+// +build all unit
+
+package qb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type builder interface {
+	ToCql() (string, []string)
+}
+
+func TestBuilders(t *testing.T) {
+	ts := time.Unix(1, 0)
+
+	tests := []struct {
+		b     builder
+		stmt  string
+		names []string
+	}{
+		{Select("t"), "SELECT * FROM t", nil},
+		{
+			Select("ks.t").Columns("a", "b").Where(Eq("a"), GtNamed("b", "min"), In("c")).OrderBy("b", DESC).Limit(10).AllowFiltering(),
+			"SELECT a,b FROM ks.t WHERE a=? AND b>? AND c IN ? ORDER BY b DESC LIMIT 10 ALLOW FILTERING",
+			[]string{"a", "min", "c"},
+		},
+		{
+			Insert("t").Columns("a", "b").Unique().TTL(time.Minute).TimestampNamed("ts"),
+			"INSERT INTO t (a,b) VALUES (?,?) IF NOT EXISTS USING TTL 60 AND TIMESTAMP ?",
+			[]string{"a", "b", "ts"},
+		},
+		{
+			Update("t").TTLNamed("ttl").Set("a").Add("c").Remove("d").Where(Eq("k")).If(Ne("a"), LtOrEq("b")),
+			"UPDATE t USING TTL ? SET a=?,c=c+?,d=d-? WHERE k=? IF a!=? AND b<=?",
+			[]string{"ttl", "a", "c", "d", "k", "a", "b"},
+		},
+		{
+			Update("t").SetNamed("a", "x").Where(Eq("k")).Existing(),
+			"UPDATE t SET a=? WHERE k=? IF EXISTS",
+			[]string{"x", "k"},
+		},
+		{
+			Delete("t").Columns("a").Timestamp(ts).Where(Eq("k"), ContainsKey("m")).If(Eq("b")),
+			"DELETE a FROM t USING TIMESTAMP 1000000 WHERE k=? AND m CONTAINS KEY ? IF b=?",
+			[]string{"k", "m", "b"},
+		},
+		{Delete("t").Where(Eq("k")).Existing(), "DELETE FROM t WHERE k=? IF EXISTS", []string{"k"}},
+	}
+
+	for _, test := range tests {
+		stmt, names := test.b.ToCql()
+		if stmt != test.stmt {
+			t.Errorf("expected %q got %q", test.stmt, stmt)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%q: expected the names %v got %v", stmt, test.names, names)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	km := &gocql.KeyspaceMetadata{
+		Name: "ks",
+		Tables: map[string]*gocql.TableMetadata{
+			"t": {
+				Name: "t",
+				Columns: map[string]*gocql.ColumnMetadata{
+					"k": {Name: "k"},
+					"a": {Name: "a"},
+					"B": {Name: "B"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		b interface {
+			Validate(*gocql.KeyspaceMetadata) error
+		}
+		err error
+	}{
+		{Select("ks.t").Columns("a", `"B"`, "count(*)").Where(Eq("K")), nil},
+		{Select("t").Columns("B"), ErrUnknownColumn},
+		{Select("missing"), ErrUnknownTable},
+		{Insert("t").Columns("k", "c"), ErrUnknownColumn},
+		{Update("t").Set("a").Where(Eq("k")).If(Eq("c")), ErrUnknownColumn},
+		{Delete("t").Where(Eq("k")), nil},
+	}
+
+	for i, test := range tests {
+		if err := test.b.Validate(km); !errors.Is(err, test.err) {
+			t.Errorf("%d: expected %v got %v", i, test.err, err)
+		}
+	}
+}
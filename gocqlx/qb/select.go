@@ -0,0 +1,130 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/gocqlx"
+)
+
+// Order is the order of the rows selected by SelectBuilder.OrderBy.
+type Order bool
+
+const (
+	ASC  Order = true
+	DESC Order = false
+)
+
+func (o Order) String() string {
+	if o == ASC {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+type orderBy struct {
+	column string
+	order  Order
+}
+
+// SelectBuilder builds SELECT statements.
+type SelectBuilder struct {
+	table          string
+	columns        []string
+	where          []Cmp
+	orderBy        []orderBy
+	limit          uint
+	allowFiltering bool
+}
+
+// Select returns a builder of the SELECT statements of table.
+func Select(table string) *SelectBuilder {
+	return &SelectBuilder{table: table}
+}
+
+// Columns sets the selected columns, all of them are selected by default.
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *SelectBuilder) Where(cmps ...Cmp) *SelectBuilder {
+	b.where = append(b.where, cmps...)
+	return b
+}
+
+// OrderBy orders the rows by column.
+func (b *SelectBuilder) OrderBy(column string, o Order) *SelectBuilder {
+	b.orderBy = append(b.orderBy, orderBy{column: column, order: o})
+	return b
+}
+
+// Limit limits the number of selected rows.
+func (b *SelectBuilder) Limit(limit uint) *SelectBuilder {
+	b.limit = limit
+	return b
+}
+
+// AllowFiltering allows the server to filter the rows of the table.
+func (b *SelectBuilder) AllowFiltering() *SelectBuilder {
+	b.allowFiltering = true
+	return b
+}
+
+// ToCql returns the statement and the names of its bind markers.
+func (b *SelectBuilder) ToCql() (stmt string, names []string) {
+	var buf strings.Builder
+	buf.WriteString("SELECT ")
+	if len(b.columns) == 0 {
+		buf.WriteByte('*')
+	} else {
+		buf.WriteString(strings.Join(b.columns, ","))
+	}
+	buf.WriteString(" FROM ")
+	buf.WriteString(b.table)
+
+	names = writeCmps(&buf, "WHERE", b.where)
+
+	for i, o := range b.orderBy {
+		if i == 0 {
+			buf.WriteString(" ORDER BY ")
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(o.column)
+		buf.WriteByte(' ')
+		buf.WriteString(o.order.String())
+	}
+
+	if b.limit > 0 {
+		buf.WriteString(" LIMIT ")
+		buf.WriteString(strconv.FormatUint(uint64(b.limit), 10))
+	}
+	if b.allowFiltering {
+		buf.WriteString(" ALLOW FILTERING")
+	}
+
+	return buf.String(), names
+}
+
+// Query returns the query of the statement on session s.
+func (b *SelectBuilder) Query(s *gocql.Session) *gocqlx.Queryx {
+	stmt, names := b.ToCql()
+	return gocqlx.Query(s.Query(stmt), names)
+}
+
+// Validate checks that the table and the columns of the statement exist in
+// the keyspace km.
+func (b *SelectBuilder) Validate(km *gocql.KeyspaceMetadata) error {
+	columns := append(append([]string(nil), b.columns...), cmpColumns(b.where)...)
+	for _, o := range b.orderBy {
+		columns = append(columns, o.column)
+	}
+	return validate(km, b.table, columns)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/gocqlx"
+)
+
+// assignment is a column assignment of the SET clause.
+type assignment struct {
+	column string
+	op     string
+	name   string
+}
+
+// UpdateBuilder builds UPDATE statements.
+type UpdateBuilder struct {
+	table    string
+	set      []assignment
+	where    []Cmp
+	ifs      []Cmp
+	existing bool
+	using    using
+}
+
+// Update returns a builder of the UPDATE statements of table.
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set adds the assignments column=? of the columns, their bind markers are
+// named after them.
+func (b *UpdateBuilder) Set(columns ...string) *UpdateBuilder {
+	for _, c := range columns {
+		b.set = append(b.set, assignment{column: c, name: c})
+	}
+	return b
+}
+
+// SetNamed adds the assignment column=? whose bind marker is named name.
+func (b *UpdateBuilder) SetNamed(column, name string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, name: name})
+	return b
+}
+
+// Add adds the assignment column=column+?, which increments counters and
+// appends to collections.
+func (b *UpdateBuilder) Add(column string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "+", name: column})
+	return b
+}
+
+// Remove adds the assignment column=column-?, which decrements counters and
+// removes from collections.
+func (b *UpdateBuilder) Remove(column string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "-", name: column})
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *UpdateBuilder) Where(cmps ...Cmp) *UpdateBuilder {
+	b.where = append(b.where, cmps...)
+	return b
+}
+
+// If adds conditions to the IF clause, the update is then a lightweight
+// transaction.
+func (b *UpdateBuilder) If(cmps ...Cmp) *UpdateBuilder {
+	b.ifs = append(b.ifs, cmps...)
+	return b
+}
+
+// Existing only updates the row if it exists, with IF EXISTS.
+func (b *UpdateBuilder) Existing() *UpdateBuilder {
+	b.existing = true
+	return b
+}
+
+// TTL sets the time to live of the updated values.
+func (b *UpdateBuilder) TTL(d time.Duration) *UpdateBuilder {
+	b.using.setTTL(d)
+	return b
+}
+
+// TTLNamed binds the time to live of the updated values, in seconds, to the
+// bind marker name.
+func (b *UpdateBuilder) TTLNamed(name string) *UpdateBuilder {
+	b.using.setTTLNamed(name)
+	return b
+}
+
+// Timestamp sets the write time of the updated values.
+func (b *UpdateBuilder) Timestamp(t time.Time) *UpdateBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampNamed binds the write time of the updated values, in
+// microseconds, to the bind marker name.
+func (b *UpdateBuilder) TimestampNamed(name string) *UpdateBuilder {
+	b.using.setTimestampNamed(name)
+	return b
+}
+
+// ToCql returns the statement and the names of its bind markers.
+func (b *UpdateBuilder) ToCql() (stmt string, names []string) {
+	var buf strings.Builder
+	buf.WriteString("UPDATE ")
+	buf.WriteString(b.table)
+	names = b.using.writeCql(&buf)
+
+	for i, a := range b.set {
+		if i == 0 {
+			buf.WriteString(" SET ")
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(a.column)
+		buf.WriteByte('=')
+		if a.op != "" {
+			buf.WriteString(a.column)
+			buf.WriteString(a.op)
+		}
+		buf.WriteByte('?')
+		names = append(names, a.name)
+	}
+
+	names = append(names, writeCmps(&buf, "WHERE", b.where)...)
+	if b.existing {
+		buf.WriteString(" IF EXISTS")
+	} else {
+		names = append(names, writeCmps(&buf, "IF", b.ifs)...)
+	}
+
+	return buf.String(), names
+}
+
+// Query returns the query of the statement on session s.
+func (b *UpdateBuilder) Query(s *gocql.Session) *gocqlx.Queryx {
+	stmt, names := b.ToCql()
+	return gocqlx.Query(s.Query(stmt), names)
+}
+
+// Validate checks that the table and the columns of the statement exist in
+// the keyspace km.
+func (b *UpdateBuilder) Validate(km *gocql.KeyspaceMetadata) error {
+	var columns []string
+	for _, a := range b.set {
+		columns = append(columns, a.column)
+	}
+	columns = append(columns, cmpColumns(b.where)...)
+	columns = append(columns, cmpColumns(b.ifs)...)
+	return validate(km, b.table, columns)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocqlx
+
+import (
+	"strings"
+)
+
+// Table compiles the statements of the rows of a table, the values of the
+// statements are named after their columns and can be bound with
+// Queryx.BindStruct.
+type Table struct {
+	Name    string
+	Columns []string
+	PartKey []string
+	SortKey []string
+}
+
+// NewTable returns the Table name whose columns are those of the fields of
+// the struct v, see Columns.
+func NewTable(name string, v interface{}, partKey, sortKey []string) *Table {
+	return &Table{
+		Name:    name,
+		Columns: Columns(v),
+		PartKey: partKey,
+		SortKey: sortKey,
+	}
+}
+
+// primaryKey returns the columns of the primary key.
+func (t *Table) primaryKey() []string {
+	return append(append([]string(nil), t.PartKey...), t.SortKey...)
+}
+
+// Get returns the statement selecting the columns, all of them when none are
+// given, of the row of a primary key.
+func (t *Table) Get(columns ...string) (string, []string) {
+	return t.selectStmt(columns, t.primaryKey())
+}
+
+// Select returns the statement selecting the columns, all of them when none
+// are given, of the rows of a partition.
+func (t *Table) Select(columns ...string) (string, []string) {
+	return t.selectStmt(columns, t.PartKey)
+}
+
+func (t *Table) selectStmt(columns, where []string) (string, []string) {
+	if len(columns) == 0 {
+		columns = t.Columns
+	}
+
+	var buf strings.Builder
+	buf.WriteString("SELECT ")
+	buf.WriteString(strings.Join(columns, ","))
+	buf.WriteString(" FROM ")
+	buf.WriteString(t.Name)
+	writeWhere(&buf, where)
+	return buf.String(), where
+}
+
+// Insert returns the statement inserting all the columns of a row.
+func (t *Table) Insert() (string, []string) {
+	var buf strings.Builder
+	buf.WriteString("INSERT INTO ")
+	buf.WriteString(t.Name)
+	buf.WriteString(" (")
+	buf.WriteString(strings.Join(t.Columns, ","))
+	buf.WriteString(") VALUES (")
+	buf.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(t.Columns)), ","))
+	buf.WriteString(")")
+	return buf.String(), t.Columns
+}
+
+// Update returns the statement updating the columns, all the columns outside
+// of the primary key when none are given, of the row of a primary key.
+func (t *Table) Update(columns ...string) (string, []string) {
+	key := t.primaryKey()
+	if len(columns) == 0 {
+		for _, c := range t.Columns {
+			if !contains(key, c) {
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	var buf strings.Builder
+	buf.WriteString("UPDATE ")
+	buf.WriteString(t.Name)
+	buf.WriteString(" SET ")
+	for i, c := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(c)
+		buf.WriteString("=?")
+	}
+	writeWhere(&buf, key)
+	return buf.String(), append(append([]string(nil), columns...), key...)
+}
+
+// Delete returns the statement deleting the row of a primary key.
+func (t *Table) Delete() (string, []string) {
+	key := t.primaryKey()
+
+	var buf strings.Builder
+	buf.WriteString("DELETE FROM ")
+	buf.WriteString(t.Name)
+	writeWhere(&buf, key)
+	return buf.String(), key
+}
+
+func writeWhere(buf *strings.Builder, columns []string) {
+	for i, c := range columns {
+		if i == 0 {
+			buf.WriteString(" WHERE ")
+		} else {
+			buf.WriteString(" AND ")
+		}
+		buf.WriteString(c)
+		buf.WriteString("=?")
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@
 package gocql
 
 import (
+	"fmt"
 	"math/big"
 	"reflect"
 	"strings"
@@ -19,6 +20,10 @@ type RowData struct {
 }
 
 func goType(t TypeInfo) reflect.Type {
+	if codec := lookupCodec(t); codec != nil {
+		return reflect.TypeOf(codec.New(t)).Elem()
+	}
+
 	switch t.Type() {
 	case TypeVarchar, TypeAscii, TypeInet:
 		return reflect.TypeOf(*new(string))
@@ -26,7 +31,7 @@ func goType(t TypeInfo) reflect.Type {
 		return reflect.TypeOf(*new(int64))
 	case TypeTimestamp:
 		return reflect.TypeOf(*new(time.Time))
-	case TypeBlob:
+	case TypeBlob, TypeCustom:
 		return reflect.TypeOf(*new([]byte))
 	case TypeBoolean:
 		return reflect.TypeOf(*new(bool))
@@ -36,6 +41,10 @@ func goType(t TypeInfo) reflect.Type {
 		return reflect.TypeOf(*new(float64))
 	case TypeInt:
 		return reflect.TypeOf(*new(int))
+	case TypeSmallInt:
+		return reflect.TypeOf(*new(int16))
+	case TypeTinyInt:
+		return reflect.TypeOf(*new(int8))
 	case TypeDecimal:
 		return reflect.TypeOf(*new(*inf.Dec))
 	case TypeUUID, TypeTimeUUID:
@@ -46,10 +55,18 @@ func goType(t TypeInfo) reflect.Type {
 		return reflect.MapOf(goType(t.(CollectionType).Key), goType(t.(CollectionType).Elem))
 	case TypeVarint:
 		return reflect.TypeOf(*new(*big.Int))
+	case TypeDate:
+		return reflect.TypeOf(*new(Date))
+	case TypeTime:
+		return reflect.TypeOf(*new(time.Duration))
+	case TypeDuration:
+		return reflect.TypeOf(*new(Duration))
 	case TypeTuple:
 		// what can we do here? all there is to do is to make a list of interface{}
 		tuple := t.(TupleTypeInfo)
 		return reflect.TypeOf(make([]interface{}, len(tuple.Elems)))
+	case TypeUDT:
+		return reflect.TypeOf(make(map[string]interface{}))
 	default:
 		return nil
 	}
@@ -91,6 +108,16 @@ func getApacheCassandraType(class string) Type {
 		return TypeTimeUUID
 	case "InetAddressType":
 		return TypeInet
+	case "ShortType":
+		return TypeSmallInt
+	case "ByteType":
+		return TypeTinyInt
+	case "SimpleDateType":
+		return TypeDate
+	case "TimeType":
+		return TypeTime
+	case "DurationType":
+		return TypeDuration
 	case "MapType":
 		return TypeMap
 	case "ListType":
@@ -178,3 +205,216 @@ func (iter *Iter) MapScan(m map[string]interface{}) bool {
 	}
 	return false
 }
+
+// structFieldMap maps column names to the fields of a struct.
+type structFieldMap struct {
+	byName map[string]reflect.Value
+	// byLower maps the lower case names to the first field declared with
+	// that name in any case
+	byLower map[string]reflect.Value
+}
+
+// structField is a field of a struct and the column name it maps to.
+type structField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields returns the fields of the struct v keyed by the column name
+// they map to. The column name is taken from the `cql` struct tag, falling
+// back to the field name when no tag is present. Fields tagged with "-" and
+// unexported fields are ignored. The fields of embedded structs are promoted
+// after the fields of the outer struct, in declaration order, unless a field of
+// the outer struct or of a previous embedded struct maps to the same column.
+// The nil pointers to embedded structs are allocated when alloc is true, so
+// that their fields can be set, and skipped otherwise.
+func structFields(v reflect.Value, alloc bool) structFieldMap {
+	fields := collectStructFields(v, alloc)
+	m := structFieldMap{
+		byName:  make(map[string]reflect.Value, len(fields)),
+		byLower: make(map[string]reflect.Value, len(fields)),
+	}
+	for _, f := range fields {
+		m.byName[f.name] = f.value
+		lower := strings.ToLower(f.name)
+		if _, ok := m.byLower[lower]; !ok {
+			m.byLower[lower] = f.value
+		}
+	}
+	return m
+}
+
+// collectStructFields returns the fields of the struct v in declaration
+// order, followed by the fields promoted from its embedded structs.
+func collectStructFields(v reflect.Value, alloc bool) []structField {
+	t := v.Type()
+
+	var (
+		fields   []structField
+		names    = make(map[string]int)
+		embedded []reflect.Value
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("cql")
+		if tag == "-" {
+			continue
+		}
+
+		f := v.Field(i)
+		if sf.Anonymous && tag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, f)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = sf.Name
+		}
+		if j, ok := names[name]; ok {
+			// the last field declared with a name wins
+			fields[j].value = f
+			continue
+		}
+		names[name] = len(fields)
+		fields = append(fields, structField{name: name, value: f})
+	}
+
+	for _, f := range embedded {
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				if !alloc || !f.CanSet() {
+					continue
+				}
+				f.Set(reflect.New(f.Type().Elem()))
+			}
+			f = f.Elem()
+		}
+
+		for _, pf := range collectStructFields(f, alloc) {
+			if _, ok := names[pf.name]; !ok {
+				names[pf.name] = len(fields)
+				fields = append(fields, pf)
+			}
+		}
+	}
+
+	return fields
+}
+
+// lookupStructField finds the field mapped to the column name, first using an
+// exact match and then falling back to a case-insensitive one, as Cassandra
+// column names are lower case unless quoted.
+func lookupStructField(fields structFieldMap, name string) (reflect.Value, bool) {
+	if f, ok := fields.byName[name]; ok {
+		return f, true
+	}
+	f, ok := fields.byLower[strings.ToLower(name)]
+	return f, ok
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("gocql: can not use nil %T as a struct", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("gocql: expected a struct got %T", v)
+	}
+	return rv, nil
+}
+
+// StructScan consumes the next row of the iterator and copies the columns of
+// the current row into the fields of the struct pointed at by dest. Columns
+// are matched to fields using the `cql` struct tag, or the field name if the
+// field is not tagged, see Iter.Scan for more details. Columns which do not
+// have a matching field are skipped.
+func (iter *Iter) StructScan(dest interface{}) bool {
+	if iter.err != nil {
+		return false
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		iter.err = fmt.Errorf("gocql: StructScan requires a pointer to a struct got %T", dest)
+		return false
+	}
+
+	fields := structFields(rv.Elem(), true)
+	values := make([]interface{}, 0, len(iter.meta.columns))
+	for _, col := range iter.Columns() {
+		f, ok := lookupStructField(fields, col.Name)
+		if !ok {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, f.Addr().Interface())
+	}
+
+	return iter.Scan(values...)
+}
+
+// StructScan executes the query, copies the columns of the first selected
+// row into the fields of the struct pointed at by dest and discards the
+// rest. If no rows were selected, ErrNotFound is returned.
+func (q *Query) StructScan(dest interface{}) error {
+	iter := q.iterOwned()
+	if err := iter.checkErrAndNotFound(); err != nil {
+		return err
+	}
+	iter.StructScan(dest)
+	return iter.Close()
+}
+
+// bindStruct returns a binding callback which will produce the query
+// arguments from the fields of v, matching the bound variables of the
+// prepared statement to fields in the same way as Iter.StructScan.
+func bindStruct(v interface{}) func(q *QueryInfo) ([]interface{}, error) {
+	return func(q *QueryInfo) ([]interface{}, error) {
+		rv, err := structValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := structFields(rv, false)
+		values := make([]interface{}, len(q.Args))
+		for i, arg := range q.Args {
+			f, ok := lookupStructField(fields, arg.Name)
+			if !ok {
+				return nil, fmt.Errorf("gocql: missing field for bound variable %q in %T", arg.Name, v)
+			}
+			values[i] = f.Interface()
+		}
+		return values, nil
+	}
+}
+
+// BindStruct binds the query arguments to the fields of the struct v, which
+// may be a struct or a pointer to a struct. The bound variables of the
+// prepared statement are matched to fields using the `cql` struct tag, or
+// the field name if the field is not tagged.
+func (q *Query) BindStruct(v interface{}) *Query {
+	q.values = nil
+	q.binding = bindStruct(v)
+	return q
+}
+
+// BindStruct adds the query to the batch operation, binding its arguments
+// to the fields of the struct v, see Query.BindStruct.
+func (b *Batch) BindStruct(stmt string, v interface{}) {
+	b.Bind(stmt, bindStruct(v))
+}
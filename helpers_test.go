@@ -0,0 +1,143 @@
+// +build all unit
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+)
+
+type structScanBase struct {
+	ID      int    `cql:"id"`
+	Ignored string `cql:"-"`
+}
+
+type structScanRow struct {
+	structScanBase
+	Name       string
+	Nickname   string `cql:"nick"`
+	unexported int
+}
+
+func TestIterStructScan(t *testing.T) {
+	iter := &Iter{
+		meta: resultMetadata{
+			columns: []ColumnInfo{
+				{Name: "id", TypeInfo: NativeType{proto: 2, typ: TypeInt}},
+				{Name: "name", TypeInfo: NativeType{proto: 2, typ: TypeVarchar}},
+				{Name: "nick", TypeInfo: NativeType{proto: 2, typ: TypeVarchar}},
+				{Name: "other", TypeInfo: NativeType{proto: 2, typ: TypeVarchar}},
+			},
+			actualColCount: 4,
+		},
+		rows: [][][]byte{
+			{encInt(42), []byte("alice"), []byte("al"), []byte("skipped")},
+		},
+	}
+
+	var row structScanRow
+	if !iter.StructScan(&row) {
+		t.Fatalf("StructScan failed: %v", iter.Close())
+	}
+
+	expected := structScanRow{
+		structScanBase: structScanBase{ID: 42},
+		Name:           "alice",
+		Nickname:       "al",
+	}
+	if !reflect.DeepEqual(row, expected) {
+		t.Fatalf("expected %+v got %+v", expected, row)
+	}
+
+	if iter.StructScan(&row) {
+		t.Fatal("expected StructScan to return false at the end of the rows")
+	}
+}
+
+func TestLookupStructFieldCase(t *testing.T) {
+	var row struct {
+		ID int
+		Id int
+	}
+	rv := reflect.ValueOf(&row).Elem()
+
+	// the first field declared with the name in any case is picked
+	for i := 0; i < 20; i++ {
+		f, ok := lookupStructField(structFields(rv, true), "id")
+		if !ok || f.Addr().Interface() != &row.ID {
+			t.Fatal("expected the id column to map to the ID field")
+		}
+	}
+	if f, ok := lookupStructField(structFields(rv, true), "Id"); !ok || f.Addr().Interface() != &row.Id {
+		t.Fatal("expected the Id column to map to the Id field")
+	}
+}
+
+func TestStructFieldsEmbeddedPointer(t *testing.T) {
+	type Base struct {
+		ID int `cql:"id"`
+	}
+	var row struct {
+		*Base
+		Name string
+	}
+	rv := reflect.ValueOf(&row).Elem()
+
+	// binding must not modify the struct
+	fields := structFields(rv, false)
+	if row.Base != nil {
+		t.Fatal("expected the nil embedded struct not to be allocated")
+	}
+	if _, ok := lookupStructField(fields, "id"); ok {
+		t.Fatal("expected the fields of the nil embedded struct to be skipped")
+	}
+
+	fields = structFields(rv, true)
+	if row.Base == nil {
+		t.Fatal("expected the nil embedded struct to be allocated")
+	}
+	if f, ok := lookupStructField(fields, "id"); !ok || f.Addr().Interface() != &row.ID {
+		t.Fatal("expected the id column to map to the embedded ID field")
+	}
+}
+
+func TestIterStructScanNonPointer(t *testing.T) {
+	iter := &Iter{}
+	if iter.StructScan(structScanRow{}) {
+		t.Fatal("expected StructScan to fail for a non pointer value")
+	}
+	if iter.Close() == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBindStruct(t *testing.T) {
+	info := &QueryInfo{
+		Args: []ColumnInfo{
+			{Name: "nick"},
+			{Name: "id"},
+			{Name: "NAME"},
+		},
+	}
+
+	row := &structScanRow{
+		structScanBase: structScanBase{ID: 7},
+		Name:           "bob",
+		Nickname:       "bobby",
+	}
+
+	values, err := bindStruct(row)(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{"bobby", 7, "bob"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v got %v", expected, values)
+	}
+
+	info.Args = append(info.Args, ColumnInfo{Name: "missing"})
+	if _, err := bindStruct(row)(info); err == nil {
+		t.Fatal("expected an error for a missing field")
+	}
+}
@@ -1,27 +1,134 @@
 package gocql
 
 import (
-	"log"
 	"net"
+	"sync"
 	"time"
 )
 
 type HostInfo struct {
-	Peer       string
-	DataCenter string
-	Rack       string
-	HostId     string
-	Tokens     []string
+	// Peer is the address the driver connects to, the rpc_address of the
+	// host or its broadcast address when it listens on all interfaces.
+	Peer string
+	// BroadcastAddress is the address the host uses to talk to the other
+	// hosts of the cluster.
+	BroadcastAddress string
+	DataCenter       string
+	Rack             string
+	HostId           string
+	Tokens           []string
+	// Version is the Cassandra release version of the host.
+	Version string
+	// Compressor is the name of the compressor negotiated by the
+	// connections to the host, empty when they are not compressed or when
+	// the host was found before being connected to.
+	Compressor string
+}
+
+// hostOptions caches the options supported by the hosts, keyed by the address
+// they are dialed at, and the compressor negotiated with them. The methods
+// can be called on a nil hostOptions, which caches nothing.
+type hostOptions struct {
+	mu          sync.Mutex
+	options     map[string]map[string][]string
+	compressors map[string]string
+}
+
+func newHostOptions() *hostOptions {
+	return &hostOptions{
+		options:     make(map[string]map[string][]string),
+		compressors: make(map[string]string),
+	}
+}
+
+// supported returns the options supported by the host at addr, false if they
+// were not requested yet.
+func (h *hostOptions) supported(addr string) (map[string][]string, bool) {
+	if h == nil {
+		return nil, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	options, ok := h.options[addr]
+	return options, ok
+}
+
+func (h *hostOptions) setSupported(addr string, options map[string][]string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.options[addr] = options
+	h.mu.Unlock()
+}
+
+// compressor returns the name of the compressor negotiated with the host at
+// addr.
+func (h *hostOptions) compressor(addr string) string {
+	if h == nil {
+		return ""
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.compressors[addr]
+}
+
+func (h *hostOptions) setCompressor(addr, name string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.compressors[addr] = name
+	h.mu.Unlock()
+}
+
+// forget removes the options of addr, they are requested again by the next
+// connection to addr.
+func (h *hostOptions) forget(addr string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	delete(h.options, addr)
+	h.mu.Unlock()
+}
+
+// HostStateListener is the interface implemented by the listeners of the
+// changes of the cluster topology. HostAdded and HostRemoved are called when a
+// refresh of the ring finds new hosts or misses known ones, the hosts of the
+// first refresh are all reported added. HostUp and HostDown are called when
+// the cluster reports a change of status. The methods are called sequentially
+// from the goroutines of the driver and must not block.
+type HostStateListener interface {
+	HostAdded(host HostInfo)
+	HostRemoved(host HostInfo)
+	HostUp(host HostInfo)
+	HostDown(host HostInfo)
 }
 
 // Polls system.peers at a specific interval to find new hosts
 type ringDescriber struct {
-	dcFilter        string
-	rackFilter      string
+	dcFilter   string
+	rackFilter string
+	session    *Session
+	closeChan  chan bool
+
+	// protects prevHosts and prevPartitioner, and serializes the refreshes
+	mu              sync.Mutex
 	prevHosts       []HostInfo
 	prevPartitioner string
-	session         *Session
-	closeChan       chan bool
+
+	// listenerMu serializes the notifications of the HostStateListener and
+	// protects the hosts it knows
+	listenerMu    sync.Mutex
+	listenerHosts map[string]HostInfo
 }
 
 func (r *ringDescriber) GetHosts() (
@@ -29,18 +136,21 @@ func (r *ringDescriber) GetHosts() (
 	partitioner string,
 	err error,
 ) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// we need conn to be the same because we need to query system.peers and system.local
 	// on the same node to get the whole cluster
-	conn := r.session.Pool.Pick(nil)
+	conn := r.conn()
 	if conn == nil {
 		return r.prevHosts, r.prevPartitioner, nil
 	}
 
-	query := r.session.Query("SELECT data_center, rack, host_id, tokens, partitioner FROM system.local")
+	query := r.session.Query("SELECT broadcast_address, data_center, rack, host_id, tokens, release_version, partitioner FROM system.local")
 	iter := conn.executeQuery(query)
 
 	host := HostInfo{}
-	iter.Scan(&host.DataCenter, &host.Rack, &host.HostId, &host.Tokens, &partitioner)
+	iter.Scan(&host.BroadcastAddress, &host.DataCenter, &host.Rack, &host.HostId, &host.Tokens, &host.Version, &partitioner)
 
 	if err = iter.Close(); err != nil {
 		return nil, "", err
@@ -54,14 +164,18 @@ func (r *ringDescriber) GetHosts() (
 	}
 
 	host.Peer = addr
+	host.Compressor = r.session.cfg.hostOptions.compressor(JoinHostPort(host.Peer, r.session.cfg.Port))
 
 	hosts = []HostInfo{host}
 
-	query = r.session.Query("SELECT peer, data_center, rack, host_id, tokens FROM system.peers")
+	query = r.session.Query("SELECT peer, rpc_address, data_center, rack, host_id, tokens, release_version FROM system.peers")
 	iter = conn.executeQuery(query)
 
+	var rpcAddress string
 	host = HostInfo{}
-	for iter.Scan(&host.Peer, &host.DataCenter, &host.Rack, &host.HostId, &host.Tokens) {
+	for iter.Scan(&host.BroadcastAddress, &rpcAddress, &host.DataCenter, &host.Rack, &host.HostId, &host.Tokens, &host.Version) {
+		host.Peer = r.session.cfg.translateAddress(peerAddress(host.BroadcastAddress, rpcAddress))
+		host.Compressor = r.session.cfg.hostOptions.compressor(JoinHostPort(host.Peer, r.session.cfg.Port))
 		if r.matchFilter(&host) {
 			hosts = append(hosts, host)
 		}
@@ -78,6 +192,102 @@ func (r *ringDescriber) GetHosts() (
 	return hosts, partitioner, nil
 }
 
+// peerAddress returns the address to connect to a peer, its rpc_address
+// unless the peer listens on all interfaces.
+func peerAddress(broadcastAddress, rpcAddress string) string {
+	if ip := net.ParseIP(rpcAddress); ip == nil || ip.IsUnspecified() {
+		return broadcastAddress
+	}
+	return rpcAddress
+}
+
+// knownHosts returns the hosts found by the last refresh.
+func (r *ringDescriber) knownHosts() []HostInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.prevHosts
+}
+
+// refresh fetches the hosts of the ring and updates the pool of the session.
+// conn returns the connection the ring is queried on, lazy sessions query
+// it on the control connection so that it opens no data connection.
+func (r *ringDescriber) conn() *Conn {
+	if r.session.cfg.LazyConnect && r.session.control != nil {
+		if conn := r.session.control.getConn(); conn != nil {
+			return conn
+		}
+	}
+	return r.session.Pool.Pick(nil)
+}
+
+func (r *ringDescriber) refresh() error {
+	hosts, partitioner, err := r.GetHosts()
+	if err != nil {
+		return err
+	}
+
+	r.session.Pool.SetHosts(hosts)
+	if v, ok := r.session.Pool.(SetPartitioner); ok {
+		v.SetPartitioner(partitioner)
+	}
+
+	r.notifyHosts(hosts)
+
+	return nil
+}
+
+// notifyHosts reports the hosts added and removed since the last refresh to
+// the HostStateListener of the session.
+func (r *ringDescriber) notifyHosts(hosts []HostInfo) {
+	listener := r.session.cfg.HostStateListener
+	if listener == nil {
+		return
+	}
+
+	r.listenerMu.Lock()
+	defer r.listenerMu.Unlock()
+
+	current := make(map[string]HostInfo, len(hosts))
+	for _, host := range hosts {
+		current[host.Peer] = host
+		if _, ok := r.listenerHosts[host.Peer]; !ok {
+			listener.HostAdded(host)
+		}
+	}
+
+	for addr, host := range r.listenerHosts {
+		if _, ok := current[addr]; !ok {
+			listener.HostRemoved(host)
+		}
+	}
+
+	r.listenerHosts = current
+}
+
+// notifyStatus reports a change of status of a host to the
+// HostStateListener of the session.
+func (r *ringDescriber) notifyStatus(addr string, up bool) {
+	listener := r.session.cfg.HostStateListener
+	if listener == nil {
+		return
+	}
+
+	r.listenerMu.Lock()
+	defer r.listenerMu.Unlock()
+
+	host, ok := r.listenerHosts[addr]
+	if !ok {
+		host = HostInfo{Peer: addr}
+	}
+
+	if up {
+		listener.HostUp(host)
+	} else {
+		listener.HostDown(host)
+	}
+}
+
 func (r *ringDescriber) matchFilter(host *HostInfo) bool {
 
 	if r.dcFilter != "" && r.dcFilter != host.DataCenter {
@@ -96,22 +306,29 @@ func (h *ringDescriber) run(sleep time.Duration) {
 		sleep = 30 * time.Second
 	}
 
+	refresh := time.NewTimer(sleep)
+	defer refresh.Stop()
+
+	var metadata <-chan time.Time
+	if interval := h.session.cfg.Discovery.MetadataRefreshInterval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		metadata = ticker.C
+	}
+
 	for {
 		select {
-		case <-time.After(sleep):
+		case <-refresh.C:
 			// if we have 0 hosts this will return the previous list of hosts to
 			// attempt to reconnect to the cluster otherwise we would never find
 			// downed hosts again, could possibly have an optimisation to only
 			// try to add new hosts if GetHosts didnt error and the hosts didnt change.
-			hosts, partitioner, err := h.GetHosts()
-			if err != nil {
-				log.Println("RingDescriber: unable to get ring topology:", err)
-			} else {
-				h.session.Pool.SetHosts(hosts)
-				if v, ok := h.session.Pool.(SetPartitioner); ok {
-					v.SetPartitioner(partitioner)
-				}
+			if err := h.refresh(); err != nil {
+				h.session.cfg.logger().Warn("gocql: unable to get the ring topology", "error", err)
 			}
+			refresh.Reset(sleep)
+		case <-metadata:
+			h.session.clearMetadata()
 		case <-h.closeChan:
 			return
 		}
@@ -0,0 +1,98 @@
+// +build all unit
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerAddress(t *testing.T) {
+	tests := []struct {
+		broadcast string
+		rpc       string
+		expected  string
+	}{
+		{"10.0.0.1", "192.168.0.1", "192.168.0.1"},
+		{"10.0.0.1", "0.0.0.0", "10.0.0.1"},
+		{"10.0.0.1", "::", "10.0.0.1"},
+		{"10.0.0.1", "", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		if got := peerAddress(test.broadcast, test.rpc); got != test.expected {
+			t.Errorf("peerAddress(%q, %q): expected %q got %q", test.broadcast, test.rpc, test.expected, got)
+		}
+	}
+}
+
+type testHostStateListener struct {
+	events []string
+}
+
+func (l *testHostStateListener) HostAdded(host HostInfo) {
+	l.events = append(l.events, "added "+host.Peer)
+}
+
+func (l *testHostStateListener) HostRemoved(host HostInfo) {
+	l.events = append(l.events, "removed "+host.Peer)
+}
+
+func (l *testHostStateListener) HostUp(host HostInfo) {
+	l.events = append(l.events, "up "+host.Peer+" "+host.DataCenter)
+}
+
+func (l *testHostStateListener) HostDown(host HostInfo) {
+	l.events = append(l.events, "down "+host.Peer+" "+host.DataCenter)
+}
+
+func TestHostStateListener(t *testing.T) {
+	listener := &testHostStateListener{}
+	session := &Session{}
+	session.cfg.HostStateListener = listener
+	r := &ringDescriber{session: session}
+
+	r.notifyHosts([]HostInfo{{Peer: "10.0.0.1", DataCenter: "dc1"}})
+	r.notifyHosts([]HostInfo{{Peer: "10.0.0.1", DataCenter: "dc1"}, {Peer: "10.0.0.2"}})
+	r.notifyStatus("10.0.0.1", false)
+	r.notifyStatus("10.0.0.1", true)
+	r.notifyHosts([]HostInfo{{Peer: "10.0.0.2"}})
+	r.notifyStatus("10.0.0.3", false)
+
+	expected := []string{
+		"added 10.0.0.1",
+		"added 10.0.0.2",
+		"down 10.0.0.1 dc1",
+		"up 10.0.0.1 dc1",
+		"removed 10.0.0.1",
+		"down 10.0.0.3 ",
+	}
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Errorf("expected %v got %v", expected, listener.events)
+	}
+}
+
+func TestMetadataRefresh(t *testing.T) {
+	s := &Session{cfg: ClusterConfig{Discovery: DiscoveryConfig{MetadataRefreshInterval: 10 * time.Millisecond}}}
+	s.schemaDescriber = newSchemaDescriber(s)
+	s.schemaDescriber.cache["ks"] = &KeyspaceMetadata{Name: "ks"}
+
+	r := &ringDescriber{session: s, closeChan: make(chan bool)}
+	go r.run(time.Hour)
+	defer close(r.closeChan)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.schemaDescriber.mu.Lock()
+		n := len(s.schemaDescriber.cache)
+		s.schemaDescriber.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the keyspace metadata to be dropped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+	"time"
+)
+
+// SessionInterface is the subset of the methods of Session running queries.
+// Applications depending on it instead of Session can swap the session for a
+// fake in their tests, such as the one of the gocqlmock package. Sessions
+// are adapted with NewSessionInterface.
+type SessionInterface interface {
+	Query(stmt string, values ...interface{}) QueryInterface
+	NewBatch(typ BatchType) *Batch
+	ExecuteBatch(batch *Batch) error
+	Close()
+	Closed() bool
+}
+
+// QueryInterface is the subset of the methods of Query of SessionInterface,
+// the setters return the query itself as Query does.
+type QueryInterface interface {
+	Bind(v ...interface{}) QueryInterface
+	Consistency(c Consistency) QueryInterface
+	SerialConsistency(cons SerialConsistency) QueryInterface
+	PageSize(n int) QueryInterface
+	Timeout(timeout time.Duration) QueryInterface
+	WithContext(ctx context.Context) QueryInterface
+	Statement() string
+	Values() []interface{}
+	Exec() error
+	Scan(dest ...interface{}) error
+	ScanCAS(dest ...interface{}) (applied bool, err error)
+	MapScan(m map[string]interface{}) error
+	Iter() IterInterface
+}
+
+// IterInterface is the subset of the methods of Iter of QueryInterface.
+type IterInterface interface {
+	Columns() []ColumnInfo
+	Scan(dest ...interface{}) bool
+	MapScan(m map[string]interface{}) bool
+	Warnings() []string
+	Close() error
+}
+
+var _ IterInterface = (*Iter)(nil)
+
+// NewSessionInterface returns the SessionInterface of s.
+func NewSessionInterface(s *Session) SessionInterface {
+	return sessionInterface{s}
+}
+
+type sessionInterface struct {
+	*Session
+}
+
+func (s sessionInterface) Query(stmt string, values ...interface{}) QueryInterface {
+	return queryInterface{s.Session.Query(stmt, values...)}
+}
+
+type queryInterface struct {
+	*Query
+}
+
+func (q queryInterface) Bind(v ...interface{}) QueryInterface {
+	q.Query.Bind(v...)
+	return q
+}
+
+func (q queryInterface) Consistency(c Consistency) QueryInterface {
+	q.Query.Consistency(c)
+	return q
+}
+
+func (q queryInterface) SerialConsistency(cons SerialConsistency) QueryInterface {
+	q.Query.SerialConsistency(cons)
+	return q
+}
+
+func (q queryInterface) PageSize(n int) QueryInterface {
+	q.Query.PageSize(n)
+	return q
+}
+
+func (q queryInterface) Timeout(timeout time.Duration) QueryInterface {
+	q.Query.Timeout(timeout)
+	return q
+}
+
+func (q queryInterface) WithContext(ctx context.Context) QueryInterface {
+	q.Query.WithContext(ctx)
+	return q
+}
+
+func (q queryInterface) Iter() IterInterface {
+	return q.Query.Iter()
+}
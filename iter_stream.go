@@ -0,0 +1,67 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+)
+
+// Row is a row received from the channel of Iter.Rows.
+type Row struct {
+	// Values are the values of the columns, see Iter.MapScan.
+	Values map[string]interface{}
+	// Err is the error which ended the iteration, it is only set on the
+	// last row received.
+	Err error
+}
+
+// Rows scans the rows of the iterator in a goroutine and sends them to the
+// returned channel, which is closed after the last row. The channel buffers
+// a page of rows so that the rows are decoded while the previous ones are
+// processed, the next pages are prefetched as set by Query.Prefetch. The
+// iteration fails with the error of Close, which is sent as the last row.
+//
+// The iteration stops when ctx is done, the channel is then closed without
+// sending ctx.Err(). The iterator is closed when the channel is closed and
+// must not be used meanwhile.
+func (iter *Iter) Rows(ctx context.Context) <-chan Row {
+	ch := make(chan Row, streamBuffer(iter))
+
+	go func() {
+		defer close(ch)
+
+		for {
+			m := make(map[string]interface{})
+			if !iter.MapScan(m) {
+				break
+			}
+
+			select {
+			case ch <- Row{Values: m}:
+			case <-ctx.Done():
+				iter.Close()
+				return
+			}
+		}
+
+		if err := iter.Close(); err != nil {
+			select {
+			case ch <- Row{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return ch
+}
+
+// streamBuffer returns the size of the buffer of the channels streaming the
+// rows of iter, the number of rows of its first page.
+func streamBuffer(iter *Iter) int {
+	if n := len(iter.rows); n > 0 {
+		return n
+	}
+	return 1
+}
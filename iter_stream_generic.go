@@ -0,0 +1,59 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.18
+
+package gocql
+
+import (
+	"context"
+)
+
+// TypedRow is a row received from the channel of RowsOf.
+type TypedRow[T any] struct {
+	Value T
+	// Err is the error which ended the iteration, it is only set on the
+	// last row received.
+	Err error
+}
+
+// RowsOf is Iter.Rows scanning the rows into values of the struct type T,
+// with its DecodeRow method if *T is a RowDecoder or else with
+// Iter.StructScan.
+func RowsOf[T any](ctx context.Context, iter *Iter) <-chan TypedRow[T] {
+	ch := make(chan TypedRow[T], streamBuffer(iter))
+
+	go func() {
+		defer close(ch)
+
+		for {
+			var v T
+			var ok bool
+			if decoder, isDecoder := interface{}(&v).(RowDecoder); isDecoder {
+				ok = iter.Scan(decoder)
+			} else {
+				ok = iter.StructScan(&v)
+			}
+			if !ok {
+				break
+			}
+
+			select {
+			case ch <- TypedRow[T]{Value: v}:
+			case <-ctx.Done():
+				iter.Close()
+				return
+			}
+		}
+
+		if err := iter.Close(); err != nil {
+			select {
+			case ch <- TypedRow[T]{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return ch
+}
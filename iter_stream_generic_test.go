@@ -0,0 +1,52 @@
+// +build all unit
+// +build go1.18
+
+package gocql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRowsOf(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4)
+	defer srv.Stop()
+
+	srv.queryRows = func(query string) *testRows {
+		return &testRows{
+			columns: []string{"key", "value"},
+			types:   []Type{TypeVarchar, TypeInt},
+			rows:    [][][]byte{{[]byte("a"), {0, 0, 0, 1}}, {[]byte("b"), {0, 0, 0, 2}}},
+		}
+	}
+
+	db, err := newTestSession(srv.Address, protoVersion4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var users []testUser
+	for row := range RowsOf[testUser](context.Background(), db.Query("SELECT key, value FROM t").Iter()) {
+		if row.Err != nil {
+			t.Fatal(row.Err)
+		}
+		users = append(users, row.Value)
+	}
+	if expected := []testUser{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(users, expected) {
+		t.Errorf("expected %v got %v", expected, users)
+	}
+
+	// testRow is a RowDecoder
+	var rows []testRow
+	for row := range RowsOf[testRow](context.Background(), db.Query("SELECT key, value FROM t").Iter()) {
+		if row.Err != nil {
+			t.Fatal(row.Err)
+		}
+		rows = append(rows, row.Value)
+	}
+	if expected := []testRow{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v got %v", expected, rows)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// every power of two range of latencies is split in latencySubBuckets
+	// linear buckets, the relative error of the percentiles is below
+	// 1/latencySubBuckets.
+	latencySubBucketBits = 5
+	latencySubBuckets    = 1 << latencySubBucketBits
+
+	// latencies are recorded in microseconds and capped to 2^40us (~12 days)
+	latencyMaxBits = 40
+	latencyBuckets = latencySubBuckets + (latencyMaxBits-latencySubBucketBits)*latencySubBuckets
+
+	// latencyWindow is the duration of the windows of the recent latency
+	// histograms, they cover the responses of the last one to two windows.
+	latencyWindow = time.Minute
+)
+
+// latencyHistogram is a HDR style histogram of latencies: the values below
+// latencySubBuckets microseconds are counted exactly and larger values with
+// a constant relative precision.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts [latencyBuckets]int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func latencyBucket(v int64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	if v >= 1<<latencyMaxBits {
+		v = 1<<latencyMaxBits - 1
+	}
+
+	// number of bits of v, it is at least latencySubBucketBits+1
+	n := latencySubBucketBits + 1
+	for v>>uint(n) != 0 {
+		n++
+	}
+
+	shift := uint(n - latencySubBucketBits - 1)
+	sub := int(v>>shift) & (latencySubBuckets - 1)
+	return latencySubBuckets + int(shift)*latencySubBuckets + sub
+}
+
+// latencyBucketValue returns the highest value counted by the bucket i.
+func latencyBucketValue(i int) int64 {
+	if i < latencySubBuckets {
+		return int64(i)
+	}
+
+	i -= latencySubBuckets
+	shift := uint(i / latencySubBuckets)
+	sub := int64(i%latencySubBuckets) | latencySubBuckets
+	return (sub+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+
+	h.mu.Lock()
+	h.counts[latencyBucket(v)]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+func (h *latencyHistogram) snapshot() LatencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := LatencySnapshot{
+		Count:  h.count,
+		Min:    time.Duration(h.min) * time.Microsecond,
+		Max:    time.Duration(h.max) * time.Microsecond,
+		counts: make([]int64, len(h.counts)),
+	}
+	if h.count > 0 {
+		s.Mean = time.Duration(h.sum/h.count) * time.Microsecond
+	}
+	copy(s.counts, h.counts[:])
+
+	return s
+}
+
+// LatencySnapshot is a copy of the latency histogram of a host, it covers
+// every response received from the host by queries and batches since the
+// session was created.
+type LatencySnapshot struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+
+	counts []int64
+}
+
+// Percentile returns the latency below which the fraction p, between 0 and
+// 1, of the responses were received. The value is rounded up to the precision
+// of the histogram, about 3%.
+func (s LatencySnapshot) Percentile(p float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return s.Min
+	}
+	if p >= 1 {
+		return s.Max
+	}
+
+	rank := int64(p*float64(s.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for i, n := range s.counts {
+		seen += n
+		if seen >= rank {
+			v := time.Duration(latencyBucketValue(i)) * time.Microsecond
+			if v > s.Max {
+				v = s.Max
+			}
+			return v
+		}
+	}
+
+	return s.Max
+}
+
+// merge returns the snapshot of the responses of both s and o.
+func (s LatencySnapshot) merge(o LatencySnapshot) LatencySnapshot {
+	if o.Count == 0 {
+		return s
+	}
+	if s.Count == 0 {
+		return o
+	}
+
+	m := LatencySnapshot{
+		Count:  s.Count + o.Count,
+		Min:    s.Min,
+		Max:    s.Max,
+		Mean:   time.Duration((float64(s.Mean)*float64(s.Count) + float64(o.Mean)*float64(o.Count)) / float64(s.Count+o.Count)),
+		counts: make([]int64, len(s.counts)),
+	}
+	if o.Min < m.Min {
+		m.Min = o.Min
+	}
+	if o.Max > m.Max {
+		m.Max = o.Max
+	}
+	for i := range m.counts {
+		m.counts[i] = s.counts[i] + o.counts[i]
+	}
+
+	return m
+}
+
+// hostLatency is the latency histogram of a host since the session was
+// created and the histograms of its current and previous windows.
+type hostLatency struct {
+	all latencyHistogram
+
+	mu      sync.Mutex
+	started time.Time
+	cur     *latencyHistogram
+	prev    *latencyHistogram
+}
+
+// windows returns the histograms of the current and previous windows, prev
+// is nil when there was no response during the previous window.
+func (h *hostLatency) windows(now time.Time) (cur, prev *latencyHistogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if elapsed := now.Sub(h.started); h.cur == nil || elapsed >= latencyWindow {
+		h.prev = h.cur
+		if elapsed >= 2*latencyWindow {
+			h.prev = nil
+		}
+		h.cur = &latencyHistogram{}
+		h.started = now
+	}
+
+	return h.cur, h.prev
+}
+
+func (h *hostLatency) record(d time.Duration) {
+	h.all.record(d)
+	cur, _ := h.windows(time.Now())
+	cur.record(d)
+}
+
+// recent returns a snapshot of the responses of the current and previous
+// windows.
+func (h *hostLatency) recent() LatencySnapshot {
+	cur, prev := h.windows(time.Now())
+	s := cur.snapshot()
+	if prev != nil {
+		s = s.merge(prev.snapshot())
+	}
+	return s
+}
+
+// hostLatencies are the latency histograms of the hosts of a session.
+type hostLatencies struct {
+	mu    sync.RWMutex
+	hosts map[string]*hostLatency
+}
+
+func (l *hostLatencies) record(host string, d time.Duration) {
+	l.mu.RLock()
+	h := l.hosts[host]
+	l.mu.RUnlock()
+
+	if h == nil {
+		l.mu.Lock()
+		if l.hosts == nil {
+			l.hosts = make(map[string]*hostLatency)
+		}
+		if h = l.hosts[host]; h == nil {
+			h = &hostLatency{}
+			l.hosts[host] = h
+		}
+		l.mu.Unlock()
+	}
+
+	h.record(d)
+}
+
+// recent returns a snapshot of the responses of the last one to two minutes
+// of host.
+func (l *hostLatencies) recent(host string) LatencySnapshot {
+	l.mu.RLock()
+	h := l.hosts[host]
+	l.mu.RUnlock()
+
+	if h == nil {
+		return LatencySnapshot{}
+	}
+	return h.recent()
+}
+
+// HostLatencyStats returns a snapshot of the latency histogram of every host
+// the session received a response from, keyed by host address.
+func (s *Session) HostLatencyStats() map[string]LatencySnapshot {
+	s.latencies.mu.RLock()
+	defer s.latencies.mu.RUnlock()
+
+	stats := make(map[string]LatencySnapshot, len(s.latencies.hosts))
+	for host, h := range s.latencies.hosts {
+		stats[host] = h.all.snapshot()
+	}
+
+	return stats
+}
@@ -0,0 +1,124 @@
+// +build all unit
+
+package gocql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	for _, v := range []int64{0, 1, 31, 32, 33, 63, 64, 65, 1000, 123456, 1<<latencyMaxBits - 1} {
+		i := latencyBucket(v)
+		if i < 0 || i >= latencyBuckets {
+			t.Fatalf("%d: bucket %d out of range", v, i)
+		}
+		if max := latencyBucketValue(i); v > max {
+			t.Errorf("%d: bucket %d has a max value of %d", v, i, max)
+		}
+		if i > 0 {
+			if prev := latencyBucketValue(i - 1); v <= prev {
+				t.Errorf("%d: expected to be above the previous bucket max %d", v, prev)
+			}
+		}
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	s := h.snapshot()
+	if s.Count != 1000 {
+		t.Fatalf("expected 1000 values got %d", s.Count)
+	}
+	if s.Min != time.Millisecond || s.Max != time.Second {
+		t.Errorf("expected min 1ms and max 1s got %v and %v", s.Min, s.Max)
+	}
+
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0.5, 500 * time.Millisecond},
+		{0.9, 900 * time.Millisecond},
+		{0.99, 990 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		got := s.Percentile(test.p)
+		if got < test.expected || float64(got) > float64(test.expected)*(1+1.0/latencySubBuckets) {
+			t.Errorf("p%v: expected about %v got %v", test.p*100, test.expected, got)
+		}
+	}
+}
+
+func TestRecentLatency(t *testing.T) {
+	var l hostLatencies
+	l.record("host", time.Second)
+	l.record("host", time.Millisecond)
+
+	if s := l.recent("host"); s.Count != 2 || s.Max != time.Second {
+		t.Errorf("expected the 2 responses to be recent got %d responses, max %v", s.Count, s.Max)
+	}
+	if s := l.recent("other"); s.Count != 0 {
+		t.Errorf("expected no recent responses of an unknown host got %d", s.Count)
+	}
+
+	// the responses of the previous window are still recent
+	h := l.hosts["host"]
+	h.started = h.started.Add(-latencyWindow)
+	l.record("host", 2*time.Millisecond)
+	if s := l.recent("host"); s.Count != 3 || s.Min != time.Millisecond || s.Max != time.Second {
+		t.Errorf("expected the 3 responses to be recent got %d responses, min %v, max %v", s.Count, s.Min, s.Max)
+	}
+
+	h.started = h.started.Add(-latencyWindow)
+	l.record("host", 3*time.Millisecond)
+	if s := l.recent("host"); s.Count != 2 || s.Max != 3*time.Millisecond {
+		t.Errorf("expected the 2 last responses to be recent got %d responses, max %v", s.Count, s.Max)
+	}
+
+	h.started = h.started.Add(-2 * latencyWindow)
+	if s := l.recent("host"); s.Count != 0 {
+		t.Errorf("expected no recent responses got %d", s.Count)
+	}
+
+	if s := h.all.snapshot(); s.Count != 4 {
+		t.Errorf("expected 4 responses since the session was created got %d", s.Count)
+	}
+}
+
+func TestHostLatencyStats(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := db.Query("void").Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Query("slow").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := db.HostLatencyStats()
+	s, ok := stats[srv.Address]
+	if !ok {
+		t.Fatalf("no latency stats for %s: %v", srv.Address, stats)
+	}
+	if s.Count != 6 {
+		t.Errorf("expected 6 responses got %d", s.Count)
+	}
+	if s.Percentile(1) < 50*time.Millisecond {
+		t.Errorf("expected the slow query latency to be recorded, max %v", s.Percentile(1))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// Logger is the interface used by the driver to report warnings and errors,
+// such as hosts failing to connect or statements being prepared again. The
+// message is followed by alternating keys and values, which is the calling
+// convention of log/slog: a *slog.Logger implements Logger, see also
+// NewSlogLogger.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// nopLogger discards everything, it is used when no Logger is configured.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger writing to l, each entry is written on a
+// single line as the level, the message and the key=value pairs. Debug
+// entries are discarded.
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l: l}
+}
+
+func (s stdLogger) output(level, msg string, keyvals []interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(level)
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		fmt.Fprintf(&buf, " %v=%v", keyvals[i], v)
+	}
+
+	s.l.Output(3, buf.String())
+}
+
+func (s stdLogger) Debug(msg string, keyvals ...interface{}) {}
+
+func (s stdLogger) Info(msg string, keyvals ...interface{}) {
+	s.output("INFO", msg, keyvals)
+}
+
+func (s stdLogger) Warn(msg string, keyvals ...interface{}) {
+	s.output("WARN", msg, keyvals)
+}
+
+func (s stdLogger) Error(msg string, keyvals ...interface{}) {
+	s.output("ERROR", msg, keyvals)
+}
+
+func (cfg *ClusterConfig) logger() Logger {
+	if cfg.Logger == nil {
+		return nopLogger{}
+	}
+	return cfg.Logger
+}
+
+func (cfg *ConnConfig) logger() Logger {
+	if cfg.Logger == nil {
+		return nopLogger{}
+	}
+	return cfg.Logger
+}
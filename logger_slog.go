@@ -0,0 +1,20 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.21
+
+package gocql
+
+import (
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger writing to l, or to the default slog logger
+// when l is nil.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lz4 implements the LZ4 frame compression of the native protocol,
+// which is the recommended compression for Cassandra 3 and above:
+//
+//	cluster := gocql.NewCluster("127.0.0.1")
+//	cluster.Compressor = lz4.LZ4Compressor{}
+package lz4
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// LZ4Compressor implements the gocql.Compressor interface. The native
+// protocol prefixes the compressed LZ4 blocks with their uncompressed length
+// as a 4 byte big endian integer. It also implements gocql.BlockCompressor
+// for the segments of protocol v5, which carry the length in their header.
+type LZ4Compressor struct{}
+
+func (s LZ4Compressor) Name() string {
+	return "lz4"
+}
+
+func (s LZ4Compressor) Encode(data []byte) ([]byte, error) {
+	buf := make([]byte, 4+lz4.CompressBlockBound(len(data)))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+
+	var c lz4.Compressor
+	n, err := c.CompressBlock(data, buf[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:4+n], nil
+}
+
+func (s LZ4Compressor) Decode(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("lz4: compressed data too short: %d", len(data))
+	}
+
+	size := binary.BigEndian.Uint32(data)
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	buf := make([]byte, size)
+	n, err := lz4.UncompressBlock(data[4:], buf)
+	if err != nil {
+		return nil, err
+	} else if n != len(buf) {
+		return nil, fmt.Errorf("lz4: expected %d uncompressed bytes got %d", len(buf), n)
+	}
+
+	return buf, nil
+}
+
+func (s LZ4Compressor) CompressBlock(src []byte) ([]byte, error) {
+	buf := make([]byte, lz4.CompressBlockBound(len(src)))
+
+	var c lz4.Compressor
+	n, err := c.CompressBlock(src, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+func (s LZ4Compressor) DecompressBlock(src []byte, uncompressedLength int) ([]byte, error) {
+	buf := make([]byte, uncompressedLength)
+	n, err := lz4.UncompressBlock(src, buf)
+	if err != nil {
+		return nil, err
+	} else if n != len(buf) {
+		return nil, fmt.Errorf("lz4: expected %d uncompressed bytes got %d", len(buf), n)
+	}
+
+	return buf, nil
+}
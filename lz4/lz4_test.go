@@ -0,0 +1,74 @@
+// +build all unit
+
+package lz4
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	_ gocql.Compressor      = LZ4Compressor{}
+	_ gocql.BlockCompressor = LZ4Compressor{}
+)
+
+func TestLZ4Compressor(t *testing.T) {
+	c := LZ4Compressor{}
+	if c.Name() != "lz4" {
+		t.Fatalf("expected name to be 'lz4', got %v", c.Name())
+	}
+
+	tests := [][]byte{
+		[]byte{},
+		[]byte("My Test String"),
+		bytes.Repeat([]byte("My Test String"), 100),
+	}
+
+	for _, data := range tests {
+		val, err := c.Encode(data)
+		if err != nil {
+			t.Fatalf("failed to encode '%s' with error %v", data, err)
+		}
+
+		if size := int(val[0])<<24 | int(val[1])<<16 | int(val[2])<<8 | int(val[3]); size != len(data) {
+			t.Fatalf("expected uncompressed length prefix %d, got %d", len(data), size)
+		}
+
+		res, err := c.Decode(val)
+		if err != nil {
+			t.Fatalf("failed to decode '%x' with error %v", val, err)
+		} else if !bytes.Equal(data, res) {
+			t.Fatalf("expected to decode '%s', got '%s'", data, res)
+		}
+	}
+
+	if _, err := c.Decode([]byte{0, 0}); err == nil {
+		t.Fatal("expected an error decoding data without a length prefix")
+	}
+	if _, err := c.Decode([]byte{0, 0, 0, 10, 0xff}); err == nil {
+		t.Fatal("expected an error decoding corrupt data")
+	}
+}
+
+func TestLZ4BlockCompressor(t *testing.T) {
+	c := LZ4Compressor{}
+	data := bytes.Repeat([]byte("My Test String"), 100)
+
+	val, err := c.CompressBlock(data)
+	if err != nil {
+		t.Fatalf("failed to compress block with error %v", err)
+	}
+
+	res, err := c.DecompressBlock(val, len(data))
+	if err != nil {
+		t.Fatalf("failed to decompress block with error %v", err)
+	} else if !bytes.Equal(data, res) {
+		t.Fatalf("expected to decompress '%s', got '%s'", data, res)
+	}
+
+	if _, err := c.DecompressBlock(val, len(data)+1); err == nil {
+		t.Fatal("expected an error decompressing with a wrong length")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"net"
@@ -29,17 +30,36 @@ var (
 )
 
 // Marshaler is the interface implemented by objects that can marshal
-// themselves into values understood by Cassandra.
+// themselves into values understood by Cassandra. It is consulted before
+// any of the built-in conversions, which makes it possible for a type such as
+// a custom Money type to control how it is encoded as a decimal. Marshaler is
+// used for both value and pointer receivers.
 type Marshaler interface {
 	MarshalCQL(info TypeInfo) ([]byte, error)
 }
 
 // Unmarshaler is the interface implemented by objects that can unmarshal
-// a Cassandra specific description of themselves.
+// a Cassandra specific description of themselves. Like Marshaler it is
+// consulted before any of the built-in conversions. A nil data slice
+// represents a null value.
 type Unmarshaler interface {
 	UnmarshalCQL(info TypeInfo, data []byte) error
 }
 
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// unsetColumn is the type of UnsetValue.
+type unsetColumn struct{}
+
+// UnsetValue can be bound to a variable of a prepared statement to leave the
+// column untouched, whereas binding nil writes a null, which is stored as a
+// tombstone. It allows a single statement to update any subset of the
+// columns of a row without reading it first.
+//
+// Only available on protocol >= 4, the query fails with ErrUnsupported with
+// older protocols.
+var UnsetValue = unsetColumn{}
+
 // Marshal returns the CQL encoding of the value for the Cassandra
 // internal type described by the info parameter.
 func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
@@ -62,6 +82,15 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 
 	if v, ok := value.(Marshaler); ok {
 		return v.MarshalCQL(info)
+	} else if t := reflect.TypeOf(value); reflect.PtrTo(t).Implements(marshalerType) {
+		// MarshalCQL has a pointer receiver but we got passed a value
+		ptr := reflect.New(t)
+		ptr.Elem().Set(reflect.ValueOf(value))
+		return ptr.Interface().(Marshaler).MarshalCQL(info)
+	}
+
+	if codec := lookupCodec(info); codec != nil {
+		return codec.Marshal(info, value)
 	}
 
 	switch info.Type() {
@@ -71,6 +100,10 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 		return marshalBool(info, value)
 	case TypeInt:
 		return marshalInt(info, value)
+	case TypeSmallInt:
+		return marshalSmallInt(info, value)
+	case TypeTinyInt:
+		return marshalTinyInt(info, value)
 	case TypeBigInt, TypeCounter:
 		return marshalBigInt(info, value)
 	case TypeFloat:
@@ -91,6 +124,14 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 		return marshalVarint(info, value)
 	case TypeInet:
 		return marshalInet(info, value)
+	case TypeDate:
+		return marshalDate(info, value)
+	case TypeTime:
+		return marshalTime(info, value)
+	case TypeDuration:
+		return marshalDuration(info, value)
+	case TypeTuple:
+		return marshalTuple(info, value)
 	case TypeUDT:
 		return marshalUDT(info, value)
 	}
@@ -100,6 +141,11 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, ErrorUDTUnavailable
 	}
 
+	if info.Type() == TypeCustom {
+		// custom types without a registered codec are passed through as is
+		return marshalVarchar(info, value)
+	}
+
 	// TODO(tux21b): add the remaining types
 	return nil, fmt.Errorf("can not marshal %T into %s", value, info)
 }
@@ -115,6 +161,10 @@ func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
 		return unmarshalNullable(info, data, value)
 	}
 
+	if codec := lookupCodec(info); codec != nil {
+		return codec.Unmarshal(info, data, value)
+	}
+
 	switch info.Type() {
 	case TypeVarchar, TypeAscii, TypeBlob:
 		return unmarshalVarchar(info, data, value)
@@ -122,6 +172,10 @@ func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
 		return unmarshalBool(info, data, value)
 	case TypeInt:
 		return unmarshalInt(info, data, value)
+	case TypeSmallInt:
+		return unmarshalSmallInt(info, data, value)
+	case TypeTinyInt:
+		return unmarshalTinyInt(info, data, value)
 	case TypeBigInt, TypeCounter:
 		return unmarshalBigInt(info, data, value)
 	case TypeVarint:
@@ -144,6 +198,12 @@ func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
 		return unmarshalUUID(info, data, value)
 	case TypeInet:
 		return unmarshalInet(info, data, value)
+	case TypeDate:
+		return unmarshalDate(info, data, value)
+	case TypeTime:
+		return unmarshalTime(info, data, value)
+	case TypeDuration:
+		return unmarshalDuration(info, data, value)
 	case TypeTuple:
 		return unmarshalTuple(info, data, value)
 	case TypeUDT:
@@ -155,6 +215,10 @@ func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
 		return ErrorUDTUnavailable
 	}
 
+	if info.Type() == TypeCustom {
+		return unmarshalVarchar(info, data, value)
+	}
+
 	// TODO(tux21b): add the remaining types
 	return fmt.Errorf("can not unmarshal %s into %T", info, value)
 }
@@ -203,6 +267,16 @@ func marshalVarchar(info TypeInfo, value interface{}) ([]byte, error) {
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
 
+// isBytesType reports whether the values of info are unmarshaled into a
+// *[]byte as is, see unmarshalVarchar.
+func isBytesType(info TypeInfo) bool {
+	switch info.Type() {
+	case TypeVarchar, TypeAscii, TypeBlob, TypeCustom:
+		return true
+	}
+	return false
+}
+
 func unmarshalVarchar(info TypeInfo, data []byte, value interface{}) error {
 	switch v := value.(type) {
 	case Unmarshaler:
@@ -218,6 +292,18 @@ func unmarshalVarchar(info TypeInfo, data []byte, value interface{}) error {
 		}
 		*v = dataCopy
 		return nil
+	case *io.Reader:
+		// the rows of an Iter are not reused once they have been read from
+		// the frame, which makes it safe to stream the value without first
+		// copying it, unless the query borrows the bytes of the response,
+		// then the reader is only valid until the next Scan or Close of
+		// the Iter. A null value is unmarshaled as a nil io.Reader.
+		if data == nil {
+			*v = nil
+			return nil
+		}
+		*v = bytes.NewReader(data)
+		return nil
 	}
 	rv := reflect.ValueOf(value)
 	if rv.Kind() != reflect.Ptr {
@@ -306,6 +392,82 @@ func marshalInt(info TypeInfo, value interface{}) ([]byte, error) {
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
 
+// intInRange converts an integer or a string holding one to an int64,
+// checking that it is in the range [min, max].
+func intInRange(info TypeInfo, value interface{}, min, max int64) (int64, error) {
+	var v int64
+	if s, ok := value.(string); ok {
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, marshalErrorf("can not marshal string to %s: %s", info, err)
+		}
+		v = i
+	} else {
+		rv := reflect.ValueOf(value)
+		switch rv.Type().Kind() {
+		case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+			v = rv.Int()
+		case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+			u := rv.Uint()
+			if u > uint64(max) {
+				return 0, marshalErrorf("marshal %s: value %d out of range", info, u)
+			}
+			v = int64(u)
+		default:
+			return 0, marshalErrorf("can not marshal %T into %s", value, info)
+		}
+	}
+
+	if v < min || v > max {
+		return 0, marshalErrorf("marshal %s: value %d out of range", info, v)
+	}
+	return v, nil
+}
+
+func marshalSmallInt(info TypeInfo, value interface{}) ([]byte, error) {
+	if v, ok := value.(Marshaler); ok {
+		return v.MarshalCQL(info)
+	}
+	v, err := intInRange(info, value, math.MinInt16, math.MaxInt16)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{byte(v >> 8), byte(v)}, nil
+}
+
+func unmarshalSmallInt(info TypeInfo, data []byte, value interface{}) error {
+	if len(data) != 0 && len(data) != 2 {
+		return unmarshalErrorf("unmarshal smallint: invalid length %d", len(data))
+	}
+	var v int64
+	if len(data) == 2 {
+		v = int64(int16(data[0])<<8 | int16(data[1]))
+	}
+	return unmarshalIntlike(info, v, data, value)
+}
+
+func marshalTinyInt(info TypeInfo, value interface{}) ([]byte, error) {
+	if v, ok := value.(Marshaler); ok {
+		return v.MarshalCQL(info)
+	}
+	v, err := intInRange(info, value, math.MinInt8, math.MaxInt8)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{byte(v)}, nil
+}
+
+func unmarshalTinyInt(info TypeInfo, data []byte, value interface{}) error {
+	if len(data) != 0 && len(data) != 1 {
+		return unmarshalErrorf("unmarshal tinyint: invalid length %d", len(data))
+	}
+	var v int64
+	if len(data) == 1 {
+		v = int64(int8(data[0]))
+	}
+	return unmarshalIntlike(info, v, data, value)
+}
+
 func encInt(x int32) []byte {
 	return []byte{byte(x >> 24), byte(x >> 16), byte(x >> 8), byte(x)}
 }
@@ -392,9 +554,20 @@ func unmarshalInt(info TypeInfo, data []byte, value interface{}) error {
 }
 
 func unmarshalVarint(info TypeInfo, data []byte, value interface{}) error {
-	switch value.(type) {
+	switch v := value.(type) {
 	case *big.Int:
 		return unmarshalIntlike(info, 0, data, value)
+	case *uint64:
+		// values above math.MaxInt64 are prefixed with a zero byte
+		if len(data) == 9 && data[0] == 0 {
+			*v = binary.BigEndian.Uint64(data[1:])
+			return nil
+		}
+	case *string:
+		if len(data) > 8 {
+			*v = decBigInt2C(data, nil).String()
+			return nil
+		}
 	}
 
 	if len(data) > 8 {
@@ -402,7 +575,7 @@ func unmarshalVarint(info TypeInfo, data []byte, value interface{}) error {
 	}
 
 	int64Val := bytesToInt64(data)
-	if len(data) < 8 && data[0]&0x80 > 0 {
+	if len(data) > 0 && len(data) < 8 && data[0]&0x80 > 0 {
 		int64Val -= (1 << uint(len(data)*8))
 	}
 	return unmarshalIntlike(info, int64Val, data, value)
@@ -423,6 +596,12 @@ func marshalVarint(info TypeInfo, value interface{}) ([]byte, error) {
 			retBytes = make([]byte, 8)
 			binary.BigEndian.PutUint64(retBytes, v)
 		}
+	case string:
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			return nil, marshalErrorf("can not marshal %q into %s: invalid varint", v, info)
+		}
+		retBytes = encBigInt2C(n)
 	default:
 		retBytes, err = marshalBigInt(info, value)
 	}
@@ -729,27 +908,72 @@ func marshalDecimal(info TypeInfo, value interface{}) ([]byte, error) {
 	case Marshaler:
 		return v.MarshalCQL(info)
 	case inf.Dec:
-		unscaled := encBigInt2C(v.UnscaledBig())
-		if unscaled == nil {
-			return nil, marshalErrorf("can not marshal %T into %s", value, info)
+		return encDecimal(info, value, v.UnscaledBig(), int32(v.Scale()))
+	case big.Int:
+		return encDecimal(info, value, &v, 0)
+	case string:
+		dec, ok := new(inf.Dec).SetString(v)
+		if !ok {
+			return nil, marshalErrorf("can not marshal %q into %s: invalid decimal", v, info)
 		}
-
-		buf := make([]byte, 4+len(unscaled))
-		copy(buf[0:4], encInt(int32(v.Scale())))
-		copy(buf[4:], unscaled)
-		return buf, nil
+		return encDecimal(info, value, dec.UnscaledBig(), int32(dec.Scale()))
 	}
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
 
+// encDecimal encodes a decimal as its scale followed by the two's complement
+// representation of its unscaled value.
+func encDecimal(info TypeInfo, value interface{}, unscaled *big.Int, scale int32) ([]byte, error) {
+	b := encBigInt2C(unscaled)
+	if b == nil {
+		return nil, marshalErrorf("can not marshal %T into %s", value, info)
+	}
+
+	buf := make([]byte, 4+len(b))
+	copy(buf[0:4], encInt(scale))
+	copy(buf[4:], b)
+	return buf, nil
+}
+
 func unmarshalDecimal(info TypeInfo, data []byte, value interface{}) error {
-	switch v := value.(type) {
-	case Unmarshaler:
+	if v, ok := value.(Unmarshaler); ok {
 		return v.UnmarshalCQL(info, data)
-	case *inf.Dec:
+	}
+
+	var dec *inf.Dec
+	if len(data) == 0 {
+		dec = new(inf.Dec)
+	} else if len(data) < 4 {
+		return unmarshalErrorf("unmarshal decimal: unexpected eof")
+	} else {
 		scale := decInt(data[0:4])
 		unscaled := decBigInt2C(data[4:], nil)
-		*v = *inf.NewDecBig(unscaled, inf.Scale(scale))
+		dec = inf.NewDecBig(unscaled, inf.Scale(scale))
+	}
+
+	switch v := value.(type) {
+	case *inf.Dec:
+		*v = *dec
+		return nil
+	case *big.Rat:
+		// the value of the decimal is unscaled * 10**-scale
+		scale := big.NewInt(int64(dec.Scale()))
+		if scale.Sign() < 0 {
+			scale.Neg(scale)
+		}
+		pow := new(big.Int).Exp(big.NewInt(10), scale, nil)
+		if dec.Scale() >= 0 {
+			v.SetFrac(dec.UnscaledBig(), pow)
+		} else {
+			v.SetInt(new(big.Int).Mul(dec.UnscaledBig(), pow))
+		}
+		return nil
+	case *string:
+		if len(data) == 0 {
+			*v = ""
+			return nil
+		}
+		*v = dec.String()
 		return nil
 	}
 	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
@@ -846,6 +1070,130 @@ func unmarshalTimestamp(info TypeInfo, data []byte, value interface{}) error {
 	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
 }
 
+// Date is the Go representation of the CQL date type, a calendar date
+// without a time of day or a time zone.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf returns the calendar date of t in the location of t.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// Time returns the time at midnight UTC on the date d.
+func (d Date) Time() time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// dateEpoch is the encoded value of 1970-01-01, dates are stored as an
+// unsigned number of days centered on the unix epoch.
+const dateEpoch = 1 << 31
+
+func marshalDate(info TypeInfo, value interface{}) ([]byte, error) {
+	var d Date
+	switch v := value.(type) {
+	case Marshaler:
+		return v.MarshalCQL(info)
+	case Date:
+		d = v
+	case time.Time:
+		d = DateOf(v)
+	case string:
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, marshalErrorf("can not marshal %q into %s: %v", v, info, err)
+		}
+		d = DateOf(t)
+	default:
+		return nil, marshalErrorf("can not marshal %T into %s", value, info)
+	}
+
+	days := d.Time().Unix()/86400 + dateEpoch
+	if days < 0 || days > math.MaxUint32 {
+		return nil, marshalErrorf("marshal date: %v out of range", d)
+	}
+	return encInt(int32(uint32(days))), nil
+}
+
+func unmarshalDate(info TypeInfo, data []byte, value interface{}) error {
+	if len(data) != 0 && len(data) != 4 {
+		return unmarshalErrorf("unmarshal date: invalid length %d", len(data))
+	}
+
+	// null dates are unmarshaled as the zero value
+	var d Date
+	if len(data) == 4 {
+		days := int64(uint32(decInt(data))) - dateEpoch
+		d = DateOf(time.Unix(days*86400, 0).UTC())
+	}
+
+	switch v := value.(type) {
+	case *Date:
+		*v = d
+		return nil
+	case *time.Time:
+		if len(data) == 0 {
+			*v = time.Time{}
+			return nil
+		}
+		*v = d.Time()
+		return nil
+	case *string:
+		if len(data) == 0 {
+			*v = ""
+			return nil
+		}
+		*v = d.String()
+		return nil
+	}
+	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
+}
+
+// marshalTime marshals the CQL time type, the number of nanoseconds since
+// midnight.
+func marshalTime(info TypeInfo, value interface{}) ([]byte, error) {
+	var nanos int64
+	switch v := value.(type) {
+	case Marshaler:
+		return v.MarshalCQL(info)
+	case time.Duration:
+		nanos = int64(v)
+	case int64:
+		nanos = v
+	default:
+		return nil, marshalErrorf("can not marshal %T into %s", value, info)
+	}
+
+	if nanos < 0 || nanos >= int64(24*time.Hour) {
+		return nil, marshalErrorf("marshal time: %v is not within a day", time.Duration(nanos))
+	}
+	return encBigInt(nanos), nil
+}
+
+func unmarshalTime(info TypeInfo, data []byte, value interface{}) error {
+	if len(data) != 0 && len(data) != 8 {
+		return unmarshalErrorf("unmarshal time: invalid length %d", len(data))
+	}
+
+	switch v := value.(type) {
+	case *time.Duration:
+		*v = time.Duration(decBigInt(data))
+		return nil
+	case *int64:
+		*v = decBigInt(data)
+		return nil
+	}
+	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
+}
+
 func writeCollectionSize(info CollectionType, n int, buf *bytes.Buffer) error {
 	if info.proto > protoVersion2 {
 		if n > math.MaxInt32 {
@@ -901,12 +1249,20 @@ func marshalList(info TypeInfo, value interface{}) ([]byte, error) {
 		}
 		return buf.Bytes(), nil
 	case reflect.Map:
+		// sets can be marshaled from a map[T]struct{} or a map[T]bool, in
+		// which case only the keys mapped to true are members of the set
 		elem := t.Elem()
-		if elem.Kind() == reflect.Struct && elem.NumField() == 0 {
+		if elem.Kind() == reflect.Struct && elem.NumField() == 0 || elem.Kind() == reflect.Bool {
+			if rv.IsNil() {
+				return nil, nil
+			}
 			rkeys := rv.MapKeys()
-			keys := make([]interface{}, len(rkeys))
-			for i := 0; i < len(keys); i++ {
-				keys[i] = rkeys[i].Interface()
+			keys := make([]interface{}, 0, len(rkeys))
+			for _, key := range rkeys {
+				if elem.Kind() == reflect.Bool && !rv.MapIndex(key).Bool() {
+					continue
+				}
+				keys = append(keys, key.Interface())
 			}
 			return marshalList(listInfo, keys)
 		}
@@ -914,17 +1270,39 @@ func marshalList(info TypeInfo, value interface{}) ([]byte, error) {
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
 
-func readCollectionSize(info CollectionType, data []byte) (size, read int) {
+func readCollectionSize(info CollectionType, data []byte) (size, read int, err error) {
 	if info.proto > protoVersion2 {
-		size = int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if len(data) < 4 {
+			return 0, 0, unmarshalErrorf("unmarshal %s: unexpected eof", info)
+		}
+		size = int(int32(data[0])<<24 | int32(data[1])<<16 | int32(data[2])<<8 | int32(data[3]))
 		read = 4
 	} else {
+		if len(data) < 2 {
+			return 0, 0, unmarshalErrorf("unmarshal %s: unexpected eof", info)
+		}
 		size = int(data[0])<<8 | int(data[1])
 		read = 2
 	}
 	return
 }
 
+// readCollectionElem reads a single length prefixed element of a collection
+// from data, a negative length is returned as a nil element.
+func readCollectionElem(info CollectionType, data []byte) (elem, rest []byte, err error) {
+	n, p, err := readCollectionSize(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = data[p:]
+	if n < 0 {
+		return nil, data, nil
+	} else if len(data) < n {
+		return nil, nil, unmarshalErrorf("unmarshal %s: unexpected eof", info)
+	}
+	return data[:n], data[n:], nil
+}
+
 func unmarshalList(info TypeInfo, data []byte, value interface{}) error {
 	listInfo, ok := info.(CollectionType)
 	if !ok {
@@ -948,10 +1326,10 @@ func unmarshalList(info TypeInfo, data []byte, value interface{}) error {
 			rv.Set(reflect.Zero(t))
 			return nil
 		}
-		if len(data) < 2 {
-			return unmarshalErrorf("unmarshal list: unexpected eof")
+		n, p, err := readCollectionSize(listInfo, data)
+		if err != nil {
+			return err
 		}
-		n, p := readCollectionSize(listInfo, data)
 		data = data[p:]
 		if k == reflect.Array {
 			if rv.Len() != n {
@@ -961,15 +1339,48 @@ func unmarshalList(info TypeInfo, data []byte, value interface{}) error {
 			rv.Set(reflect.MakeSlice(t, n, n))
 		}
 		for i := 0; i < n; i++ {
-			if len(data) < 2 {
-				return unmarshalErrorf("unmarshal list: unexpected eof")
+			elem, rest, err := readCollectionElem(listInfo, data)
+			if err != nil {
+				return err
 			}
-			m, p := readCollectionSize(listInfo, data)
-			data = data[p:]
-			if err := Unmarshal(listInfo.Elem, data[:m], rv.Index(i).Addr().Interface()); err != nil {
+			data = rest
+			if err := Unmarshal(listInfo.Elem, elem, rv.Index(i).Addr().Interface()); err != nil {
 				return err
 			}
-			data = data[m:]
+		}
+		return nil
+	case reflect.Map:
+		// sets can be unmarshaled into a map[T]struct{} or a map[T]bool
+		elemKind := t.Elem().Kind()
+		if listInfo.typ != TypeSet || !(elemKind == reflect.Bool ||
+			elemKind == reflect.Struct && t.Elem().NumField() == 0) {
+			break
+		}
+		if data == nil {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		n, p, err := readCollectionSize(listInfo, data)
+		if err != nil {
+			return err
+		}
+		data = data[p:]
+		rv.Set(reflect.MakeMap(t))
+		present := reflect.New(t.Elem()).Elem()
+		if elemKind == reflect.Bool {
+			present.SetBool(true)
+		}
+		for i := 0; i < n; i++ {
+			elem, rest, err := readCollectionElem(listInfo, data)
+			if err != nil {
+				return err
+			}
+			data = rest
+			key := reflect.New(t.Key())
+			if err := Unmarshal(listInfo.Elem, elem, key.Interface()); err != nil {
+				return err
+			}
+			rv.SetMapIndex(key.Elem(), present)
 		}
 		return nil
 	}
@@ -1039,31 +1450,32 @@ func unmarshalMap(info TypeInfo, data []byte, value interface{}) error {
 		rv.Set(reflect.Zero(t))
 		return nil
 	}
-	rv.Set(reflect.MakeMap(t))
-	if len(data) < 2 {
-		return unmarshalErrorf("unmarshal map: unexpected eof")
+	n, p, err := readCollectionSize(mapInfo, data)
+	if err != nil {
+		return err
 	}
-	n, p := readCollectionSize(mapInfo, data)
 	data = data[p:]
+	rv.Set(reflect.MakeMap(t))
 	for i := 0; i < n; i++ {
-		if len(data) < 2 {
-			return unmarshalErrorf("unmarshal list: unexpected eof")
+		elem, rest, err := readCollectionElem(mapInfo, data)
+		if err != nil {
+			return err
 		}
-		m, p := readCollectionSize(mapInfo, data)
-		data = data[p:]
+		data = rest
 		key := reflect.New(t.Key())
-		if err := Unmarshal(mapInfo.Key, data[:m], key.Interface()); err != nil {
+		if err := Unmarshal(mapInfo.Key, elem, key.Interface()); err != nil {
 			return err
 		}
-		data = data[m:]
 
-		m, p = readCollectionSize(mapInfo, data)
-		data = data[p:]
+		elem, rest, err = readCollectionElem(mapInfo, data)
+		if err != nil {
+			return err
+		}
+		data = rest
 		val := reflect.New(t.Elem())
-		if err := Unmarshal(mapInfo.Elem, data[:m], val.Interface()); err != nil {
+		if err := Unmarshal(mapInfo.Elem, elem, val.Interface()); err != nil {
 			return err
 		}
-		data = data[m:]
 
 		rv.SetMapIndex(key.Elem(), val.Elem())
 	}
@@ -1147,11 +1559,16 @@ func marshalInet(info TypeInfo, value interface{}) ([]byte, error) {
 	// with the remaining byte values e.g. ::ffff:127.0.0.1 and not 127.0.0.1
 	switch val := value.(type) {
 	case net.IP:
-		t := val.To4()
-		if t == nil {
-			return val.To16(), nil
+		if val == nil {
+			return nil, nil
 		}
-		return t, nil
+		if t := val.To4(); t != nil {
+			return t, nil
+		}
+		if t := val.To16(); t != nil {
+			return t, nil
+		}
+		return nil, marshalErrorf("cannot marshal. invalid ip %v", val)
 	case string:
 		b := net.ParseIP(val)
 		if b != nil {
@@ -1163,6 +1580,9 @@ func marshalInet(info TypeInfo, value interface{}) ([]byte, error) {
 		}
 		return nil, marshalErrorf("cannot marshal. invalid ip string %s", val)
 	}
+	if data, ok, err := marshalNetipAddr(value); ok {
+		return data, err
+	}
 	return nil, marshalErrorf("cannot marshal %T into %s", value, info)
 }
 
@@ -1171,7 +1591,16 @@ func unmarshalInet(info TypeInfo, data []byte, value interface{}) error {
 	case Unmarshaler:
 		return v.UnmarshalCQL(info, data)
 	case *net.IP:
-		ip := net.IP(data)
+		if len(data) == 0 {
+			*v = nil
+			return nil
+		}
+		if len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return unmarshalErrorf("unmarshal inet: invalid length %d", len(data))
+		}
+		// data belongs to the frame so it must be copied
+		ip := make(net.IP, len(data))
+		copy(ip, data)
 		if v4 := ip.To4(); v4 != nil {
 			*v = v4
 			return nil
@@ -1183,6 +1612,9 @@ func unmarshalInet(info TypeInfo, data []byte, value interface{}) error {
 			*v = ""
 			return nil
 		}
+		if len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return unmarshalErrorf("unmarshal inet: invalid length %d", len(data))
+		}
 		ip := net.IP(data)
 		if v4 := ip.To4(); v4 != nil {
 			*v = v4.String()
@@ -1191,12 +1623,265 @@ func unmarshalInet(info TypeInfo, data []byte, value interface{}) error {
 		*v = ip.String()
 		return nil
 	}
+	if ok, err := unmarshalNetipAddr(data, value); ok {
+		return err
+	}
 	return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
 }
 
-// currently only support unmarshal into a list of values, this makes it possible
-// to support tuples without changing the query API. In the future this can be extend
-// to allow unmarshalling into custom tuple types.
+// Duration is the Go representation of the CQL duration type. Unlike a
+// time.Duration it is made up of separate month, day and nanosecond
+// components as the length of a month or a day depends on the date the
+// duration is applied to.
+type Duration struct {
+	Months      int32
+	Days        int32
+	Nanoseconds int64
+}
+
+// encVint appends v to buf using the zig-zag encoded variable length
+// integer encoding used by Cassandra. The number of leading one bits of the
+// first byte gives the number of bytes which follow it.
+func encVint(buf []byte, v int64) []byte {
+	u := uint64(v>>63) ^ uint64(v<<1)
+
+	n := 1
+	for n < 9 && u >= 1<<(7*uint(n)) {
+		n++
+	}
+
+	b := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		b[i] = byte(u)
+		u >>= 8
+	}
+	if n == 9 {
+		b[0] = 0xff
+	} else {
+		b[0] = byte(u) | ^byte(0xff>>uint(n-1))
+	}
+
+	return append(buf, b...)
+}
+
+// decVint decodes a variable length integer written by encVint, it returns
+// the value and the number of bytes read.
+func decVint(data []byte) (int64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, unmarshalErrorf("unmarshal vint: unexpected eof")
+	}
+
+	first := data[0]
+	n := 0
+	for n < 8 && first&(0x80>>uint(n)) != 0 {
+		n++
+	}
+	if len(data) < n+1 {
+		return 0, 0, unmarshalErrorf("unmarshal vint: unexpected eof")
+	}
+
+	u := uint64(first & (0xff >> uint(n)))
+	for i := 1; i <= n; i++ {
+		u = u<<8 | uint64(data[i])
+	}
+
+	return int64(u>>1) ^ -int64(u&1), n + 1, nil
+}
+
+func marshalDuration(info TypeInfo, value interface{}) ([]byte, error) {
+	var d Duration
+	switch v := value.(type) {
+	case Marshaler:
+		return v.MarshalCQL(info)
+	case Duration:
+		d = v
+	case time.Duration:
+		d.Nanoseconds = int64(v)
+	default:
+		return nil, marshalErrorf("can not marshal %T into %s", value, info)
+	}
+
+	// the components of a duration must all have the same sign
+	if (d.Months < 0 || d.Days < 0 || d.Nanoseconds < 0) &&
+		(d.Months > 0 || d.Days > 0 || d.Nanoseconds > 0) {
+		return nil, marshalErrorf("marshal duration: components of %+v have different signs", d)
+	}
+
+	buf := make([]byte, 0, 3)
+	buf = encVint(buf, int64(d.Months))
+	buf = encVint(buf, int64(d.Days))
+	buf = encVint(buf, d.Nanoseconds)
+	return buf, nil
+}
+
+func unmarshalDuration(info TypeInfo, data []byte, value interface{}) error {
+	var d Duration
+	if len(data) > 0 {
+		var vals [3]int64
+		for i := range vals {
+			v, n, err := decVint(data)
+			if err != nil {
+				return err
+			}
+			vals[i] = v
+			data = data[n:]
+		}
+
+		if vals[0] < math.MinInt32 || vals[0] > math.MaxInt32 || vals[1] < math.MinInt32 || vals[1] > math.MaxInt32 {
+			return unmarshalErrorf("unmarshal duration: months or days out of range")
+		}
+		d = Duration{Months: int32(vals[0]), Days: int32(vals[1]), Nanoseconds: vals[2]}
+	}
+
+	switch v := value.(type) {
+	case *Duration:
+		*v = d
+		return nil
+	case *time.Duration:
+		if d.Months != 0 || d.Days != 0 {
+			return unmarshalErrorf("unmarshal duration: %+v can not be represented as a time.Duration", d)
+		}
+		*v = time.Duration(d.Nanoseconds)
+		return nil
+	}
+	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
+}
+
+// appendElement appends a single tuple or UDT element, encoded as [bytes], to
+// buf. A nil value is encoded as null.
+func appendElement(buf, data []byte) []byte {
+	if data == nil {
+		return append(buf, 0xff, 0xff, 0xff, 0xff)
+	}
+
+	n := len(data)
+	buf = append(buf, byte(n>>24),
+		byte(n>>16),
+		byte(n>>8),
+		byte(n))
+
+	return append(buf, data...)
+}
+
+// readElement reads the next [bytes] encoded tuple or UDT element from data.
+// The returned element is nil if it is null, or if it is absent which happens
+// when fields have been added to a UDT after the value was written.
+func readElement(data []byte) (elem, rest []byte, err error) {
+	if len(data) == 0 {
+		return nil, nil, nil
+	} else if len(data) < 4 {
+		return nil, nil, unmarshalErrorf("unmarshal: unexpected eof reading element")
+	}
+
+	size := int(readInt(data))
+	data = data[4:]
+	if size < 0 {
+		return nil, data, nil
+	} else if len(data) < size {
+		return nil, nil, unmarshalErrorf("unmarshal: unexpected eof reading element")
+	}
+
+	return data[:size], data[size:], nil
+}
+
+// tupleFields returns the fields of the struct v which are mapped to the
+// elements of a tuple, in declaration order. Unexported fields and fields
+// tagged with `cql:"-"` are skipped.
+func tupleFields(v reflect.Value) []reflect.Value {
+	t := v.Type()
+	fields := make([]reflect.Value, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("cql") == "-" {
+			continue
+		}
+		fields = append(fields, v.Field(i))
+	}
+	return fields
+}
+
+// marshalTuple marshals a tuple from either a []interface{} holding one value
+// per element or from a struct whose exported fields are mapped to the
+// elements of the tuple in declaration order.
+func marshalTuple(info TypeInfo, value interface{}) ([]byte, error) {
+	tuple := info.(TupleTypeInfo)
+
+	var elems []interface{}
+	switch v := value.(type) {
+	case Marshaler:
+		return v.MarshalCQL(info)
+	case nil:
+		return nil, nil
+	case []interface{}:
+		elems = v
+	default:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return nil, marshalErrorf("cannot marshal %T into %s", value, info)
+		}
+
+		for _, f := range tupleFields(rv) {
+			elems = append(elems, f.Interface())
+		}
+	}
+
+	if len(elems) != len(tuple.Elems) {
+		return nil, marshalErrorf("cannot marshal %T into %s: expected %d elements got %d",
+			value, info, len(tuple.Elems), len(elems))
+	}
+
+	var buf []byte
+	for i, elem := range tuple.Elems {
+		data, err := Marshal(elem, elems[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf = appendElement(buf, data)
+	}
+
+	return buf, nil
+}
+
+// scansWholeTuple reports whether dest, the value a tuple with a single
+// element is scanned into, receives the whole tuple rather than its element.
+// A struct receives the element when the element can be unmarshaled into a
+// struct, and a slice when the element is a collection.
+func scansWholeTuple(tuple TupleTypeInfo, dest interface{}) bool {
+	if len(tuple.Elems) != 1 || dest == nil {
+		return false
+	}
+
+	elem := tuple.Elems[0].Type()
+	switch dest.(type) {
+	case Unmarshaler:
+		return true
+	case []interface{}, *[]interface{}:
+		return elem != TypeList && elem != TypeSet
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	switch elem {
+	case TypeUDT, TypeTuple, TypeTimestamp, TypeDate, TypeVarint, TypeDecimal, TypeDuration:
+		return false
+	}
+	return true
+}
+
+// unmarshalTuple unmarshals a tuple into either a []interface{} holding one
+// pointer per element, a *[]interface{}, or a pointer to a struct whose
+// exported fields are mapped to the elements of the tuple in declaration
+// order. Nil entries of a []interface{} are skipped, which is what allows
+// Iter.Scan to expand a tuple into one destination per element.
 func unmarshalTuple(info TypeInfo, data []byte, value interface{}) error {
 	if v, ok := value.(Unmarshaler); ok {
 		return v.UnmarshalCQL(info, data)
@@ -1205,22 +1890,86 @@ func unmarshalTuple(info TypeInfo, data []byte, value interface{}) error {
 	tuple := info.(TupleTypeInfo)
 	switch v := value.(type) {
 	case []interface{}:
+		if len(v) != len(tuple.Elems) {
+			return unmarshalErrorf("cannot unmarshal %s into %T: expected %d elements got %d",
+				info, value, len(tuple.Elems), len(v))
+		}
+
 		for i, elem := range tuple.Elems {
-			// each element inside data is a [bytes]
-			size := readInt(data)
-			data = data[4:]
+			field, rest, err := readElement(data)
+			if err != nil {
+				return err
+			}
+			data = rest
+
+			if v[i] == nil {
+				continue
+			}
+			if err := Unmarshal(elem, field, v[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case *[]interface{}:
+		if data == nil {
+			*v = nil
+			return nil
+		}
 
-			err := Unmarshal(elem, data[:size], v[i])
+		values := make([]interface{}, len(tuple.Elems))
+		for i, elem := range tuple.Elems {
+			field, rest, err := readElement(data)
 			if err != nil {
 				return err
 			}
-			data = data[size:]
+			data = rest
+
+			val := elem.New()
+			if err := Unmarshal(elem, field, val); err != nil {
+				return err
+			}
+			values[i] = dereference(val)
 		}
+		*v = values
 
 		return nil
 	}
 
-	return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return unmarshalErrorf("can not unmarshal into non-pointer %T", value)
+	}
+
+	k := rv.Elem()
+	if k.Kind() != reflect.Struct {
+		return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
+	}
+
+	if data == nil {
+		k.Set(reflect.Zero(k.Type()))
+		return nil
+	}
+
+	fields := tupleFields(k)
+	if len(fields) != len(tuple.Elems) {
+		return unmarshalErrorf("cannot unmarshal %s into %T: expected %d elements got %d",
+			info, value, len(tuple.Elems), len(fields))
+	}
+
+	for i, elem := range tuple.Elems {
+		field, rest, err := readElement(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		if err := Unmarshal(elem, field, fields[i].Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // UDTMarshaler is an interface which should be implemented by users wishing to
@@ -1256,13 +2005,7 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 				return nil, err
 			}
 
-			n := len(data)
-			buf = append(buf, byte(n>>24),
-				byte(n>>16),
-				byte(n>>8),
-				byte(n))
-
-			buf = append(buf, data...)
+			buf = appendElement(buf, data)
 		}
 
 		return buf, nil
@@ -1279,13 +2022,7 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 				return nil, err
 			}
 
-			n := len(data)
-			buf = append(buf, byte(n>>24),
-				byte(n>>16),
-				byte(n>>8),
-				byte(n))
-
-			buf = append(buf, data...)
+			buf = appendElement(buf, data)
 		}
 
 		return buf, nil
@@ -1303,27 +2040,13 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, marshalErrorf("cannot marshal %T into %s", value, info)
 	}
 
-	fields := make(map[string]reflect.Value)
-	t := reflect.TypeOf(value)
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
-	}
+	fields := structFields(k, false)
 
 	var buf []byte
 	for _, e := range udt.Elements {
-		f, ok := fields[e.Name]
+		f, ok := lookupStructField(fields, e.Name)
 		if !ok {
-			f = k.FieldByName(e.Name)
-		}
-
-		if !f.IsValid() {
-			return nil, marshalErrorf("cannot marshal %T into %s", value, info)
-		} else if f.Kind() == reflect.Ptr {
-			f = f.Elem()
+			return nil, marshalErrorf("cannot marshal %T into %s: missing field %s", value, info, e.Name)
 		}
 
 		data, err := Marshal(e.Type, f.Interface())
@@ -1331,59 +2054,65 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 			return nil, err
 		}
 
-		n := len(data)
-		buf = append(buf, byte(n>>24),
-			byte(n>>16),
-			byte(n>>8),
-			byte(n))
-
-		buf = append(buf, data...)
+		buf = appendElement(buf, data)
 	}
 
 	return buf, nil
-
 }
 
 func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
+	udt := info.(UDTTypeInfo)
+
 	switch v := value.(type) {
 	case Unmarshaler:
 		return v.UnmarshalCQL(info, data)
 	case UDTUnmarshaler:
-		udt := info.(UDTTypeInfo)
-
 		for _, e := range udt.Elements {
-			size := readInt(data[:4])
-			data = data[4:]
-
-			var err error
-			if size < 0 {
-				err = v.UnmarshalUDT(e.Name, e.Type, nil)
-			} else {
-				err = v.UnmarshalUDT(e.Name, e.Type, data[:size])
-				data = data[size:]
+			field, rest, err := readElement(data)
+			if err != nil {
+				return err
+			}
+			data = rest
+
+			if err := v.UnmarshalUDT(e.Name, e.Type, field); err != nil {
+				return err
 			}
+		}
+
+		return nil
+	case *map[string]interface{}:
+		if data == nil {
+			*v = nil
+			return nil
+		}
 
+		m := make(map[string]interface{}, len(udt.Elements))
+		for _, e := range udt.Elements {
+			field, rest, err := readElement(data)
 			if err != nil {
 				return err
 			}
+			data = rest
+
+			val := e.Type.New()
+			if err := Unmarshal(e.Type, field, val); err != nil {
+				return err
+			}
+			m[e.Name] = dereference(val)
 		}
+		*v = m
 
 		return nil
 	}
 
-	k := reflect.ValueOf(value).Elem()
-	if k.Kind() != reflect.Struct || !k.IsValid() {
-		return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return unmarshalErrorf("can not unmarshal into non-pointer %T", value)
 	}
 
-	fields := make(map[string]reflect.Value)
-	t := k.Type()
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
+	k := rv.Elem()
+	if k.Kind() != reflect.Struct || !k.IsValid() {
+		return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
 	}
 
 	if len(data) == 0 {
@@ -1394,30 +2123,25 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 		return nil
 	}
 
-	udt := info.(UDTTypeInfo)
+	fields := structFields(k, true)
 	for _, e := range udt.Elements {
-		size := readInt(data[:4])
-		data = data[4:]
-
-		var err error
-		if size >= 0 {
-			f, ok := fields[e.Name]
-			if !ok {
-				f = k.FieldByName(e.Name)
-			}
+		field, rest, err := readElement(data)
+		if err != nil {
+			return err
+		}
+		data = rest
 
-			if !f.IsValid() || !f.CanAddr() {
-				return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
-			}
+		f, ok := lookupStructField(fields, e.Name)
+		if !ok || !f.CanAddr() {
+			return unmarshalErrorf("cannot unmarshal %s into %T: missing field %s", info, value, e.Name)
+		}
 
-			fk := f.Addr().Interface()
-			if err := Unmarshal(e.Type, data[:size], fk); err != nil {
-				return err
-			}
-			data = data[size:]
+		if field == nil {
+			f.Set(reflect.Zero(f.Type()))
+			continue
 		}
 
-		if err != nil {
+		if err := Unmarshal(e.Type, field, f.Addr().Interface()); err != nil {
 			return err
 		}
 	}
@@ -1442,7 +2166,16 @@ type NativeType struct {
 	custom string // only used for TypeCustom
 }
 
+// NewNativeType returns the type typ of protocol version proto, custom is the
+// class name of TypeCustom types.
+func NewNativeType(proto byte, typ Type, custom string) NativeType {
+	return NativeType{proto: proto, typ: typ, custom: custom}
+}
+
 func (t NativeType) New() interface{} {
+	if codec := lookupCodec(t); codec != nil {
+		return codec.New(t)
+	}
 	return reflect.New(goType(t)).Interface()
 }
 
@@ -1495,6 +2228,25 @@ type TupleTypeInfo struct {
 	Elems []TypeInfo
 }
 
+// New creates a pointer to an empty []interface{} which can hold the
+// elements of the tuple.
+func (t TupleTypeInfo) New() interface{} {
+	return reflect.New(goType(t)).Interface()
+}
+
+func (t TupleTypeInfo) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s(", t.typ)
+	for i, elem := range t.Elems {
+		if i > 0 {
+			fmt.Fprint(buf, ", ")
+		}
+		fmt.Fprint(buf, elem)
+	}
+	fmt.Fprint(buf, ")")
+	return buf.String()
+}
+
 type UDTField struct {
 	Name string
 	Type TypeInfo
@@ -1548,6 +2300,11 @@ const (
 	TypeVarint         = 0x000E
 	TypeTimeUUID       = 0x000F
 	TypeInet           = 0x0010
+	TypeDate           = 0x0011
+	TypeTime           = 0x0012
+	TypeSmallInt       = 0x0013
+	TypeTinyInt        = 0x0014
+	TypeDuration       = 0x0015
 	TypeList           = 0x0020
 	TypeMap            = 0x0021
 	TypeSet            = 0x0022
@@ -1588,6 +2345,16 @@ func (t Type) String() string {
 		return "timeuuid"
 	case TypeInet:
 		return "inet"
+	case TypeDate:
+		return "date"
+	case TypeTime:
+		return "time"
+	case TypeSmallInt:
+		return "smallint"
+	case TypeTinyInt:
+		return "tinyint"
+	case TypeDuration:
+		return "duration"
 	case TypeList:
 		return "list"
 	case TypeMap:
@@ -1598,6 +2365,8 @@ func (t Type) String() string {
 		return "varint"
 	case TypeTuple:
 		return "tuple"
+	case TypeUDT:
+		return "udt"
 	default:
 		return fmt.Sprintf("unknown_type_%d", t)
 	}
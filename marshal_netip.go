@@ -0,0 +1,44 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.18
+
+package gocql
+
+import "net/netip"
+
+// marshalNetipAddr marshals a netip.Addr into an inet, ok is false if value
+// is not a netip.Addr.
+func marshalNetipAddr(value interface{}) (data []byte, ok bool, err error) {
+	addr, ok := value.(netip.Addr)
+	if !ok {
+		return nil, false, nil
+	}
+	if !addr.IsValid() {
+		return nil, true, nil
+	}
+	// IPv4 mapped IPv6 addresses are sent as their 4 byte representation
+	// like net.IP
+	addr = addr.Unmap()
+	return addr.AsSlice(), true, nil
+}
+
+// unmarshalNetipAddr unmarshals an inet into a *netip.Addr, ok is false if
+// value is not a *netip.Addr.
+func unmarshalNetipAddr(data []byte, value interface{}) (ok bool, err error) {
+	v, ok := value.(*netip.Addr)
+	if !ok {
+		return false, nil
+	}
+	if len(data) == 0 {
+		*v = netip.Addr{}
+		return true, nil
+	}
+	addr, ok := netip.AddrFromSlice(data)
+	if !ok {
+		return true, unmarshalErrorf("unmarshal inet: invalid length %d", len(data))
+	}
+	*v = addr.Unmap()
+	return true, nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !go1.18
+
+package gocql
+
+func marshalNetipAddr(value interface{}) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func unmarshalNetipAddr(data []byte, value interface{}) (bool, error) {
+	return false, nil
+}
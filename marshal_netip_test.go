@@ -0,0 +1,38 @@
+// +build all unit
+// +build go1.18
+
+package gocql
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestMarshalNetipAddr(t *testing.T) {
+	info := NativeType{proto: 2, typ: TypeInet}
+
+	for _, test := range []struct {
+		Addr netip.Addr
+		Data []byte
+	}{
+		{netip.MustParseAddr("127.0.0.1"), []byte("\x7F\x00\x00\x01")},
+		{netip.MustParseAddr("::ffff:127.0.0.1"), []byte("\x7F\x00\x00\x01")},
+		{netip.MustParseAddr("21da:d3:0:2f3b:2aa:ff:fe28:9c5a"), []byte("\x21\xDA\x00\xd3\x00\x00\x2f\x3b\x02\xaa\x00\xff\xfe\x28\x9c\x5a")},
+		{netip.Addr{}, nil},
+	} {
+		data, err := Marshal(info, test.Addr)
+		if err != nil {
+			t.Errorf("marshal %v: %v", test.Addr, err)
+		} else if !bytes.Equal(data, test.Data) {
+			t.Errorf("marshal %v: expected %x got %x", test.Addr, test.Data, data)
+		}
+
+		var addr netip.Addr
+		if err := Unmarshal(info, test.Data, &addr); err != nil {
+			t.Errorf("unmarshal %x: %v", test.Data, err)
+		} else if addr != test.Addr.Unmap() {
+			t.Errorf("unmarshal %x: expected %v got %v", test.Data, test.Addr.Unmap(), addr)
+		}
+	}
+}
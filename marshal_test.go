@@ -4,6 +4,8 @@ package gocql
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"math"
 	"math/big"
 	"net"
@@ -213,6 +215,91 @@ var marshalTests = []struct {
 		[]byte("\x00\x00\x00\x14\xff\x052"),
 		decimalize("-0.00000000000000064206"), // From the datastax/python-driver test suite
 	},
+	{
+		NativeType{proto: 2, typ: TypeDecimal},
+		[]byte("\x00\x00\x00\x02\x19"),
+		"0.25",
+	},
+	{
+		NativeType{proto: 2, typ: TypeDecimal},
+		[]byte("\x00\x00\x00\x06\xe5\xde]\x98Y"),
+		"-112233.441191",
+	},
+	{
+		NativeType{proto: 3, typ: TypeSmallInt},
+		[]byte("\x7f\xff"),
+		int16(math.MaxInt16),
+	},
+	{
+		NativeType{proto: 3, typ: TypeSmallInt},
+		[]byte("\x80\x00"),
+		int(math.MinInt16),
+	},
+	{
+		NativeType{proto: 3, typ: TypeSmallInt},
+		[]byte("\xff\xfe"),
+		"-2",
+	},
+	{
+		NativeType{proto: 3, typ: TypeTinyInt},
+		[]byte("\x7f"),
+		int8(math.MaxInt8),
+	},
+	{
+		NativeType{proto: 3, typ: TypeTinyInt},
+		[]byte("\x80"),
+		int64(math.MinInt8),
+	},
+	{
+		NativeType{proto: 3, typ: TypeTinyInt},
+		[]byte("\x7e"),
+		uint16(126),
+	},
+	{
+		NativeType{proto: 3, typ: TypeDate},
+		[]byte("\x80\x00\x00\x00"),
+		Date{Year: 1970, Month: time.January, Day: 1},
+	},
+	{
+		NativeType{proto: 3, typ: TypeDate},
+		[]byte("\x7f\xff\xff\xff"),
+		Date{Year: 1969, Month: time.December, Day: 31},
+	},
+	{
+		NativeType{proto: 3, typ: TypeDate},
+		[]byte("\x80\x00\x40\x55"),
+		time.Date(2015, time.February, 3, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		NativeType{proto: 3, typ: TypeDate},
+		[]byte("\x80\x00\x40\x55"),
+		"2015-02-03",
+	},
+	{
+		NativeType{proto: 3, typ: TypeTime},
+		[]byte("\x00\x00\x36\xd7\xb0\x14\x78\x00"),
+		16*time.Hour + 45*time.Minute,
+	},
+	{
+		NativeType{proto: 3, typ: TypeDuration},
+		[]byte("\x02\x04\x80\xf0"),
+		Duration{Months: 1, Days: 2, Nanoseconds: 120},
+	},
+	{
+		NativeType{proto: 3, typ: TypeDuration},
+		[]byte("\x01\x03\xfc\x27\x4a\x48\xa7\x7f\xff"),
+		Duration{Months: -1, Days: -2, Nanoseconds: -6 * int64(time.Hour)},
+	},
+	{
+		NativeType{proto: 3, typ: TypeDuration},
+		[]byte("\x00\x00\xf0\x77\x35\x94\x00"),
+		time.Second,
+	},
+	{
+		NativeType{proto: 2, typ: TypeDecimal},
+		[]byte(nil),
+		(*inf.Dec)(nil),
+	},
 	{
 		NativeType{proto: 2, typ: TypeDecimal},
 		[]byte("\xff\xff\xff\x9c\x00\xfa\xce"),
@@ -646,6 +733,11 @@ func TestMarshalVarint(t *testing.T) {
 			Marshaled:   []byte("\xFF\x7F\xFF\xFF\xFF\xFF\xFF\xFF\xFF"),
 			Unmarshaled: bigintize("-9223372036854775809"),
 		},
+		{
+			Value:       "-2361183241434822606848", // -2**71
+			Marshaled:   []byte("\x80\x00\x00\x00\x00\x00\x00\x00\x00"),
+			Unmarshaled: bigintize("-2361183241434822606848"),
+		},
 	}
 
 	for i, test := range varintTests {
@@ -667,6 +759,29 @@ func TestMarshalVarint(t *testing.T) {
 		if test.Unmarshaled.Cmp(binder) != 0 {
 			t.Errorf("unmarshaled varint mismatch: expected %v, got %v (test #%d)", test.Unmarshaled, binder, i)
 		}
+
+		var str string
+		err = Unmarshal(NativeType{proto: 2, typ: TypeVarint}, test.Marshaled, &str)
+		if err != nil {
+			t.Errorf("error unmarshaling varint into string: %v (test #%d)", err, i)
+		} else if str != test.Unmarshaled.String() {
+			t.Errorf("unmarshaled varint mismatch: expected %v, got %v (test #%d)", test.Unmarshaled, str, i)
+		}
+	}
+
+	var u uint64
+	err := Unmarshal(NativeType{proto: 2, typ: TypeVarint}, []byte("\x00\xFF\xFF\xFF\xFF\xFF\xFF\xFF\xFF"), &u)
+	if err != nil {
+		t.Error(err)
+	} else if u != math.MaxUint64 {
+		t.Errorf("expected %d got %d", uint64(math.MaxUint64), u)
+	}
+
+	var n int
+	if err := Unmarshal(NativeType{proto: 2, typ: TypeVarint}, nil, &n); err != nil {
+		t.Error(err)
+	} else if n != 0 {
+		t.Errorf("expected null varint to unmarshal to 0 got %d", n)
 	}
 }
 
@@ -760,6 +875,11 @@ var typeLookupTest = []struct {
 	{"MapType", TypeMap},
 	{"ListType", TypeList},
 	{"SetType", TypeSet},
+	{"ShortType", TypeSmallInt},
+	{"ByteType", TypeTinyInt},
+	{"SimpleDateType", TypeDate},
+	{"TimeType", TypeTime},
+	{"DurationType", TypeDuration},
 	{"unknown", TypeCustom},
 }
 
@@ -795,6 +915,54 @@ func TestMarshalPointer(t *testing.T) {
 	}
 }
 
+// money is stored as a decimal with a scale of 2.
+type money int64
+
+func (m *money) MarshalCQL(info TypeInfo) ([]byte, error) {
+	return Marshal(info, inf.NewDec(int64(*m), 2))
+}
+
+func (m *money) UnmarshalCQL(info TypeInfo, data []byte) error {
+	dec := new(inf.Dec)
+	if err := Unmarshal(info, data, dec); err != nil {
+		return err
+	}
+	*m = money(dec.SetScale(2).UnscaledBig().Int64())
+	return nil
+}
+
+func TestMarshalerPointerReceiver(t *testing.T) {
+	typ := NativeType{proto: 3, typ: TypeDecimal}
+	expected := []byte("\x00\x00\x00\x02\x04\xd2")
+
+	m := money(1234)
+	for _, value := range []interface{}{m, &m, []money{m}} {
+		info := TypeInfo(typ)
+		if _, ok := value.([]money); ok {
+			info = CollectionType{
+				NativeType: NativeType{proto: 3, typ: TypeList},
+				Elem:       typ,
+			}
+		}
+
+		data, err := Marshal(info, value)
+		if err != nil {
+			t.Errorf("marshal %T: %v", value, err)
+			continue
+		}
+		if !bytes.Contains(data, expected) {
+			t.Errorf("marshal %T: expected %x to contain %x", value, data, expected)
+		}
+	}
+
+	var out money
+	if err := Unmarshal(typ, expected, &out); err != nil {
+		t.Fatal(err)
+	} else if out != m {
+		t.Errorf("expected %d got %d", m, out)
+	}
+}
+
 func TestMarshalTimestamp(t *testing.T) {
 	var marshalTimestampTests = []struct {
 		Info  TypeInfo
@@ -860,3 +1028,503 @@ func TestMarshalTimestamp(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalUDT(t *testing.T) {
+	point := UDTTypeInfo{
+		NativeType: NativeType{proto: 3, typ: TypeUDT},
+		Name:       "point",
+		Elements: []UDTField{
+			{"x", NativeType{proto: 3, typ: TypeInt}},
+			{"y", NativeType{proto: 3, typ: TypeInt}},
+		},
+	}
+	shape := UDTTypeInfo{
+		NativeType: NativeType{proto: 3, typ: TypeUDT},
+		Name:       "shape",
+		Elements: []UDTField{
+			{"name", NativeType{proto: 3, typ: TypeVarchar}},
+			{"origin", point},
+		},
+	}
+
+	type Point struct {
+		X int `cql:"x"`
+		Y int `cql:"y"`
+	}
+	type Shape struct {
+		Name   string
+		Origin *Point `cql:"origin"`
+	}
+
+	expected := []byte("\x00\x00\x00\x03box" +
+		"\x00\x00\x00\x10\x00\x00\x00\x04\x00\x00\x00\x01\x00\x00\x00\x04\x00\x00\x00\x02")
+
+	for _, value := range []interface{}{
+		Shape{Name: "box", Origin: &Point{1, 2}},
+		&Shape{Name: "box", Origin: &Point{1, 2}},
+		map[string]interface{}{"name": "box", "origin": map[string]interface{}{"x": 1, "y": 2}},
+	} {
+		data, err := Marshal(shape, value)
+		if err != nil {
+			t.Errorf("marshal %#v: %v", value, err)
+			continue
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("marshal %#v: expected %x, got %x", value, expected, data)
+		}
+	}
+
+	var s Shape
+	if err := Unmarshal(shape, expected, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "box" || s.Origin == nil || *s.Origin != (Point{1, 2}) {
+		t.Errorf("unmarshal: got %+v", s)
+	}
+
+	var m map[string]interface{}
+	if err := Unmarshal(shape, expected, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{
+		"name":   "box",
+		"origin": map[string]interface{}{"x": 1, "y": 2},
+	}) {
+		t.Errorf("unmarshal into map: got %v", m)
+	}
+
+	// a null origin followed by a field missing from the data
+	nulls := []byte("\x00\x00\x00\x03box\xff\xff\xff\xff")
+	s = Shape{Origin: &Point{3, 4}}
+	if err := Unmarshal(shape, nulls, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "box" || s.Origin != nil {
+		t.Errorf("unmarshal nulls: got %+v", s)
+	}
+
+	data, err := Marshal(shape, Shape{Name: "box"})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, nulls) {
+		t.Errorf("marshal null field: expected %x, got %x", nulls, data)
+	}
+
+	if _, err := Marshal(shape, map[string]interface{}{"name": "box"}); err == nil {
+		t.Error("expected error marshaling map with missing field")
+	}
+	if err := Unmarshal(shape, expected[:6], &s); err == nil {
+		t.Error("expected error unmarshaling truncated data")
+	}
+}
+
+func TestMarshalTuple(t *testing.T) {
+	info := TupleTypeInfo{
+		NativeType: NativeType{proto: 3, typ: TypeTuple},
+		Elems: []TypeInfo{
+			NativeType{proto: 3, typ: TypeVarchar},
+			NativeType{proto: 3, typ: TypeInt},
+		},
+	}
+
+	type pair struct {
+		Name    string
+		Value   int
+		Ignored bool `cql:"-"`
+	}
+
+	expected := []byte("\x00\x00\x00\x03foo\x00\x00\x00\x04\x00\x00\x00\x2a")
+
+	for _, value := range []interface{}{
+		[]interface{}{"foo", 42},
+		pair{"foo", 42, true},
+		&pair{"foo", 42, false},
+	} {
+		data, err := Marshal(info, value)
+		if err != nil {
+			t.Errorf("marshal %#v: %v", value, err)
+			continue
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("marshal %#v: expected %x, got %x", value, expected, data)
+		}
+	}
+
+	if _, err := Marshal(info, []interface{}{"foo"}); err == nil {
+		t.Error("expected error marshaling a tuple with missing elements")
+	}
+
+	var p pair
+	if err := Unmarshal(info, expected, &p); err != nil {
+		t.Fatal(err)
+	} else if p != (pair{Name: "foo", Value: 42}) {
+		t.Errorf("unmarshal into struct: got %+v", p)
+	}
+
+	var values []interface{}
+	if err := Unmarshal(info, expected, &values); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(values, []interface{}{"foo", 42}) {
+		t.Errorf("unmarshal into []interface{}: got %v", values)
+	}
+
+	var name string
+	if err := Unmarshal(info, expected, []interface{}{&name, nil}); err != nil {
+		t.Fatal(err)
+	} else if name != "foo" {
+		t.Errorf("unmarshal into positional values: got %q", name)
+	}
+
+	if err := Unmarshal(info, expected[:6], &p); err == nil {
+		t.Error("expected error unmarshaling truncated data")
+	}
+
+	// tuples nested in a collection
+	list := CollectionType{
+		NativeType: NativeType{proto: 3, typ: TypeList},
+		Elem:       info,
+	}
+	data, err := Marshal(list, []pair{{"foo", 42, false}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs [][]interface{}
+	if err := Unmarshal(list, data, &pairs); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(pairs, [][]interface{}{{"foo", 42}}) {
+		t.Errorf("unmarshal list of tuples: got %v", pairs)
+	}
+}
+
+func TestScanTuple(t *testing.T) {
+	info := TupleTypeInfo{
+		NativeType: NativeType{proto: 3, typ: TypeTuple},
+		Elems: []TypeInfo{
+			NativeType{proto: 3, typ: TypeInt},
+			NativeType{proto: 3, typ: TypeInt},
+		},
+	}
+	newIter := func() *Iter {
+		return &Iter{
+			meta: resultMetadata{
+				columns: []ColumnInfo{
+					{Name: "id", TypeInfo: NativeType{proto: 3, typ: TypeInt}},
+					{Name: "coord", TypeInfo: info},
+				},
+				actualColCount: 3,
+			},
+			rows: [][][]byte{
+				{encInt(1), []byte("\x00\x00\x00\x04\x00\x00\x00\x02\x00\x00\x00\x04\x00\x00\x00\x03")},
+			},
+		}
+	}
+
+	var id, y int
+	if iter := newIter(); !iter.Scan(&id, nil, &y) {
+		t.Fatal(iter.Close())
+	} else if id != 1 || y != 3 {
+		t.Errorf("expanded scan: got id=%d y=%d", id, y)
+	}
+
+	var coord struct{ X, Y int }
+	if iter := newIter(); !iter.Scan(nil, &coord) {
+		t.Fatal(iter.Close())
+	} else if coord.X != 2 || coord.Y != 3 {
+		t.Errorf("scan into struct: got %+v", coord)
+	}
+
+	if iter := newIter(); iter.Scan(&id) {
+		t.Error("expected count mismatch")
+	}
+
+	// a tuple with a single element has as many values in both forms
+	single := TupleTypeInfo{
+		NativeType: NativeType{proto: 3, typ: TypeTuple},
+		Elems:      []TypeInfo{NativeType{proto: 3, typ: TypeInt}},
+	}
+	iter := &Iter{
+		meta: resultMetadata{
+			columns:        []ColumnInfo{{Name: "v", TypeInfo: single}},
+			actualColCount: 1,
+		},
+		rows: [][][]byte{
+			{[]byte("\x00\x00\x00\x04\x00\x00\x00\x07")},
+			{[]byte("\x00\x00\x00\x04\x00\x00\x00\x08")},
+		},
+	}
+
+	var v int
+	if !iter.Scan(&v) {
+		t.Fatal(iter.Close())
+	} else if v != 7 {
+		t.Errorf("expanded scan of a single element tuple: got %d", v)
+	}
+
+	var whole struct{ V int }
+	if !iter.Scan(&whole) {
+		t.Fatal(iter.Close())
+	} else if whole.V != 8 {
+		t.Errorf("scan of a single element tuple into struct: got %+v", whole)
+	}
+}
+
+func TestMarshalNestedCollections(t *testing.T) {
+	for _, proto := range []byte{2, 3} {
+		info := CollectionType{
+			NativeType: NativeType{proto: proto, typ: TypeMap},
+			Key:        NativeType{proto: proto, typ: TypeVarchar},
+			Elem: CollectionType{
+				NativeType: NativeType{proto: proto, typ: TypeList},
+				Elem:       NativeType{proto: proto, typ: TypeInt},
+			},
+		}
+
+		value := map[string][]int{"a": {1, 2}}
+		data, err := Marshal(info, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var expected []byte
+		if proto == 2 {
+			expected = []byte("\x00\x01\x00\x01a\x00\x0e\x00\x02\x00\x04\x00\x00\x00\x01\x00\x04\x00\x00\x00\x02")
+		} else {
+			expected = []byte("\x00\x00\x00\x01\x00\x00\x00\x01a\x00\x00\x00\x14" +
+				"\x00\x00\x00\x02\x00\x00\x00\x04\x00\x00\x00\x01\x00\x00\x00\x04\x00\x00\x00\x02")
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("proto %d: expected %x, got %x", proto, expected, data)
+		}
+
+		var out map[string][]int
+		if err := Unmarshal(info, data, &out); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(out, value) {
+			t.Errorf("proto %d: expected %v, got %v", proto, value, out)
+		}
+
+		for i := 1; i < len(data); i++ {
+			if err := Unmarshal(info, data[:i], &out); err == nil {
+				t.Errorf("proto %d: expected error unmarshaling %d bytes of truncated data", proto, i)
+			}
+		}
+	}
+}
+
+func TestMarshalSet(t *testing.T) {
+	info := CollectionType{
+		NativeType: NativeType{proto: 3, typ: TypeSet},
+		Elem:       NativeType{proto: 3, typ: TypeVarchar},
+	}
+	expected := []byte("\x00\x00\x00\x01\x00\x00\x00\x01a")
+
+	for _, value := range []interface{}{
+		[]string{"a"},
+		map[string]struct{}{"a": {}},
+		map[string]bool{"a": true, "b": false},
+	} {
+		data, err := Marshal(info, value)
+		if err != nil {
+			t.Errorf("marshal %#v: %v", value, err)
+		} else if !bytes.Equal(data, expected) {
+			t.Errorf("marshal %#v: expected %x, got %x", value, expected, data)
+		}
+	}
+
+	var set map[string]struct{}
+	if err := Unmarshal(info, expected, &set); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(set, map[string]struct{}{"a": {}}) {
+		t.Errorf("unmarshal into map[string]struct{}: got %v", set)
+	}
+
+	var flags map[string]bool
+	if err := Unmarshal(info, expected, &flags); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(flags, map[string]bool{"a": true}) {
+		t.Errorf("unmarshal into map[string]bool: got %v", flags)
+	}
+}
+
+func TestUnmarshalDecimal(t *testing.T) {
+	info := NativeType{proto: 2, typ: TypeDecimal}
+
+	var rat big.Rat
+	if err := Unmarshal(info, []byte("\x00\x00\x00\x02\x19"), &rat); err != nil {
+		t.Fatal(err)
+	} else if rat.Cmp(big.NewRat(1, 4)) != 0 {
+		t.Errorf("expected 1/4 got %v", &rat)
+	}
+
+	// a negative scale multiplies the unscaled value
+	if err := Unmarshal(info, []byte("\xff\xff\xff\xfe\x19"), &rat); err != nil {
+		t.Fatal(err)
+	} else if rat.Cmp(big.NewRat(2500, 1)) != 0 {
+		t.Errorf("expected 2500 got %v", &rat)
+	}
+
+	var dec inf.Dec
+	if err := Unmarshal(info, []byte("\x00\x00"), &dec); err == nil {
+		t.Error("expected an error unmarshaling truncated data")
+	}
+
+	data, err := Marshal(info, *big.NewInt(-1))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, []byte("\x00\x00\x00\x00\xff")) {
+		t.Errorf("marshal big.Int: got %x", data)
+	}
+
+	if _, err := Marshal(info, "not a number"); err == nil {
+		t.Error("expected an error marshaling an invalid decimal string")
+	}
+}
+
+func TestMarshalDuration(t *testing.T) {
+	info := NativeType{proto: 3, typ: TypeDuration}
+
+	for _, v := range []int64{0, 1, -1, 63, -64, 64, 1 << 20, -1 << 40, math.MaxInt64, math.MinInt64} {
+		data := encVint(nil, v)
+		got, n, err := decVint(data)
+		if err != nil {
+			t.Errorf("decVint(%x): %v", data, err)
+		} else if got != v || n != len(data) {
+			t.Errorf("vint %d: decoded %d from %d of %d bytes", v, got, n, len(data))
+		}
+	}
+
+	if _, err := Marshal(info, Duration{Months: 1, Days: -1}); err == nil {
+		t.Error("expected an error marshaling a duration with mixed signs")
+	}
+
+	var d time.Duration
+	if err := Unmarshal(info, []byte("\x02\x00\x00"), &d); err == nil {
+		t.Error("expected an error unmarshaling a duration with months into a time.Duration")
+	}
+
+	var dur Duration
+	if err := Unmarshal(info, []byte("\x02\x04\x80"), &dur); err == nil {
+		t.Error("expected an error unmarshaling truncated data")
+	}
+}
+
+func TestMarshalDateTime(t *testing.T) {
+	date := NativeType{proto: 3, typ: TypeDate}
+
+	// the date is taken in the location of the time, not in UTC
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	data, err := Marshal(date, time.Date(2015, time.February, 3, 8, 0, 0, 0, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d Date
+	if err := Unmarshal(date, data, &d); err != nil {
+		t.Fatal(err)
+	} else if d != (Date{2015, time.February, 3}) {
+		t.Errorf("expected 2015-02-03 got %v", d)
+	}
+
+	if err := Unmarshal(date, []byte("\x80\x00"), &d); err == nil {
+		t.Error("expected an error unmarshaling a date of invalid length")
+	}
+
+	tm := NativeType{proto: 3, typ: TypeTime}
+	for _, v := range []time.Duration{-1, 24 * time.Hour} {
+		if _, err := Marshal(tm, v); err == nil {
+			t.Errorf("expected an error marshaling time %v", v)
+		}
+	}
+}
+
+func TestMarshalSmallIntRange(t *testing.T) {
+	smallint := NativeType{proto: 3, typ: TypeSmallInt}
+	tinyint := NativeType{proto: 3, typ: TypeTinyInt}
+
+	for _, test := range []struct {
+		Info  TypeInfo
+		Value interface{}
+	}{
+		{smallint, math.MaxInt16 + 1},
+		{smallint, math.MinInt16 - 1},
+		{smallint, uint64(math.MaxUint64)},
+		{smallint, "40000"},
+		{tinyint, 128},
+		{tinyint, int16(-129)},
+		{tinyint, "x"},
+	} {
+		if _, err := Marshal(test.Info, test.Value); err == nil {
+			t.Errorf("expected an error marshaling %T(%v) into %s", test.Value, test.Value, test.Info)
+		}
+	}
+
+	var i8 int8
+	if err := Unmarshal(smallint, []byte("\x01\x00"), &i8); err == nil {
+		t.Error("expected an error unmarshaling 256 into an int8")
+	}
+	var u8 uint8
+	if err := Unmarshal(tinyint, []byte("\xff"), &u8); err == nil {
+		t.Error("expected an error unmarshaling -1 into an uint8")
+	}
+	if err := Unmarshal(tinyint, []byte("\x00\x01"), &i8); err == nil {
+		t.Error("expected an error unmarshaling a tinyint of invalid length")
+	}
+}
+
+func TestUnmarshalInet(t *testing.T) {
+	info := NativeType{proto: 2, typ: TypeInet}
+
+	data := []byte("\x7F\x00\x00\x01")
+	var ip net.IP
+	if err := Unmarshal(info, data, &ip); err != nil {
+		t.Fatal(err)
+	}
+	// the unmarshaled address must not share memory with the frame
+	data[0] = 10
+	if !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("expected 127.0.0.1 got %v", ip)
+	}
+
+	if err := Unmarshal(info, nil, &ip); err != nil {
+		t.Fatal(err)
+	} else if ip != nil {
+		t.Errorf("expected a null inet to unmarshal to nil got %v", ip)
+	}
+
+	if err := Unmarshal(info, []byte("\x7F\x00\x01"), &ip); err == nil {
+		t.Error("expected an error unmarshaling an inet of invalid length")
+	}
+
+	// the Unmarshaler implementations validate the data themselves
+	var custom CustomString
+	if err := Unmarshal(info, []byte("HOST"), &custom); err != nil {
+		t.Fatal(err)
+	} else if custom != "host" {
+		t.Errorf("expected the inet to be unmarshaled by UnmarshalCQL got %q", custom)
+	}
+
+	if _, err := Marshal(info, net.IP{1, 2, 3}); err == nil {
+		t.Error("expected an error marshaling an invalid net.IP")
+	}
+}
+
+func TestUnmarshalBlobReader(t *testing.T) {
+	info := NativeType{proto: 2, typ: TypeBlob}
+	data := []byte("a large blob")
+
+	var r io.Reader
+	if err := Unmarshal(info, data, &r); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, data) {
+		t.Errorf("expected %q got %q", data, b)
+	}
+
+	if err := Unmarshal(info, nil, &r); err != nil {
+		t.Fatal(err)
+	} else if r != nil {
+		t.Errorf("expected a null blob to unmarshal to a nil reader got %v", r)
+	}
+}
@@ -8,19 +8,25 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 )
 
-// schema metadata for a keyspace
+// schema metadata for a keyspace, the views, types, functions and aggregates
+// are only known for Cassandra 3.0 and later, see system_schema
 type KeyspaceMetadata struct {
 	Name            string
 	DurableWrites   bool
 	StrategyClass   string
 	StrategyOptions map[string]interface{}
 	Tables          map[string]*TableMetadata
+	Views           map[string]*ViewMetadata
+	Types           map[string]*TypeMetadata
+	// Functions and Aggregates are keyed by their signature, for instance
+	// avg(int), as they may be overloaded
+	Functions  map[string]*FunctionMetadata
+	Aggregates map[string]*AggregateMetadata
 }
 
 // schema metadata for a table (a.k.a. column family)
@@ -37,6 +43,26 @@ type TableMetadata struct {
 	ClusteringColumns []*ColumnMetadata
 	Columns           map[string]*ColumnMetadata
 	OrderedColumns    []string
+	Indexes           map[string]*IndexMetadata
+	// Options are only known for Cassandra 3.0 and later
+	Options TableOptions
+}
+
+// the options of a table or materialized view set with the WITH clause of
+// CREATE TABLE, the maps hold the sub-options of the options taking a map
+type TableOptions struct {
+	BloomFilterFpChance     float64
+	Caching                 map[string]string
+	Comment                 string
+	Compaction              map[string]string
+	Compression             map[string]string
+	CrcCheckChance          float64
+	DefaultTimeToLive       int
+	GcGraceSeconds          int
+	MaxIndexInterval        int
+	MemtableFlushPeriodInMs int
+	MinIndexInterval        int
+	SpeculativeRetry        string
 }
 
 // schema metadata for a column
@@ -52,6 +78,90 @@ type ColumnMetadata struct {
 	Index          ColumnIndexMetadata
 }
 
+// schema metadata for a materialized view, its columns are described like the
+// columns of a table
+type ViewMetadata struct {
+	TableMetadata
+	BaseTable         string
+	IncludeAllColumns bool
+	WhereClause       string
+}
+
+// schema metadata for a user defined type
+type TypeMetadata struct {
+	Keyspace   string
+	Name       string
+	FieldNames []string
+	FieldTypes []TypeInfo
+}
+
+// schema metadata for a user defined function
+type FunctionMetadata struct {
+	Keyspace          string
+	Name              string
+	ArgumentNames     []string
+	ArgumentTypes     []TypeInfo
+	ReturnType        TypeInfo
+	Language          string
+	Body              string
+	CalledOnNullInput bool
+}
+
+// schema metadata for a user defined aggregate, the state and final functions
+// are keyed by their signature in the Functions of the keyspace
+type AggregateMetadata struct {
+	Keyspace      string
+	Name          string
+	ArgumentTypes []TypeInfo
+	ReturnType    TypeInfo
+	StateFunc     string
+	StateType     TypeInfo
+	// FinalFunc is empty when the aggregate has no final function
+	FinalFunc string
+	// InitCond is the CQL literal of the initial state, empty when the
+	// initial state is null
+	InitCond string
+}
+
+// schema metadata for a secondary index of a table
+type IndexMetadata struct {
+	Keyspace string
+	Table    string
+	Name     string
+	// Kind is KEYS, COMPOSITES or CUSTOM, the storage-attached indexes are
+	// CUSTOM indexes, see StorageAttached
+	Kind string
+	// Target is the indexed column as given when creating the index, the
+	// columns of a collection type are wrapped in keys(), values(),
+	// entries() or full()
+	Target string
+	// Column is the name of the indexed column
+	Column  string
+	Options map[string]string
+}
+
+// StorageAttached returns true if the index is a storage-attached index
+// (SAI) rather than a legacy secondary index.
+func (i *IndexMetadata) StorageAttached() bool {
+	class := i.Options["class_name"]
+	return strings.HasSuffix(class, "StorageAttachedIndex") || strings.EqualFold(class, "sai")
+}
+
+// indexTargetColumn returns the name of the column of an index target.
+func indexTargetColumn(target string) string {
+	if open := strings.IndexByte(target, '('); open > 0 && strings.HasSuffix(target, ")") {
+		switch strings.ToLower(target[:open]) {
+		case "keys", "values", "entries", "full":
+			target = target[open+1 : len(target)-1]
+		}
+	}
+
+	if len(target) >= 2 && target[0] == '"' && target[len(target)-1] == '"' {
+		return strings.Replace(target[1:len(target)-1], `""`, `"`, -1)
+	}
+	return target
+}
+
 // the ordering of the column with regard to its comparator
 type ColumnOrder bool
 
@@ -71,6 +181,7 @@ const (
 	PARTITION_KEY  = "partition_key"
 	CLUSTERING_KEY = "clustering_key"
 	REGULAR        = "regular"
+	STATIC         = "static"
 	COMPACT_VALUE  = "compact_value"
 )
 
@@ -87,6 +198,9 @@ type schemaDescriber struct {
 	mu      sync.Mutex
 
 	cache map[string]*KeyspaceMetadata
+	// legacySchema is set once the cluster is found to have no
+	// system_schema keyspace, which was added in Cassandra 3.0
+	legacySchema bool
 }
 
 // creates a session bound schema describer which will query and cache
@@ -104,8 +218,6 @@ func (s *schemaDescriber) getSchema(keyspaceName string) (*KeyspaceMetadata, err
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// TODO handle schema change events
-
 	metadata, found := s.cache[keyspaceName]
 	if !found {
 		// refresh the cache for this keyspace
@@ -120,9 +232,36 @@ func (s *schemaDescriber) getSchema(keyspaceName string) (*KeyspaceMetadata, err
 	return metadata, nil
 }
 
+// removes the cached KeyspaceMetadata for the named keyspace, it is fetched
+// again on the next call to getSchema.
+func (s *schemaDescriber) clearSchema(keyspaceName string) {
+	s.mu.Lock()
+	delete(s.cache, keyspaceName)
+	s.mu.Unlock()
+}
+
+// removes the cached KeyspaceMetadata of every keyspace.
+func (s *schemaDescriber) clearAll() {
+	s.mu.Lock()
+	s.cache = map[string]*KeyspaceMetadata{}
+	s.mu.Unlock()
+}
+
 // forcibly updates the current KeyspaceMetadata held by the schema describer
 // for a given named keyspace.
 func (s *schemaDescriber) refreshSchema(keyspaceName string) error {
+	if !s.legacySchema {
+		keyspace, err := getSystemSchemaMetadata(s.session, keyspaceName)
+		if err == nil {
+			s.cache[keyspaceName] = keyspace
+			return nil
+		}
+		if err != errNoSystemSchema {
+			return err
+		}
+		s.legacySchema = true
+	}
+
 	var err error
 
 	// query the system keyspace for schema data
@@ -141,7 +280,7 @@ func (s *schemaDescriber) refreshSchema(keyspaceName string) error {
 	}
 
 	// organize the schema data
-	compileMetadata(s.session.cfg.ProtoVersion, keyspace, tables, columns)
+	compileMetadata(s.session.cfg.ProtoVersion, keyspace, tables, columns, s.session.cfg.logger())
 
 	// update the cache
 	s.cache[keyspaceName] = keyspace
@@ -159,10 +298,12 @@ func compileMetadata(
 	keyspace *KeyspaceMetadata,
 	tables []TableMetadata,
 	columns []ColumnMetadata,
+	logger Logger,
 ) {
 	keyspace.Tables = make(map[string]*TableMetadata)
 	for i := range tables {
 		tables[i].Columns = make(map[string]*ColumnMetadata)
+		tables[i].Indexes = make(map[string]*IndexMetadata)
 
 		keyspace.Tables[tables[i].Name] = &tables[i]
 	}
@@ -170,7 +311,7 @@ func compileMetadata(
 	// add columns from the schema data
 	for i := range columns {
 		// decode the validator for TypeInfo and order
-		validatorParsed := parseType(columns[i].Validator)
+		validatorParsed := parseType(columns[i].Validator, logger)
 		columns[i].Type = validatorParsed.types[0]
 		columns[i].Order = ASC
 		if validatorParsed.reversed[0] {
@@ -180,12 +321,29 @@ func compileMetadata(
 		table := keyspace.Tables[columns[i].Table]
 		table.Columns[columns[i].Name] = &columns[i]
 		table.OrderedColumns = append(table.OrderedColumns, columns[i].Name)
+
+		// the indexes are described with the indexed columns
+		if index := columns[i].Index; index.Name != "" {
+			options := make(map[string]string, len(index.Options))
+			for k, v := range index.Options {
+				options[k] = fmt.Sprint(v)
+			}
+			table.Indexes[index.Name] = &IndexMetadata{
+				Keyspace: keyspace.Name,
+				Table:    table.Name,
+				Name:     index.Name,
+				Kind:     index.Type,
+				Target:   columns[i].Name,
+				Column:   columns[i].Name,
+				Options:  options,
+			}
+		}
 	}
 
 	if protoVersion == 1 {
-		compileV1Metadata(tables)
+		compileV1Metadata(tables, logger)
 	} else {
-		compileV2Metadata(tables)
+		compileV2Metadata(tables, logger)
 	}
 }
 
@@ -194,14 +352,14 @@ func compileMetadata(
 // column metadata as V2+ (because V1 doesn't support the "type" column in the
 // system.schema_columns table) so determining PartitionKey and ClusterColumns
 // is more complex.
-func compileV1Metadata(tables []TableMetadata) {
+func compileV1Metadata(tables []TableMetadata, logger Logger) {
 	for i := range tables {
 		table := &tables[i]
 
 		// decode the key validator
-		keyValidatorParsed := parseType(table.KeyValidator)
+		keyValidatorParsed := parseType(table.KeyValidator, logger)
 		// decode the comparator
-		comparatorParsed := parseType(table.Comparator)
+		comparatorParsed := parseType(table.Comparator, logger)
 
 		// the partition key length is the same as the number of types in the
 		// key validator
@@ -287,7 +445,7 @@ func compileV1Metadata(tables []TableMetadata) {
 				alias = table.ValueAlias
 			}
 			// decode the default validator
-			defaultValidatorParsed := parseType(table.DefaultValidator)
+			defaultValidatorParsed := parseType(table.DefaultValidator, logger)
 			column := &ColumnMetadata{
 				Keyspace: table.Keyspace,
 				Table:    table.Name,
@@ -301,11 +459,11 @@ func compileV1Metadata(tables []TableMetadata) {
 }
 
 // The simpler compile case for V2+ protocol
-func compileV2Metadata(tables []TableMetadata) {
+func compileV2Metadata(tables []TableMetadata, logger Logger) {
 	for i := range tables {
 		table := &tables[i]
 
-		keyValidatorParsed := parseType(table.KeyValidator)
+		keyValidatorParsed := parseType(table.KeyValidator, logger)
 		table.PartitionKey = make([]*ColumnMetadata, len(keyValidatorParsed.types))
 
 		clusteringColumnCount := componentColumnCountOfType(table.Columns, CLUSTERING_KEY)
@@ -360,7 +518,7 @@ func getKeyspaceMetadata(
 		&strategyOptionsJSON,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("Error querying keyspace schema: %v", err)
+		return nil, fmt.Errorf("Error querying keyspace schema: %w", err)
 	}
 
 	err = json.Unmarshal(strategyOptionsJSON, &keyspace.StrategyOptions)
@@ -447,7 +605,7 @@ func getTableMetadata(
 
 	err := iter.Close()
 	if err != nil && err != ErrNotFound {
-		return nil, fmt.Errorf("Error querying table schema: %v", err)
+		return nil, fmt.Errorf("Error querying table schema: %w", err)
 	}
 
 	return tables, nil
@@ -562,7 +720,7 @@ func getColumnMetadata(
 
 	err := iter.Close()
 	if err != nil && err != ErrNotFound {
-		return nil, fmt.Errorf("Error querying column schema: %v", err)
+		return nil, fmt.Errorf("Error querying column schema: %w", err)
 	}
 
 	return columns, nil
@@ -570,8 +728,9 @@ func getColumnMetadata(
 
 // type definition parser state
 type typeParser struct {
-	input string
-	index int
+	input  string
+	index  int
+	logger Logger
 }
 
 // the type definition parser result
@@ -583,8 +742,8 @@ type typeParserResult struct {
 }
 
 // Parse the type definition used for validator and comparator schema data
-func parseType(def string) typeParserResult {
-	parser := &typeParser{input: def}
+func parseType(def string, logger Logger) typeParserResult {
+	parser := &typeParser{input: def, logger: logger}
 	return parser.parse()
 }
 
@@ -644,11 +803,10 @@ func (t *typeParser) parse() typeParserResult {
 				var name string
 				decoded, err := hex.DecodeString(*param.name)
 				if err != nil {
-					log.Printf(
-						"Error parsing type '%s', contains collection name '%s' with an invalid format: %v",
-						t.input,
-						*param.name,
-						err,
+					t.logger.Warn("gocql: invalid collection name in type",
+						"type", t.input,
+						"name", *param.name,
+						"error", err,
 					)
 					// just use the provided name
 					name = *param.name
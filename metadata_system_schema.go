@@ -0,0 +1,632 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errNoSystemSchema is returned when the cluster has no system_schema
+// keyspace, the schema is then read from the tables of the system keyspace.
+var errNoSystemSchema = errors.New("gocql: no system_schema keyspace")
+
+// the kinds of the columns in system_schema.columns which differ from the
+// system.schema_columns ones
+const (
+	systemSchemaClustering = "clustering"
+)
+
+// getSystemSchemaMetadata queries the schema of a keyspace from the
+// system_schema keyspace of Cassandra 3.0 and later.
+func getSystemSchemaMetadata(session *Session, keyspaceName string) (*KeyspaceMetadata, error) {
+	keyspace, err := getSystemSchemaKeyspace(session, keyspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	// the types are needed to describe the columns and arguments using them
+	if keyspace.Types, err = getSystemSchemaTypes(session, keyspaceName); err != nil {
+		return nil, err
+	}
+
+	tables, err := getSystemSchemaTables(session, keyspaceName)
+	if err != nil {
+		return nil, err
+	}
+	views, err := getSystemSchemaViews(session, keyspaceName)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := getSystemSchemaColumns(session, keyspaceName)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := getSystemSchemaIndexes(session, keyspaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyspace.Functions, err = getSystemSchemaFunctions(session, keyspace); err != nil {
+		return nil, err
+	}
+	if keyspace.Aggregates, err = getSystemSchemaAggregates(session, keyspace); err != nil {
+		return nil, err
+	}
+
+	compileSystemSchemaMetadata(keyspace, tables, views, columns, indexes)
+
+	return keyspace, nil
+}
+
+// systemSchemaQuery returns a query on the system_schema keyspace.
+func systemSchemaQuery(session *Session, stmt string, values ...interface{}) *Query {
+	query := session.Query(stmt, values...)
+	// Set a routing key to avoid GetRoutingKey from computing the routing key
+	// TODO use a separate connection (pool) for system keyspace queries.
+	query.RoutingKey([]byte{})
+	return query
+}
+
+func getSystemSchemaKeyspace(session *Session, keyspaceName string) (*KeyspaceMetadata, error) {
+	query := systemSchemaQuery(session, `
+		SELECT durable_writes, replication
+		FROM system_schema.keyspaces
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	)
+
+	keyspace := &KeyspaceMetadata{Name: keyspaceName}
+	var replication map[string]string
+
+	if err := query.Scan(&keyspace.DurableWrites, &replication); err != nil {
+		if errors.Is(err, ErrCodeInvalid) {
+			// unconfigured table, the cluster is older than Cassandra 3.0
+			return nil, errNoSystemSchema
+		}
+		return nil, fmt.Errorf("Error querying keyspace schema: %w", err)
+	}
+
+	keyspace.StrategyOptions = make(map[string]interface{}, len(replication))
+	for k, v := range replication {
+		if k == "class" {
+			keyspace.StrategyClass = v
+			continue
+		}
+		keyspace.StrategyOptions[k] = v
+	}
+
+	return keyspace, nil
+}
+
+// systemSchemaTableOptions are the columns of the table options in
+// system_schema.tables and system_schema.views, the options which were
+// removed since Cassandra 3.0 are left out.
+const systemSchemaTableOptions = `
+	bloom_filter_fp_chance,
+	caching,
+	comment,
+	compaction,
+	compression,
+	crc_check_chance,
+	default_time_to_live,
+	gc_grace_seconds,
+	max_index_interval,
+	memtable_flush_period_in_ms,
+	min_index_interval,
+	speculative_retry`
+
+// scanTableOptions returns the destinations of the systemSchemaTableOptions
+// columns.
+func scanTableOptions(options *TableOptions) []interface{} {
+	return []interface{}{
+		&options.BloomFilterFpChance,
+		&options.Caching,
+		&options.Comment,
+		&options.Compaction,
+		&options.Compression,
+		&options.CrcCheckChance,
+		&options.DefaultTimeToLive,
+		&options.GcGraceSeconds,
+		&options.MaxIndexInterval,
+		&options.MemtableFlushPeriodInMs,
+		&options.MinIndexInterval,
+		&options.SpeculativeRetry,
+	}
+}
+
+func getSystemSchemaTables(session *Session, keyspaceName string) ([]TableMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT table_name,`+systemSchemaTableOptions+`
+		FROM system_schema.tables
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	).Iter()
+
+	tables := []TableMetadata{}
+	table := TableMetadata{Keyspace: keyspaceName}
+	scan := func() bool {
+		dest := []interface{}{&table.Name}
+		return iter.Scan(append(dest, scanTableOptions(&table.Options)...)...)
+	}
+	for scan() {
+		tables = append(tables, table)
+		table = TableMetadata{Keyspace: keyspaceName}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying table schema: %w", err)
+	}
+
+	return tables, nil
+}
+
+func getSystemSchemaViews(session *Session, keyspaceName string) ([]ViewMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT view_name, base_table_name, include_all_columns, where_clause,`+systemSchemaTableOptions+`
+		FROM system_schema.views
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	).Iter()
+
+	views := []ViewMetadata{}
+	view := ViewMetadata{TableMetadata: TableMetadata{Keyspace: keyspaceName}}
+	scan := func() bool {
+		dest := []interface{}{&view.Name, &view.BaseTable, &view.IncludeAllColumns, &view.WhereClause}
+		return iter.Scan(append(dest, scanTableOptions(&view.Options)...)...)
+	}
+	for scan() {
+		views = append(views, view)
+		view = ViewMetadata{TableMetadata: TableMetadata{Keyspace: keyspaceName}}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying view schema: %w", err)
+	}
+
+	return views, nil
+}
+
+// getSystemSchemaColumns returns the columns of the tables and views of a
+// keyspace, their Validator is their CQL type.
+func getSystemSchemaColumns(session *Session, keyspaceName string) ([]ColumnMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT table_name, column_name, clustering_order, kind, position, type
+		FROM system_schema.columns
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	).Iter()
+
+	columns := []ColumnMetadata{}
+	column := ColumnMetadata{Keyspace: keyspaceName}
+	var clusteringOrder string
+	for iter.Scan(&column.Table, &column.Name, &clusteringOrder, &column.Kind, &column.ComponentIndex, &column.Validator) {
+		if column.Kind == systemSchemaClustering {
+			column.Kind = CLUSTERING_KEY
+		}
+		if clusteringOrder == "desc" {
+			column.Order = DESC
+		}
+
+		columns = append(columns, column)
+		column = ColumnMetadata{Keyspace: keyspaceName}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying column schema: %w", err)
+	}
+
+	return columns, nil
+}
+
+func getSystemSchemaIndexes(session *Session, keyspaceName string) ([]IndexMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT table_name, index_name, kind, options
+		FROM system_schema.indexes
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	).Iter()
+
+	indexes := []IndexMetadata{}
+	index := IndexMetadata{Keyspace: keyspaceName}
+	for iter.Scan(&index.Table, &index.Name, &index.Kind, &index.Options) {
+		index.Target = index.Options["target"]
+		index.Column = indexTargetColumn(index.Target)
+
+		indexes = append(indexes, index)
+		index = IndexMetadata{Keyspace: keyspaceName}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying index schema: %w", err)
+	}
+
+	return indexes, nil
+}
+
+func getSystemSchemaTypes(session *Session, keyspaceName string) (map[string]*TypeMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT type_name, field_names, field_types
+		FROM system_schema.types
+		WHERE keyspace_name = ?
+		`,
+		keyspaceName,
+	).Iter()
+
+	types := make(map[string]*TypeMetadata)
+	defs := make(map[string][]string)
+	var (
+		name       string
+		fieldNames []string
+		fieldTypes []string
+	)
+	for iter.Scan(&name, &fieldNames, &fieldTypes) {
+		types[name] = &TypeMetadata{
+			Keyspace:   keyspaceName,
+			Name:       name,
+			FieldNames: fieldNames,
+		}
+		defs[name] = fieldTypes
+		fieldNames, fieldTypes = nil, nil
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying type schema: %w", err)
+	}
+
+	// the types are listed by name and may use types listed after them, which
+	// are parsed first
+	var lookup func(name string) *TypeMetadata
+	lookup = func(name string) *TypeMetadata {
+		udt, ok := types[name]
+		if !ok || udt.FieldTypes != nil {
+			return udt
+		}
+
+		udt.FieldTypes = make([]TypeInfo, len(defs[name]))
+		for i, def := range defs[name] {
+			p := cqlTypeParser{input: def, keyspace: keyspaceName, lookup: lookup}
+			udt.FieldTypes[i] = p.parse()
+		}
+		return udt
+	}
+	for name := range types {
+		lookup(name)
+	}
+
+	return types, nil
+}
+
+func getSystemSchemaFunctions(session *Session, keyspace *KeyspaceMetadata) (map[string]*FunctionMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT function_name, argument_names, argument_types, return_type, language, body, called_on_null_input
+		FROM system_schema.functions
+		WHERE keyspace_name = ?
+		`,
+		keyspace.Name,
+	).Iter()
+
+	functions := make(map[string]*FunctionMetadata)
+	function := &FunctionMetadata{Keyspace: keyspace.Name}
+	var (
+		argumentTypes []string
+		returnType    string
+	)
+	for iter.Scan(
+		&function.Name,
+		&function.ArgumentNames,
+		&argumentTypes,
+		&returnType,
+		&function.Language,
+		&function.Body,
+		&function.CalledOnNullInput,
+	) {
+		function.ArgumentTypes = parseCQLTypes(argumentTypes, keyspace)
+		function.ReturnType = parseCQLType(returnType, keyspace.Name, keyspace.Types)
+		functions[functionSignature(function.Name, argumentTypes)] = function
+
+		function = &FunctionMetadata{Keyspace: keyspace.Name}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying function schema: %w", err)
+	}
+
+	return functions, nil
+}
+
+func getSystemSchemaAggregates(session *Session, keyspace *KeyspaceMetadata) (map[string]*AggregateMetadata, error) {
+	iter := systemSchemaQuery(session, `
+		SELECT aggregate_name, argument_types, return_type, state_func, state_type, final_func, initcond
+		FROM system_schema.aggregates
+		WHERE keyspace_name = ?
+		`,
+		keyspace.Name,
+	).Iter()
+
+	aggregates := make(map[string]*AggregateMetadata)
+	aggregate := &AggregateMetadata{Keyspace: keyspace.Name}
+	var (
+		argumentTypes []string
+		returnType    string
+		stateType     string
+		stateFunc     string
+		finalFunc     string
+	)
+	for iter.Scan(
+		&aggregate.Name,
+		&argumentTypes,
+		&returnType,
+		&stateFunc,
+		&stateType,
+		&finalFunc,
+		&aggregate.InitCond,
+	) {
+		aggregate.ArgumentTypes = parseCQLTypes(argumentTypes, keyspace)
+		aggregate.ReturnType = parseCQLType(returnType, keyspace.Name, keyspace.Types)
+		aggregate.StateType = parseCQLType(stateType, keyspace.Name, keyspace.Types)
+
+		// the state function takes the state followed by the arguments, the
+		// final function takes the state
+		aggregate.StateFunc = functionSignature(stateFunc, append([]string{stateType}, argumentTypes...))
+		if finalFunc != "" {
+			aggregate.FinalFunc = functionSignature(finalFunc, []string{stateType})
+		}
+		aggregates[functionSignature(aggregate.Name, argumentTypes)] = aggregate
+
+		aggregate = &AggregateMetadata{Keyspace: keyspace.Name}
+	}
+
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("Error querying aggregate schema: %w", err)
+	}
+
+	return aggregates, nil
+}
+
+// functionSignature returns the key of a function or aggregate in the
+// metadata of its keyspace.
+func functionSignature(name string, argumentTypes []string) string {
+	return name + "(" + strings.Join(argumentTypes, ",") + ")"
+}
+
+func parseCQLTypes(defs []string, keyspace *KeyspaceMetadata) []TypeInfo {
+	types := make([]TypeInfo, len(defs))
+	for i, def := range defs {
+		types[i] = parseCQLType(def, keyspace.Name, keyspace.Types)
+	}
+	return types
+}
+
+// compileSystemSchemaMetadata links the tables, views, columns and indexes of
+// a keyspace together and derives the partition key and clustering columns of
+// the tables and views.
+func compileSystemSchemaMetadata(
+	keyspace *KeyspaceMetadata,
+	tables []TableMetadata,
+	views []ViewMetadata,
+	columns []ColumnMetadata,
+	indexes []IndexMetadata,
+) {
+	keyspace.Tables = make(map[string]*TableMetadata)
+	keyspace.Views = make(map[string]*ViewMetadata)
+
+	// the columns of the views are listed with the columns of the tables
+	all := make(map[string]*TableMetadata)
+	for i := range tables {
+		tables[i].Columns = make(map[string]*ColumnMetadata)
+		tables[i].Indexes = make(map[string]*IndexMetadata)
+		keyspace.Tables[tables[i].Name] = &tables[i]
+		all[tables[i].Name] = &tables[i]
+	}
+	for i := range views {
+		views[i].Columns = make(map[string]*ColumnMetadata)
+		keyspace.Views[views[i].Name] = &views[i]
+		all[views[i].Name] = &views[i].TableMetadata
+	}
+
+	for i := range columns {
+		column := &columns[i]
+		column.Type = parseCQLType(column.Validator, keyspace.Name, keyspace.Types)
+
+		table, ok := all[column.Table]
+		if !ok {
+			continue
+		}
+		table.Columns[column.Name] = column
+		table.OrderedColumns = append(table.OrderedColumns, column.Name)
+	}
+
+	for i := range indexes {
+		index := &indexes[i]
+		table, ok := keyspace.Tables[index.Table]
+		if !ok {
+			continue
+		}
+		table.Indexes[index.Name] = index
+
+		if column, ok := table.Columns[index.Column]; ok {
+			options := make(map[string]interface{}, len(index.Options))
+			for k, v := range index.Options {
+				options[k] = v
+			}
+			column.Index = ColumnIndexMetadata{Name: index.Name, Type: index.Kind, Options: options}
+		}
+	}
+
+	for _, table := range all {
+		table.PartitionKey = make([]*ColumnMetadata, componentColumnCountOfType(table.Columns, PARTITION_KEY))
+		table.ClusteringColumns = make([]*ColumnMetadata, componentColumnCountOfType(table.Columns, CLUSTERING_KEY))
+
+		for _, columnName := range table.OrderedColumns {
+			column := table.Columns[columnName]
+			if column.Kind == PARTITION_KEY {
+				table.PartitionKey[column.ComponentIndex] = column
+			} else if column.Kind == CLUSTERING_KEY {
+				table.ClusteringColumns[column.ComponentIndex] = column
+			}
+		}
+	}
+}
+
+// parseCQLType returns the TypeInfo of a CQL type definition as found in
+// system_schema, for instance frozen<map<text, list<int>>>. The user defined
+// types are looked up in types.
+func parseCQLType(def string, keyspace string, types map[string]*TypeMetadata) TypeInfo {
+	p := cqlTypeParser{
+		input:    def,
+		keyspace: keyspace,
+		lookup: func(name string) *TypeMetadata {
+			return types[name]
+		},
+	}
+	return p.parse()
+}
+
+// cqlTypeParser is a recursive descent parser of CQL type definitions.
+type cqlTypeParser struct {
+	input    string
+	index    int
+	keyspace string
+	// lookup returns the user defined type with the given name, or nil
+	lookup func(name string) *TypeMetadata
+}
+
+// TYPE := NAME [ '<' TYPE { ',' TYPE } '>' ] | QUOTED_CLASS
+func (p *cqlTypeParser) parse() TypeInfo {
+	p.skipWhitespace()
+
+	if p.index < len(p.input) && p.input[p.index] == '\'' {
+		// custom type given by its class name
+		end := strings.IndexByte(p.input[p.index+1:], '\'')
+		if end < 0 {
+			end = len(p.input) - p.index - 1
+		}
+		class := p.input[p.index+1 : p.index+1+end]
+		p.index += end + 2
+		return NativeType{typ: TypeCustom, custom: class}
+	}
+
+	name := p.name()
+	var params []TypeInfo
+
+	p.skipWhitespace()
+	if p.index < len(p.input) && p.input[p.index] == '<' {
+		p.index++
+		for {
+			params = append(params, p.parse())
+			p.skipWhitespace()
+			if p.index >= len(p.input) {
+				break
+			}
+			c := p.input[p.index]
+			p.index++
+			if c != ',' {
+				break
+			}
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "frozen":
+		if len(params) == 1 {
+			return params[0]
+		}
+	case "list", "set":
+		if len(params) == 1 {
+			var typ Type = TypeList
+			if strings.ToLower(name) == "set" {
+				typ = TypeSet
+			}
+			return CollectionType{NativeType: NativeType{typ: typ}, Elem: params[0]}
+		}
+	case "map":
+		if len(params) == 2 {
+			return CollectionType{NativeType: NativeType{typ: TypeMap}, Key: params[0], Elem: params[1]}
+		}
+	case "tuple":
+		return TupleTypeInfo{NativeType: NativeType{typ: TypeTuple}, Elems: params}
+	}
+
+	if typ, ok := cqlNativeTypes[strings.ToLower(name)]; ok {
+		return NativeType{typ: typ}
+	}
+
+	// a user defined type
+	udt := UDTTypeInfo{NativeType: NativeType{typ: TypeUDT}, KeySpace: p.keyspace, Name: name}
+	if t := p.lookup(name); t != nil {
+		udt.Elements = make([]UDTField, len(t.FieldNames))
+		for i := range t.FieldNames {
+			udt.Elements[i] = UDTField{Name: t.FieldNames[i], Type: t.FieldTypes[i]}
+		}
+	}
+	return udt
+}
+
+// name returns the next type name, the quotes of a quoted name are removed.
+func (p *cqlTypeParser) name() string {
+	p.skipWhitespace()
+
+	if p.index < len(p.input) && p.input[p.index] == '"' {
+		var name []byte
+		for p.index++; p.index < len(p.input); p.index++ {
+			c := p.input[p.index]
+			if c == '"' {
+				// a doubled quote is an escaped quote
+				if p.index+1 < len(p.input) && p.input[p.index+1] == '"' {
+					name = append(name, '"')
+					p.index++
+					continue
+				}
+				p.index++
+				break
+			}
+			name = append(name, c)
+		}
+		return string(name)
+	}
+
+	start := p.index
+	for p.index < len(p.input) && isIdentifierChar(p.input[p.index]) {
+		p.index++
+	}
+	return p.input[start:p.index]
+}
+
+func (p *cqlTypeParser) skipWhitespace() {
+	for p.index < len(p.input) && isWhitespaceChar(p.input[p.index]) {
+		p.index++
+	}
+}
+
+var cqlNativeTypes = map[string]Type{
+	"ascii":     TypeAscii,
+	"bigint":    TypeBigInt,
+	"blob":      TypeBlob,
+	"boolean":   TypeBoolean,
+	"counter":   TypeCounter,
+	"date":      TypeDate,
+	"decimal":   TypeDecimal,
+	"double":    TypeDouble,
+	"duration":  TypeDuration,
+	"float":     TypeFloat,
+	"inet":      TypeInet,
+	"int":       TypeInt,
+	"smallint":  TypeSmallInt,
+	"text":      TypeVarchar,
+	"time":      TypeTime,
+	"timestamp": TypeTimestamp,
+	"timeuuid":  TypeTimeUUID,
+	"tinyint":   TypeTinyInt,
+	"uuid":      TypeUUID,
+	"varchar":   TypeVarchar,
+	"varint":    TypeVarint,
+}
@@ -5,6 +5,7 @@
 package gocql
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -94,7 +95,7 @@ func TestCompileMetadata(t *testing.T) {
 		ColumnMetadata{Keyspace: "V1Keyspace", Table: "peers", Kind: REGULAR, Name: "schema_version", ComponentIndex: 0, Validator: "org.apache.cassandra.db.marshal.UUIDType"},
 		ColumnMetadata{Keyspace: "V1Keyspace", Table: "peers", Kind: REGULAR, Name: "tokens", ComponentIndex: 0, Validator: "org.apache.cassandra.db.marshal.SetType(org.apache.cassandra.db.marshal.UTF8Type)"},
 	}
-	compileMetadata(1, keyspace, tables, columns)
+	compileMetadata(1, keyspace, tables, columns, nopLogger{})
 	assertKeyspaceMetadata(
 		t,
 		keyspace,
@@ -375,7 +376,7 @@ func TestCompileMetadata(t *testing.T) {
 			Validator: "org.apache.cassandra.db.marshal.UTF8Type",
 		},
 	}
-	compileMetadata(2, keyspace, tables, columns)
+	compileMetadata(2, keyspace, tables, columns, nopLogger{})
 	assertKeyspaceMetadata(
 		t,
 		keyspace,
@@ -564,6 +565,182 @@ func assertKeyspaceMetadata(t *testing.T, actual, expected *KeyspaceMetadata) {
 	}
 }
 
+// Tests the metadata compilation of the system_schema tables of Cassandra 3.0
+func TestCompileSystemSchemaMetadata(t *testing.T) {
+	keyspace := &KeyspaceMetadata{
+		Name: "ks",
+		Types: map[string]*TypeMetadata{
+			"address": &TypeMetadata{
+				Keyspace:   "ks",
+				Name:       "address",
+				FieldNames: []string{"street", "zip"},
+				FieldTypes: []TypeInfo{NativeType{typ: TypeVarchar}, NativeType{typ: TypeInt}},
+			},
+		},
+	}
+	tables := []TableMetadata{
+		TableMetadata{Keyspace: "ks", Name: "users", Options: TableOptions{Comment: "the users", DefaultTimeToLive: 3600}},
+	}
+	views := []ViewMetadata{
+		ViewMetadata{
+			TableMetadata: TableMetadata{Keyspace: "ks", Name: "users_by_email"},
+			BaseTable:     "users",
+			WhereClause:   "email IS NOT NULL AND id IS NOT NULL",
+		},
+	}
+	columns := []ColumnMetadata{
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "created", Kind: CLUSTERING_KEY, ComponentIndex: 1, Order: DESC, Validator: "timestamp"},
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "id", Kind: PARTITION_KEY, ComponentIndex: 0, Validator: "uuid"},
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "region", Kind: PARTITION_KEY, ComponentIndex: 1, Validator: "text"},
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "email", Kind: CLUSTERING_KEY, ComponentIndex: 0, Validator: "text"},
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "home", Kind: REGULAR, ComponentIndex: -1, Validator: "frozen<address>"},
+		ColumnMetadata{Keyspace: "ks", Table: "users", Name: "quota", Kind: STATIC, ComponentIndex: -1, Validator: "bigint"},
+		ColumnMetadata{Keyspace: "ks", Table: "users_by_email", Name: "email", Kind: PARTITION_KEY, ComponentIndex: 0, Validator: "text"},
+		ColumnMetadata{Keyspace: "ks", Table: "users_by_email", Name: "id", Kind: CLUSTERING_KEY, ComponentIndex: 0, Validator: "uuid"},
+	}
+
+	indexes := []IndexMetadata{
+		IndexMetadata{
+			Keyspace: "ks",
+			Table:    "users",
+			Name:     "users_home",
+			Kind:     "CUSTOM",
+			Target:   "home",
+			Column:   "home",
+			Options:  map[string]string{"class_name": "StorageAttachedIndex", "target": "home"},
+		},
+		IndexMetadata{Keyspace: "ks", Table: "users", Name: "users_quota", Kind: "COMPOSITES", Target: "quota", Column: "quota"},
+	}
+
+	compileSystemSchemaMetadata(keyspace, tables, views, columns, indexes)
+
+	users, ok := keyspace.Tables["users"]
+	if !ok {
+		t.Fatal("expected the users table")
+	}
+	names := func(columns []*ColumnMetadata) []string {
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		return names
+	}
+	if partitionKey := names(users.PartitionKey); !reflect.DeepEqual(partitionKey, []string{"id", "region"}) {
+		t.Errorf("unexpected partition key %v", partitionKey)
+	}
+	if clustering := names(users.ClusteringColumns); !reflect.DeepEqual(clustering, []string{"email", "created"}) {
+		t.Errorf("unexpected clustering columns %v", clustering)
+	}
+	if users.Options.Comment != "the users" || users.Options.DefaultTimeToLive != 3600 {
+		t.Errorf("unexpected table options %+v", users.Options)
+	}
+	if quota := users.Columns["quota"]; quota.Kind != STATIC || quota.Type != (NativeType{typ: TypeBigInt}) {
+		t.Errorf("expected quota to be a static bigint got %s %v", quota.Kind, quota.Type)
+	}
+	if users.Columns["created"].Order != DESC {
+		t.Error("expected created to be ordered DESC")
+	}
+	if udt, ok := users.Columns["home"].Type.(UDTTypeInfo); !ok || len(udt.Elements) != 2 || udt.Elements[1].Name != "zip" {
+		t.Errorf("expected the home column to be an address got %v", users.Columns["home"].Type)
+	}
+
+	if index, ok := users.Indexes["users_home"]; !ok || !index.StorageAttached() {
+		t.Errorf("expected the storage-attached index users_home got %+v", index)
+	}
+	if index, ok := users.Indexes["users_quota"]; !ok || index.StorageAttached() {
+		t.Errorf("expected the legacy index users_quota got %+v", index)
+	}
+	if users.Columns["quota"].Index.Name != "users_quota" {
+		t.Errorf("expected the quota column to be indexed by users_quota got %q", users.Columns["quota"].Index.Name)
+	}
+
+	view, ok := keyspace.Views["users_by_email"]
+	if !ok {
+		t.Fatal("expected the users_by_email view")
+	}
+	if view.BaseTable != "users" {
+		t.Errorf("expected the base table users got %q", view.BaseTable)
+	}
+	if names(view.PartitionKey)[0] != "email" || names(view.ClusteringColumns)[0] != "id" {
+		t.Errorf("unexpected primary key of the view %v %v", names(view.PartitionKey), names(view.ClusteringColumns))
+	}
+	if _, ok := keyspace.Tables["users_by_email"]; ok {
+		t.Error("expected the view not to be listed with the tables")
+	}
+}
+
+func TestIndexTargetColumn(t *testing.T) {
+	tests := []struct {
+		target string
+		column string
+	}{
+		{"email", "email"},
+		{"keys(tags)", "tags"},
+		{"values(tags)", "tags"},
+		{"entries(tags)", "tags"},
+		{"full(tags)", "tags"},
+		{`"Mixed""Case"`, `Mixed"Case`},
+		{`keys("Tags")`, "Tags"},
+	}
+
+	for _, test := range tests {
+		if column := indexTargetColumn(test.target); column != test.column {
+			t.Errorf("%s: expected the column %q got %q", test.target, test.column, column)
+		}
+	}
+}
+
+// Tests the parser of the CQL type definitions of system_schema
+func TestParseCQLType(t *testing.T) {
+	types := map[string]*TypeMetadata{
+		"address": &TypeMetadata{
+			Keyspace:   "ks",
+			Name:       "address",
+			FieldNames: []string{"street"},
+			FieldTypes: []TypeInfo{NativeType{typ: TypeVarchar}},
+		},
+	}
+
+	tests := []struct {
+		def      string
+		expected TypeInfo
+	}{
+		{"int", NativeType{typ: TypeInt}},
+		{"text", NativeType{typ: TypeVarchar}},
+		{"list<timeuuid>", CollectionType{NativeType: NativeType{typ: TypeList}, Elem: NativeType{typ: TypeTimeUUID}}},
+		{"set<bigint>", CollectionType{NativeType: NativeType{typ: TypeSet}, Elem: NativeType{typ: TypeBigInt}}},
+		{
+			"frozen<map<text, list<int>>>",
+			CollectionType{
+				NativeType: NativeType{typ: TypeMap},
+				Key:        NativeType{typ: TypeVarchar},
+				Elem:       CollectionType{NativeType: NativeType{typ: TypeList}, Elem: NativeType{typ: TypeInt}},
+			},
+		},
+		{
+			"tuple<int, text>",
+			TupleTypeInfo{NativeType: NativeType{typ: TypeTuple}, Elems: []TypeInfo{NativeType{typ: TypeInt}, NativeType{typ: TypeVarchar}}},
+		},
+		{
+			"frozen<address>",
+			UDTTypeInfo{
+				NativeType: NativeType{typ: TypeUDT},
+				KeySpace:   "ks",
+				Name:       "address",
+				Elements:   []UDTField{UDTField{Name: "street", Type: NativeType{typ: TypeVarchar}}},
+			},
+		},
+		{`"Quoted""Name"`, UDTTypeInfo{NativeType: NativeType{typ: TypeUDT}, KeySpace: "ks", Name: `Quoted"Name`}},
+		{"'org.apache.cassandra.db.marshal.LexicalUUIDType'", NativeType{typ: TypeCustom, custom: "org.apache.cassandra.db.marshal.LexicalUUIDType"}},
+	}
+
+	for _, test := range tests {
+		if actual := parseCQLType(test.def, "ks", types); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %#v got %#v", test.def, test.expected, actual)
+		}
+	}
+}
+
 // Tests the cassandra type definition parser
 func TestTypeParser(t *testing.T) {
 	// native type
@@ -674,7 +851,7 @@ func assertParseNonCompositeType(
 	typeExpected assertTypeInfo,
 ) {
 
-	result := parseType(def)
+	result := parseType(def, nopLogger{})
 	if len(result.reversed) != 1 {
 		t.Errorf("%s expected %d reversed values but there were %d", def, 1, len(result.reversed))
 	}
@@ -704,7 +881,7 @@ func assertParseCompositeType(
 	collectionsExpected map[string]assertTypeInfo,
 ) {
 
-	result := parseType(def)
+	result := parseType(def, nopLogger{})
 	if len(result.reversed) != len(typesExpected) {
 		t.Errorf("%s expected %d reversed values but there were %d", def, len(typesExpected), len(result.reversed))
 	}
@@ -0,0 +1,417 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.16
+
+// Package migrate applies versioned CQL migrations to a keyspace. The
+// migrations are the files of an fs.FS named after their version, such as
+// 001_create_users.cql, which are applied in order of version:
+//
+//	//go:embed migrations/*.cql
+//	var migrations embed.FS
+//
+//	files, _ := fs.Sub(migrations, "migrations")
+//	err := migrate.New(session).Migrate(ctx, files)
+//
+// The applied migrations are recorded in a table of the keyspace of the
+// session, along with the number of their statements which were applied, so
+// that a migration failing half way resumes with the failed statement. The
+// migrators hold a lock, taken with a lightweight transaction, while
+// migrating so that concurrent migrators, such as the instances of a service
+// being deployed, apply every migration once. Each statement is followed by
+// waiting for the hosts to agree on the schema.
+package migrate
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("migrate: checksum mismatch of an applied migration")
+	ErrLockLost         = errors.New("migrate: lost the migration lock")
+)
+
+// Migration is a versioned migration file.
+type Migration struct {
+	Version int
+	Name    string
+	// Statements are the statements of the file, in order.
+	Statements []string
+	Checksum   string
+}
+
+// AppliedMigration is a migration recorded as applied, or partially applied
+// when Done is less than the number of its statements.
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	Done      int
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations with a session.
+type Migrator struct {
+	Session *gocql.Session
+
+	// Table is the table recording the applied migrations, the lock is held
+	// in the table of the same name suffixed with _lock.
+	// (default: gocql_migrations)
+	Table string
+
+	// LockTTL is the time to live of the migration lock, which is released
+	// when a migrator dies while holding it. The lock is renewed after every
+	// statement so the statements must complete within LockTTL.
+	// (default: 1m)
+	LockTTL time.Duration
+
+	// LockRetryInterval is the delay between two attempts to take the lock
+	// held by another migrator. (default: 1s)
+	LockRetryInterval time.Duration
+
+	// SchemaAgreementTimeout bounds the wait for schema agreement after each
+	// statement. (default: 1m)
+	SchemaAgreementTimeout time.Duration
+
+	// Logger reports the applied migrations. (default: no logging)
+	Logger gocql.Logger
+}
+
+// New returns a Migrator applying migrations with session s.
+func New(s *gocql.Session) *Migrator {
+	return &Migrator{
+		Session:                s,
+		Table:                  "gocql_migrations",
+		LockTTL:                time.Minute,
+		LockRetryInterval:      time.Second,
+		SchemaAgreementTimeout: time.Minute,
+	}
+}
+
+// Load returns the migrations of the .cql files at the root of fsys sorted
+// by version. The version of a migration is the number its file name starts
+// with.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.cql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	versions := make(map[int]string)
+	for _, file := range files {
+		m, err := parseName(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := versions[m.Version]; ok {
+			return nil, fmt.Errorf("migrate: %s and %s have the same version", other, file)
+		}
+		versions[m.Version] = file
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := md5.Sum(content)
+		m.Checksum = hex.EncodeToString(sum[:])
+		if m.Statements, err = splitStatements(string(content)); err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", file, err)
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parseName returns the migration of the file name <version>_<name>.cql.
+func parseName(file string) (Migration, error) {
+	name := strings.TrimSuffix(path.Base(file), ".cql")
+
+	n := 0
+	for n < len(name) && name[n] >= '0' && name[n] <= '9' {
+		n++
+	}
+	version, err := strconv.Atoi(name[:n])
+	if err != nil {
+		return Migration{}, fmt.Errorf("migrate: %s does not start with a version", file)
+	}
+
+	return Migration{Version: version, Name: name}, nil
+}
+
+// splitStatements splits a file in its statements separated by semicolons,
+// outside of strings, quoted identifiers, function bodies and comments.
+func splitStatements(content string) ([]string, error) {
+	var (
+		stmts []string
+		start int
+	)
+
+	add := func(end int) {
+		if stmt := strings.TrimSpace(content[start:end]); stmt != "" && !isComment(stmt) {
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(content); i++ {
+		rest := content[i:]
+		switch {
+		case rest[0] == '\'' || rest[0] == '"':
+			// quotes are escaped by doubling them
+			end := i + 1
+			for ; end < len(content); end++ {
+				if content[end] == rest[0] {
+					if end+1 < len(content) && content[end+1] == rest[0] {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(content) {
+				return nil, errors.New("unterminated string")
+			}
+			i = end
+		case strings.HasPrefix(rest, "$$"):
+			end := strings.Index(rest[2:], "$$")
+			if end < 0 {
+				return nil, errors.New("unterminated function body")
+			}
+			i += end + 3
+		case strings.HasPrefix(rest, "--"), strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 3
+		case rest[0] == ';':
+			add(i)
+		}
+	}
+	add(len(content))
+
+	return stmts, nil
+}
+
+// isComment reports whether stmt is only made of comments.
+func isComment(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "//") {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Migrator) lockTable() string {
+	return m.Table + "_lock"
+}
+
+func (m *Migrator) createTables(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			version int PRIMARY KEY,
+			name text,
+			checksum text,
+			done int,
+			applied_at timestamp
+		)`, m.Table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id int PRIMARY KEY,
+			owner uuid
+		)`, m.lockTable()),
+	}
+
+	for _, stmt := range stmts {
+		if err := m.Session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+			return err
+		}
+	}
+	return m.awaitSchemaAgreement(ctx)
+}
+
+func (m *Migrator) awaitSchemaAgreement(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.SchemaAgreementTimeout)
+	defer cancel()
+	return m.Session.AwaitSchemaAgreement(ctx)
+}
+
+// Applied returns the migrations recorded as applied, sorted by version.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	iter := m.Session.Query(fmt.Sprintf("SELECT version, name, checksum, done, applied_at FROM %s", m.Table)).
+		WithContext(ctx).Consistency(gocql.Quorum).Iter()
+
+	var (
+		applied []AppliedMigration
+		a       AppliedMigration
+	)
+	for iter.Scan(&a.Version, &a.Name, &a.Checksum, &a.Done, &a.AppliedAt) {
+		applied = append(applied, a)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version < applied[j].Version
+	})
+	return applied, nil
+}
+
+// lock takes the migration lock, waiting for the other migrators to release
+// it, and returns the owner of the lock.
+func (m *Migrator) lock(ctx context.Context) (gocql.UUID, error) {
+	owner := gocql.TimeUUID()
+	stmt := fmt.Sprintf("INSERT INTO %s (id, owner) VALUES (0, ?) IF NOT EXISTS USING TTL ?", m.lockTable())
+
+	for {
+		lock := make(map[string]interface{})
+		applied, err := m.Session.Query(stmt, owner, int(m.LockTTL/time.Second)).
+			WithContext(ctx).Consistency(gocql.Quorum).MapScanCAS(lock)
+		if err != nil {
+			return owner, err
+		}
+		if applied {
+			return owner, nil
+		}
+
+		if m.Logger != nil {
+			m.Logger.Info("migrate: waiting for the migration lock", "holder", lock["owner"])
+		}
+
+		select {
+		case <-time.After(m.LockRetryInterval):
+		case <-ctx.Done():
+			return owner, ctx.Err()
+		}
+	}
+}
+
+// renewLock extends the time to live of the lock held by owner.
+func (m *Migrator) renewLock(ctx context.Context, owner gocql.UUID) error {
+	stmt := fmt.Sprintf("UPDATE %s USING TTL ? SET owner = ? WHERE id = 0 IF owner = ?", m.lockTable())
+
+	var holder gocql.UUID
+	applied, err := m.Session.Query(stmt, int(m.LockTTL/time.Second), owner, owner).
+		WithContext(ctx).Consistency(gocql.Quorum).ScanCAS(&holder)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context, owner gocql.UUID) error {
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE id = 0 IF owner = ?", m.lockTable())
+
+	var holder gocql.UUID
+	_, err := m.Session.Query(stmt, owner).WithContext(ctx).Consistency(gocql.Quorum).ScanCAS(&holder)
+	return err
+}
+
+// Migrate applies the migrations of fsys which were not applied yet, see
+// Load. The migrations which were applied must not have changed since.
+func (m *Migrator) Migrate(ctx context.Context, fsys fs.FS) (err error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return err
+	}
+
+	if err := m.createTables(ctx); err != nil {
+		return err
+	}
+
+	owner, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := m.unlock(context.Background(), owner); err == nil {
+			err = uerr
+		}
+	}()
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	done := make(map[int]AppliedMigration, len(applied))
+	for _, a := range applied {
+		done[a.Version] = a
+	}
+
+	for _, mig := range migrations {
+		a, ok := done[mig.Version]
+		if ok && a.Checksum != mig.Checksum {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, mig.Name)
+		}
+		if ok && a.Done >= len(mig.Statements) {
+			continue
+		}
+
+		if err := m.apply(ctx, owner, mig, a.Done); err != nil {
+			return fmt.Errorf("migrate: %s: %w", mig.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// apply applies the statements of mig from the statement done, the ones
+// before it having already been applied.
+func (m *Migrator) apply(ctx context.Context, owner gocql.UUID, mig Migration, done int) error {
+	if m.Logger != nil {
+		m.Logger.Info("migrate: applying migration", "name", mig.Name, "from_statement", done)
+	}
+
+	record := fmt.Sprintf("INSERT INTO %s (version, name, checksum, done, applied_at) VALUES (?, ?, ?, ?, ?)", m.Table)
+	for i := done; i < len(mig.Statements); i++ {
+		if err := m.renewLock(ctx, owner); err != nil {
+			return err
+		}
+
+		if err := m.Session.Query(mig.Statements[i]).WithContext(ctx).Exec(); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if err := m.awaitSchemaAgreement(ctx); err != nil {
+			return err
+		}
+
+		err := m.Session.Query(record, mig.Version, mig.Name, mig.Checksum, i+1, time.Now()).
+			WithContext(ctx).Consistency(gocql.Quorum).Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
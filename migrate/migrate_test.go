@@ -0,0 +1,77 @@
+// +build all unit
+// +build go1.16
+
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	content := `-- users
+CREATE TABLE users (id uuid PRIMARY KEY, name text);
+INSERT INTO users (id, name) VALUES (uuid(), 'a;b''c');
+
+/* ; */
+CREATE FUNCTION f (a int) RETURNS NULL ON NULL INPUT RETURNS int
+	LANGUAGE java AS $$ return a; $$;
+// trailing comment;
+`
+
+	stmts, err := splitStatements(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"-- users\nCREATE TABLE users (id uuid PRIMARY KEY, name text)",
+		"INSERT INTO users (id, name) VALUES (uuid(), 'a;b''c')",
+		"/* ; */\nCREATE FUNCTION f (a int) RETURNS NULL ON NULL INPUT RETURNS int\n\tLANGUAGE java AS $$ return a; $$",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected %q got %q", expected, stmts)
+	}
+
+	for _, content := range []string{"SELECT 'a", "SELECT $$ a", "/* a"} {
+		if _, err := splitStatements(content); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_add_email.cql": {Data: []byte("ALTER TABLE users ADD email text;")},
+		"2_users.cql":       {Data: []byte("CREATE TABLE users (id uuid PRIMARY KEY);\nCREATE INDEX ON users (id)")},
+		"README.md":         {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations got %d", len(migrations))
+	}
+	if m := migrations[0]; m.Version != 2 || m.Name != "2_users" || len(m.Statements) != 2 {
+		t.Errorf("unexpected first migration %+v", m)
+	}
+	if m := migrations[1]; m.Version != 10 || m.Name != "010_add_email" || len(m.Statements) != 1 {
+		t.Errorf("unexpected second migration %+v", m)
+	}
+	if migrations[0].Checksum == migrations[1].Checksum {
+		t.Error("expected the checksums of the migrations to differ")
+	}
+
+	fsys["10_duplicate.cql"] = &fstest.MapFile{Data: []byte("SELECT now() FROM system.local")}
+	if _, err := Load(fsys); err == nil {
+		t.Error("expected an error loading migrations with the same version")
+	}
+
+	if _, err := Load(fstest.MapFS{"users.cql": {}}); err == nil {
+		t.Error("expected an error loading a migration without a version")
+	}
+}
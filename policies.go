@@ -5,9 +5,11 @@
 package gocql
 
 import (
-	"log"
+	"context"
+	"math/rand"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 //RetryableQuery is an interface that represents a query or batch statement that
@@ -48,6 +50,230 @@ func (s *SimpleRetryPolicy) Attempt(q RetryableQuery) bool {
 	return q.Attempts() <= s.NumRetries
 }
 
+// RetryBackoff is the interface implemented by the retry policies which wait
+// before retrying, the session waits for the delay returned by Backoff
+// before executing the query or batch again, unless its context is done
+// first.
+type RetryBackoff interface {
+	Backoff(q RetryableQuery) time.Duration
+}
+
+// ExponentialBackoffRetryPolicy retries the queries up to NumRetries times
+// like SimpleRetryPolicy, waiting before each retry. The bound of the delay
+// doubles after every attempt, starting at Min and up to Max, and the
+// actual delay is picked at random up to the bound (full jitter) so the
+// clients of an overloaded host do not retry all at once.
+//
+//     cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+//             NumRetries: 3,
+//             Min:        10 * time.Millisecond,
+//             Max:        time.Second,
+//     }
+//
+type ExponentialBackoffRetryPolicy struct {
+	NumRetries int
+
+	// Min is the bound of the delay before the first retry. (default: 100ms)
+	Min time.Duration
+
+	// Max caps the bound of the delay. (default: 0, unbounded)
+	Max time.Duration
+}
+
+// defaultRetryBackoffMin is the bound of the delay before the first retry
+// of an ExponentialBackoffRetryPolicy without Min.
+const defaultRetryBackoffMin = 100 * time.Millisecond
+
+func (e *ExponentialBackoffRetryPolicy) Attempt(q RetryableQuery) bool {
+	return q.Attempts() <= e.NumRetries
+}
+
+func (e *ExponentialBackoffRetryPolicy) Backoff(q RetryableQuery) time.Duration {
+	bound := e.Min
+	if bound <= 0 {
+		bound = defaultRetryBackoffMin
+	}
+	for i := 1; i < q.Attempts() && bound < 1<<62 && (e.Max <= 0 || bound < e.Max); i++ {
+		bound *= 2
+	}
+	if e.Max > 0 && bound > e.Max {
+		bound = e.Max
+	}
+
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// retryBackoff waits for the delay of the retry policy rt before the next
+// attempt of q, it returns false if ctx is done first.
+func retryBackoff(ctx context.Context, rt RetryPolicy, q RetryableQuery) bool {
+	b, ok := rt.(RetryBackoff)
+	if !ok {
+		return true
+	}
+	d := b.Backoff(q)
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// SpeculativeExecutionPolicy is used by gocql to send a query which is still
+// waiting for the response of a host to another host, the first successful
+// response is returned. As the statement can be applied by several hosts it
+// must only be used for idempotent statements.
+//
+//     query.SpeculativeExecutionPolicy(&gocql.PercentileSpeculativeExecution{
+//         NumAttempts: 1,
+//         Percentile:  0.99,
+//         MinSamples:  100,
+//         Fallback:    100 * time.Millisecond,
+//     })
+//
+type SpeculativeExecutionPolicy interface {
+	// Attempts returns the maximum number of executions of a query in
+	// addition to the first one.
+	Attempts() int
+	// Delay returns how long to wait for the response of the host of the
+	// last execution before the next one, recent is the latency histogram of
+	// the responses received from this host during the last one to two
+	// minutes. A delay of zero or less sends no more executions.
+	Delay(recent LatencySnapshot) time.Duration
+}
+
+// SimpleSpeculativeExecution sends the query to another host every
+// TimeoutDelay, up to NumAttempts times. A TimeoutDelay of zero disables it.
+type SimpleSpeculativeExecution struct {
+	NumAttempts  int
+	TimeoutDelay time.Duration
+}
+
+func (s *SimpleSpeculativeExecution) Attempts() int {
+	return s.NumAttempts
+}
+
+func (s *SimpleSpeculativeExecution) Delay(recent LatencySnapshot) time.Duration {
+	return s.TimeoutDelay
+}
+
+// PercentileSpeculativeExecution sends the query to another host when the
+// host of the last execution did not respond within a percentile of its
+// recent latency, up to NumAttempts times. The delay follows the latency of
+// each host as the load of the cluster changes.
+type PercentileSpeculativeExecution struct {
+	NumAttempts int
+
+	// Percentile is the fraction, between 0 and 1, of the recent responses
+	// of the host expected before the next execution, e.g. 0.99 for the p99.
+	Percentile float64
+
+	// MinSamples is the number of recent responses of the host below which
+	// Fallback is used as the delay. (default: 0, any recent response)
+	MinSamples int64
+
+	// Fallback is the delay used for the hosts with too few recent
+	// responses. (default: 0, no speculative execution until the host has
+	// enough recent responses)
+	Fallback time.Duration
+
+	// Min and Max bound the delay computed from the percentile. (default: 0,
+	// unbounded)
+	Min time.Duration
+	Max time.Duration
+}
+
+func (p *PercentileSpeculativeExecution) Attempts() int {
+	return p.NumAttempts
+}
+
+func (p *PercentileSpeculativeExecution) Delay(recent LatencySnapshot) time.Duration {
+	if recent.Count == 0 || recent.Count < p.MinSamples {
+		return p.Fallback
+	}
+
+	d := recent.Percentile(p.Percentile)
+	if d < p.Min {
+		d = p.Min
+	}
+	if p.Max > 0 && d > p.Max {
+		d = p.Max
+	}
+	return d
+}
+
+// ReconnectionPolicy interface is used by gocql to determine how long to wait
+// before connecting again to a host which could not be reached, or after the
+// control connection was lost.
+//
+// See ExponentialReconnectionPolicy and ConstantReconnectionPolicy.
+type ReconnectionPolicy interface {
+	// GetInterval returns the delay before the attempt-th reconnection,
+	// starting at 1 after the first failure.
+	GetInterval(attempt int) time.Duration
+}
+
+// ConstantReconnectionPolicy waits the same interval before every
+// reconnection.
+//
+//     cluster.ReconnectionPolicy = &gocql.ConstantReconnectionPolicy{Interval: time.Second}
+//
+type ConstantReconnectionPolicy struct {
+	Interval time.Duration
+}
+
+func (c *ConstantReconnectionPolicy) GetInterval(attempt int) time.Duration {
+	return c.Interval
+}
+
+// ExponentialReconnectionPolicy doubles the interval after every failed
+// reconnection, starting at InitialInterval and up to MaxInterval. A random
+// jitter picks the actual delay between half the interval and the interval,
+// so clients do not reconnect all at once to a host coming back up.
+//
+//     cluster.ReconnectionPolicy = &gocql.ExponentialReconnectionPolicy{
+//             InitialInterval: 100 * time.Millisecond,
+//             MaxInterval:     10 * time.Second,
+//     }
+//
+type ExponentialReconnectionPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func (e *ExponentialReconnectionPolicy) GetInterval(attempt int) time.Duration {
+	interval := e.InitialInterval
+	for i := 1; i < attempt && interval < 1<<62 && (e.MaxInterval <= 0 || interval < e.MaxInterval); i++ {
+		interval *= 2
+	}
+	if e.MaxInterval > 0 && interval > e.MaxInterval {
+		interval = e.MaxInterval
+	}
+
+	if interval < 2 {
+		return interval
+	}
+	return interval/2 + time.Duration(rand.Int63n(int64(interval/2)))
+}
+
+// reconnectionPolicy returns the configured reconnection policy, or the
+// default one of NewCluster.
+func (cfg *ClusterConfig) reconnectionPolicy() ReconnectionPolicy {
+	if cfg.ReconnectionPolicy == nil {
+		return &ExponentialReconnectionPolicy{
+			InitialInterval: 100 * time.Millisecond,
+			MaxInterval:     10 * time.Second,
+		}
+	}
+	return cfg.ReconnectionPolicy
+}
+
 //HostSelectionPolicy is an interface for selecting
 //the most appropriate host to execute a given query.
 type HostSelectionPolicy interface {
@@ -107,7 +333,7 @@ func (r *roundRobinHostPolicy) Pick(qry *Query) NextHost {
 
 //NewTokenAwareHostPolicy is a token aware host selection policy
 func NewTokenAwareHostPolicy(fallback HostSelectionPolicy) HostSelectionPolicy {
-	return &tokenAwareHostPolicy{fallback: fallback, hosts: []HostInfo{}}
+	return &tokenAwareHostPolicy{fallback: fallback, hosts: []HostInfo{}, logger: nopLogger{}}
 }
 
 type tokenAwareHostPolicy struct {
@@ -116,6 +342,17 @@ type tokenAwareHostPolicy struct {
 	partitioner string
 	tokenRing   *tokenRing
 	fallback    HostSelectionPolicy
+	logger      Logger
+}
+
+func (t *tokenAwareHostPolicy) SetLogger(logger Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if setter, ok := t.fallback.(SetLogger); ok {
+		setter.SetLogger(logger)
+	}
+	t.logger = logger
 }
 
 func (t *tokenAwareHostPolicy) SetHosts(hosts []HostInfo) {
@@ -150,7 +387,7 @@ func (t *tokenAwareHostPolicy) resetTokenRing() {
 	// create a new token ring
 	tokenRing, err := newTokenRing(t.partitioner, t.hosts)
 	if err != nil {
-		log.Printf("Unable to update the token ring due to error: %s", err)
+		t.logger.Warn("gocql: unable to update the token ring", "partitioner", t.partitioner, "error", err)
 		return
 	}
 
@@ -242,3 +479,46 @@ func (r *roundRobinConnPolicy) Pick(qry *Query) *Conn {
 	r.mu.RUnlock()
 	return conn
 }
+
+type leastInFlightConnPolicy struct {
+	conns []*Conn
+	pos   uint32
+	mu    sync.RWMutex
+}
+
+// NewLeastInFlightConnPolicy is a connection selection policy which picks the
+// connection with the fewest requests waiting for a response, connections
+// which are equally busy are picked by round-robin.
+func NewLeastInFlightConnPolicy() ConnSelectionPolicy {
+	return &leastInFlightConnPolicy{}
+}
+
+func (l *leastInFlightConnPolicy) SetConns(conns []*Conn) {
+	l.mu.Lock()
+	l.conns = conns
+	l.mu.Unlock()
+}
+
+func (l *leastInFlightConnPolicy) Pick(qry *Query) *Conn {
+	pos := atomic.AddUint32(&l.pos, 1)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var (
+		best      *Conn
+		available = -1
+	)
+	for i := range l.conns {
+		conn := l.conns[(pos+uint32(i))%uint32(len(l.conns))]
+		if conn.Closed() {
+			continue
+		}
+		// the streams which are not available are in flight
+		if n := conn.AvailableStreams(); n > available {
+			best, available = conn, n
+		}
+	}
+
+	return best
+}
@@ -4,7 +4,11 @@
 
 package gocql
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 // Tests of the round-robin host selection policy implementation
 func TestRoundRobinHostPolicy(t *testing.T) {
@@ -123,3 +127,191 @@ func TestRoundRobinConnPolicy(t *testing.T) {
 		t.Error("Expected conn1")
 	}
 }
+
+// Tests of the exponential reconnection policy implementation
+func TestExponentialReconnectionPolicy(t *testing.T) {
+	policy := &ExponentialReconnectionPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for i, max := range expected {
+		for j := 0; j < 10; j++ {
+			interval := policy.GetInterval(i + 1)
+			if interval < max/2 || interval > max {
+				t.Fatalf("attempt %d: expected an interval between %v and %v got %v", i+1, max/2, max, interval)
+			}
+		}
+	}
+
+	// a large attempt number must not overflow
+	if interval := policy.GetInterval(1000); interval < 500*time.Millisecond || interval > time.Second {
+		t.Errorf("expected an interval capped to %v got %v", time.Second, interval)
+	}
+}
+
+type constantBackoff time.Duration
+
+func (c constantBackoff) Attempt(q RetryableQuery) bool {
+	return true
+}
+
+func (c constantBackoff) Backoff(q RetryableQuery) time.Duration {
+	return time.Duration(c)
+}
+
+// Tests of the exponential backoff retry policy implementation
+func TestExponentialBackoffRetryPolicy(t *testing.T) {
+	policy := &ExponentialBackoffRetryPolicy{
+		NumRetries: 3,
+		Min:        10 * time.Millisecond,
+		Max:        50 * time.Millisecond,
+	}
+
+	bounds := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+	}
+
+	for i, max := range bounds {
+		q := &Query{attempts: i + 1}
+		if attempt := policy.Attempt(q); attempt != (i < 3) {
+			t.Errorf("attempt %d: expected Attempt to return %v", i+1, i < 3)
+		}
+		for j := 0; j < 10; j++ {
+			if d := policy.Backoff(q); d < 0 || d > max {
+				t.Fatalf("attempt %d: expected a delay up to %v got %v", i+1, max, d)
+			}
+		}
+	}
+
+	// the delay has a bound without Min
+	policy = &ExponentialBackoffRetryPolicy{NumRetries: 3, Max: time.Second}
+	var longest time.Duration
+	for j := 0; j < 100; j++ {
+		if d := policy.Backoff(&Query{attempts: 1}); d > longest {
+			longest = d
+		}
+	}
+	if longest <= 0 || longest > defaultRetryBackoffMin {
+		t.Errorf("expected delays up to %v got up to %v", defaultRetryBackoffMin, longest)
+	}
+
+	// the backoff is interrupted by the context of the query
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if retryBackoff(ctx, constantBackoff(time.Hour), &Query{attempts: 1}) {
+		t.Error("expected the backoff to be interrupted")
+	}
+
+	if !retryBackoff(context.Background(), &SimpleRetryPolicy{NumRetries: 1}, &Query{attempts: 1}) {
+		t.Error("expected the policies without backoff to retry at once")
+	}
+}
+
+func TestPercentileSpeculativeExecution(t *testing.T) {
+	policy := &PercentileSpeculativeExecution{
+		NumAttempts: 2,
+		Percentile:  0.9,
+		MinSamples:  10,
+		Fallback:    time.Second,
+		Min:         5 * time.Millisecond,
+		Max:         500 * time.Millisecond,
+	}
+
+	var h latencyHistogram
+	for i := 1; i <= 5; i++ {
+		h.record(time.Duration(i) * 10 * time.Millisecond)
+	}
+	if d := policy.Delay(h.snapshot()); d != time.Second {
+		t.Errorf("expected the fallback delay with too few samples got %v", d)
+	}
+	if d := (&PercentileSpeculativeExecution{NumAttempts: 1, MinSamples: 10}).Delay(h.snapshot()); d > 0 {
+		t.Errorf("expected no speculative execution without fallback got a delay of %v", d)
+	}
+
+	for i := 6; i <= 100; i++ {
+		h.record(time.Duration(i) * 10 * time.Millisecond)
+	}
+	if d := policy.Delay(h.snapshot()); d != 500*time.Millisecond {
+		t.Errorf("expected the delay to be bounded by %v got %v", policy.Max, d)
+	}
+
+	h = latencyHistogram{}
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * 100 * time.Microsecond)
+	}
+	if d := policy.Delay(h.snapshot()); d < 9*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("expected the p90 delay of about 9ms got %v", d)
+	}
+
+	h = latencyHistogram{}
+	for i := 0; i < 100; i++ {
+		h.record(time.Millisecond)
+	}
+	if d := policy.Delay(h.snapshot()); d != policy.Min {
+		t.Errorf("expected the delay to be at least %v got %v", policy.Min, d)
+	}
+}
+
+// Tests of the constant reconnection policy implementation
+func TestConstantReconnectionPolicy(t *testing.T) {
+	policy := &ConstantReconnectionPolicy{Interval: time.Second}
+
+	for attempt := 1; attempt < 5; attempt++ {
+		if interval := policy.GetInterval(attempt); interval != time.Second {
+			t.Errorf("attempt %d: expected %v got %v", attempt, time.Second, interval)
+		}
+	}
+}
+
+// Tests of the least in flight connection selection policy implementation
+func TestLeastInFlightConnPolicy(t *testing.T) {
+	policy := NewLeastInFlightConnPolicy()
+
+	newConn := func(available int) *Conn {
+		conn := &Conn{streams: newStreamIDs(11)}
+		for i := 0; i < 10-available; i++ {
+			conn.streams.get(nil)
+		}
+		return conn
+	}
+
+	busy, idle, closed := newConn(2), newConn(8), newConn(10)
+	closed.closed = 1
+	policy.SetConns([]*Conn{busy, idle, closed})
+
+	for i := 0; i < 3; i++ {
+		if conn := policy.Pick(nil); conn != idle {
+			t.Fatalf("expected the connection with the fewest requests in flight")
+		}
+	}
+
+	// equally busy connections are picked in turn
+	other := newConn(8)
+	policy.SetConns([]*Conn{busy, idle, other})
+
+	picked := make(map[*Conn]bool)
+	for i := 0; i < 3; i++ {
+		picked[policy.Pick(nil)] = true
+	}
+	if len(picked) != 2 || !picked[idle] || !picked[other] {
+		t.Errorf("expected both idle connections to be picked")
+	}
+
+	policy.SetConns(nil)
+	if conn := policy.Pick(nil); conn != nil {
+		t.Errorf("expected no connection to be picked")
+	}
+}
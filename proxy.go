@@ -0,0 +1,251 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrProxyScheme = errors.New("gocql: unsupported proxy scheme, expected socks5 or http")
+
+// ProxyFromEnvironment returns the URL of the proxy set in the ALL_PROXY or
+// all_proxy environment variables, or nil when they are not set.
+func ProxyFromEnvironment() (*url.URL, error) {
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		if v := os.Getenv(name); v != "" {
+			return url.Parse(v)
+		}
+	}
+	return nil, nil
+}
+
+// ProxyURL returns a function for ClusterConfig.Proxy which always returns
+// u.
+func ProxyURL(u *url.URL) func() (*url.URL, error) {
+	return func() (*url.URL, error) {
+		return u, nil
+	}
+}
+
+// NewProxyDialer returns a Dialer opening the connections through the proxy
+// at u, either a SOCKS5 proxy (socks5://[user:password@]host:port) or a
+// proxy supporting the HTTP CONNECT method (http://[user:password@]host:port).
+// The connections to the proxy are opened with forward, or a net.Dialer when
+// it is nil.
+func NewProxyDialer(u *url.URL, forward Dialer) (Dialer, error) {
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, ErrProxyScheme
+	}
+
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+
+	return &proxyDialer{url: u, forward: forward}, nil
+}
+
+type proxyDialer struct {
+	url     *url.URL
+	forward Dialer
+}
+
+func (d *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyAddr := d.url.Host
+	if d.url.Port() == "" {
+		port := "1080"
+		if d.url.Scheme == "http" {
+			port = "80"
+		}
+		proxyAddr = net.JoinHostPort(d.url.Hostname(), port)
+	}
+
+	conn, err := d.forward.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake with the proxy must complete within the dial timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if d.url.Scheme == "http" {
+		err = d.httpConnect(conn, addr)
+	} else {
+		err = d.socks5Connect(conn, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks the proxy to connect to addr with the CONNECT method.
+func (d *proxyDialer) httpConnect(conn net.Conn, addr string) error {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.url.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// the host does not send anything before the client so nothing is
+	// buffered past the response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gocql: proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5UserPassword = 0x02
+	socks5Connect      = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// socks5Connect asks the proxy to connect to addr, see RFC 1928 and RFC 1929
+// for the username and password authentication.
+func (d *proxyDialer) socks5Connect(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+
+	methods := []byte{socks5NoAuth}
+	if d.url.User != nil {
+		methods = append(methods, socks5UserPassword)
+	}
+
+	buf := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("gocql: unexpected SOCKS version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPassword:
+		if d.url.User == nil {
+			return errors.New("gocql: SOCKS proxy requires authentication")
+		}
+		user := d.url.User.Username()
+		password, _ := d.url.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("gocql: SOCKS username or password too long")
+		}
+
+		buf = []byte{0x01, byte(len(user))}
+		buf = append(buf, user...)
+		buf = append(buf, byte(len(password)))
+		buf = append(buf, password...)
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("gocql: SOCKS proxy rejected the username and password")
+		}
+	default:
+		return errors.New("gocql: no acceptable SOCKS authentication method")
+	}
+
+	buf = []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("gocql: SOCKS host name too long")
+		}
+		buf = append(buf, socks5AddrDomain, byte(len(host)))
+		buf = append(buf, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		buf = append(buf, socks5AddrIPv4)
+		buf = append(buf, ip4...)
+	} else {
+		buf = append(buf, socks5AddrIPv6)
+		buf = append(buf, ip...)
+	}
+	buf = append(buf, 0, 0)
+	binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(port))
+
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+
+	// version, status, reserved and type of the bound address
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("gocql: SOCKS proxy failed to connect to %s: status %d", addr, header[1])
+	}
+
+	var n int
+	switch header[3] {
+	case socks5AddrIPv4:
+		n = net.IPv4len
+	case socks5AddrIPv6:
+		n = net.IPv6len
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(conn, header[:1]); err != nil {
+			return err
+		}
+		n = int(header[0])
+	default:
+		return fmt.Errorf("gocql: unexpected SOCKS address type %d", header[3])
+	}
+
+	// discard the bound address and port
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
@@ -0,0 +1,167 @@
+// +build all unit
+
+package gocql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProxy is a SOCKS5 or HTTP CONNECT proxy accepting a single connection.
+type testProxy struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	target string
+	auth   string
+}
+
+func newTestProxy(t *testing.T, handshake func(p *testProxy, conn net.Conn) (string, error)) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProxy{listener: l}
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		target, err := handshake(p, conn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer upstream.Close()
+
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}()
+
+	return p
+}
+
+func socks5Handshake(p *testProxy, conn net.Conn) (string, error) {
+	buf := make([]byte, 262)
+
+	// greeting, the username and password method is picked when offered
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	methods := make([]byte, buf[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(methods, socks5UserPassword) >= 0 {
+		conn.Write([]byte{socks5Version, socks5UserPassword})
+
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return "", err
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		password := make([]byte, buf[0])
+		io.ReadFull(conn, password)
+
+		p.mu.Lock()
+		p.auth = string(user) + ":" + string(password)
+		p.mu.Unlock()
+		conn.Write([]byte{0x01, 0})
+	} else {
+		conn.Write([]byte{socks5Version, socks5NoAuth})
+	}
+
+	// connect request to an IPv4 address
+	if _, err := io.ReadFull(conn, buf[:10]); err != nil {
+		return "", err
+	}
+	target := net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[8:10]))))
+
+	p.mu.Lock()
+	p.target = target
+	p.mu.Unlock()
+
+	conn.Write([]byte{socks5Version, 0, 0, socks5AddrIPv4, 127, 0, 0, 1, 0, 0})
+	return target, nil
+}
+
+func httpConnectHandshake(p *testProxy, conn net.Conn) (string, error) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.target = req.Host
+	p.auth = req.Header.Get("Proxy-Authorization")
+	p.mu.Unlock()
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, nil
+}
+
+func TestProxyDialer(t *testing.T) {
+	tests := []struct {
+		scheme    string
+		handshake func(p *testProxy, conn net.Conn) (string, error)
+		auth      string
+	}{
+		{"socks5", socks5Handshake, "user:secret"},
+		{"http", httpConnectHandshake, "Basic dXNlcjpzZWNyZXQ="},
+	}
+
+	for _, test := range tests {
+		srv := NewTestServer(t, defaultProto)
+		proxy := newTestProxy(t, test.handshake)
+
+		u := &url.URL{Scheme: test.scheme, Host: proxy.listener.Addr().String(), User: url.UserPassword("user", "secret")}
+		dialer, err := NewProxyDialer(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := ConnConfig{ProtoVersion: int(defaultProto), Timeout: time.Second, Dialer: dialer}
+		conn, err := Connect(srv.Address, cfg, &testErrorHandler{errs: make(chan error, 1)})
+		if err != nil {
+			t.Fatalf("%s: %v", test.scheme, err)
+		}
+
+		proxy.mu.Lock()
+		if proxy.target != srv.Address {
+			t.Errorf("%s: expected the proxy to connect to %s got %s", test.scheme, srv.Address, proxy.target)
+		}
+		if proxy.auth != test.auth {
+			t.Errorf("%s: expected the credentials %q got %q", test.scheme, test.auth, proxy.auth)
+		}
+		proxy.mu.Unlock()
+
+		conn.Close()
+		proxy.listener.Close()
+		srv.Stop()
+	}
+}
+
+func TestProxyDialerScheme(t *testing.T) {
+	if _, err := NewProxyDialer(&url.URL{Scheme: "ftp", Host: "proxy"}, nil); err != ErrProxyScheme {
+		t.Errorf("expected %v got %v", ErrProxyScheme, err)
+	}
+}
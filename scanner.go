@@ -0,0 +1,189 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"sync"
+)
+
+// Scanner reads all the rows of a table by querying ranges of the token ring
+// concurrently, each range being sent to the host owning it. The progress of a
+// scan is reported per range so that an interrupted scan can be resumed
+// without reading the ranges already scanned again.
+//
+// A scanner is created with Session.Scanner, configured with its methods and
+// started with Run or Chan.
+type Scanner struct {
+	session      *Session
+	stmt         string
+	partitionKey []string
+
+	concurrency int
+	splits      int
+	ranges      []TokenRange
+	cons        Consistency
+	checkpoint  func(r TokenRange)
+
+	mu  sync.Mutex
+	err error
+
+	// checkpointMu serializes the calls of checkpoint
+	checkpointMu sync.Mutex
+}
+
+// Scanner returns a scanner running stmt on every range of the token ring. The
+// statement selects the rows of a table without a WHERE clause, for instance
+// "SELECT id, name FROM users", the condition on the tokens of the range is
+// appended to it. The partition key are the names of the partition key
+// columns of the table in order.
+//
+// By default the ranges between the tokens of the ring are scanned without
+// being split, 8 at a time.
+func (s *Session) Scanner(stmt string, partitionKey ...string) *Scanner {
+	return &Scanner{
+		session:      s,
+		stmt:         stmt,
+		partitionKey: partitionKey,
+		concurrency:  8,
+		cons:         s.cons,
+	}
+}
+
+// Concurrency sets the number of ranges scanned concurrently.
+func (sc *Scanner) Concurrency(n int) *Scanner {
+	if n > 0 {
+		sc.concurrency = n
+	}
+	return sc
+}
+
+// Splits sets the number of ranges the token ring is split into, see
+// Session.TokenRanges. The ranges between the tokens are not split when n is
+// lower than the number of tokens.
+func (sc *Scanner) Splits(n int) *Scanner {
+	sc.splits = n
+	return sc
+}
+
+// Ranges sets the token ranges to scan instead of the ranges of the whole ring,
+// to resume a scan with the ranges which were not reported by Checkpoint.
+func (sc *Scanner) Ranges(ranges []TokenRange) *Scanner {
+	sc.ranges = ranges
+	return sc
+}
+
+// Consistency sets the consistency of the range queries.
+func (sc *Scanner) Consistency(cons Consistency) *Scanner {
+	sc.cons = cons
+	return sc
+}
+
+// Checkpoint sets a function called once the rows of a range were all
+// processed, the calls are serialized.
+func (sc *Scanner) Checkpoint(fn func(r TokenRange)) *Scanner {
+	sc.checkpoint = fn
+	return sc
+}
+
+// Run scans the ranges and calls fn with the iterator over the rows of each
+// range, fn is called concurrently and must read the rows from the iterator.
+// The scan stops at the first error returned by fn or by the iterator of a
+// range, which is returned once the ranges being scanned are done.
+func (sc *Scanner) Run(fn func(r TokenRange, iter *Iter) error) error {
+	ranges := sc.ranges
+	if ranges == nil {
+		var err error
+		if ranges, err = sc.session.TokenRanges(sc.splits); err != nil {
+			return err
+		}
+	}
+
+	work := make(chan TokenRange)
+	var wg sync.WaitGroup
+	for i := 0; i < sc.concurrency && i < len(ranges); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				sc.scanRange(r, fn)
+			}
+		}()
+	}
+
+	for _, r := range ranges {
+		if sc.Err() != nil {
+			break
+		}
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+
+	return sc.Err()
+}
+
+// Chan scans the ranges in the background and sends the rows to the returned
+// channel, the channel is closed once the scan is done and Err returns the
+// error which stopped the scan if any. The rows must all be received for the
+// scan to complete.
+func (sc *Scanner) Chan() <-chan map[string]interface{} {
+	rows := make(chan map[string]interface{}, sc.concurrency)
+	go func() {
+		defer close(rows)
+
+		err := sc.Run(func(r TokenRange, iter *Iter) error {
+			for {
+				row := make(map[string]interface{})
+				if !iter.MapScan(row) {
+					return nil
+				}
+				rows <- row
+			}
+		})
+		sc.setErr(err)
+	}()
+	return rows
+}
+
+// Err returns the error which stopped the scan.
+func (sc *Scanner) Err() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return sc.err
+}
+
+// setErr keeps the first error of the scan.
+func (sc *Scanner) setErr(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.err == nil {
+		sc.err = err
+	}
+}
+
+func (sc *Scanner) scanRange(r TokenRange, fn func(r TokenRange, iter *Iter) error) {
+	cond, values := r.Predicate(sc.partitionKey...)
+
+	qry := sc.session.Query(sc.stmt+" WHERE "+cond, values...).Consistency(sc.cons)
+	qry.host = r.Host.Peer
+
+	iter := qry.Iter()
+	err := fn(r, iter)
+	if closeErr := iter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		sc.setErr(err)
+		return
+	}
+
+	if sc.checkpoint != nil {
+		sc.checkpointMu.Lock()
+		sc.checkpoint(r)
+		sc.checkpointMu.Unlock()
+	}
+}
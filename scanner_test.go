@@ -0,0 +1,89 @@
+// +build all unit
+
+package gocql
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestScannerRanges(t *testing.T) {
+	srv1 := NewTestServer(t, defaultProto)
+	defer srv1.Stop()
+	srv2 := NewTestServer(t, defaultProto)
+	defer srv2.Stop()
+
+	cluster := NewCluster(srv1.Address, srv2.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.ConnPoolType = NewRoundRobinConnPool
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the ranges owned by the second server are all sent to it
+	host := HostInfo{Peer: srv2.Address}
+	ranges := []TokenRange{
+		{End: "-100", Host: host},
+		{Start: "-100", End: "0", Host: host},
+		{Start: "0", End: "100", Host: host},
+		{Start: "100", Host: host},
+	}
+
+	before1, before2 := atomic.LoadUint64(&srv1.nreq), atomic.LoadUint64(&srv2.nreq)
+
+	var scanned int32
+	var done []TokenRange
+	err = db.Scanner("void", "id").
+		Concurrency(2).
+		Ranges(ranges).
+		Checkpoint(func(r TokenRange) {
+			done = append(done, r)
+		}).
+		Run(func(r TokenRange, iter *Iter) error {
+			atomic.AddInt32(&scanned, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scanned != 4 || len(done) != 4 {
+		t.Errorf("expected 4 ranges scanned and checkpointed got %d and %d", scanned, len(done))
+	}
+	if n := atomic.LoadUint64(&srv1.nreq) - before1; n != 0 {
+		t.Errorf("expected no request to the first server got %d", n)
+	}
+	if n := atomic.LoadUint64(&srv2.nreq) - before2; n != 4 {
+		t.Errorf("expected 4 requests to the second server got %d", n)
+	}
+}
+
+func TestScannerError(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the ranges are not checkpointed when the query fails
+	var done int
+	err = db.Scanner("kill", "id").
+		Ranges([]TokenRange{{Start: "0"}, {End: "0"}}).
+		Checkpoint(func(r TokenRange) {
+			done++
+		}).
+		Run(func(r TokenRange, iter *Iter) error {
+			return nil
+		})
+	if err == nil {
+		t.Error("expected the error of the range query")
+	}
+	if done != 0 {
+		t.Errorf("expected no range checkpointed got %d", done)
+	}
+}
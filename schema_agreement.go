@@ -0,0 +1,88 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNoSchemaAgreement = errors.New("gocql: no schema agreement between the hosts")
+
+// schemaAgreementInterval is the delay between two polls of the schema
+// versions of the hosts.
+const schemaAgreementInterval = 200 * time.Millisecond
+
+// hostDownChecker is implemented by the pools knowing which hosts are down.
+type hostDownChecker interface {
+	isHostDown(addr string) bool
+}
+
+// AwaitSchemaAgreement waits until the hosts of the cluster agree on the
+// version of the schema, which is needed before using a table or type
+// created or changed on another host. The schema versions are read from
+// system.local and system.peers, the hosts known to be down are ignored. It
+// returns ErrNoSchemaAgreement when ctx is done before the hosts agree.
+func (s *Session) AwaitSchemaAgreement(ctx context.Context) error {
+	for {
+		if s.Closed() {
+			return ErrSessionClosed
+		}
+
+		versions, err := s.schemaVersions()
+		if err == nil && len(versions) <= 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return err
+			}
+			s.cfg.logger().Warn("gocql: no schema agreement between the hosts", "versions", versions)
+			return ErrNoSchemaAgreement
+		case <-time.After(schemaAgreementInterval):
+		}
+	}
+}
+
+// schemaVersions returns the hosts by schema version, system.local and
+// system.peers are queried on the same host.
+func (s *Session) schemaVersions() (map[string][]string, error) {
+	conn := s.Pool.Pick(nil)
+	if conn == nil {
+		return nil, ErrNoConnections
+	}
+
+	versions := make(map[string][]string)
+
+	var version UUID
+	iter := conn.executeQuery(s.Query("SELECT schema_version FROM system.local"))
+	if iter.Scan(&version) {
+		versions[version.String()] = append(versions[version.String()], conn.Address())
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	checker, _ := s.Pool.(hostDownChecker)
+
+	var peer, rpcAddress string
+	iter = conn.executeQuery(s.Query("SELECT peer, rpc_address, schema_version FROM system.peers"))
+	for iter.Scan(&peer, &rpcAddress, &version) {
+		addr := s.cfg.translateAddress(peerAddress(peer, rpcAddress))
+		// the hosts joining the cluster have no schema version yet
+		if version == (UUID{}) || (checker != nil && checker.isHostDown(addr)) {
+			continue
+		}
+		versions[version.String()] = append(versions[version.String()], addr)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,138 @@
+// +build all unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSchemaVersionServer returns a server whose peer agrees on the schema
+// version of the server after the given number of polls of system.peers.
+func newSchemaVersionServer(t *testing.T, polls int32) *TestServer {
+	local, _ := ParseUUID("8a9c9e3a-6f3c-11e5-9d70-feff819cdc9f")
+	other, _ := ParseUUID("9b8d8f4b-6f3c-11e5-9d70-feff819cdc9f")
+
+	var n int32
+	srv := NewTestServer(t, defaultProto)
+	srv.queryRows = func(query string) *testRows {
+		switch {
+		case strings.Contains(query, "system.local"):
+			return &testRows{
+				columns: []string{"schema_version"},
+				types:   []Type{TypeUUID},
+				rows:    [][][]byte{{local.Bytes()}},
+			}
+		case strings.Contains(query, "system.peers"):
+			version := other
+			if atomic.AddInt32(&n, 1) > polls {
+				version = local
+			}
+			peer := []byte(net.ParseIP("127.0.0.2").To4())
+			return &testRows{
+				columns: []string{"peer", "rpc_address", "schema_version"},
+				types:   []Type{TypeInet, TypeInet, TypeUUID},
+				rows: [][][]byte{
+					{peer, peer, version.Bytes()},
+					// a joining host without schema version is ignored
+					{[]byte{127, 0, 0, 3}, []byte{127, 0, 0, 3}, nil},
+				},
+			}
+		}
+		return nil
+	}
+	return srv
+}
+
+func TestAwaitSchemaAgreement(t *testing.T) {
+	srv := newSchemaVersionServer(t, 2)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.AwaitSchemaAgreement(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAwaitSchemaAgreementTimeout(t *testing.T) {
+	srv := newSchemaVersionServer(t, 1000)
+	defer srv.Stop()
+
+	db, err := newTestSession(srv.Address, defaultProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if err := db.AwaitSchemaAgreement(ctx); err != ErrNoSchemaAgreement {
+		t.Fatalf("expected ErrNoSchemaAgreement got %v", err)
+	}
+}
+
+func TestSchemaChangeWaitsForAgreement(t *testing.T) {
+	srv := newSchemaVersionServer(t, 1000)
+	defer srv.Stop()
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.MaxWaitSchemaAgreement = 300 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("create table t (id int primary key)").Exec(); err != ErrNoSchemaAgreement {
+		t.Fatalf("expected ErrNoSchemaAgreement got %v", err)
+	}
+	// the other statements do not wait
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaChangeAgreementError(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+	// the schema versions can not be read
+	srv.queryRows = func(query string) *testRows {
+		if strings.Contains(query, "system.local") {
+			return &testRows{
+				columns: []string{"schema_version"},
+				types:   []Type{TypeInt},
+				rows:    [][][]byte{{{0, 0, 0, 1}}},
+			}
+		}
+		return nil
+	}
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.MaxWaitSchemaAgreement = 300 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Query("create table t (id int primary key)").Exec()
+	if !errors.Is(err, ErrNoSchemaAgreement) {
+		t.Fatalf("expected ErrNoSchemaAgreement got %v", err)
+	}
+}
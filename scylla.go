@@ -0,0 +1,123 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"math/bits"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// scyllaShardInfo is the sharding of a Scylla host advertised in the options
+// it supports. Each shard of a host owns a part of the token range and the
+// requests for the other tokens are forwarded between the shards, which is
+// avoided by sending them on a connection to the owning shard.
+type scyllaShardInfo struct {
+	// shard is the shard handling the connection
+	shard     int
+	nrShards  int
+	msbIgnore uint
+
+	// shardAwarePort and shardAwarePortSSL are the ports on which the host
+	// assigns the connections to the shard picked by their source port,
+	// zero when the host does not listen on them
+	shardAwarePort    int
+	shardAwarePortSSL int
+}
+
+// parseScyllaShardInfo returns the sharding advertised in the supported
+// options, it returns false for the hosts which are not Scylla hosts or use
+// a sharding the driver does not know.
+func parseScyllaShardInfo(supported map[string][]string) (scyllaShardInfo, bool) {
+	option := func(name string) string {
+		if values := supported[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if option("SCYLLA_SHARDING_ALGORITHM") != "biased-token-round-robin" ||
+		option("SCYLLA_PARTITIONER") != "org.apache.cassandra.dht.Murmur3Partitioner" {
+		return scyllaShardInfo{}, false
+	}
+
+	shard, err := strconv.Atoi(option("SCYLLA_SHARD"))
+	if err != nil {
+		return scyllaShardInfo{}, false
+	}
+	nrShards, err := strconv.Atoi(option("SCYLLA_NR_SHARDS"))
+	if err != nil || nrShards <= 0 || shard < 0 || shard >= nrShards {
+		return scyllaShardInfo{}, false
+	}
+	msbIgnore, err := strconv.ParseUint(option("SCYLLA_SHARDING_IGNORE_MSB"), 10, 8)
+	if err != nil {
+		return scyllaShardInfo{}, false
+	}
+
+	info := scyllaShardInfo{
+		shard:     shard,
+		nrShards:  nrShards,
+		msbIgnore: uint(msbIgnore),
+	}
+
+	// the shard-aware ports are optional
+	info.shardAwarePort, _ = strconv.Atoi(option("SCYLLA_SHARD_AWARE_PORT"))
+	info.shardAwarePortSSL, _ = strconv.Atoi(option("SCYLLA_SHARD_AWARE_PORT_SSL"))
+
+	return info, true
+}
+
+// shardOf returns the shard owning a murmur3 token.
+func (s scyllaShardInfo) shardOf(token murmur3Token) int {
+	biased := uint64(token) + 1<<63
+	biased <<= s.msbIgnore
+	shard, _ := bits.Mul64(biased, uint64(s.nrShards))
+	return int(shard)
+}
+
+const (
+	// the source ports of the connections to the shard-aware port are taken
+	// from the range of the ephemeral ports
+	scyllaMinLocalPort = 49152
+	scyllaMaxLocalPort = 65535
+	// scyllaLocalPortAttempts is the number of source ports tried before
+	// falling back to the regular port
+	scyllaLocalPortAttempts = 16
+)
+
+// localPorts returns random source ports which the shard-aware port assigns
+// to shard.
+func (s scyllaShardInfo) localPorts(shard int) []int {
+	// first port of the range assigned to shard
+	first := scyllaMinLocalPort + (shard-scyllaMinLocalPort%s.nrShards+s.nrShards)%s.nrShards
+	if first > scyllaMaxLocalPort {
+		return nil
+	}
+	n := (scyllaMaxLocalPort-first)/s.nrShards + 1
+
+	ports := make([]int, 0, scyllaLocalPortAttempts)
+	start := rand.Intn(n)
+	for i := 0; i < scyllaLocalPortAttempts && i < n; i++ {
+		ports = append(ports, first+(start+i)%n*s.nrShards)
+	}
+	return ports
+}
+
+// isLocalPortInUse returns true if err is the failure to dial from a local
+// port which is already in use.
+func isLocalPortInUse(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+	return sysErr.Err == syscall.EADDRINUSE || sysErr.Err == syscall.EADDRNOTAVAIL
+}
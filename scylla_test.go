@@ -0,0 +1,189 @@
+// +build all unit
+
+package gocql
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseScyllaShardInfo(t *testing.T) {
+	supported := map[string][]string{
+		"SCYLLA_SHARD":               {"3"},
+		"SCYLLA_NR_SHARDS":           {"12"},
+		"SCYLLA_PARTITIONER":         {"org.apache.cassandra.dht.Murmur3Partitioner"},
+		"SCYLLA_SHARDING_ALGORITHM":  {"biased-token-round-robin"},
+		"SCYLLA_SHARDING_IGNORE_MSB": {"12"},
+	}
+
+	info, ok := parseScyllaShardInfo(supported)
+	if !ok {
+		t.Fatal("expected the sharding to be parsed")
+	}
+	if expected := (scyllaShardInfo{shard: 3, nrShards: 12, msbIgnore: 12}); info != expected {
+		t.Errorf("expected %+v got %+v", expected, info)
+	}
+
+	if _, ok := parseScyllaShardInfo(map[string][]string{"COMPRESSION": {"snappy"}}); ok {
+		t.Error("expected no sharding for a Cassandra host")
+	}
+
+	supported["SCYLLA_SHARDING_ALGORITHM"] = []string{"unknown"}
+	if _, ok := parseScyllaShardInfo(supported); ok {
+		t.Error("expected no sharding for an unknown algorithm")
+	}
+}
+
+func TestScyllaShardOf(t *testing.T) {
+	tests := []struct {
+		info     scyllaShardInfo
+		token    murmur3Token
+		expected int
+	}{
+		{scyllaShardInfo{nrShards: 4}, math.MinInt64, 0},
+		{scyllaShardInfo{nrShards: 4}, -1, 1},
+		{scyllaShardInfo{nrShards: 4}, 0, 2},
+		{scyllaShardInfo{nrShards: 4}, math.MaxInt64, 3},
+		{scyllaShardInfo{nrShards: 4, msbIgnore: 1}, 0, 0},
+		{scyllaShardInfo{nrShards: 4, msbIgnore: 1}, -1, 3},
+		{scyllaShardInfo{nrShards: 4, msbIgnore: 1}, 1 << 61, 1},
+	}
+
+	for _, test := range tests {
+		if shard := test.info.shardOf(test.token); shard != test.expected {
+			t.Errorf("%+v shardOf(%d): expected %d got %d", test.info, test.token, test.expected, shard)
+		}
+	}
+}
+
+func TestHostConnPoolSharded(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	srv.supported = map[string][]string{
+		"SCYLLA_SHARD":               {"0"},
+		"SCYLLA_NR_SHARDS":           {"1"},
+		"SCYLLA_PARTITIONER":         {"org.apache.cassandra.dht.Murmur3Partitioner"},
+		"SCYLLA_SHARDING_ALGORITHM":  {"biased-token-round-robin"},
+		"SCYLLA_SHARDING_IGNORE_MSB": {"12"},
+	}
+
+	host, portStr, err := net.SplitHostPort(srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := net.LookupPort("tcp", portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := ConnConfig{ProtoVersion: int(defaultProto), Timeout: time.Second}
+	pool := newHostConnPool(host, port, 3, cfg, "", NewRoundRobinConnPolicy(), &ConstantReconnectionPolicy{}, false)
+	defer pool.Close()
+
+	// a connection per shard regardless of the configured size
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected 1 connection got %d", size)
+	}
+
+	qry := &Query{routingKey: []byte("key")}
+	if conn := pool.Pick(qry); conn == nil || conn.scylla == nil || conn.scylla.shard != 0 {
+		t.Errorf("expected the connection to shard 0 got %v", conn)
+	}
+}
+
+func TestScyllaLocalPorts(t *testing.T) {
+	info := scyllaShardInfo{nrShards: 7}
+
+	for shard := 0; shard < info.nrShards; shard++ {
+		ports := info.localPorts(shard)
+		if len(ports) != scyllaLocalPortAttempts {
+			t.Fatalf("shard %d: expected %d ports got %v", shard, scyllaLocalPortAttempts, ports)
+		}
+		for _, port := range ports {
+			if port < scyllaMinLocalPort || port > scyllaMaxLocalPort || port%info.nrShards != shard {
+				t.Errorf("shard %d: unexpected port %d", shard, port)
+			}
+		}
+	}
+}
+
+func newShardedTestServer(t *testing.T, shard, nrShards int, shardAwarePort string) (*TestServer, string, int) {
+	srv := NewTestServer(t, defaultProto)
+	srv.supported = map[string][]string{
+		"SCYLLA_SHARD":               {strconv.Itoa(shard)},
+		"SCYLLA_NR_SHARDS":           {strconv.Itoa(nrShards)},
+		"SCYLLA_PARTITIONER":         {"org.apache.cassandra.dht.Murmur3Partitioner"},
+		"SCYLLA_SHARDING_ALGORITHM":  {"biased-token-round-robin"},
+		"SCYLLA_SHARDING_IGNORE_MSB": {"12"},
+	}
+	if shardAwarePort != "" {
+		srv.supported["SCYLLA_SHARD_AWARE_PORT"] = []string{shardAwarePort}
+	}
+
+	host, portStr, err := net.SplitHostPort(srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, host, port
+}
+
+func TestHostConnPoolShardAwarePort(t *testing.T) {
+	// the shard-aware port is served by another server which always
+	// reports the shard picked by the driver
+	shardSrv, _, shardPort := newShardedTestServer(t, 1, 2, "")
+	defer shardSrv.Stop()
+	srv, host, port := newShardedTestServer(t, 0, 2, strconv.Itoa(shardPort))
+	defer srv.Stop()
+
+	cfg := ConnConfig{ProtoVersion: int(defaultProto), Timeout: time.Second}
+	pool := newHostConnPool(host, port, 1, cfg, "", NewRoundRobinConnPolicy(), &ConstantReconnectionPolicy{}, false)
+	defer pool.Close()
+
+	if size := pool.Size(); size != 2 {
+		t.Fatalf("expected 2 connections got %d", size)
+	}
+
+	conn := pool.shards[1]
+	if conn == nil || conn.Address() != shardSrv.Address {
+		t.Fatalf("expected a connection to the shard-aware port got %v", conn)
+	}
+	if localPort := conn.conn.LocalAddr().(*net.TCPAddr).Port; localPort%2 != 1 {
+		t.Errorf("expected an odd source port got %d", localPort)
+	}
+}
+
+func TestHostConnPoolShardAwarePortFallback(t *testing.T) {
+	// reserve a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	srv, host, port := newShardedTestServer(t, 0, 2, closedPort)
+	defer srv.Stop()
+
+	cfg := ConnConfig{ProtoVersion: int(defaultProto), Timeout: time.Second}
+	pool := newHostConnPool(host, port, 1, cfg, "", NewRoundRobinConnPolicy(), &ConstantReconnectionPolicy{}, false)
+	defer pool.Close()
+
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected 1 connection got %d", size)
+	}
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	if !pool.noShardAwarePort {
+		t.Error("expected the shard-aware port to be disabled")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Protocol v5 wraps frames in segments which carry their own checksums and
+// are compressed as a whole instead of frame by frame. A segment header is
+// made of a little endian bit field followed by its CRC24:
+//
+//	uncompressed: payload length (17 bits), self contained flag (1 bit)
+//	compressed:   compressed length (17 bits), uncompressed length (17 bits),
+//	              self contained flag (1 bit)
+//
+// The payload is followed by the CRC32 of the payload as it was written,
+// that is after compression. An uncompressed length of 0 in a compressed
+// segment means the payload did not compress and was written as is.
+
+const (
+	maxSegmentPayload = 1<<17 - 1
+
+	segmentHeaderSize           = 6
+	compressedSegmentHeaderSize = 8
+
+	crc24Init = 0x875060
+	crc24Poly = 0x1974F0B
+)
+
+var (
+	ErrSegmentHeaderChecksum  = errors.New("segment header checksum mismatch")
+	ErrSegmentPayloadChecksum = errors.New("segment payload checksum mismatch")
+)
+
+// BlockCompressor compresses the segments of protocol v5 connections. Unlike
+// Compressor the compressed blocks do not carry their uncompressed length,
+// which is sent in the segment header instead. DecompressBlock must not
+// retain src, whose buffer is reused.
+type BlockCompressor interface {
+	Name() string
+	CompressBlock(src []byte) ([]byte, error)
+	DecompressBlock(src []byte, uncompressedLength int) ([]byte, error)
+}
+
+// segmentCRCInit are the bytes the payload CRC32 is seeded with.
+var segmentCRCInit = []byte{0xfa, 0x2d, 0x55, 0xca}
+
+func crc24(v uint64, n int) uint32 {
+	crc := uint32(crc24Init)
+	for ; n > 0; n-- {
+		crc ^= uint32(v&0xff) << 16
+		v >>= 8
+
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+func segmentCRC32(p []byte) uint32 {
+	crc := crc32.ChecksumIEEE(segmentCRCInit)
+	return crc32.Update(crc, crc32.IEEETable, p)
+}
+
+func putUint24(p []byte, v uint32) {
+	p[0] = byte(v)
+	p[1] = byte(v >> 8)
+	p[2] = byte(v >> 16)
+}
+
+func readUint24(p []byte) uint32 {
+	return uint32(p[0]) | uint32(p[1])<<8 | uint32(p[2])<<16
+}
+
+// writeSegment writes payload as a single segment, compressing it when comp
+// is not nil.
+func writeSegment(w io.Writer, payload []byte, selfContained bool, comp BlockCompressor) error {
+	if len(payload) > maxSegmentPayload {
+		return fmt.Errorf("segment payload too large: %d", len(payload))
+	}
+
+	var buf []byte
+	if comp == nil {
+		header := uint64(len(payload))
+		if selfContained {
+			header |= 1 << 17
+		}
+
+		buf = getBuffer(segmentHeaderSize + len(payload) + 4)[:segmentHeaderSize]
+		putUint24(buf, uint32(header))
+		putUint24(buf[3:], crc24(header, 3))
+	} else {
+		compressed, err := comp.CompressBlock(payload)
+		if err != nil {
+			return err
+		}
+
+		uncompressedLen := len(payload)
+		if len(compressed) >= len(payload) {
+			// not worth it, send the payload as is
+			compressed = payload
+			uncompressedLen = 0
+		}
+		payload = compressed
+
+		header := uint64(len(payload)) | uint64(uncompressedLen)<<17
+		if selfContained {
+			header |= 1 << 34
+		}
+
+		buf = getBuffer(compressedSegmentHeaderSize + len(payload) + 4)[:compressedSegmentHeaderSize]
+		binary.LittleEndian.PutUint64(buf, header|uint64(crc24(header, 5))<<40)
+	}
+
+	buf = append(buf, payload...)
+	buf = append(buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], segmentCRC32(payload))
+
+	_, err := w.Write(buf)
+	putBuffer(buf)
+	return err
+}
+
+// readSegment reads a segment written with the same compression settings and
+// returns its uncompressed payload, which may come from the buffer pools.
+func readSegment(r io.Reader, comp BlockCompressor) (payload []byte, selfContained bool, err error) {
+	var (
+		head            [compressedSegmentHeaderSize]byte
+		length          int
+		uncompressedLen int
+	)
+
+	if comp == nil {
+		if _, err := io.ReadFull(r, head[:segmentHeaderSize]); err != nil {
+			return nil, false, err
+		}
+
+		header := readUint24(head[:])
+		if crc24(uint64(header), 3) != readUint24(head[3:]) {
+			return nil, false, ErrSegmentHeaderChecksum
+		}
+
+		length = int(header & maxSegmentPayload)
+		selfContained = header&(1<<17) != 0
+	} else {
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, false, err
+		}
+
+		v := binary.LittleEndian.Uint64(head[:])
+		header := v & (1<<40 - 1)
+		if uint64(crc24(header, 5)) != v>>40 {
+			return nil, false, ErrSegmentHeaderChecksum
+		}
+
+		length = int(header & maxSegmentPayload)
+		uncompressedLen = int(header >> 17 & maxSegmentPayload)
+		selfContained = header&(1<<34) != 0
+	}
+
+	buf := getBuffer(length + 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		putBuffer(buf)
+		return nil, false, err
+	}
+
+	payload = buf[:length]
+	if segmentCRC32(payload) != binary.LittleEndian.Uint32(buf[length:]) {
+		putBuffer(buf)
+		return nil, false, ErrSegmentPayloadChecksum
+	}
+
+	if uncompressedLen > 0 {
+		payload, err = comp.DecompressBlock(payload, uncompressedLen)
+		putBuffer(buf)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return payload, selfContained, nil
+}
+
+// segmentReader reads the frames carried by the segments read from r, the
+// frames split in several segments are read as if they were not.
+type segmentReader struct {
+	r    io.Reader
+	comp BlockCompressor
+	// buf is the payload of the current segment, returned to the buffer
+	// pools once it has been read
+	buf     []byte
+	payload []byte
+}
+
+func newSegmentReader(r io.Reader, comp BlockCompressor) *segmentReader {
+	return &segmentReader{r: r, comp: comp}
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	for len(s.payload) == 0 {
+		putBuffer(s.buf)
+		s.buf = nil
+
+		payload, _, err := readSegment(s.r, s.comp)
+		if err != nil {
+			return 0, err
+		}
+		s.buf = payload
+		s.payload = payload
+	}
+
+	n := copy(p, s.payload)
+	s.payload = s.payload[n:]
+	return n, nil
+}
+
+// appendSegments appends the segments carrying the frames p to the buffer,
+// the frames too large for a segment are split in several ones.
+func appendSegments(buf *bytes.Buffer, p []byte, comp BlockCompressor) error {
+	selfContained := len(p) <= maxSegmentPayload
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxSegmentPayload {
+			n = maxSegmentPayload
+		}
+		if err := writeSegment(buf, p[:n], selfContained, comp); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
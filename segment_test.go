@@ -0,0 +1,169 @@
+// +build all unit
+
+package gocql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+type testBlockCompressor struct{}
+
+func (testBlockCompressor) Name() string {
+	return "test"
+}
+
+func (testBlockCompressor) CompressBlock(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (testBlockCompressor) DecompressBlock(src []byte, uncompressedLength int) ([]byte, error) {
+	p, err := snappy.Decode(nil, src)
+	if err != nil {
+		return nil, err
+	} else if len(p) != uncompressedLength {
+		return nil, fmt.Errorf("expected %d uncompressed bytes got %d", uncompressedLength, len(p))
+	}
+	return p, nil
+}
+
+func TestCRC24(t *testing.T) {
+	// an empty input is the initial value
+	if crc := crc24(0, 0); crc != crc24Init {
+		t.Errorf("expected crc24 of nothing to be 0x%x, got 0x%x", crc24Init, crc)
+	}
+	if crc24(1, 3) == crc24(1<<8, 3) {
+		t.Error("expected crc24 to depend on the byte order")
+	}
+	if crc := crc24(0xffffffffff, 5); crc > 0xffffff {
+		t.Errorf("expected crc24 to fit in 24 bits, got 0x%x", crc)
+	}
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		{},
+		[]byte("abc"),
+		bytes.Repeat([]byte("abcdef"), 1000),
+		bytes.Repeat([]byte{0xff}, maxSegmentPayload),
+	}
+
+	for _, comp := range []BlockCompressor{nil, testBlockCompressor{}} {
+		for _, payload := range payloads {
+			for _, selfContained := range []bool{true, false} {
+				buf := &bytes.Buffer{}
+				if err := writeSegment(buf, payload, selfContained, comp); err != nil {
+					t.Fatal(err)
+				}
+
+				p, sc, err := readSegment(buf, comp)
+				if err != nil {
+					t.Fatalf("compressor=%v len=%d: %v", comp, len(payload), err)
+				}
+				if !bytes.Equal(p, payload) {
+					t.Errorf("compressor=%v len=%d: payload mismatch", comp, len(payload))
+				}
+				if sc != selfContained {
+					t.Errorf("compressor=%v len=%d: expected self contained %v got %v", comp, len(payload), selfContained, sc)
+				}
+				if buf.Len() != 0 {
+					t.Errorf("compressor=%v len=%d: %d trailing bytes", comp, len(payload), buf.Len())
+				}
+			}
+		}
+	}
+}
+
+func TestSegmentCompressedLayout(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	// incompressible payloads are sent as is with an uncompressed length of 0
+	if err := writeSegment(buf, []byte("abc"), true, testBlockCompressor{}); err != nil {
+		t.Fatal(err)
+	}
+	if p := buf.Bytes(); len(p) != compressedSegmentHeaderSize+3+4 {
+		t.Fatalf("expected an uncompressed payload, got segment %x", p)
+	} else if header := uint64(p[0]) | uint64(p[1])<<8 | uint64(p[2])<<16 | uint64(p[3])<<24 | uint64(p[4])<<32; header != 3|1<<34 {
+		t.Fatalf("expected header 0x%x got 0x%x", uint64(3|1<<34), header)
+	}
+
+	buf.Reset()
+	payload := bytes.Repeat([]byte("abcdef"), 1000)
+	if err := writeSegment(buf, payload, false, testBlockCompressor{}); err != nil {
+		t.Fatal(err)
+	}
+	p := buf.Bytes()
+	header := uint64(p[0]) | uint64(p[1])<<8 | uint64(p[2])<<16 | uint64(p[3])<<24 | uint64(p[4])<<32
+	if n := int(header >> 17 & maxSegmentPayload); n != len(payload) {
+		t.Fatalf("expected uncompressed length %d got %d", len(payload), n)
+	}
+	if n := int(header & maxSegmentPayload); n != len(p)-compressedSegmentHeaderSize-4 {
+		t.Fatalf("expected compressed length %d got %d", len(p)-compressedSegmentHeaderSize-4, n)
+	}
+}
+
+func TestSegmentChecksums(t *testing.T) {
+	for _, comp := range []BlockCompressor{nil, testBlockCompressor{}} {
+		buf := &bytes.Buffer{}
+		if err := writeSegment(buf, bytes.Repeat([]byte("abc"), 100), true, comp); err != nil {
+			t.Fatal(err)
+		}
+		segment := buf.Bytes()
+
+		corrupt := append([]byte(nil), segment...)
+		corrupt[1] ^= 0x01
+		if _, _, err := readSegment(bytes.NewReader(corrupt), comp); err != ErrSegmentHeaderChecksum {
+			t.Errorf("compressor=%v: expected %v got %v", comp, ErrSegmentHeaderChecksum, err)
+		}
+
+		corrupt = append([]byte(nil), segment...)
+		corrupt[len(corrupt)-5] ^= 0x01
+		if _, _, err := readSegment(bytes.NewReader(corrupt), comp); err != ErrSegmentPayloadChecksum {
+			t.Errorf("compressor=%v: expected %v got %v", comp, ErrSegmentPayloadChecksum, err)
+		}
+	}
+
+	if err := writeSegment(&bytes.Buffer{}, make([]byte, maxSegmentPayload+1), true, nil); err == nil {
+		t.Error("expected an error writing a too large payload")
+	}
+}
+
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// BenchmarkSegments measures the allocations of writing and reading frames
+// wrapped in segments, whose buffers come from the buffer pools.
+func BenchmarkSegments(b *testing.B) {
+	frame := bytes.Repeat([]byte{'a'}, 64*1024)
+	var segments bytes.Buffer
+	if err := appendSegments(&segments, frame, nil); err != nil {
+		b.Fatal(err)
+	}
+
+	conn := &Conn{conn: discardConn{}, segmented: true}
+	r := bytes.NewReader(nil)
+	sr := newSegmentReader(r, nil)
+	p := make([]byte, len(frame))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Write(frame); err != nil {
+			b.Fatal(err)
+		}
+
+		r.Reset(segments.Bytes())
+		if _, err := io.ReadFull(sr, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -5,8 +5,7 @@
 package gocql
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -36,12 +35,21 @@ type Session struct {
 	schemaDescriber     *schemaDescriber
 	trace               Tracer
 	hostSource          *ringDescriber
+	control             *controlConn
+	contactPoints       *contactPoints
+	latencies           hostLatencies
+	hostErrors          hostErrors
 	mu                  sync.RWMutex
 
 	cfg ClusterConfig
 
 	closeMu  sync.RWMutex
 	isClosed bool
+
+	// active are the queries and batches executing, waited for by
+	// CloseWithContext
+	active    sync.WaitGroup
+	closeOnce sync.Once
 }
 
 // NewSession wraps an existing Node.
@@ -60,6 +68,37 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		cfg.NumStreams = maxStreams
 	}
 
+	// the SRV and host names are resolved before the first connections, the
+	// host names are needed to verify the certificates of the hosts unless
+	// the TLS config has a server name, and custom dialers may not dial
+	// addresses
+	verifyNames := cfg.SslOpts != nil && cfg.SslOpts.EnableHostVerification &&
+		cfg.SslOpts.baseConfig().ServerName == ""
+	contacts := newContactPoints(cfg.Hosts, !verifyNames && cfg.Dialer == nil)
+	if contacts.resolvable() {
+		if _, err := contacts.resolve(); err != nil {
+			return nil, err
+		}
+		cfg.Hosts = contacts.get()
+	} else {
+		contacts = nil
+	}
+
+	if cfg.Proxy != nil {
+		proxyURL, err := cfg.Proxy()
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			if cfg.Dialer, err = NewProxyDialer(proxyURL, cfg.Dialer); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cfg.stats = &sessionStats{}
+	cfg.hostOptions = newHostOptions()
+
 	pool, err := cfg.ConnPoolType(&cfg)
 	if err != nil {
 		return nil, err
@@ -71,14 +110,15 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 	stmtsLRU.Unlock()
 
 	s := &Session{
-		Pool:     pool,
-		cons:     cfg.Consistency,
-		prefetch: 0.25,
-		cfg:      cfg,
+		Pool:          pool,
+		cons:          cfg.Consistency,
+		prefetch:      0.25,
+		cfg:           cfg,
+		contactPoints: contacts,
 	}
 
-	//See if there are any connections in the pool
-	if pool.Size() > 0 {
+	//See if there are any connections in the pool, lazy pools have none yet
+	if pool.Size() > 0 || cfg.LazyConnect {
 		s.routingKeyInfoCache.lru = lru.New(cfg.MaxRoutingKeyInfo)
 
 		s.SetConsistency(cfg.Consistency)
@@ -91,8 +131,54 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 				rackFilter: cfg.Discovery.RackFilter,
 				closeChan:  make(chan bool),
 			}
+		}
+
+		if cfg.DiscoverHosts || cfg.LazyConnect {
+			if s.control, err = newControlConn(s); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		if cfg.LazyConnect {
+			// the control connection is the only one opened by lazy
+			// sessions, it checks that the cluster can be reached
+			if err := s.control.connect(); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+
+		if cfg.DiscoverHosts {
+			// populate the pool with the hosts of the ring before the
+			// session is used, instead of only knowing the contact points
+			// until the first refresh.
+			if err := s.hostSource.refresh(); err != nil {
+				cfg.logger().Warn("gocql: unable to get the ring topology", "error", err)
+			}
 
 			go s.hostSource.run(cfg.Discovery.Sleep)
+
+			if !cfg.LazyConnect {
+				if err := s.control.connect(); err != nil {
+					cfg.logger().Warn("gocql: unable to open the control connection", "error", err)
+					go s.control.reconnect()
+				}
+			}
+		}
+
+		if cfg.WarmupPool && !cfg.LazyConnect {
+			if err := s.warmup(); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+
+		if s.contactPoints != nil {
+			go s.contactPoints.refresh(s, cfg.SRVRefreshInterval)
+		}
+
+		if cfg.ExpvarName != "" {
+			publishExpvar(cfg.ExpvarName, s)
 		}
 
 		return s, nil
@@ -103,6 +189,24 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 	return nil, ErrNoConnectionsStarted
 }
 
+// warmup opens the connections of the pool and prepares the statements of
+// ClusterConfig.WarmupStatements on each host.
+func (s *Session) warmup() error {
+	w, ok := s.Pool.(Warmup)
+	if !ok {
+		return nil
+	}
+
+	for _, conn := range w.Warmup() {
+		for _, stmt := range s.cfg.WarmupStatements {
+			if _, err := conn.prepareStatement(context.Background(), stmt, "", nil); err != nil {
+				return fmt.Errorf("gocql: unable to prepare %q on %s: %w", stmt, conn.Address(), err)
+			}
+		}
+	}
+	return nil
+}
+
 // SetConsistency sets the default consistency level for this session. This
 // setting can also be changed on a per-query basis and the default value
 // is Quorum.
@@ -138,6 +242,34 @@ func (s *Session) SetTrace(trace Tracer) {
 	s.mu.Unlock()
 }
 
+// SetKeyspace changes the keyspace of the connections of the session, in which
+// the statements not qualifying their tables with a keyspace are run. The
+// connections opened later by the pool use the keyspace too. USE statements
+// can not be run with Query as they would only change the keyspace of the
+// connection they are sent to.
+//
+// It returns ErrUnsupported when the connection pool does not implement the
+// SetKeyspace interface.
+func (s *Session) SetKeyspace(keyspace string) error {
+	if keyspace == "" {
+		return ErrNoKeyspace
+	}
+	setter, ok := s.Pool.(SetKeyspace)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	// the routing key infos are cached by keyspace and statement
+	s.routingKeyInfoCache.mu.Lock()
+	s.cfg.Keyspace = keyspace
+	if s.routingKeyInfoCache.lru != nil {
+		s.routingKeyInfoCache.lru = lru.New(s.cfg.MaxRoutingKeyInfo)
+	}
+	s.routingKeyInfoCache.mu.Unlock()
+
+	return setter.SetKeyspace(keyspace)
+}
+
 // Query generates a new query object for interacting with the database.
 // Further details of the query may be tweaked using the resulting query
 // value before the query is executed. Query is automatically prepared
@@ -147,7 +279,7 @@ func (s *Session) Query(stmt string, values ...interface{}) *Query {
 	qry := &Query{stmt: stmt, values: values, cons: s.cons,
 		session: s, pageSize: s.pageSize, trace: s.trace,
 		prefetch: s.prefetch, rt: s.cfg.RetryPolicy, serialCons: s.cfg.SerialConsistency,
-		defaultTimestamp: s.cfg.DefaultTimestamp,
+		defaultTimestamp: s.cfg.DefaultTimestamp, observer: s.cfg.QueryObserver,
 	}
 	s.mu.RUnlock()
 	return qry
@@ -169,27 +301,87 @@ func (s *Session) Bind(stmt string, b func(q *QueryInfo) ([]interface{}, error))
 	s.mu.RLock()
 	qry := &Query{stmt: stmt, binding: b, cons: s.cons,
 		session: s, pageSize: s.pageSize, trace: s.trace,
-		prefetch: s.prefetch, rt: s.cfg.RetryPolicy}
+		prefetch: s.prefetch, rt: s.cfg.RetryPolicy, observer: s.cfg.QueryObserver}
 	s.mu.RUnlock()
 	return qry
 }
 
-// Close closes all connections. The session is unusable after this
-// operation.
+// Close closes the connections of the session at once, which aborts the
+// requests in flight, see CloseWithContext. The session is unusable after
+// this operation.
 func (s *Session) Close() {
+	s.shutdown()
+	s.closeOnce.Do(s.closeConns)
+}
+
+// CloseWithContext closes the session gracefully: the new queries and
+// batches fail with ErrSessionClosed, as do the following pages of the
+// iterators, and the session waits for the queries and batches executing
+// to complete before closing its connections. The connections are closed
+// when ctx is done, CloseWithContext then returns the error of ctx.
+func (s *Session) CloseWithContext(ctx context.Context) error {
+	if !s.shutdown() {
+		return nil
+	}
 
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.closeOnce.Do(s.closeConns)
+	return err
+}
+
+// shutdown marks the session closed, it returns false if it already was.
+func (s *Session) shutdown() bool {
 	s.closeMu.Lock()
 	defer s.closeMu.Unlock()
 	if s.isClosed {
-		return
+		return false
 	}
 	s.isClosed = true
+	return true
+}
 
+// begin registers a query or batch executing, it returns false when the
+// session is closed. active.Done must be called once it completes.
+func (s *Session) begin() bool {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.isClosed {
+		return false
+	}
+	s.active.Add(1)
+	return true
+}
+
+func (s *Session) closeConns() {
 	s.Pool.Close()
 
+	if s.cfg.ExpvarName != "" {
+		unpublishExpvar(s.cfg.ExpvarName, s)
+	}
+
 	if s.hostSource != nil {
 		close(s.hostSource.closeChan)
 	}
+
+	if s.control != nil {
+		s.control.close()
+	}
+
+	if s.contactPoints != nil {
+		s.contactPoints.close()
+	}
 }
 
 func (s *Session) Closed() bool {
@@ -202,13 +394,29 @@ func (s *Session) Closed() bool {
 func (s *Session) executeQuery(qry *Query) *Iter {
 
 	// fail fast
-	if s.Closed() {
+	if !s.begin() {
 		return &Iter{err: ErrSessionClosed}
 	}
+	defer s.active.Done()
+
+	read := qry.statementType() == "select"
+	if err := validateConsistency(qry.cons, qry.serialCons, read); err != nil {
+		return &Iter{err: err}
+	}
+	for _, cons := range qry.consLadder {
+		if err := validateConsistency(cons, qry.serialCons, read); err != nil {
+			return &Iter{err: err}
+		}
+	}
 
 	var iter *Iter
 	qry.attempts = 0
 	qry.totalLatency = 0
+	ladder := qry.consLadder
+	if len(ladder) > 0 {
+		qry.cons = ladder[0]
+		ladder = ladder[1:]
+	}
 	for {
 		conn := s.Pool.Pick(qry)
 
@@ -218,24 +426,174 @@ func (s *Session) executeQuery(qry *Query) *Iter {
 			break
 		}
 
-		t := time.Now()
-		iter = conn.executeQuery(qry)
-		qry.totalLatency += time.Now().Sub(t).Nanoseconds()
+		var t time.Time
+		iter, conn, t = s.executeSpeculative(qry, conn)
+		end := time.Now()
+		qry.totalLatency += end.Sub(t).Nanoseconds()
 		qry.attempts++
 
+		if iter.err != ErrTimeoutNoResponse {
+			s.latencies.record(conn.Address(), end.Sub(t))
+		}
+		s.hostErrors.record(conn.Address(), iter.err, end)
+
+		if s.cfg.SlowQueryThreshold > 0 && end.Sub(t) >= s.cfg.SlowQueryThreshold {
+			s.reportSlowQuery(SlowQuery{
+				Statement:   qry.stmt,
+				Keyspace:    conn.keyspace(),
+				Host:        conn.Address(),
+				Consistency: qry.cons,
+				Latency:     end.Sub(t),
+				Attempt:     qry.attempts,
+				Err:         iter.err,
+			})
+		}
+
+		if qry.observer != nil {
+			qry.observer.ObserveQuery(ObservedQuery{
+				Keyspace:    conn.keyspace(),
+				Statement:   qry.stmt,
+				Host:        conn.Address(),
+				Consistency: qry.cons,
+				Start:       t,
+				End:         end,
+				Rows:        len(iter.rows),
+				Attempt:     qry.attempts,
+				Warnings:    iter.warnings,
+				Err:         iter.err,
+			})
+		}
+
 		//Exit for loop if the query was successful
 		if iter.err == nil {
 			break
 		}
 
-		if qry.rt == nil || !qry.rt.Attempt(qry) {
+		// a cancelled query is not retried
+		if qry.Context().Err() != nil {
 			break
 		}
+
+		var unavailable *RequestErrUnavailable
+		if len(ladder) > 0 && errors.As(iter.err, &unavailable) {
+			qry.cons = ladder[0]
+			ladder = ladder[1:]
+			continue
+		}
+
+		if qry.rt == nil || !qry.rt.Attempt(qry) || !retryBackoff(qry.Context(), qry.rt, qry) {
+			break
+		}
+		s.cfg.stats.retry()
+	}
+
+	if iter.schemaChanged && s.cfg.MaxWaitSchemaAgreement > 0 {
+		// the statement was applied, only the agreement can fail here
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.MaxWaitSchemaAgreement)
+		if err := s.AwaitSchemaAgreement(ctx); err != nil && err != ErrNoSchemaAgreement {
+			iter.err = fmt.Errorf("%w: %v", ErrNoSchemaAgreement, err)
+		} else {
+			iter.err = err
+		}
+		cancel()
 	}
 
 	return iter
 }
 
+// speculativeResult is the response of an execution of a query.
+type speculativeResult struct {
+	conn  *Conn
+	start time.Time
+	iter  *Iter
+}
+
+// executeSpeculative executes qry on conn and, following the speculative
+// execution policy of the query, on other hosts while waiting for the
+// response. It returns the first successful response, or the last error when
+// every execution failed, along with the connection it was received from and
+// the time the execution started.
+func (s *Session) executeSpeculative(qry *Query, conn *Conn) (*Iter, *Conn, time.Time) {
+	var delay time.Duration
+	if qry.spec != nil && qry.spec.Attempts() > 0 {
+		delay = qry.spec.Delay(s.latencies.recent(conn.Address()))
+	}
+	if delay <= 0 {
+		start := time.Now()
+		return conn.executeQuery(qry), conn, start
+	}
+
+	results := make(chan speculativeResult, qry.spec.Attempts()+1)
+	execute := func(conn *Conn) {
+		// every execution has its own copy of the query which may still be
+		// read once the response of another one was returned
+		q := *qry
+		start := time.Now()
+		// the executions still pending are waited for by CloseWithContext
+		s.active.Add(1)
+		go func() {
+			defer s.active.Done()
+			results <- speculativeResult{conn: conn, start: start, iter: conn.executeQuery(&q)}
+		}()
+	}
+
+	execute(conn)
+	hosts := map[string]bool{conn.Address(): true}
+	last := conn.Address()
+	pending, remaining := 1, qry.spec.Attempts()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.iter.err == nil || pending == 0 {
+				if pending > 0 {
+					go s.drainSpeculative(results, pending)
+				}
+				return res.iter, res.conn, res.start
+			}
+		case <-timer.C:
+			// a query is sent at most once to each host, the attempt is
+			// used even when no other host can be picked
+			remaining--
+			for i := s.Pool.Size(); i > 0; i-- {
+				next := s.Pool.Pick(qry)
+				if next == nil {
+					break
+				}
+				if !hosts[next.Address()] {
+					hosts[next.Address()] = true
+					last = next.Address()
+					execute(next)
+					pending++
+					break
+				}
+			}
+			if remaining > 0 {
+				if delay = qry.spec.Delay(s.latencies.recent(last)); delay > 0 {
+					timer.Reset(delay)
+				}
+			}
+		}
+	}
+}
+
+// drainSpeculative records the responses of the executions of a query still
+// pending once another response was returned, and releases them.
+func (s *Session) drainSpeculative(results <-chan speculativeResult, pending int) {
+	for ; pending > 0; pending-- {
+		res := <-results
+		end := time.Now()
+		if res.iter.err != ErrTimeoutNoResponse {
+			s.latencies.record(res.conn.Address(), end.Sub(res.start))
+		}
+		s.hostErrors.record(res.conn.Address(), res.iter.err, end)
+		res.iter.releaseBorrowed()
+	}
+}
+
 // KeyspaceMetadata returns the schema metadata for the keyspace specified.
 func (s *Session) KeyspaceMetadata(keyspace string) (*KeyspaceMetadata, error) {
 	// fail fast
@@ -257,10 +615,68 @@ func (s *Session) KeyspaceMetadata(keyspace string) (*KeyspaceMetadata, error) {
 	return s.schemaDescriber.getSchema(keyspace)
 }
 
+// handleSchemaChange invalidates the cached metadata of a keyspace and the
+// prepared statements of the changed table, or of every table of the
+// keyspace when table is empty.
+func (s *Session) handleSchemaChange(keyspace, table string) {
+	s.mu.Lock()
+	describer := s.schemaDescriber
+	s.mu.Unlock()
+
+	if describer != nil {
+		describer.clearSchema(keyspace)
+	}
+
+	stmtsLRU.Lock()
+	if stmtsLRU.lru != nil {
+		stmtsLRU.evictTable(keyspace, table)
+	}
+	stmtsLRU.Unlock()
+
+	// the routing key of the statements is derived from their prepared
+	// metadata, the cache is keyed by statement so it is cleared entirely
+	s.clearRoutingKeyInfo()
+}
+
+// clearMetadata drops the cached metadata of every keyspace and the routing
+// key information of the statements, they are read again on their next use.
+func (s *Session) clearMetadata() {
+	s.mu.Lock()
+	describer := s.schemaDescriber
+	s.mu.Unlock()
+
+	if describer != nil {
+		describer.clearAll()
+	}
+	s.clearRoutingKeyInfo()
+}
+
+func (s *Session) clearRoutingKeyInfo() {
+	s.routingKeyInfoCache.mu.Lock()
+	if s.routingKeyInfoCache.lru != nil {
+		s.routingKeyInfoCache.lru = lru.New(s.cfg.MaxRoutingKeyInfo)
+	}
+	s.routingKeyInfoCache.mu.Unlock()
+}
+
 // returns routing key indexes and type info
 func (s *Session) routingKeyInfo(stmt string) (*routingKeyInfo, error) {
+	return s.routingKeyInfoForColumns(stmt, "", nil)
+}
+
+// returns routing key indexes and type info of the bound variables of the
+// given columns, or of the partition key columns when columns is empty. The
+// statement is prepared in keyspace, or in the keyspace of the session when
+// keyspace is empty.
+func (s *Session) routingKeyInfoForColumns(stmt, keyspace string, columns []string) (*routingKeyInfo, error) {
 	s.routingKeyInfoCache.mu.Lock()
 	cacheKey := s.cfg.Keyspace + stmt
+	if keyspace != "" {
+		cacheKey = keyspace + stmt
+	}
+	if len(columns) > 0 {
+		cacheKey += "\x00" + strings.Join(columns, ",")
+	}
 
 	entry, cached := s.routingKeyInfoCache.lru.Get(cacheKey)
 	if cached {
@@ -289,10 +705,7 @@ func (s *Session) routingKeyInfo(stmt string) (*routingKeyInfo, error) {
 	s.routingKeyInfoCache.lru.Add(cacheKey, inflight)
 	s.routingKeyInfoCache.mu.Unlock()
 
-	var (
-		prepared     *resultPreparedFrame
-		partitionKey []*ColumnMetadata
-	)
+	var prepared *resultPreparedFrame
 
 	// get the query info for the statement
 	conn := s.Pool.Pick(nil)
@@ -304,7 +717,7 @@ func (s *Session) routingKeyInfo(stmt string) (*routingKeyInfo, error) {
 		return nil, inflight.err
 	}
 
-	prepared, inflight.err = conn.prepareStatement(stmt, nil)
+	prepared, inflight.err = conn.prepareStatement(context.Background(), stmt, keyspace, nil)
 	if inflight.err != nil {
 		// don't cache this error
 		s.routingKeyInfoCache.Remove(cacheKey)
@@ -316,11 +729,25 @@ func (s *Session) routingKeyInfo(stmt string) (*routingKeyInfo, error) {
 		return nil, nil
 	}
 
+	if len(columns) > 0 {
+		inflight.value = boundRoutingKeyInfo(prepared.reqMeta, columns)
+		// no routing key if a column is not bound, and no error
+		return inflight.value.(*routingKeyInfo), nil
+	}
+
+	// protocol v4 returns the indexes of the partition key columns in the
+	// bound variables, the schema is only needed with older protocols
+	if len(prepared.reqMeta.pkeyColumns) > 0 {
+		inflight.value = preparedRoutingKeyInfo(prepared.reqMeta)
+		return inflight.value.(*routingKeyInfo), nil
+	}
+
 	// get the table metadata
+	keyspace = prepared.reqMeta.columns[0].Keyspace
 	table := prepared.reqMeta.columns[0].Table
 
 	var keyspaceMetadata *KeyspaceMetadata
-	keyspaceMetadata, inflight.err = s.KeyspaceMetadata(s.cfg.Keyspace)
+	keyspaceMetadata, inflight.err = s.KeyspaceMetadata(keyspace)
 	if inflight.err != nil {
 		// don't cache this error
 		s.routingKeyInfoCache.Remove(cacheKey)
@@ -338,47 +765,72 @@ func (s *Session) routingKeyInfo(stmt string) (*routingKeyInfo, error) {
 		return nil, inflight.err
 	}
 
-	partitionKey = tableMetadata.PartitionKey
+	partitionKey := make([]string, len(tableMetadata.PartitionKey))
+	for i, column := range tableMetadata.PartitionKey {
+		partitionKey[i] = column.Name
+	}
+
+	// cache this result
+	inflight.value = boundRoutingKeyInfo(prepared.reqMeta, partitionKey)
+
+	return inflight.value.(*routingKeyInfo), nil
+}
 
-	size := len(partitionKey)
-	routingKeyInfo := &routingKeyInfo{
-		indexes: make([]int, size),
-		types:   make([]TypeInfo, size),
+// boundRoutingKeyInfo returns the routing key info made of the bound variables
+// of the given columns, or nil if a column is not bound.
+func boundRoutingKeyInfo(meta resultMetadata, columns []string) *routingKeyInfo {
+	info := &routingKeyInfo{
+		indexes: make([]int, len(columns)),
+		types:   make([]TypeInfo, len(columns)),
 	}
-	for keyIndex, keyColumn := range partitionKey {
+	for keyIndex, keyColumn := range columns {
 		// set an indicator for checking if the mapping is missing
-		routingKeyInfo.indexes[keyIndex] = -1
+		info.indexes[keyIndex] = -1
 
 		// find the column in the query info
-		for argIndex, boundColumn := range prepared.reqMeta.columns {
-			if keyColumn.Name == boundColumn.Name {
+		for argIndex, boundColumn := range meta.columns {
+			if keyColumn == boundColumn.Name {
 				// there may be many such bound columns, pick the first
-				routingKeyInfo.indexes[keyIndex] = argIndex
-				routingKeyInfo.types[keyIndex] = boundColumn.TypeInfo
+				info.indexes[keyIndex] = argIndex
+				info.types[keyIndex] = boundColumn.TypeInfo
 				break
 			}
 		}
 
-		if routingKeyInfo.indexes[keyIndex] == -1 {
+		if info.indexes[keyIndex] == -1 {
 			// missing a routing key column mapping
-			// no routing key, and no error
-			return nil, nil
+			return nil
 		}
 	}
+	return info
+}
 
-	// cache this result
-	inflight.value = routingKeyInfo
-
-	return routingKeyInfo, nil
+// preparedRoutingKeyInfo returns the routing key info of a statement from the
+// partition key indexes of its bound variables.
+func preparedRoutingKeyInfo(meta resultMetadata) *routingKeyInfo {
+	info := &routingKeyInfo{
+		indexes: make([]int, len(meta.pkeyColumns)),
+		types:   make([]TypeInfo, len(meta.pkeyColumns)),
+	}
+	for i, argIndex := range meta.pkeyColumns {
+		info.indexes[i] = argIndex
+		info.types[i] = meta.columns[argIndex].TypeInfo
+	}
+	return info
 }
 
 // ExecuteBatch executes a batch operation and returns nil if successful
 // otherwise an error is returned describing the failure.
 func (s *Session) ExecuteBatch(batch *Batch) error {
 	// fail fast
-	if s.Closed() {
+	if !s.begin() {
 		return ErrSessionClosed
 	}
+	defer s.active.Done()
+
+	if err := validateConsistency(batch.Cons, batch.serialCons, false); err != nil {
+		return err
+	}
 
 	// Prevent the execution of the batch if greater than the limit
 	// Currently batches have a limit of 65536 queries.
@@ -387,7 +839,19 @@ func (s *Session) ExecuteBatch(batch *Batch) error {
 		return ErrTooManyStmts
 	}
 
-	var err error
+	n := batch.Size()
+	if max := s.cfg.BatchStatementsFailThreshold; max > 0 && n > max {
+		return fmt.Errorf("%w: %d statements, the limit is %d", ErrBatchTooLarge, n, max)
+	}
+	if max := s.cfg.BatchStatementsWarnThreshold; max > 0 && n > max {
+		s.cfg.logger().Warn("gocql: batch with too many statements", "statements", n, "threshold", max)
+	}
+	batch.sizeLimit = s.cfg.BatchSizeFailThreshold
+
+	var (
+		iter *Iter
+		err  error
+	)
 	batch.attempts = 0
 	batch.totalLatency = 0
 	for {
@@ -399,27 +863,102 @@ func (s *Session) ExecuteBatch(batch *Batch) error {
 			break
 		}
 		t := time.Now()
-		err = conn.executeBatch(batch)
-		batch.totalLatency += time.Now().Sub(t).Nanoseconds()
+		iter = conn.executeBatch(batch)
+		end := time.Now()
+		err = iter.err
+		batch.totalLatency += end.Sub(t).Nanoseconds()
 		batch.attempts++
+
+		if max := s.cfg.BatchSizeWarnThreshold; batch.attempts == 1 && max > 0 && batch.size > max {
+			s.cfg.logger().Warn("gocql: large batch", "size", batch.size, "threshold", max, "statements", n)
+		}
+
+		if err != ErrTimeoutNoResponse {
+			s.latencies.record(conn.Address(), end.Sub(t))
+		}
+		s.hostErrors.record(conn.Address(), err, end)
+
+		if s.cfg.SlowQueryThreshold > 0 && end.Sub(t) >= s.cfg.SlowQueryThreshold {
+			s.reportSlowQuery(SlowQuery{
+				Statement:   batchStatement(batch),
+				Batch:       true,
+				Keyspace:    conn.keyspace(),
+				Host:        conn.Address(),
+				Consistency: batch.Cons,
+				Latency:     end.Sub(t),
+				Attempt:     batch.attempts,
+				Err:         err,
+			})
+		}
+
+		if batch.observer != nil {
+			batch.observer.ObserveBatch(ObservedBatch{
+				Keyspace:   conn.keyspace(),
+				Statements: len(batch.Entries),
+				Host:       conn.Address(),
+				Start:      t,
+				End:        end,
+				Size:       batch.size,
+				Attempt:    batch.attempts,
+				Warnings:   iter.warnings,
+				Err:        err,
+			})
+		}
 		//Exit loop if operation executed correctly
 		if err == nil {
 			return nil
 		}
 
-		if batch.rt == nil || !batch.rt.Attempt(batch) {
+		// a cancelled or too large batch is not retried
+		if batch.Context().Err() != nil || errors.Is(err, ErrBatchTooLarge) {
 			break
 		}
+
+		if batch.rt == nil || !batch.rt.Attempt(batch) || !retryBackoff(batch.Context(), batch.rt, batch) {
+			break
+		}
+		s.cfg.stats.retry()
 	}
 
 	return err
 }
 
+// Priority is the class of a query or batch. When a connection is at its
+// ClusterConfig.MaxInFlightPerConn limit, the queued requests are sent by
+// order of priority and the lower priority ones are the first to fail with
+// ErrTooManyInFlight.
+type Priority int8
+
+const (
+	// PriorityBatch is for the background work which can wait, or be
+	// retried later.
+	PriorityBatch Priority = -1
+	// PriorityNormal is the priority of the queries and batches by default.
+	PriorityNormal Priority = 0
+	// PriorityInteractive is for the latency sensitive requests, e.g. the
+	// ones a user waits for.
+	PriorityInteractive Priority = 1
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBatch:
+		return "BATCH"
+	case PriorityNormal:
+		return "NORMAL"
+	case PriorityInteractive:
+		return "INTERACTIVE"
+	default:
+		return fmt.Sprintf("PRIORITY_%d", int8(p))
+	}
+}
+
 // Query represents a CQL statement that can be executed.
 type Query struct {
 	stmt             string
 	values           []interface{}
 	cons             Consistency
+	consLadder       []Consistency
 	pageSize         int
 	routingKey       []byte
 	pageState        []byte
@@ -427,11 +966,30 @@ type Query struct {
 	trace            Tracer
 	session          *Session
 	rt               RetryPolicy
+	spec             SpeculativeExecutionPolicy
 	binding          func(q *QueryInfo) ([]interface{}, error)
 	attempts         int
 	totalLatency     int64
 	serialCons       SerialConsistency
 	defaultTimestamp bool
+
+	defaultTimestampValue int64
+	customPayload         map[string][]byte
+	observer              QueryObserver
+	routingKeyColumns     []string
+	// host is the address of the host the query is sent to first, before
+	// the hosts of the host selection policy
+	host string
+	// keyspace is the keyspace the query runs in instead of the one of the
+	// connection, v5+
+	keyspace string
+	// v5+
+	nowInSeconds      bool
+	nowInSecondsValue int
+	context           context.Context
+	timeout           time.Duration
+	borrowBytes       bool
+	priority          Priority
 }
 
 // String implements the stringer interface.
@@ -454,9 +1012,27 @@ func (q *Query) Latency() int64 {
 
 // Consistency sets the consistency level for this query. If no consistency
 // level have been set, the default consistency level of the cluster
-// is used.
+// is used. The query fails with ErrInvalidConsistency when the level is
+// not valid for it, ANY for a SELECT or SERIAL for a write, which can be
+// set with Consistency(Serial) for the linearizable reads.
 func (q *Query) Consistency(c Consistency) *Query {
 	q.cons = c
+	q.consLadder = nil
+	return q
+}
+
+// ConsistencyLadder sets the consistency levels the query falls back to,
+// in order, when the hosts are unavailable: the query is executed at the
+// first level and executed again at the next one when it fails with a
+// RequestErrUnavailable, for instance Quorum, LocalQuorum then One. The
+// fallbacks are not subject to the retry policy. Every execution, including
+// those of the next pages, starts at the first level, the level used is
+// reported to the observer and returned by GetConsistency.
+func (q *Query) ConsistencyLadder(levels ...Consistency) *Query {
+	q.consLadder = levels
+	if len(levels) > 0 {
+		q.cons = levels[0]
+	}
 	return q
 }
 
@@ -493,6 +1069,117 @@ func (q *Query) DefaultTimestamp(enable bool) *Query {
 	return q
 }
 
+// WithTimestamp will enable the with default timestamp flag on the query
+// like DefaultTimestamp does. But also allows to define value for timestamp.
+// It works the same way as USING TIMESTAMP in the query itself, but
+// should not break prepared query optimization. The timestamp is in
+// microseconds since the unix epoch.
+//
+// Only available on protocol >= 3
+func (q *Query) WithTimestamp(timestamp int64) *Query {
+	q.DefaultTimestamp(true)
+	q.defaultTimestampValue = timestamp
+	return q
+}
+
+// WithNowInSeconds sets the current time of the host executing the query, in
+// seconds since the unix epoch. It is used instead of the clock of the host
+// to compute the expiration of the cells, which makes the TTLs written and
+// read by the query deterministic in tests.
+//
+// Only available on protocol >= 5, the query fails with ErrUnsupported with
+// older protocols.
+func (q *Query) WithNowInSeconds(now int) *Query {
+	q.nowInSeconds = true
+	q.nowInSecondsValue = now
+	return q
+}
+
+// Observer sets the observer notified of every execution of this query,
+// overriding ClusterConfig.QueryObserver. A nil observer disables it.
+func (q *Query) Observer(observer QueryObserver) *Query {
+	q.observer = observer
+	return q
+}
+
+// WithContext sets the context of the query. When the context is cancelled
+// the query stops waiting for the response of the host and returns the error
+// of the context, and it is not retried.
+func (q *Query) WithContext(ctx context.Context) *Query {
+	q.context = ctx
+	return q
+}
+
+// Context returns the context of the query, context.Background() when it
+// has none.
+func (q *Query) Context() context.Context {
+	if q.context == nil {
+		return context.Background()
+	}
+	return q.context
+}
+
+// Timeout sets the time to wait for the response to the query, overriding
+// ClusterConfig.Timeout. Every attempt of the query has its own timeout,
+// while the deadline of the context of the query bounds all of them.
+func (q *Query) Timeout(timeout time.Duration) *Query {
+	q.timeout = timeout
+	return q
+}
+
+// BorrowBytes makes the values scanned into *[]byte, and those streamed
+// into *io.Reader, alias the buffer of the response instead of being copied,
+// for the hot paths which immediately hash or re-serialize them. The buffer
+// is reused once the iterator is done with it, so the values are only valid
+// until the next call to Scan or Close of the Iter, or until the function
+// passed to Query.ForEach returns. Query.Scan, Query.StructScan,
+// Query.MapScan and the CAS variants close the iterator before returning,
+// they ignore it and copy the values.
+func (q *Query) BorrowBytes(enable bool) *Query {
+	q.borrowBytes = enable
+	return q
+}
+
+// CustomPayload sets the custom payload sent along with the query, it is
+// interpreted by the server or by custom query handlers installed on it. The
+// payload sent back by the host is returned by Iter.GetCustomPayload. Custom
+// payloads require protocol 4 or above and are ignored by older versions.
+func (q *Query) CustomPayload(payload map[string][]byte) *Query {
+	q.customPayload = payload
+	return q
+}
+
+// proxyExecuteKey is the custom payload key used by DataStax Enterprise to
+// request proxy execution.
+const proxyExecuteKey = "ProxyExecute"
+
+// ExecuteAs runs the query with the permissions of user instead of the
+// authenticated user of the connection. This requires DataStax Enterprise
+// 5.1 or above with proxy execution enabled, and the authenticated user must
+// have been granted the PROXY.EXECUTE permission on user.
+func (q *Query) ExecuteAs(user string) *Query {
+	payload := make(map[string][]byte, len(q.customPayload)+1)
+	for k, v := range q.customPayload {
+		payload[k] = v
+	}
+	payload[proxyExecuteKey] = []byte(user)
+
+	q.customPayload = payload
+	return q
+}
+
+// Keyspace sets the keyspace the unqualified tables of the statement belong
+// to instead of the keyspace of the session, which allows running statements
+// in several keyspaces without qualifying their tables and without changing
+// the keyspace of the connections.
+//
+// Only available on protocol >= 5, the query fails with ErrUnsupported with
+// older protocols.
+func (q *Query) Keyspace(keyspace string) *Query {
+	q.keyspace = keyspace
+	return q
+}
+
 // RoutingKey sets the routing key to use when a token aware connection
 // pool is used to optimize the routing of this query.
 func (q *Query) RoutingKey(routingKey []byte) *Query {
@@ -500,6 +1187,17 @@ func (q *Query) RoutingKey(routingKey []byte) *Query {
 	return q
 }
 
+// RoutingKeyColumns sets the columns whose bound values make the routing key
+// of this query, in the order of the partition key. The statement is prepared
+// to find the bound variables of the columns, which allows token aware routing
+// when the partition key of the statement can not be found otherwise, for
+// instance when the schema can not be read. The routing key set with
+// RoutingKey takes precedence.
+func (q *Query) RoutingKeyColumns(columns ...string) *Query {
+	q.routingKeyColumns = columns
+	return q
+}
+
 // GetRoutingKey gets the routing key to use for routing this query. If
 // a routing key has not been explicitly set, then the routing key will
 // be constructed if possible using the keyspace's schema and the query
@@ -512,7 +1210,7 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 	}
 
 	// try to determine the routing key
-	routingKeyInfo, err := q.session.routingKeyInfo(q.stmt)
+	routingKeyInfo, err := q.session.routingKeyInfoForColumns(q.stmt, q.keyspace, q.routingKeyColumns)
 	if err != nil {
 		return nil, err
 	}
@@ -533,7 +1231,7 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 	}
 
 	// composite routing key
-	buf := &bytes.Buffer{}
+	components := make([][]byte, len(routingKeyInfo.indexes))
 	for i := range routingKeyInfo.indexes {
 		encoded, err := Marshal(
 			routingKeyInfo.types[i],
@@ -542,16 +1240,22 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		binary.Write(buf, binary.BigEndian, int16(len(encoded)))
-		buf.Write(encoded)
-		buf.WriteByte(0x00)
+		components[i] = encoded
 	}
-	routingKey := buf.Bytes()
-	return routingKey, nil
+	return compositePartitionKey(components), nil
 }
 
 func (q *Query) shouldPrepare() bool {
+	switch q.statementType() {
+	case "select", "insert", "update", "delete", "batch":
+		return true
+	}
+	return false
+}
 
+// statementType returns the first keyword of the statement in lower case,
+// or batch for the batch statements.
+func (q *Query) statementType() string {
 	stmt := strings.TrimLeftFunc(strings.TrimRightFunc(q.stmt, func(r rune) bool {
 		return unicode.IsSpace(r) || r == ';'
 	}), unicode.IsSpace)
@@ -565,11 +1269,32 @@ func (q *Query) shouldPrepare() bool {
 			stmtType = strings.ToLower(stmt[n+1:])
 		}
 	}
-	switch stmtType {
-	case "select", "insert", "update", "delete", "batch":
-		return true
+	return stmtType
+}
+
+// validateConsistency returns an error wrapping ErrInvalidConsistency when
+// cons, or serial when set, is not a valid level for a read or a write.
+func validateConsistency(cons Consistency, serial SerialConsistency, read bool) error {
+	switch cons {
+	case One, Two, Three, Quorum, All, LocalQuorum, EachQuorum, LocalOne:
+	case Any:
+		if read {
+			return fmt.Errorf("%w: ANY can only be used for writes", ErrInvalidConsistency)
+		}
+	case Consistency(Serial), Consistency(LocalSerial):
+		if !read {
+			return fmt.Errorf("%w: %v can only be used for reads", ErrInvalidConsistency, SerialConsistency(cons))
+		}
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidConsistency, cons)
 	}
-	return false
+
+	switch serial {
+	case 0, Serial, LocalSerial:
+	default:
+		return fmt.Errorf("%w: %v is not a serial consistency", ErrInvalidConsistency, serial)
+	}
+	return nil
 }
 
 // SetPrefetch sets the default threshold for pre-fetching new pages. If
@@ -586,6 +1311,21 @@ func (q *Query) RetryPolicy(r RetryPolicy) *Query {
 	return q
 }
 
+// Priority sets the priority of the query on the connections at their
+// ClusterConfig.MaxInFlightPerConn limit. (default: PriorityNormal)
+func (q *Query) Priority(p Priority) *Query {
+	q.priority = p
+	return q
+}
+
+// SpeculativeExecutionPolicy sets the policy to use to send the query to
+// other hosts while waiting for the response of a host. The query must be
+// idempotent.
+func (q *Query) SpeculativeExecutionPolicy(sp SpeculativeExecutionPolicy) *Query {
+	q.spec = sp
+	return q
+}
+
 // Bind sets query arguments of query. This can also be used to rebind new query arguments
 // to an existing query instance.
 func (q *Query) Bind(v ...interface{}) *Query {
@@ -593,6 +1333,16 @@ func (q *Query) Bind(v ...interface{}) *Query {
 	return q
 }
 
+// Statement returns the statement of the query.
+func (q *Query) Statement() string {
+	return q.stmt
+}
+
+// Values returns the arguments bound to the query, see Bind.
+func (q *Query) Values() []interface{} {
+	return q.values
+}
+
 // SerialConsistency sets the consistencyc level for the
 // serial phase of conditional updates. That consitency can only be
 // either SERIAL or LOCAL_SERIAL and if not present, it defaults to
@@ -618,11 +1368,21 @@ func (q *Query) Iter() *Iter {
 	return q.session.executeQuery(q)
 }
 
+// iterOwned executes the query without borrowing the bytes of the response,
+// for the helpers which close the iterator before returning the values.
+func (q *Query) iterOwned() *Iter {
+	borrow := q.borrowBytes
+	q.borrowBytes = false
+	iter := q.Iter()
+	q.borrowBytes = borrow
+	return iter
+}
+
 // MapScan executes the query, copies the columns of the first selected
 // row into the map pointed at by m and discards the rest. If no rows
 // were selected, ErrNotFound is returned.
 func (q *Query) MapScan(m map[string]interface{}) error {
-	iter := q.Iter()
+	iter := q.iterOwned()
 	if err := iter.checkErrAndNotFound(); err != nil {
 		return err
 	}
@@ -634,7 +1394,7 @@ func (q *Query) MapScan(m map[string]interface{}) error {
 // row into the values pointed at by dest and discards the rest. If no rows
 // were selected, ErrNotFound is returned.
 func (q *Query) Scan(dest ...interface{}) error {
-	iter := q.Iter()
+	iter := q.iterOwned()
 	if err := iter.checkErrAndNotFound(); err != nil {
 		return err
 	}
@@ -647,7 +1407,7 @@ func (q *Query) Scan(dest ...interface{}) error {
 // the existing values did not match, the previous values will be stored
 // in dest.
 func (q *Query) ScanCAS(dest ...interface{}) (applied bool, err error) {
-	iter := q.Iter()
+	iter := q.iterOwned()
 	if err := iter.checkErrAndNotFound(); err != nil {
 		return false, err
 	}
@@ -669,7 +1429,7 @@ func (q *Query) ScanCAS(dest ...interface{}) (applied bool, err error) {
 // SELECT * FROM. So using ScanCAS with INSERT is inherently prone to
 // column mismatching. MapScanCAS is added to capture them safely.
 func (q *Query) MapScanCAS(dest map[string]interface{}) (applied bool, err error) {
-	iter := q.Iter()
+	iter := q.iterOwned()
 	if err := iter.checkErrAndNotFound(); err != nil {
 		return false, err
 	}
@@ -689,6 +1449,15 @@ type Iter struct {
 	rows [][][]byte
 	meta resultMetadata
 	next *nextIter
+
+	// schemaChanged is set when the statement changed the schema
+	schemaChanged bool
+	// borrowed is the buffer of the response the rows alias, see
+	// Query.BorrowBytes
+	borrowed []byte
+	// v4+
+	warnings      []string
+	customPayload map[string][]byte
 }
 
 // Columns returns the name and type of the selected columns.
@@ -696,11 +1465,36 @@ func (iter *Iter) Columns() []ColumnInfo {
 	return iter.meta.columns
 }
 
+// GetCustomPayload returns the custom payload the host sent along with the
+// result of the query, or of the current page of the result, or nil if it
+// sent none. Custom payloads require protocol 4 or above.
+func (iter *Iter) GetCustomPayload() map[string][]byte {
+	return iter.customPayload
+}
+
+// Warnings returns the warnings the host sent along with the result of the
+// query, or of the current page of the result, such as the tombstone
+// thresholds being exceeded. Warnings require protocol 4 or above.
+func (iter *Iter) Warnings() []string {
+	return iter.warnings
+}
+
 // Scan consumes the next row of the iterator and copies the columns of the
 // current row into the values pointed at by dest. Use nil as a dest value
 // to skip the corresponding column. Scan might send additional queries
 // to the database to retrieve the next set of rows if paging was enabled.
 //
+// A tuple column is either scanned into a single value, a pointer to a struct
+// or a *[]interface{}, or it is expanded in which case one value must be
+// passed for each element of the tuple. A tuple with a single element is
+// expanded unless its value is one of those which can hold the whole tuple.
+//
+// Blob and text columns can be scanned into an *io.Reader to stream large
+// values, into a file or a hash for instance, without copying them into a
+// []byte first.
+//
+// A single RowDecoder destination decodes the whole row itself.
+//
 // Scan returns true if the row was successfully unmarshaled or false if the
 // end of the result set was reached or if an error occurred. Close should
 // be called afterwards to retrieve any potential errors.
@@ -710,6 +1504,7 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 	}
 	if iter.pos >= len(iter.rows) {
 		if iter.next != nil {
+			iter.releaseBorrowed()
 			*iter = *iter.next.fetch()
 			return iter.Scan(dest...)
 		}
@@ -719,34 +1514,44 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 		go iter.next.fetch()
 	}
 
-	// currently only support scanning into an expand tuple, such that its the same
-	// as scanning in more values from a single column
-	if len(dest) != iter.meta.actualColCount {
+	if len(dest) == 1 {
+		if decoder, ok := dest[0].(RowDecoder); ok {
+			if iter.err = decoder.DecodeRow(iter.meta.columns, iter.rows[iter.pos]); iter.err != nil {
+				return false
+			}
+			iter.pos++
+			return true
+		}
+	}
+
+	// tuple columns can either be scanned into a single value, such as a
+	// pointer to a struct or a *[]interface{}, or be expanded such that each
+	// element of the tuple is scanned into its own value.
+	expand := len(dest) != len(iter.meta.columns)
+	if expand && len(dest) != iter.meta.actualColCount {
 		iter.err = errors.New("count mismatch")
 		return false
 	}
+	// when the tuples all have a single element both forms have the same
+	// number of values, the type of the tuple and of its value decide
+	ambiguous := !expand && len(dest) == iter.meta.actualColCount
 
 	// i is the current position in dest, could posible replace it and just use
 	// slices of dest
 	i := 0
 	for c, col := range iter.meta.columns {
-		if dest[i] == nil {
-			i++
-			continue
-		}
-
-		switch col.TypeInfo.Type() {
-		case TypeTuple:
-			// this will panic, actually a bug, please report
-			tuple := col.TypeInfo.(TupleTypeInfo)
-
+		if tuple, ok := col.TypeInfo.(TupleTypeInfo); ok && (expand || ambiguous && !scansWholeTuple(tuple, dest[i])) {
 			count := len(tuple.Elems)
 			// here we pass in a slice of the struct which has the number number of
-			// values as elements in the tuple
+			// values as elements in the tuple, nil values are skipped
 			iter.err = Unmarshal(col.TypeInfo, iter.rows[iter.pos][c], dest[i:i+count])
 			i += count
-		default:
-			iter.err = Unmarshal(col.TypeInfo, iter.rows[iter.pos][c], dest[i])
+		} else {
+			if p, ok := dest[i].(*[]byte); ok && iter.borrowed != nil && isBytesType(col.TypeInfo) {
+				*p = iter.rows[iter.pos][c]
+			} else if dest[i] != nil {
+				iter.err = Unmarshal(col.TypeInfo, iter.rows[iter.pos][c], dest[i])
+			}
 			i++
 		}
 
@@ -759,12 +1564,36 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 	return true
 }
 
+// RowDecoder is implemented by the types decoding whole rows, such as the
+// structs whose methods are generated by gocqlgen. Iter.Scan passes the rows
+// to a single RowDecoder destination instead of unmarshaling the columns
+// into the destinations with reflection.
+type RowDecoder interface {
+	// DecodeRow decodes the values of a row, which are in the order of
+	// the columns and must not be retained.
+	DecodeRow(columns []ColumnInfo, row [][]byte) error
+}
+
 // Close closes the iterator and returns any errors that happened during
 // the query or the iteration.
 func (iter *Iter) Close() error {
+	iter.releaseBorrowed()
 	return iter.err
 }
 
+// releaseBorrowed returns the buffer aliased by the rows to the buffer
+// pools, the rows are dropped as they can no longer be read.
+func (iter *Iter) releaseBorrowed() {
+	if iter.borrowed == nil {
+		return
+	}
+
+	putBuffer(iter.borrowed)
+	iter.borrowed = nil
+	iter.rows = nil
+	iter.pos = 0
+}
+
 // checkErrAndNotFound handle error and NotFound in one method.
 func (iter *Iter) checkErrAndNotFound() error {
 	if iter.err != nil {
@@ -798,6 +1627,22 @@ type Batch struct {
 	totalLatency     int64
 	serialCons       SerialConsistency
 	defaultTimestamp bool
+
+	defaultTimestampValue int64
+	observer              BatchObserver
+	customPayload         map[string][]byte
+	// keyspace is the keyspace the batch runs in instead of the one of the
+	// connection, v5+
+	keyspace string
+	// v5+
+	nowInSeconds      bool
+	nowInSecondsValue int
+	context           context.Context
+	// size is the size of the values and statements of the last attempt,
+	// the attempts fail when it is over sizeLimit
+	size      int
+	sizeLimit int
+	priority  Priority
 }
 
 // NewBatch creates a new batch operation without defaults from the cluster
@@ -809,11 +1654,18 @@ func NewBatch(typ BatchType) *Batch {
 func (s *Session) NewBatch(typ BatchType) *Batch {
 	s.mu.RLock()
 	batch := &Batch{Type: typ, rt: s.cfg.RetryPolicy, serialCons: s.cfg.SerialConsistency,
-		Cons: s.cons, defaultTimestamp: s.cfg.DefaultTimestamp}
+		Cons: s.cons, defaultTimestamp: s.cfg.DefaultTimestamp, observer: s.cfg.BatchObserver}
 	s.mu.RUnlock()
 	return batch
 }
 
+// Observer sets the observer notified of every execution of this batch,
+// overriding ClusterConfig.BatchObserver. A nil observer disables it.
+func (b *Batch) Observer(observer BatchObserver) *Batch {
+	b.observer = observer
+	return b
+}
+
 // Attempts returns the number of attempts made to execute the batch.
 func (b *Batch) Attempts() int {
 	return b.attempts
@@ -827,6 +1679,21 @@ func (b *Batch) Latency() int64 {
 	return 0
 }
 
+// Priority sets the priority of the batch on the connections at their
+// ClusterConfig.MaxInFlightPerConn limit. (default: PriorityNormal)
+func (b *Batch) Priority(p Priority) *Batch {
+	b.priority = p
+	return b
+}
+
+// Consistency sets the consistency level of the batch, overriding the
+// default consistency level of the session. The batch fails with
+// ErrInvalidConsistency when the level is not valid for writes.
+func (b *Batch) Consistency(c Consistency) *Batch {
+	b.Cons = c
+	return b
+}
+
 // GetConsistency returns the currently configured consistency level for the batch
 // operation.
 func (b *Batch) GetConsistency() Consistency {
@@ -879,6 +1746,60 @@ func (b *Batch) DefaultTimestamp(enable bool) *Batch {
 	return b
 }
 
+// WithTimestamp will enable the with default timestamp flag on the batch
+// like DefaultTimestamp does, using the given timestamp in microseconds
+// since the unix epoch for all of its mutations instead of the current time.
+//
+// Only available on protocol >= 3
+func (b *Batch) WithTimestamp(timestamp int64) *Batch {
+	b.DefaultTimestamp(true)
+	b.defaultTimestampValue = timestamp
+	return b
+}
+
+// Keyspace sets the keyspace the unqualified tables of the statements of the
+// batch belong to instead of the keyspace of the session.
+//
+// Only available on protocol >= 5, the batch fails with ErrUnsupported with
+// older protocols.
+func (b *Batch) Keyspace(keyspace string) *Batch {
+	b.keyspace = keyspace
+	return b
+}
+
+// CustomPayload sets the custom payload sent along with the batch, see
+// Query.CustomPayload.
+func (b *Batch) CustomPayload(payload map[string][]byte) *Batch {
+	b.customPayload = payload
+	return b
+}
+
+// WithNowInSeconds sets the current time of the host executing the batch, in
+// seconds since the unix epoch, see Query.WithNowInSeconds.
+//
+// Only available on protocol >= 5, the batch fails with ErrUnsupported with
+// older protocols.
+func (b *Batch) WithNowInSeconds(now int) *Batch {
+	b.nowInSeconds = true
+	b.nowInSecondsValue = now
+	return b
+}
+
+// WithContext sets the context of the batch, see Query.WithContext.
+func (b *Batch) WithContext(ctx context.Context) *Batch {
+	b.context = ctx
+	return b
+}
+
+// Context returns the context of the batch, context.Background() when it
+// has none.
+func (b *Batch) Context() context.Context {
+	if b.context == nil {
+		return context.Background()
+	}
+	return b.context
+}
+
 type BatchType byte
 
 const (
@@ -947,47 +1868,214 @@ type Tracer interface {
 	Trace(traceId []byte)
 }
 
-type traceWriter struct {
-	session *Session
-	w       io.Writer
-	mu      sync.Mutex
+// TraceEvent is a single event of a tracing session.
+type TraceEvent struct {
+	Timestamp time.Time
+	Activity  string
+	Source    string
+	// Elapsed is the time elapsed on the source since the start of the
+	// request.
+	Elapsed time.Duration
 }
 
-// NewTraceWriter returns a simple Tracer implementation that outputs
-// the event log in a textual format.
-func NewTraceWriter(session *Session, w io.Writer) Tracer {
-	return &traceWriter{session: session, w: w}
+// TraceSession is the event log of a traced query.
+type TraceSession struct {
+	ID          []byte
+	Coordinator string
+	Duration    time.Duration
+	Events      []TraceEvent
 }
 
-func (t *traceWriter) Trace(traceId []byte) {
+// WriteTo writes the event log in a textual format.
+func (t *TraceSession) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	n, err := fmt.Fprintf(w, "Tracing session %016x (coordinator: %s, duration: %v):\n",
+		t.ID, t.Coordinator, t.Duration)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	for _, e := range t.Events {
+		n, err = fmt.Fprintf(w, "%s: %s (source: %s, elapsed: %d)\n",
+			e.Timestamp.Format("2006/01/02 15:04:05.999999"), e.Activity, e.Source, e.Elapsed/time.Microsecond)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// DefaultTraceTimeout is a time to wait for traces to be complete which suits
+// most clusters, see NewTraceWriterTimeout and Session.FetchTrace.
+const DefaultTraceTimeout = 2 * time.Second
+
+// FetchTrace reads the tracing session traceId from the system_traces
+// keyspace. Cassandra writes traces asynchronously so they might not be
+// available right after the traced query returns, FetchTrace polls until the
+// tracing session is complete or timeout elapses in which case the events
+// read so far are returned along with ErrTraceIncomplete.
+func (s *Session) FetchTrace(traceId []byte, timeout time.Duration) (*TraceSession, error) {
+	trace := &TraceSession{ID: traceId}
+
 	var (
-		coordinator string
-		duration    int
+		deadline = time.Now().Add(timeout)
+		sleep    = 10 * time.Millisecond
+		duration int
+		err      error
 	)
-	t.session.Query(`SELECT coordinator, duration
+
+	for {
+		err = s.Query(`SELECT coordinator, duration
 			FROM system_traces.sessions
 			WHERE session_id = ?`, traceId).
-		Consistency(One).Scan(&coordinator, &duration)
+			Consistency(One).Scan(&trace.Coordinator, &duration)
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+
+		// the duration is only set once the request is complete
+		if duration > 0 || !time.Now().Add(sleep).Before(deadline) {
+			break
+		}
+
+		time.Sleep(sleep)
+		if sleep < 200*time.Millisecond {
+			sleep *= 2
+		}
+	}
 
-	iter := t.session.Query(`SELECT event_id, activity, source, source_elapsed
+	trace.Duration = time.Duration(duration) * time.Microsecond
+
+	iter := s.Query(`SELECT event_id, activity, source, source_elapsed
 			FROM system_traces.events
 			WHERE session_id = ?`, traceId).
 		Consistency(One).Iter()
+
 	var (
-		timestamp time.Time
-		activity  string
-		source    string
-		elapsed   int
+		event   TraceEvent
+		elapsed int
 	)
+	for iter.Scan(&event.Timestamp, &event.Activity, &event.Source, &elapsed) {
+		event.Elapsed = time.Duration(elapsed) * time.Microsecond
+		trace.Events = append(trace.Events, event)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	if duration == 0 {
+		return trace, ErrTraceIncomplete
+	}
+	return trace, nil
+}
+
+// ObservedQuery describes a single execution of a query, a query is executed
+// once per attempt and once per page.
+type ObservedQuery struct {
+	Keyspace  string
+	Statement string
+
+	// Host is the address of the host the query was sent to.
+	Host string
+
+	// Consistency is the consistency level of this execution, see
+	// Query.ConsistencyLadder.
+	Consistency Consistency
+
+	Start time.Time
+	End   time.Time
+
+	// Rows is the number of rows returned by this execution.
+	Rows int
+
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int
+
+	// Warnings are the warnings the host sent along with the result, they
+	// require protocol 4 or above.
+	Warnings []string
+
+	// Err is the error returned by the execution, if any.
+	Err error
+}
+
+// QueryObserver is the interface implemented by query observers, they are
+// notified after every execution of a query and are suitable to gather
+// metrics or to log queries. ObserveQuery is called synchronously from the
+// goroutine executing the query and must not block.
+type QueryObserver interface {
+	ObserveQuery(q ObservedQuery)
+}
+
+// ObservedBatch describes a single execution of a batch.
+type ObservedBatch struct {
+	Keyspace string
+
+	// Statements is the number of statements in the batch.
+	Statements int
+
+	// Size is the size in bytes of the bound values and of the unprepared
+	// statements of the batch, see ClusterConfig.BatchSizeWarnThreshold.
+	Size int
+
+	// Host is the address of the host the batch was sent to.
+	Host string
+
+	Start time.Time
+	End   time.Time
+
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int
+
+	// Warnings are the warnings the host sent along with the result, they
+	// require protocol 4 or above.
+	Warnings []string
+
+	// Err is the error returned by the execution, if any.
+	Err error
+}
+
+// BatchObserver is the interface implemented by batch observers, they are
+// notified after every execution of a batch. Like QueryObserver,
+// ObserveBatch is called synchronously and must not block.
+type BatchObserver interface {
+	ObserveBatch(b ObservedBatch)
+}
+
+type traceWriter struct {
+	session *Session
+	w       io.Writer
+	timeout time.Duration
+	mu      sync.Mutex
+}
+
+// NewTraceWriter returns a simple Tracer implementation that outputs
+// the event log in a textual format. The traces are read once, right after
+// the traced query returns, and may be incomplete.
+func NewTraceWriter(session *Session, w io.Writer) Tracer {
+	return NewTraceWriterTimeout(session, w, 0)
+}
+
+// NewTraceWriterTimeout is like NewTraceWriter but waits at most timeout for
+// the traces to be complete, see Session.FetchTrace. The traces are read by
+// the goroutine executing the traced query, which returns once they are
+// written.
+func NewTraceWriterTimeout(session *Session, w io.Writer, timeout time.Duration) Tracer {
+	return &traceWriter{session: session, w: w, timeout: timeout}
+}
+
+func (t *traceWriter) Trace(traceId []byte) {
+	trace, err := t.session.FetchTrace(traceId, t.timeout)
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	fmt.Fprintf(t.w, "Tracing session %016x (coordinator: %s, duration: %v):\n",
-		traceId, coordinator, time.Duration(duration)*time.Microsecond)
-	for iter.Scan(&timestamp, &activity, &source, &elapsed) {
-		fmt.Fprintf(t.w, "%s: %s (source: %s, elapsed: %d)\n",
-			timestamp.Format("2006/01/02 15:04:05.999999"), activity, source, elapsed)
+	if trace != nil {
+		trace.WriteTo(t.w)
 	}
-	if err := iter.Close(); err != nil {
+	if err != nil {
 		fmt.Fprintln(t.w, "Error:", err)
 	}
 }
@@ -1006,11 +2094,15 @@ var (
 	ErrUnavailable   = errors.New("unavailable")
 	ErrUnsupported   = errors.New("feature not supported")
 	ErrTooManyStmts  = errors.New("too many statements")
-	ErrUseStmt       = errors.New("use statements aren't supported. Please see https://github.com/gocql/gocql for explaination.")
+	ErrBatchTooLarge = errors.New("batch too large")
+	ErrUseStmt       = errors.New("use statements aren't supported, use Session.SetKeyspace to change the keyspace of the session")
 	ErrSessionClosed = errors.New("session has been closed")
 	ErrNoConnections = errors.New("no connections available")
 	ErrNoKeyspace    = errors.New("no keyspace provided")
 	ErrNoMetadata    = errors.New("no metadata available")
+
+	ErrTraceIncomplete    = errors.New("trace incomplete")
+	ErrInvalidConsistency = errors.New("invalid consistency")
 )
 
 type ErrProtocol struct{ error }
@@ -3,6 +3,7 @@
 package gocql
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -135,6 +136,18 @@ func TestQueryBasicAPI(t *testing.T) {
 	if qry.values[0] != qry {
 		t.Fatalf("expected Query.Values[0] to be '%v', got '%v'", qry, qry.values[0])
 	}
+
+	payload := map[string][]byte{"key": []byte("value")}
+	qry.CustomPayload(payload).ExecuteAs("alice")
+	if v := string(qry.customPayload["ProxyExecute"]); v != "alice" {
+		t.Fatalf("expected Query.ExecuteAs to set the proxied user to 'alice', got '%s'", v)
+	}
+	if v := string(qry.customPayload["key"]); v != "value" {
+		t.Fatalf("expected Query.ExecuteAs to keep the custom payload, got '%s'", v)
+	}
+	if len(payload) != 1 {
+		t.Fatalf("expected Query.ExecuteAs not to modify the custom payload, got %v", payload)
+	}
 }
 
 func TestQueryShouldPrepare(t *testing.T) {
@@ -203,6 +216,11 @@ func TestBatchBasicAPI(t *testing.T) {
 		t.Fatalf("expected batch.GetConsistency() to return 'One', got '%s'", b.GetConsistency())
 	}
 
+	b.Consistency(Any)
+	if b.GetConsistency() != Any {
+		t.Fatalf("expected batch.GetConsistency() to return 'Any', got '%s'", b.GetConsistency())
+	}
+
 	b.Query("test", 1)
 	if b.Entries[0].Stmt != "test" {
 		t.Fatalf("expected batch.Entries[0].Stmt to be 'test', got '%v'", b.Entries[0].Stmt)
@@ -232,6 +250,33 @@ func TestBatchBasicAPI(t *testing.T) {
 
 }
 
+func TestValidateConsistency(t *testing.T) {
+	tests := []struct {
+		cons   Consistency
+		serial SerialConsistency
+		read   bool
+		valid  bool
+	}{
+		{Quorum, 0, true, true},
+		{LocalOne, LocalSerial, false, true},
+		{Any, 0, false, true},
+		{Any, 0, true, false},
+		{Consistency(Serial), 0, true, true},
+		{Consistency(LocalSerial), 0, false, false},
+		{Consistency(0x42), 0, true, false},
+		{One, SerialConsistency(One), false, false},
+	}
+
+	for _, test := range tests {
+		err := validateConsistency(test.cons, test.serial, test.read)
+		if test.valid && err != nil {
+			t.Errorf("%v/%v read=%v: expected no error got %v", test.cons, test.serial, test.read, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidConsistency) {
+			t.Errorf("%v/%v read=%v: expected %v got %v", test.cons, test.serial, test.read, ErrInvalidConsistency, err)
+		}
+	}
+}
+
 func TestConsistencyNames(t *testing.T) {
 	names := map[fmt.Stringer]string{
 		Any:         "ANY",
@@ -0,0 +1,140 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// SlowQuery describes an execution of a query or a batch which took longer
+// than ClusterConfig.SlowQueryThreshold.
+type SlowQuery struct {
+	// Statement is the statement of the query, or the statements of the
+	// batch separated by "; ". Its literals are replaced with "?" when
+	// ClusterConfig.SlowQueryRedact is set.
+	Statement string
+	// Batch is true when the execution was a batch.
+	Batch bool
+
+	Keyspace    string
+	Host        string
+	Consistency Consistency
+
+	// Latency is the duration of this execution.
+	Latency time.Duration
+
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int
+
+	// Err is the error returned by the execution, if any.
+	Err error
+}
+
+func (s *Session) reportSlowQuery(q SlowQuery) {
+	if s.cfg.SlowQueryRedact {
+		q.Statement = redactStatement(q.Statement)
+	}
+
+	if s.cfg.SlowQueryFunc != nil {
+		s.cfg.SlowQueryFunc(q)
+		return
+	}
+
+	keyvals := []interface{}{
+		"statement", q.Statement,
+		"keyspace", q.Keyspace,
+		"host", q.Host,
+		"consistency", q.Consistency,
+		"latency", q.Latency,
+		"attempt", q.Attempt,
+	}
+	if q.Err != nil {
+		keyvals = append(keyvals, "error", q.Err)
+	}
+
+	msg := "gocql: slow query"
+	if q.Batch {
+		msg = "gocql: slow batch"
+	}
+
+	s.cfg.logger().Warn(msg, keyvals...)
+}
+
+func batchStatement(b *Batch) string {
+	stmts := make([]string, len(b.Entries))
+	for i, entry := range b.Entries {
+		stmts[i] = entry.Stmt
+	}
+	return strings.Join(stmts, "; ")
+}
+
+// redactStatement replaces the string, numeric and blob literals of stmt
+// with "?", identifiers and bind markers are left untouched.
+func redactStatement(stmt string) string {
+	var buf bytes.Buffer
+	buf.Grow(len(stmt))
+
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == '\'':
+			// string literal, quotes are escaped by doubling them
+			i++
+			for i < len(stmt) {
+				if stmt[i] == '\'' {
+					if i+1 < len(stmt) && stmt[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			buf.WriteByte('?')
+		case c == '"':
+			// quoted identifier
+			j := i + 1
+			for j < len(stmt) && stmt[j] != '"' {
+				j++
+			}
+			if j < len(stmt) {
+				j++
+			}
+			buf.WriteString(stmt[i:j])
+			i = j
+		case isIdentChar(c) && !isDigit(c):
+			j := i
+			for j < len(stmt) && isIdentChar(stmt[j]) {
+				j++
+			}
+			buf.WriteString(stmt[i:j])
+			i = j
+		case isDigit(c) || (c == '-' && i+1 < len(stmt) && isDigit(stmt[i+1])):
+			// numbers, blobs and uuids
+			j := i + 1
+			for j < len(stmt) && (isIdentChar(stmt[j]) || stmt[j] == '.' || stmt[j] == '-') {
+				j++
+			}
+			buf.WriteByte('?')
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+
+	return buf.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
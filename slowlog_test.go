@@ -0,0 +1,85 @@
+// +build all unit
+
+package gocql
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedactStatement(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+	}{
+		{"SELECT * FROM t1 WHERE id = ?", "SELECT * FROM t1 WHERE id = ?"},
+		{"SELECT * FROM t WHERE name = 'it''s' AND n = -12.5e3", "SELECT * FROM t WHERE name = ? AND n = ?"},
+		{"INSERT INTO \"T1\" (a, b) VALUES (0xcafe, 550e8400-e29b-41d4-a716-446655440000)", "INSERT INTO \"T1\" (a, b) VALUES (?, ?)"},
+		{"UPDATE t SET m = {'k': 1} WHERE id = 'x'", "UPDATE t SET m = {?: ?} WHERE id = ?"},
+	}
+
+	for _, test := range tests {
+		if got := redactStatement(test.stmt); got != test.expected {
+			t.Errorf("%q: expected %q got %q", test.stmt, test.expected, got)
+		}
+	}
+}
+
+func TestSlowQuery(t *testing.T) {
+	srv := NewTestServer(t, defaultProto)
+	defer srv.Stop()
+
+	var (
+		mu   sync.Mutex
+		slow []SlowQuery
+	)
+
+	cluster := NewCluster(srv.Address)
+	cluster.ProtoVersion = int(defaultProto)
+	cluster.NumConns = 1
+	cluster.SlowQueryThreshold = 20 * time.Millisecond
+	cluster.SlowQueryRedact = true
+	cluster.SlowQueryFunc = func(q SlowQuery) {
+		mu.Lock()
+		slow = append(slow, q)
+		mu.Unlock()
+	}
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("slow WHERE id = 'secret'").Consistency(Quorum).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(slow) != 1 {
+		t.Fatalf("expected 1 slow query got %d", len(slow))
+	}
+
+	q := slow[0]
+	if q.Statement != "slow WHERE id = ?" {
+		t.Errorf("expected redacted statement got %q", q.Statement)
+	}
+	if q.Host != srv.Address {
+		t.Errorf("expected host %q got %q", srv.Address, q.Host)
+	}
+	if q.Consistency != Quorum {
+		t.Errorf("expected consistency %v got %v", Quorum, q.Consistency)
+	}
+	if q.Attempt != 1 {
+		t.Errorf("expected attempt 1 got %d", q.Attempt)
+	}
+	if q.Latency < cluster.SlowQueryThreshold {
+		t.Errorf("expected latency above %v got %v", cluster.SlowQueryThreshold, q.Latency)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionStats are runtime statistics of a session, the counters are totals
+// since the session was created.
+type SessionStats struct {
+	// OpenConnections is the number of connections in the pool.
+	OpenConnections int
+	// InFlight is the number of requests waiting for a response.
+	InFlight int64
+	// Retries is the number of times queries and batches were retried.
+	Retries int64
+	// Timeouts is the number of requests which timed out.
+	Timeouts int64
+	// BytesIn and BytesOut are the number of bytes read from and written to
+	// the connections.
+	BytesIn  int64
+	BytesOut int64
+}
+
+// sessionStats are shared by a session and its connections. All methods can
+// be called on a nil *sessionStats, for instance on connections which are not
+// created by a session.
+type sessionStats struct {
+	inFlight int64
+	retries  int64
+	timeouts int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+func (s *sessionStats) addInFlight(n int64) {
+	if s != nil {
+		atomic.AddInt64(&s.inFlight, n)
+	}
+}
+
+func (s *sessionStats) retry() {
+	if s != nil {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
+
+func (s *sessionStats) timeout() {
+	if s != nil {
+		atomic.AddInt64(&s.timeouts, 1)
+	}
+}
+
+func (s *sessionStats) read(n int) {
+	if s != nil {
+		atomic.AddInt64(&s.bytesIn, int64(n))
+	}
+}
+
+func (s *sessionStats) written(n int) {
+	if s != nil {
+		atomic.AddInt64(&s.bytesOut, int64(n))
+	}
+}
+
+// Stats returns the runtime statistics of the session.
+func (s *Session) Stats() SessionStats {
+	stats := SessionStats{
+		OpenConnections: s.Pool.Size(),
+	}
+
+	if st := s.cfg.stats; st != nil {
+		stats.InFlight = atomic.LoadInt64(&st.inFlight)
+		stats.Retries = atomic.LoadInt64(&st.retries)
+		stats.Timeouts = atomic.LoadInt64(&st.timeouts)
+		stats.BytesIn = atomic.LoadInt64(&st.bytesIn)
+		stats.BytesOut = atomic.LoadInt64(&st.bytesOut)
+	}
+
+	return stats
+}
+
+// HostPoolStats is the state of the connections of a session to a host, see
+// Session.PoolSnapshot.
+type HostPoolStats struct {
+	// OpenConnections is the number of connections to the host in the pool.
+	OpenConnections int
+	// InFlight is the number of requests waiting for a response of the host.
+	InFlight int
+	// Streams is the number of streams of the connections to the host.
+	Streams int
+	// StreamUtilization is the fraction of the streams in use, InFlight
+	// divided by Streams.
+	StreamUtilization float64
+	// ConsecutiveErrors is the number of executions of queries and batches
+	// on the host which failed since the last one which succeeded.
+	ConsecutiveErrors int
+	// LastError is the time of the last failed execution, zero if none
+	// failed.
+	LastError time.Time
+}
+
+// PoolSnapshot returns the state of the connections of the session to every
+// host of the pool, keyed by host address. The number of connections and
+// streams of the hosts are only reported by the pools implementing
+// HostConns, which the built-in pools do.
+func (s *Session) PoolSnapshot() map[string]HostPoolStats {
+	snapshot := make(map[string]HostPoolStats)
+
+	if p, ok := s.Pool.(HostConns); ok {
+		for host, conns := range p.HostConns() {
+			var stats HostPoolStats
+			for _, conn := range conns {
+				stats.OpenConnections++
+				stats.Streams += conn.maxStreams()
+				stats.InFlight += conn.maxStreams() - conn.AvailableStreams()
+			}
+			if stats.Streams > 0 {
+				stats.StreamUtilization = float64(stats.InFlight) / float64(stats.Streams)
+			}
+			snapshot[host] = stats
+		}
+	}
+
+	s.hostErrors.mu.RLock()
+	for host, e := range s.hostErrors.hosts {
+		stats := snapshot[host]
+		e.mu.Lock()
+		stats.ConsecutiveErrors = e.consecutive
+		stats.LastError = e.last
+		e.mu.Unlock()
+		snapshot[host] = stats
+	}
+	s.hostErrors.mu.RUnlock()
+
+	return snapshot
+}
+
+// hostErrors are the errors of the executions on the hosts of a session.
+type hostErrors struct {
+	mu    sync.RWMutex
+	hosts map[string]*hostError
+}
+
+type hostError struct {
+	mu          sync.Mutex
+	consecutive int
+	last        time.Time
+}
+
+// record records the result of an execution on host which completed at t,
+// the hosts are only tracked once an execution failed.
+func (h *hostErrors) record(host string, err error, t time.Time) {
+	h.mu.RLock()
+	e := h.hosts[host]
+	h.mu.RUnlock()
+
+	if e == nil {
+		if err == nil {
+			return
+		}
+
+		h.mu.Lock()
+		if h.hosts == nil {
+			h.hosts = make(map[string]*hostError)
+		}
+		if e = h.hosts[host]; e == nil {
+			e = &hostError{}
+			h.hosts[host] = e
+		}
+		h.mu.Unlock()
+	}
+
+	e.mu.Lock()
+	if err == nil {
+		e.consecutive = 0
+	} else {
+		e.consecutive++
+		e.last = t
+	}
+	e.mu.Unlock()
+}
+
+var (
+	expvarMu sync.Mutex
+	// expvarSessions are the sessions published under each name. expvar
+	// variables can not be removed so they are published once and report the
+	// last session created with their name.
+	expvarSessions = make(map[string]*Session)
+)
+
+func publishExpvar(name string, s *Session) {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if _, ok := expvarSessions[name]; !ok {
+		if expvar.Get(name) != nil {
+			s.cfg.logger().Warn("gocql: unable to publish the session stats, expvar already exists", "name", name)
+			return
+		}
+
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			expvarMu.Lock()
+			s := expvarSessions[name]
+			expvarMu.Unlock()
+
+			if s == nil {
+				return nil
+			}
+			return s.Stats()
+		}))
+	}
+
+	expvarSessions[name] = s
+}
+
+func unpublishExpvar(name string, s *Session) {
+	expvarMu.Lock()
+	if expvarSessions[name] == s {
+		expvarSessions[name] = nil
+	}
+	expvarMu.Unlock()
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"context"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// streamIDs allocates the stream IDs of a connection. The IDs in use are
+// tracked in a bitmap so a connection can use the 32768 streams of protocol
+// v3 and later without a queue of free IDs, stream 0 is reserved.
+type streamIDs struct {
+	// sem holds a token per stream in use, allocations wait on it when
+	// every stream is in use
+	sem chan struct{}
+
+	mu     sync.Mutex
+	bitmap []uint64
+	// pos is the bucket of the last allocation, the search for a free ID
+	// starts there
+	pos int
+}
+
+// newStreamIDs returns an allocator of the IDs 1 to n-1.
+func newStreamIDs(n int) *streamIDs {
+	s := &streamIDs{
+		sem:    make(chan struct{}, n-1),
+		bitmap: make([]uint64, (n+63)/64),
+	}
+
+	// stream 0 and the bits past the last ID are never allocated
+	s.bitmap[0] |= 1
+	for i := n; i < len(s.bitmap)*64; i++ {
+		s.bitmap[i/64] |= 1 << uint(i%64)
+	}
+
+	return s
+}
+
+// get allocates a stream ID, it waits for one to be released when they are
+// all in use. It returns false if quit is closed meanwhile.
+func (s *streamIDs) get(quit <-chan struct{}) (int, bool) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-quit:
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < len(s.bitmap); i++ {
+		bucket := (s.pos + i) % len(s.bitmap)
+		if free := ^s.bitmap[bucket]; free != 0 {
+			bit := bits.TrailingZeros64(free)
+			s.bitmap[bucket] |= 1 << uint(bit)
+			s.pos = bucket
+			return bucket*64 + bit, true
+		}
+	}
+
+	// the semaphore guarantees that an ID is free
+	panic("gocql: no free stream ID")
+}
+
+// release frees an ID returned by get.
+func (s *streamIDs) release(id int) {
+	s.mu.Lock()
+	s.bitmap[id/64] &^= 1 << uint(id%64)
+	s.mu.Unlock()
+
+	<-s.sem
+}
+
+// available returns the number of IDs which are not in use.
+func (s *streamIDs) available() int {
+	return cap(s.sem) - len(s.sem)
+}
+
+// requestLimiter limits the requests in flight on a connection, a bounded
+// number of requests wait for a slot and the others fail fast. The waiting
+// requests get the slots by order of priority, and a request evicts a
+// waiting one of lower priority when the queue is full.
+type requestLimiter struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	maxQueued   int
+	maxWait     time.Duration
+	// waiting is ordered by decreasing priority then by arrival
+	waiting []*limiterWaiter
+}
+
+// limiterWaiter is a request waiting for a slot, ready receives nil when it
+// is given a slot or ErrTooManyInFlight when it is evicted.
+type limiterWaiter struct {
+	priority Priority
+	ready    chan error
+}
+
+func newRequestLimiter(maxInFlight, maxQueued int, maxWait time.Duration) *requestLimiter {
+	return &requestLimiter{
+		maxInFlight: maxInFlight,
+		maxQueued:   maxQueued,
+		maxWait:     maxWait,
+	}
+}
+
+// acquire takes a slot, waiting at most maxWait for one when the limit is
+// reached and less than maxQueued requests are already waiting, or when one
+// of them has a lower priority than p.
+func (l *requestLimiter) acquire(ctx context.Context, p Priority, quit <-chan struct{}) error {
+	l.mu.Lock()
+	if l.inFlight < l.maxInFlight {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+
+	if len(l.waiting) >= l.maxQueued {
+		// the last waiting request is the lowest priority one which came
+		// last
+		last := len(l.waiting) - 1
+		if last < 0 || l.waiting[last].priority >= p {
+			l.mu.Unlock()
+			return ErrTooManyInFlight
+		}
+		l.waiting[last].ready <- ErrTooManyInFlight
+		l.waiting = l.waiting[:last]
+	}
+
+	w := &limiterWaiter{priority: p, ready: make(chan error, 1)}
+	i := sort.Search(len(l.waiting), func(i int) bool {
+		return l.waiting[i].priority < p
+	})
+	l.waiting = append(l.waiting, nil)
+	copy(l.waiting[i+1:], l.waiting[i:])
+	l.waiting[i] = w
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.maxWait > 0 {
+		timer := time.NewTimer(l.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err := <-w.ready:
+		return err
+	case <-timeout:
+		if l.cancel(w) {
+			return ErrTooManyInFlight
+		}
+		// the request was given a slot or evicted meanwhile
+		return <-w.ready
+	case <-quit:
+		if !l.cancel(w) && <-w.ready == nil {
+			l.release()
+		}
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		if !l.cancel(w) && <-w.ready == nil {
+			l.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// cancel removes w from the waiting requests, it returns false when w is
+// no longer waiting.
+func (l *requestLimiter) cancel(w *limiterWaiter) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, x := range l.waiting {
+		if x == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release gives the slot to the first waiting request, if any.
+func (l *requestLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.waiting) == 0 {
+		l.inFlight--
+		return
+	}
+
+	w := l.waiting[0]
+	l.waiting = l.waiting[1:]
+	w.ready <- nil
+}
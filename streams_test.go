@@ -0,0 +1,162 @@
+// +build all unit
+
+package gocql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStreamIDs(t *testing.T) {
+	const n = 130
+	streams := newStreamIDs(n)
+
+	if got := streams.available(); got != n-1 {
+		t.Fatalf("expected %d available streams got %d", n-1, got)
+	}
+
+	used := make(map[int]bool)
+	for i := 1; i < n; i++ {
+		id, ok := streams.get(nil)
+		if !ok {
+			t.Fatal("expected a stream")
+		}
+		if id <= 0 || id >= n {
+			t.Fatalf("stream %d out of range", id)
+		}
+		if used[id] {
+			t.Fatalf("stream %d allocated twice", id)
+		}
+		used[id] = true
+	}
+
+	if got := streams.available(); got != 0 {
+		t.Fatalf("expected no available stream got %d", got)
+	}
+
+	// every stream is in use, get waits until one is released
+	quit := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(quit)
+	}()
+	if _, ok := streams.get(quit); ok {
+		t.Fatal("expected no stream to be allocated")
+	}
+
+	released := make(chan int)
+	go func() {
+		id, _ := streams.get(nil)
+		released <- id
+	}()
+	streams.release(64)
+
+	select {
+	case id := <-released:
+		if id != 64 {
+			t.Errorf("expected the released stream 64 got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a stream to be allocated once released")
+	}
+}
+
+func BenchmarkStreamIDs(b *testing.B) {
+	streams := newStreamIDs(32768)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id, _ := streams.get(nil)
+			streams.release(id)
+		}
+	})
+}
+
+func TestRequestLimiterPriority(t *testing.T) {
+	l := newRequestLimiter(1, 2, 0)
+	quit := make(chan struct{})
+
+	if err := l.acquire(context.Background(), PriorityNormal, quit); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		p   Priority
+		err error
+	}
+	results := make(chan result, 3)
+	acquire := func(p Priority, queued int) {
+		go func() {
+			results <- result{p, l.acquire(context.Background(), p, quit)}
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			l.mu.Lock()
+			n := len(l.waiting)
+			l.mu.Unlock()
+			if n == queued {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d queued requests got %d", queued, n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	acquire(PriorityBatch, 1)
+	acquire(PriorityNormal, 2)
+
+	// the queue is full, the batch request is evicted
+	acquire(PriorityInteractive, 2)
+	if res := <-results; res.p != PriorityBatch || res.err != ErrTooManyInFlight {
+		t.Fatalf("expected the batch request to be evicted got %v: %v", res.p, res.err)
+	}
+
+	// no queued request has a lower priority
+	if err := l.acquire(context.Background(), PriorityNormal, quit); err != ErrTooManyInFlight {
+		t.Fatalf("expected %v got %v", ErrTooManyInFlight, err)
+	}
+
+	for _, expected := range []Priority{PriorityInteractive, PriorityNormal} {
+		l.release()
+		if res := <-results; res.p != expected || res.err != nil {
+			t.Fatalf("expected the %v request to get the slot got %v: %v", expected, res.p, res.err)
+		}
+	}
+
+	l.release()
+	if l.inFlight != 0 {
+		t.Errorf("expected no request in flight got %d", l.inFlight)
+	}
+}
+
+func TestRequestLimiterContext(t *testing.T) {
+	l := newRequestLimiter(1, 1, time.Minute)
+	quit := make(chan struct{})
+
+	if err := l.acquire(context.Background(), PriorityNormal, quit); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, PriorityNormal, quit); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	// the cancelled request no longer holds a place in the queue
+	l.mu.Lock()
+	queued := len(l.waiting)
+	l.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("expected no queued request got %d", queued)
+	}
+
+	l.release()
+	if err := l.acquire(context.Background(), PriorityNormal, quit); err != nil {
+		t.Fatal(err)
+	}
+}
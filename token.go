@@ -7,12 +7,14 @@ package gocql
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"math/big"
 	"sort"
 	"strconv"
 	"strings"
-	"unsafe"
 )
 
 // a token partitioner
@@ -37,11 +39,18 @@ func (p murmur3Partitioner) Name() string {
 }
 
 func (p murmur3Partitioner) Hash(partitionKey []byte) token {
-	h1 := murmur3H1(partitionKey)
-	return murmur3Token(int64(h1))
+	h1 := int64(murmur3H1(partitionKey))
+	// the minimum token is reserved by Cassandra for the start of the ring
+	if h1 == math.MinInt64 {
+		h1 = math.MaxInt64
+	}
+	return murmur3Token(h1)
 }
 
-// murmur3 little-endian, 128-bit hash, but returns only h1
+// murmur3 little-endian, 128-bit hash, but returns only h1. This is the
+// variant of Cassandra which sign extends the bytes of the tail, the hashes of
+// the keys whose tail has bytes above 0x7f differ from the reference
+// implementation.
 func murmur3H1(data []byte) uint64 {
 	length := len(data)
 
@@ -55,10 +64,8 @@ func murmur3H1(data []byte) uint64 {
 	// body
 	nBlocks := length / 16
 	for i := 0; i < nBlocks; i++ {
-		block := (*[2]uint64)(unsafe.Pointer(&data[i*16]))
-
-		k1 = block[0]
-		k2 = block[1]
+		k1 = binary.LittleEndian.Uint64(data[i*16:])
+		k2 = binary.LittleEndian.Uint64(data[i*16+8:])
 
 		k1 *= c1
 		k1 = (k1 << 31) | (k1 >> 33) // ROTL64(k1, 31)
@@ -85,25 +92,25 @@ func murmur3H1(data []byte) uint64 {
 	k2 = 0
 	switch length & 15 {
 	case 15:
-		k2 ^= uint64(tail[14]) << 48
+		k2 ^= uint64(int8(tail[14])) << 48
 		fallthrough
 	case 14:
-		k2 ^= uint64(tail[13]) << 40
+		k2 ^= uint64(int8(tail[13])) << 40
 		fallthrough
 	case 13:
-		k2 ^= uint64(tail[12]) << 32
+		k2 ^= uint64(int8(tail[12])) << 32
 		fallthrough
 	case 12:
-		k2 ^= uint64(tail[11]) << 24
+		k2 ^= uint64(int8(tail[11])) << 24
 		fallthrough
 	case 11:
-		k2 ^= uint64(tail[10]) << 16
+		k2 ^= uint64(int8(tail[10])) << 16
 		fallthrough
 	case 10:
-		k2 ^= uint64(tail[9]) << 8
+		k2 ^= uint64(int8(tail[9])) << 8
 		fallthrough
 	case 9:
-		k2 ^= uint64(tail[8])
+		k2 ^= uint64(int8(tail[8]))
 
 		k2 *= c2
 		k2 = (k2 << 33) | (k2 >> 31) // ROTL64(k2, 33)
@@ -112,28 +119,28 @@ func murmur3H1(data []byte) uint64 {
 
 		fallthrough
 	case 8:
-		k1 ^= uint64(tail[7]) << 56
+		k1 ^= uint64(int8(tail[7])) << 56
 		fallthrough
 	case 7:
-		k1 ^= uint64(tail[6]) << 48
+		k1 ^= uint64(int8(tail[6])) << 48
 		fallthrough
 	case 6:
-		k1 ^= uint64(tail[5]) << 40
+		k1 ^= uint64(int8(tail[5])) << 40
 		fallthrough
 	case 5:
-		k1 ^= uint64(tail[4]) << 32
+		k1 ^= uint64(int8(tail[4])) << 32
 		fallthrough
 	case 4:
-		k1 ^= uint64(tail[3]) << 24
+		k1 ^= uint64(int8(tail[3])) << 24
 		fallthrough
 	case 3:
-		k1 ^= uint64(tail[2]) << 16
+		k1 ^= uint64(int8(tail[2])) << 16
 		fallthrough
 	case 2:
-		k1 ^= uint64(tail[1]) << 8
+		k1 ^= uint64(int8(tail[1])) << 8
 		fallthrough
 	case 1:
-		k1 ^= uint64(tail[0])
+		k1 ^= uint64(int8(tail[0]))
 
 		k1 *= c1
 		k1 = (k1 << 31) | (k1 >> 33) // ROTL64(k1, 31)
@@ -187,6 +194,24 @@ func (m murmur3Token) Less(token token) bool {
 	return m < token.(murmur3Token)
 }
 
+// compositePartitionKey serializes the components of a composite partition
+// key as Cassandra does before hashing it, each component is prefixed by its
+// 16-bit length and followed by a zero byte.
+func compositePartitionKey(components [][]byte) []byte {
+	size := 0
+	for _, component := range components {
+		size += len(component) + 3
+	}
+
+	key := make([]byte, 0, size)
+	for _, component := range components {
+		key = append(key, byte(len(component)>>8), byte(len(component)))
+		key = append(key, component...)
+		key = append(key, 0x00)
+	}
+	return key
+}
+
 // order preserving partitioner and token
 type orderedPartitioner struct{}
 type orderedToken []byte
@@ -212,6 +237,28 @@ func (o orderedToken) Less(token token) bool {
 	return -1 == bytes.Compare(o, token.(orderedToken))
 }
 
+// byte ordered partitioner, its tokens are the partition keys like the order
+// preserving partitioner but they are written in hex in system.local and
+// system.peers
+type byteOrderedPartitioner struct{}
+
+func (p byteOrderedPartitioner) Name() string {
+	return "ByteOrderedPartitioner"
+}
+
+func (p byteOrderedPartitioner) Hash(partitionKey []byte) token {
+	return orderedToken(partitionKey)
+}
+
+func (p byteOrderedPartitioner) ParseString(str string) token {
+	key, err := hex.DecodeString(str)
+	if err != nil {
+		// not a token of a byte ordered partitioner, compare it as is
+		return orderedToken([]byte(str))
+	}
+	return orderedToken(key)
+}
+
 // random partitioner and token
 type randomPartitioner struct{}
 type randomToken big.Int
@@ -220,13 +267,16 @@ func (r randomPartitioner) Name() string {
 	return "RandomPartitioner"
 }
 
+// Hash returns the absolute value of the MD5 digest of the partition key read
+// as a signed 128-bit integer, see BigInteger in Java.
 func (p randomPartitioner) Hash(partitionKey []byte) token {
-	hash := md5.New()
-	sum := hash.Sum(partitionKey)
+	sum := md5.Sum(partitionKey)
 
-	val := new(big.Int)
-	val = val.SetBytes(sum)
-	val = val.Abs(val)
+	val := new(big.Int).SetBytes(sum[:])
+	if sum[0]&0x80 != 0 {
+		// the two's complement of the negative digest is its absolute value
+		val.Sub(new(big.Int).Lsh(big.NewInt(1), 128), val)
+	}
 
 	return (*randomToken)(val)
 }
@@ -260,6 +310,8 @@ func newTokenRing(partitioner string, hosts []HostInfo) (*tokenRing, error) {
 
 	if strings.HasSuffix(partitioner, "Murmur3Partitioner") {
 		tokenRing.partitioner = murmur3Partitioner{}
+	} else if strings.HasSuffix(partitioner, "ByteOrderedPartitioner") {
+		tokenRing.partitioner = byteOrderedPartitioner{}
 	} else if strings.HasSuffix(partitioner, "OrderedPartitioner") {
 		tokenRing.partitioner = orderedPartitioner{}
 	} else if strings.HasSuffix(partitioner, "RandomPartitioner") {
@@ -0,0 +1,175 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var ErrNoTokens = errors.New("gocql: no tokens in the ring")
+
+// TokenRange is a range of the token ring, the tokens greater than Start and
+// lower than or equal to End. An empty Start or End leaves the range
+// unbounded on that side, the range wrapping around the end of the ring is
+// returned as two ranges for this reason.
+//
+// The tokens are written as they are bound to the token() function: in
+// decimal for the Murmur3Partitioner and the RandomPartitioner, and as the
+// raw bytes of the key for the ordered partitioners.
+type TokenRange struct {
+	Start string
+	End   string
+	// Host is the host owning the range, the primary replica of its tokens
+	Host HostInfo
+}
+
+// Predicate returns the condition selecting the rows of the range, for
+// instance "token(id) > ? AND token(id) <= ?", and its values. The columns
+// are the partition key of the table.
+func (r TokenRange) Predicate(partitionKey ...string) (string, []interface{}) {
+	token := "token(" + strings.Join(partitionKey, ", ") + ")"
+
+	var (
+		conditions []string
+		values     []interface{}
+	)
+	if r.Start != "" {
+		conditions = append(conditions, token+" > ?")
+		values = append(values, r.Start)
+	}
+	if r.End != "" {
+		conditions = append(conditions, token+" <= ?")
+		values = append(values, r.End)
+	}
+	return strings.Join(conditions, " AND "), values
+}
+
+// TokenRanges returns the ranges of the token ring split into about n ranges,
+// each range being owned by a single host. The ranges between the tokens of
+// the hosts are split in proportion of their size, they are never merged so
+// more than n ranges are returned when the ring has more tokens. The ranges of
+// the ordered partitioners can not be split.
+func (s *Session) TokenRanges(n int) ([]TokenRange, error) {
+	// the hosts of all the data centers own the tokens, whatever the host
+	// filter of the session
+	hosts, partitioner, err := (&ringDescriber{session: s}).GetHosts()
+	if err != nil {
+		return nil, err
+	}
+	return splitTokenRing(partitioner, hosts, n)
+}
+
+// tokenSpace are the bounds of the tokens of a numeric partitioner.
+type tokenSpace struct {
+	min  *big.Int
+	size *big.Int
+}
+
+var (
+	murmur3TokenSpace = tokenSpace{
+		min:  new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 63)),
+		size: new(big.Int).Lsh(big.NewInt(1), 64),
+	}
+	// the tokens of the random partitioner range from 0 to 2^127
+	randomTokenSpace = tokenSpace{
+		min:  big.NewInt(0),
+		size: new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1)),
+	}
+)
+
+// splitTokenRing returns the ranges of the ring of the hosts split into about
+// n ranges.
+func splitTokenRing(partitioner string, hosts []HostInfo, n int) ([]TokenRange, error) {
+	ring, err := newTokenRing(partitioner, hosts)
+	if err != nil {
+		return nil, err
+	}
+	if len(ring.tokens) == 0 {
+		return nil, ErrNoTokens
+	}
+
+	var space *tokenSpace
+	switch ring.partitioner.(type) {
+	case murmur3Partitioner:
+		space = &murmur3TokenSpace
+	case randomPartitioner:
+		space = &randomTokenSpace
+	}
+
+	var ranges []TokenRange
+	for i := range ring.tokens {
+		// the range of a token starts after the previous token
+		start := ring.tokens[(i+len(ring.tokens)-1)%len(ring.tokens)].String()
+		end := ring.tokens[i].String()
+		host := *ring.hosts[i]
+
+		if space == nil {
+			ranges = appendTokenRange(ranges, start, end, host, ring.partitioner)
+			continue
+		}
+
+		for _, r := range space.split(start, end, len(ring.tokens), n) {
+			ranges = appendTokenRange(ranges, r[0], r[1], host, ring.partitioner)
+		}
+	}
+	return ranges, nil
+}
+
+// appendTokenRange appends the range (start, end] to ranges, as two ranges if
+// it wraps around the end of the ring.
+func appendTokenRange(ranges []TokenRange, start, end string, host HostInfo, p partitioner) []TokenRange {
+	if p.ParseString(start).Less(p.ParseString(end)) {
+		return append(ranges, TokenRange{Start: start, End: end, Host: host})
+	}
+	return append(ranges,
+		TokenRange{Start: start, Host: host},
+		TokenRange{End: end, Host: host},
+	)
+}
+
+// split splits the range (start, end] of a ring of count ranges into about
+// n/count ranges in proportion of its size, it returns the bounds of the
+// ranges.
+func (s *tokenSpace) split(start, end string, count, n int) [][2]string {
+	startToken, _ := new(big.Int).SetString(start, 10)
+	endToken, _ := new(big.Int).SetString(end, 10)
+
+	// the size of a range wrapping around the end of the ring, or of the
+	// whole ring when it has a single token, includes the size of the ring
+	size := new(big.Int).Sub(endToken, startToken)
+	if size.Sign() <= 0 {
+		size.Add(size, s.size)
+	}
+
+	// round size * n / ring size to the closest integer
+	share := new(big.Int).Mul(size, big.NewInt(int64(n)))
+	share.Add(share, new(big.Int).Rsh(s.size, 1))
+	share.Quo(share, s.size)
+	parts := share.Int64()
+	if parts < 1 || count >= n {
+		parts = 1
+	}
+
+	max := new(big.Int).Add(s.min, s.size)
+	max.Sub(max, big.NewInt(1))
+
+	bounds := make([][2]string, 0, parts)
+	prev := start
+	for i := int64(1); i < parts; i++ {
+		// start + size * i / parts, wrapped around the ring
+		token := new(big.Int).Mul(size, big.NewInt(i))
+		token.Quo(token, big.NewInt(parts))
+		token.Add(token, startToken)
+		if token.Cmp(max) > 0 {
+			token.Sub(token, s.size)
+		}
+
+		bounds = append(bounds, [2]string{prev, token.String()})
+		prev = token.String()
+	}
+	return append(bounds, [2]string{prev, end})
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2015 The gocql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitTokenRing(t *testing.T) {
+	hosts := []HostInfo{
+		HostInfo{Peer: "0", Tokens: []string{"-4611686018427387904"}},
+		HostInfo{Peer: "1", Tokens: []string{"0"}},
+		HostInfo{Peer: "2", Tokens: []string{"4611686018427387904"}},
+	}
+
+	ranges, err := splitTokenRing("Murmur3Partitioner", hosts, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the range of host 0 is half of the ring and wraps around its end, the
+	// ranges of the other hosts are a quarter of the ring
+	expected := []TokenRange{
+		{Start: "4611686018427387904", End: "7686143364045646506", Host: hosts[0]},
+		{Start: "7686143364045646506", Host: hosts[0]},
+		{End: "-7686143364045646507", Host: hosts[0]},
+		{Start: "-7686143364045646507", End: "-4611686018427387904", Host: hosts[0]},
+		{Start: "-4611686018427387904", End: "-2305843009213693952", Host: hosts[1]},
+		{Start: "-2305843009213693952", End: "0", Host: hosts[1]},
+		{Start: "0", End: "2305843009213693952", Host: hosts[2]},
+		{Start: "2305843009213693952", End: "4611686018427387904", Host: hosts[2]},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("expected the ranges\n%v\ngot\n%v", expected, ranges)
+	}
+}
+
+func TestSplitTokenRingSingleToken(t *testing.T) {
+	hosts := []HostInfo{HostInfo{Peer: "0", Tokens: []string{"100"}}}
+
+	// the range of the single token is the whole ring
+	ranges, err := splitTokenRing("RandomPartitioner", hosts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TokenRange{
+		{Start: "100", Host: hosts[0]},
+		{End: "100", Host: hosts[0]},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("expected the ranges %v got %v", expected, ranges)
+	}
+
+	if _, err := splitTokenRing("RandomPartitioner", []HostInfo{HostInfo{Peer: "0"}}, 1); err != ErrNoTokens {
+		t.Errorf("expected ErrNoTokens got %v", err)
+	}
+}
+
+func TestTokenRangePredicate(t *testing.T) {
+	tests := []struct {
+		r      TokenRange
+		cond   string
+		values []interface{}
+	}{
+		{TokenRange{Start: "1", End: "2"}, "token(a, b) > ? AND token(a, b) <= ?", []interface{}{"1", "2"}},
+		{TokenRange{Start: "1"}, "token(a, b) > ?", []interface{}{"1"}},
+		{TokenRange{End: "2"}, "token(a, b) <= ?", []interface{}{"2"}},
+	}
+
+	for _, test := range tests {
+		cond, values := test.r.Predicate("a", "b")
+		if cond != test.cond || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("expected %q %v got %q %v", test.cond, test.values, cond, values)
+		}
+	}
+}
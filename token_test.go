@@ -10,6 +10,8 @@ import (
 	"sort"
 	"strconv"
 	"testing"
+
+	"github.com/golang/groupcache/lru"
 )
 
 // Test the implementation of murmur3
@@ -52,6 +54,12 @@ func TestMurmur3H1(t *testing.T) {
 	assertMurmur3H1(t, []byte("hello, world"), 0x342fac623a5ebc8e)
 	assertMurmur3H1(t, []byte("19 Jan 2038 at 3:14:07 AM"), 0xb89e5988b737affc)
 	assertMurmur3H1(t, []byte("The quick brown fox jumps over the lazy dog."), 0xcd99481f9ee902c9)
+
+	// Cassandra sign extends the bytes of the tail
+	assertMurmur3H1(t, []byte{0xff}, 0xc25a08894c506b7f)
+	assertMurmur3H1(t, []byte{0x80, 0x81, 0x82}, 0x42af88c2dc61dd92)
+	assertMurmur3H1(t, []byte{0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8}, 0xa46079db2f2d5377)
+	assertMurmur3H1(t, []byte("h\xc3\xa9llo w\xc3\xb6rld"), 0x276b0f1c90c3619e)
 }
 
 // helper function for testing the murmur3 implementation
@@ -93,6 +101,92 @@ func TestMurmur3Partitioner(t *testing.T) {
 	}
 }
 
+// Tests the tokens of single and composite partition keys against the tokens
+// computed by Cassandra
+func TestMurmur3PartitionKeyToken(t *testing.T) {
+	var p murmur3Partitioner
+
+	pk, _ := marshalInt(nil, 1)
+	if token := p.Hash(pk); token != murmur3Token(-4069959284402364209) {
+		t.Errorf("expected the token -4069959284402364209 got %s", token)
+	}
+
+	key := compositePartitionKey([][]byte{pk, []byte("a")})
+	expected := []byte{0, 4, 0, 0, 0, 1, 0, 0, 1, 'a', 0}
+	if !bytes.Equal(key, expected) {
+		t.Errorf("expected the composite key %x got %x", expected, key)
+	}
+	if token := p.Hash(key); token != murmur3Token(6516349416904725244) {
+		t.Errorf("expected the token 6516349416904725244 got %s", token)
+	}
+}
+
+// Tests the routing key computed from the partition key indexes returned with
+// a prepared statement
+func TestPreparedRoutingKey(t *testing.T) {
+	// INSERT INTO t (c, name, id) VALUES (?, ?, ?) with PRIMARY KEY ((id, name), c)
+	meta := resultMetadata{
+		columns: []ColumnInfo{
+			{Keyspace: "ks", Table: "t", Name: "c", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+			{Keyspace: "ks", Table: "t", Name: "name", TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}},
+			{Keyspace: "ks", Table: "t", Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+		},
+		pkeyColumns: []int{2, 1},
+	}
+
+	session := &Session{}
+	session.routingKeyInfoCache.lru = lru.New(10)
+	inflight := &inflightCachedEntry{value: preparedRoutingKeyInfo(meta)}
+	session.routingKeyInfoCache.lru.Add("INSERT", inflight)
+
+	query := &Query{session: session, stmt: "INSERT", values: []interface{}{42, "a", 1}}
+	key, err := query.GetRoutingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0, 4, 0, 0, 0, 1, 0, 0, 1, 'a', 0}
+	if !bytes.Equal(key, expected) {
+		t.Errorf("expected the routing key %x got %x", expected, key)
+	}
+}
+
+// Tests the routing key made of the bound variables of the columns given with
+// RoutingKeyColumns
+func TestRoutingKeyColumns(t *testing.T) {
+	meta := resultMetadata{
+		columns: []ColumnInfo{
+			{Keyspace: "ks", Table: "t", Name: "c", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+			{Keyspace: "ks", Table: "t", Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+		},
+	}
+
+	if info := boundRoutingKeyInfo(meta, []string{"id", "missing"}); info != nil {
+		t.Errorf("expected no routing key info for an unbound column got %+v", info)
+	}
+
+	session := &Session{}
+	session.routingKeyInfoCache.lru = lru.New(10)
+	inflight := &inflightCachedEntry{value: boundRoutingKeyInfo(meta, []string{"id"})}
+	session.routingKeyInfoCache.lru.Add("SELECT\x00id", inflight)
+
+	query := &Query{session: session, stmt: "SELECT", values: []interface{}{42, 1}}
+	key, err := query.RoutingKeyColumns("id").GetRoutingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0, 0, 0, 1}
+	if !bytes.Equal(key, expected) {
+		t.Errorf("expected the routing key %x got %x", expected, key)
+	}
+
+	// an explicit routing key takes precedence
+	if key, _ := query.RoutingKey([]byte("key")).GetRoutingKey(); string(key) != "key" {
+		t.Errorf("expected the routing key set with RoutingKey got %x", key)
+	}
+}
+
 // Tests of the murmur3Token
 func TestMurmur3Token(t *testing.T) {
 	if murmur3Token(42).Less(murmur3Token(42)) {
@@ -165,6 +259,20 @@ func TestRandomPartitioner(t *testing.T) {
 	}
 }
 
+// Tests the tokens of the randomPartitioner against the tokens computed by
+// Cassandra, the digests of 1 and hello are negative and positive integers
+func TestRandomPartitionerToken(t *testing.T) {
+	p := randomPartitioner{}
+
+	pk, _ := marshalInt(nil, 1)
+	if token := p.Hash(pk).String(); token != "19580090105725936846312850328329299579" {
+		t.Errorf("expected the token 19580090105725936846312850328329299579 got %s", token)
+	}
+	if token := p.Hash([]byte("hello")).String(); token != "123957004363873451094272536567338222994" {
+		t.Errorf("expected the token 123957004363873451094272536567338222994 got %s", token)
+	}
+}
+
 // Tests of the randomToken
 func TestRandomToken(t *testing.T) {
 	if ((*randomToken)(big.NewInt(42))).Less((*randomToken)(big.NewInt(42))) {
@@ -405,6 +513,30 @@ func TestOrderedTokenRing(t *testing.T) {
 	}
 }
 
+// Test of the tokenRing with the ByteOrderedPartitioner, whose tokens are in hex
+func TestByteOrderedTokenRing(t *testing.T) {
+	hosts := []HostInfo{
+		HostInfo{Peer: "0", Tokens: []string{"00"}},
+		HostInfo{Peer: "1", Tokens: []string{"40"}},
+		HostInfo{Peer: "2", Tokens: []string{"80"}},
+		HostInfo{Peer: "3", Tokens: []string{"c0"}},
+	}
+	ring, err := newTokenRing("org.apache.cassandra.dht.ByteOrderedPartitioner", hosts)
+	if err != nil {
+		t.Fatalf("Failed to create token ring due to error: %v", err)
+	}
+
+	if actual := ring.GetHostForPartitionKey([]byte{0x41}); actual.Peer != "2" {
+		t.Errorf("Expected peer 2 for key 41, but was %s", actual.Peer)
+	}
+	if actual := ring.GetHostForPartitionKey([]byte{0x40}); actual.Peer != "1" {
+		t.Errorf("Expected peer 1 for key 40, but was %s", actual.Peer)
+	}
+	if actual := ring.GetHostForPartitionKey([]byte{0xd0, 0x01}); actual.Peer != "0" {
+		t.Errorf("Expected peer 0 for key d001, but was %s", actual.Peer)
+	}
+}
+
 // Test of the tokenRing with the RandomPartitioner
 func TestRandomTokenRing(t *testing.T) {
 	// String tokens are parsed into big.Int in base 10
@@ -2,7 +2,10 @@
 
 package gocql
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestTupleSimple(t *testing.T) {
 	if *flagProto < protoVersion3 {
@@ -49,3 +52,49 @@ func TestTupleSimple(t *testing.T) {
 		t.Errorf("expected to get coord.y=-100 got: %v", coord.y)
 	}
 }
+
+func TestTupleStruct(t *testing.T) {
+	if *flagProto < protoVersion3 {
+		t.Skip("tuple types are only available of proto>=3")
+	}
+
+	session := createSession(t)
+	defer session.Close()
+
+	err := createTable(session, `CREATE TABLE tuple_struct_test(
+		id int,
+		coord frozen<tuple<int, int>>,
+		path list<frozen<tuple<int, int>>>,
+
+		primary key(id))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type point struct {
+		X, Y int
+	}
+
+	path := [][]interface{}{{1, 2}, {3, 4}}
+	err = session.Query("INSERT INTO tuple_struct_test(id, coord, path) VALUES(?, ?, ?)",
+		1, point{100, -100}, path).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		coord   point
+		gotPath [][]interface{}
+	)
+	err = session.Query("SELECT coord, path FROM tuple_struct_test WHERE id=?", 1).Scan(&coord, &gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if coord != (point{100, -100}) {
+		t.Errorf("expected to get coord=%v got: %v", point{100, -100}, coord)
+	}
+	if !reflect.DeepEqual(gotPath, path) {
+		t.Errorf("expected to get path=%v got: %v", path, gotPath)
+	}
+}
@@ -110,6 +110,28 @@ func RandomUUID() (UUID, error) {
 	return u, nil
 }
 
+// RandomUUIDv7 generates a time ordered UUID (version 7) as described in
+// RFC 9562. The first 48 bits hold the current unix time in milliseconds and
+// the remaining bits are random. Cassandra treats such UUIDs as plain uuid
+// values, they can not be stored in timeuuid columns.
+func RandomUUIDv7() (UUID, error) {
+	var u UUID
+	_, err := io.ReadFull(rand.Reader, u[6:])
+	if err != nil {
+		return u, err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	u[0], u[1], u[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	u[3], u[4], u[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+
+	u[6] &= 0x0F // clear version
+	u[6] |= 0x70 // set version to 7 (time ordered uuid)
+	u[8] &= 0x3F // clear variant
+	u[8] |= 0x80 // set to IETF variant
+	return u, nil
+}
+
 var timeBase = time.Date(1582, time.October, 15, 0, 0, 0, 0, time.UTC).Unix()
 
 // TimeUUID generates a new time based UUID (version 1) using the current
@@ -122,24 +144,64 @@ func TimeUUID() UUID {
 // RFC 4122. This UUID contains the MAC address of the node that generated
 // the UUID, the given timestamp and a sequence number.
 func UUIDFromTime(aTime time.Time) UUID {
+	clock := atomic.AddUint32(&clockSeq, 1)
+	return TimeUUIDWith(aTime, clock, hardwareAddr)
+}
+
+// TimeUUIDWith generates a new time based UUID (version 1) as described in
+// RFC 4122 from the given timestamp, clock sequence and node. Only the lower
+// 14 bits of clock are used and node should be 6 bytes long, it is truncated
+// or padded with zeros otherwise.
+func TimeUUIDWith(aTime time.Time, clock uint32, node []byte) UUID {
 	var u UUID
+	putUUIDTime(&u, aTime)
+
+	u[8] = byte(clock >> 8)
+	u[9] = byte(clock)
+
+	copy(u[10:], node)
+
+	u[8] &= 0x3F // clear variant
+	u[8] |= 0x80 // set to IETF variant
+
+	return u
+}
 
+// putUUIDTime sets the timestamp and version of a time based UUID.
+func putUUIDTime(u *UUID, aTime time.Time) {
 	utcTime := aTime.In(time.UTC)
 	t := uint64(utcTime.Unix()-timeBase)*10000000 + uint64(utcTime.Nanosecond()/100)
 	u[0], u[1], u[2], u[3] = byte(t>>24), byte(t>>16), byte(t>>8), byte(t)
 	u[4], u[5] = byte(t>>40), byte(t>>32)
 	u[6], u[7] = byte(t>>56)&0x0F, byte(t>>48)
 
-	clock := atomic.AddUint32(&clockSeq, 1)
-	u[8] = byte(clock >> 8)
-	u[9] = byte(clock)
-
-	copy(u[10:], hardwareAddr)
-
 	u[6] |= 0x10 // set version to 1 (time based uuid)
-	u[8] &= 0x3F // clear variant
-	u[8] |= 0x80 // set to IETF variant
+}
+
+// MinTimeUUID returns the smallest time based UUID with the given timestamp
+// according to the ordering used by Cassandra for timeuuid columns. It is
+// meant to be used as the lower bound of range queries, as in
+// "WHERE id >= ?", and should not be stored.
+func MinTimeUUID(aTime time.Time) UUID {
+	var u UUID
+	putUUIDTime(&u, aTime)
+	// Cassandra compares the clock sequence and node as signed bytes
+	for i := 8; i < len(u); i++ {
+		u[i] = 0x80
+	}
+	return u
+}
 
+// MaxTimeUUID returns the largest time based UUID with the given timestamp
+// according to the ordering used by Cassandra for timeuuid columns. It is
+// meant to be used as the upper bound of range queries, as in
+// "WHERE id <= ?", and should not be stored.
+func MaxTimeUUID(aTime time.Time) UUID {
+	var u UUID
+	putUUIDTime(&u, aTime)
+	for i := 8; i < len(u); i++ {
+		u[i] = 0x7F
+	}
 	return u
 }
 
@@ -114,6 +114,37 @@ func TestRandomUUID(t *testing.T) {
 	}
 }
 
+func TestRandomUUIDv7(t *testing.T) {
+	var prev UUID
+	for i := 0; i < 20; i++ {
+		uuid, err := RandomUUIDv7()
+		if err != nil {
+			t.Errorf("RandomUUIDv7: %v", err)
+		}
+		if variant := uuid.Variant(); variant != VariantIETF {
+			t.Errorf("wrong variant. expected %d got %d", VariantIETF, variant)
+		}
+		if version := uuid.Version(); version != 7 {
+			t.Errorf("wrong version. expected %d got %d", 7, version)
+		}
+		if bytes.Compare(uuid[:6], prev[:6]) < 0 {
+			t.Errorf("timestamps must grow")
+		}
+		prev = uuid
+
+		data, err := Marshal(NativeType{proto: 2, typ: TypeUUID}, uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out UUID
+		if err := Unmarshal(NativeType{proto: 2, typ: TypeUUID}, data, &out); err != nil {
+			t.Fatal(err)
+		} else if out != uuid {
+			t.Errorf("expected %v got %v", uuid, out)
+		}
+	}
+}
+
 func TestRandomUUIDInvalidAPICalls(t *testing.T) {
 	uuid, err := RandomUUID()
 	if err != nil {
@@ -142,6 +173,44 @@ func TestUUIDFromTime(t *testing.T) {
 	}
 }
 
+func TestTimeUUIDWith(t *testing.T) {
+	date := time.Date(1982, 5, 5, 12, 34, 56, 400, time.UTC)
+	node := []byte{1, 2, 3, 4, 5, 6}
+	uuid := TimeUUIDWith(date, 0x1234, node)
+
+	if uuid.Time() != date {
+		t.Errorf("embedded time incorrect. Expected %v got %v", date, uuid.Time())
+	}
+	if !bytes.Equal(uuid.Node(), node) {
+		t.Errorf("wrong node. expected %x, got %x", node, uuid.Node())
+	}
+	if uuid.Variant() != VariantIETF {
+		t.Errorf("wrong variant. expected %d got %d", VariantIETF, uuid.Variant())
+	}
+	if clock := int(uuid[8]&0x3F)<<8 | int(uuid[9]); clock != 0x1234 {
+		t.Errorf("wrong clock sequence. expected %x got %x", 0x1234, clock)
+	}
+}
+
+func TestMinMaxTimeUUID(t *testing.T) {
+	date := time.Date(1982, 5, 5, 12, 34, 56, 400, time.UTC)
+	min, max := MinTimeUUID(date), MaxTimeUUID(date)
+
+	if min.Time() != date || max.Time() != date {
+		t.Errorf("embedded time incorrect. Expected %v got %v and %v", date, min.Time(), max.Time())
+	}
+
+	// Cassandra orders timeuuids with the same timestamp by comparing their
+	// remaining bytes as signed values
+	uuid := UUIDFromTime(date)
+	for i := 8; i < 16; i++ {
+		if int8(min[i]) > int8(uuid[i]) || int8(max[i]) < int8(uuid[i]) {
+			t.Errorf("%v is not between %v and %v", uuid, min, max)
+			break
+		}
+	}
+}
+
 func TestParseUUID(t *testing.T) {
 	uuid, _ := ParseUUID("486f3a88-775b-11e3-ae07-d231feb1dc81")
 	if uuid.Time() != time.Date(2014, 1, 7, 5, 19, 29, 222516000, time.UTC) {